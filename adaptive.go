@@ -0,0 +1,100 @@
+package sgzip
+
+import (
+	"errors"
+	"math"
+)
+
+// Thresholds used by adaptive blocks, in bits per byte.
+const (
+	adaptiveHighEntropy = 7.5 // data that barely compresses
+	adaptiveShift       = 1.0 // change that marks a new kind of content
+)
+
+// SetAdaptiveBlocks is an experimental mode that makes the Writer choose
+// the size of each block between min and max bytes based on the data,
+// instead of using a fixed block size. The size of each block is recorded
+// in the BlockLens field of the metadata, and MetaData().BlockSize is max.
+//
+// Blocks are grown in steps of min bytes. After each step the byte entropy
+// of the last min bytes is estimated, and the block ends if the data is
+// close to incompressible (above 7.5 bits per byte) or if the entropy
+// differs by more than 1 bit per byte from that of the first step of the
+// block, which usually means the kind of content has changed. Otherwise
+// the block grows until it holds max bytes. Compressible data thus ends
+// up in large blocks, which compress better, while incompressible data is
+// split into small blocks, which allow seeking with less work and do not
+// compress worse.
+//
+// Metadata with variable block sizes cannot be merged with MergeMetadata.
+// It must be called before the first Write, replaces the block size set
+// by SetConcurrency, and is kept across Reset.
+func (z *Writer) SetAdaptiveBlocks(min, max int) error {
+	if min <= 0 || max < min {
+		return errors.New("gzip: adaptive block sizes must satisfy 0 < min <= max")
+	}
+	if z.wroteHeader {
+		return errors.New("gzip: adaptive blocks must be set before writing")
+	}
+	if z.boundary != nil {
+		return errors.New("gzip: adaptive blocks cannot be combined with a boundary function")
+	}
+	if err := z.SetConcurrency(max, z.blocks); err != nil {
+		return err
+	}
+	z.adaptMin = min
+	return nil
+}
+
+// adaptiveRoom returns how much more data fits into the current buffer
+// before the next block size decision.
+func (z *Writer) adaptiveRoom() int {
+	cur := z.flushed + len(z.currentBuffer)
+	next := (cur/z.adaptMin + 1) * z.adaptMin
+	if next > z.blockSize {
+		next = z.blockSize
+	}
+	return next - z.flushed
+}
+
+// endAdaptiveBlock reports whether the current block ends after the step
+// that was just completed.
+func (z *Writer) endAdaptiveBlock() bool {
+	end := z.flushed+len(z.currentBuffer) >= z.blockSize
+	if !end {
+		w := z.adaptMin
+		if w > len(z.currentBuffer) {
+			w = len(z.currentBuffer)
+		}
+		e := entropy(z.currentBuffer[len(z.currentBuffer)-w:])
+		if z.steps == 0 {
+			z.blockEntropy = e
+		}
+		end = e > adaptiveHighEntropy || math.Abs(e-z.blockEntropy) > adaptiveShift
+	}
+	z.steps++
+	if end {
+		z.steps = 0
+	}
+	return end
+}
+
+// entropy returns the order-0 entropy of p in bits per byte.
+func entropy(p []byte) float64 {
+	if len(p) == 0 {
+		return 0
+	}
+	var counts [256]int
+	for _, b := range p {
+		counts[b]++
+	}
+	var e float64
+	n := float64(len(p))
+	for _, c := range counts {
+		if c > 0 {
+			f := float64(c) / n
+			e -= f * math.Log2(f)
+		}
+	}
+	return e
+}
@@ -0,0 +1,158 @@
+package sgzip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// mixedData returns n bytes alternating between incompressible and
+// repetitive runs of varying length.
+func mixedData(n int) []byte {
+	rnd := rand.New(rand.NewSource(1))
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		run := 20000 + rnd.Intn(200000)
+		if rnd.Intn(2) == 0 {
+			b := make([]byte, run)
+			rnd.Read(b)
+			out = append(out, b...)
+		} else {
+			out = append(out, bytes.Repeat([]byte("adaptive block sizes "), run/21)...)
+		}
+	}
+	return out[:n]
+}
+
+func TestAdaptiveBlocks(t *testing.T) {
+	in := mixedData(3 << 20)
+	var dst, idx bytes.Buffer
+	w, err := CreateSeekable(&dst, &idx, DefaultCompression, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetAdaptiveBlocks(16<<10, 512<<10); err != nil {
+		t.Fatal(err)
+	}
+	for p := in; len(p) > 0; p = p[1000:] {
+		if len(p) < 1000 {
+			w.Write(p)
+			break
+		}
+		w.Write(p[:1000])
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	meta := w.MetaData()
+	if len(meta.BlockLens) != len(meta.BlockData)-1 {
+		t.Fatalf("got %d block lengths for %d blocks", len(meta.BlockLens), len(meta.BlockData)-1)
+	}
+	var sum int64
+	sizes := make(map[uint32]bool)
+	for _, n := range meta.BlockLens {
+		if n > 512<<10 {
+			t.Fatalf("block of %d bytes exceeds the maximum", n)
+		}
+		sum += int64(n)
+		sizes[n] = true
+	}
+	if sum != int64(len(in)) || meta.Size != sum {
+		t.Fatalf("block lengths sum to %d, size %d, want %d", sum, meta.Size, len(in))
+	}
+	if len(sizes) < 3 {
+		t.Errorf("expected varying block sizes, got %v", meta.BlockLens)
+	}
+
+	decoded, err := DecodeIndex(bytes.NewReader(idx.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, meta) {
+		t.Fatal("decoded index does not match metadata")
+	}
+
+	comp := bytes.NewReader(dst.Bytes())
+	if err := Verify(comp, &meta); err != nil {
+		t.Fatal(err)
+	}
+	coarse := meta.Downsample(3)
+	if err := Verify(comp, &coarse); err != nil {
+		t.Fatalf("downsampled metadata: %v", err)
+	}
+	r, err := NewSeekingReader(comp, &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for _, off := range []int64{0, 12345, 1 << 20, int64(len(in)) - 10} {
+		if _, err := r.Seek(off, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, in[off:]) {
+			t.Fatalf("content from offset %d does not match", off)
+		}
+	}
+
+	got, err := ReadRange(comp, &meta, 700000, 2100000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, in[700000:2100000]) {
+		t.Error("ReadRange content does not match")
+	}
+
+	var blocks int
+	err = r.ForEachBlock(func(i int, data []byte) error {
+		if len(data) != int(meta.BlockLens[i]) {
+			t.Errorf("block %d: got %d bytes, want %d", i, len(data), meta.BlockLens[i])
+		}
+		blocks++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := len(meta.BlockLens) - 1; blocks != want {
+		t.Errorf("got %d blocks, want %d", blocks, want)
+	}
+
+	if _, err := MergeMetadata(meta, meta, int64(dst.Len())); err == nil {
+		t.Error("expected MergeMetadata to reject variable block sizes")
+	}
+}
+
+func BenchmarkAdaptiveBlocks(b *testing.B) {
+	in := mixedData(8 << 20)
+	for _, adaptive := range []bool{false, true} {
+		name := "fixed"
+		if adaptive {
+			name = "adaptive"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(in)))
+			var meta GzipMetadata
+			var out countWriter
+			for i := 0; i < b.N; i++ {
+				out = countWriter{}
+				w := NewWriter(&out)
+				w.SetConcurrency(256<<10, 8)
+				if adaptive {
+					w.SetAdaptiveBlocks(32<<10, 1<<20)
+				}
+				w.Write(in)
+				w.Close()
+				meta = w.MetaData()
+			}
+			b.ReportMetric(float64(out.n)/float64(len(in)), "ratio")
+			b.ReportMetric(float64(len(in))/float64(len(meta.BlockData)-2), "B/block")
+		})
+	}
+}
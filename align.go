@@ -0,0 +1,192 @@
+package sgzip
+
+import (
+	"errors"
+	"io"
+
+	"github.com/klauspost/compress/flate"
+)
+
+// SetBlockAlignment makes the Writer pad the compressed stream so that
+// every block starts at an offset that is a multiple of n bytes, which
+// allows blocks to be mapped or read directly at aligned positions.
+// A value of 0 or 1 disables alignment.
+//
+// The padding consists of empty deflate blocks, so the output remains a
+// valid gzip stream and decompresses to the same data. It is counted as
+// part of the preceding block (or the header) in the metadata. Each block
+// grows by fewer than n+10 bytes.
+//
+// It must be called before the first Write and is kept across Reset.
+func (z *Writer) SetBlockAlignment(n int) error {
+	if n < 0 {
+		return errors.New("gzip: block alignment cannot be negative")
+	}
+	if z.wroteHeader {
+		return errors.New("gzip: block alignment must be set before writing")
+	}
+	z.align = n
+	return nil
+}
+
+// SetPadLastBlock makes Close fill the last block with zero bytes up to
+// the block size, so that every block of the stream holds exactly
+// BlockSize bytes of uncompressed data and the block containing an offset
+// is always offset/BlockSize. It has no effect with SetAdaptiveBlocks or
+// SetBoundaryFunc.
+//
+// The padding is part of the gzip stream, so tools that ignore the
+// metadata, such as gunzip, output it after the data. The metadata records
+// it in Padding and does not count it in Size; readers created with the
+// metadata stop at Size and check that the padding is zero. Metadata of
+// padded streams has version 2 and cannot be merged.
+//
+// It must be called before the first Write and is kept across Reset.
+func (z *Writer) SetPadLastBlock(ok bool) error {
+	if z.wroteHeader {
+		return errors.New("gzip: padding must be set before writing")
+	}
+	z.padLast = ok
+	return nil
+}
+
+// padLastBlock fills the current block with zeros if SetPadLastBlock is
+// set. The zeros are not counted as written data.
+func (z *Writer) padLastBlock() {
+	n := z.flushed + len(z.currentBuffer)
+	if !z.padLast || z.variableBlocks() || n == 0 {
+		return
+	}
+	pad := z.blockSize - n
+	size := z.size
+	z.Write(make([]byte, pad))
+	z.size = size
+	z.padding = pad
+}
+
+// alignPadding returns the number of padding bytes needed after off to
+// reach the next multiple of align that can be filled by deflatePadding.
+func alignPadding(off int64, align int) int {
+	if align <= 1 {
+		return 0
+	}
+	n := int(int64(align)-off%int64(align)) % align
+	for n != 0 && !paddable(n) {
+		n += align
+	}
+	return n
+}
+
+// paddable reports whether deflatePadding can produce exactly n bytes.
+func paddable(n int) bool {
+	return n == 0 || n == 5 || n == 6 || n == 7 || n >= 9
+}
+
+// deflatePadding returns n bytes of empty, non-final deflate blocks to be
+// inserted at a byte boundary. n must satisfy paddable.
+//
+// The padding is built from pieces of 0 to 3 empty fixed Huffman blocks
+// (10 bits each) followed by an empty stored block, which realigns to a
+// byte boundary. These pieces are 5, 6, 7 and 9 bytes long.
+func deflatePadding(n int) []byte {
+	out := make([]byte, 0, n)
+	for n > 0 {
+		piece := n
+		if n >= 10 {
+			piece = 5
+			if n-5 == 8 {
+				piece = 6
+			}
+		}
+		fixed := piece - 5
+		if piece == 9 {
+			fixed = 3
+		}
+		var bits uint64
+		var nbits uint
+		for i := 0; i < fixed; i++ {
+			// BFINAL=0, BTYPE=01, then the 7-bit end-of-block code 0.
+			bits |= 2 << nbits
+			nbits += 10
+		}
+		// BFINAL=0, BTYPE=00, padded to a byte boundary.
+		nbits += 3
+		for i := uint(0); i < nbits; i += 8 {
+			out = append(out, byte(bits>>i))
+		}
+		out = append(out, 0, 0, 0xff, 0xff)
+		n -= piece
+	}
+	return out
+}
+
+// newDecompressor returns a decompressor for the deflate data read from
+// z.bufr, which starts at offset start of the uncompressed stream. If the
+// stream is padded, the decompressor stops at z.isize.
+func (z *Reader) newDecompressor(start int64) io.ReadCloser {
+	return z.newDecompressorDict(start, nil)
+}
+
+// newDecompressorDict is like newDecompressor for deflate data that refers
+// to dict, the data before start.
+func (z *Reader) newDecompressorDict(start int64, dict []byte) io.ReadCloser {
+	var fr io.ReadCloser
+	if dict == nil {
+		fr = flate.NewReader(z.bufr)
+	} else {
+		fr = flate.NewReaderDict(z.bufr, dict)
+	}
+	if z.padding == 0 {
+		return fr
+	}
+	return &paddedReader{ReadCloser: fr, remain: z.isize - start, padding: z.padding}
+}
+
+// paddedReader returns the first remain bytes of a padded deflate stream
+// and checks that they are followed by exactly padding zero bytes.
+type paddedReader struct {
+	io.ReadCloser
+	remain  int64
+	padding int
+	err     error // result of skipPadding
+}
+
+func (p *paddedReader) Read(b []byte) (int, error) {
+	if p.remain <= 0 {
+		if p.err == nil {
+			p.err = p.skipPadding()
+		}
+		return 0, p.err
+	}
+	if int64(len(b)) > p.remain {
+		b = b[:p.remain]
+	}
+	n, err := p.ReadCloser.Read(b)
+	p.remain -= int64(n)
+	return n, err
+}
+
+// skipPadding reads the padding and returns io.EOF if it is as expected.
+func (p *paddedReader) skipPadding() error {
+	buf := make([]byte, p.padding+1)
+	n, err := io.ReadFull(p.ReadCloser, buf)
+	if err != io.ErrUnexpectedEOF && err != io.EOF {
+		if err == nil {
+			err = ErrInvalidMetadata
+		}
+		return err
+	}
+	if n != p.padding || !allZero(buf[:n]) {
+		return ErrInvalidMetadata
+	}
+	return io.EOF
+}
+
+func allZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
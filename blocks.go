@@ -0,0 +1,156 @@
+package sgzip
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/flate"
+)
+
+// ForEachBlock decompresses the stream from the start and calls fn with the
+// index and uncompressed data of each block described by the metadata, in
+// order. Iteration stops at the first error returned by fn, which is then
+// returned by ForEachBlock.
+//
+// The data slice is reused between calls and is only valid until fn
+// returns. The Reader must have been created with metadata, otherwise
+// ErrUnsupported is returned. When ForEachBlock returns, the Reader is
+// positioned after the last block passed to fn.
+func (z *Reader) ForEachBlock(fn func(index int, data []byte) error) error {
+	if !z.canSeek {
+		return ErrUnsupported
+	}
+	if _, err := z.seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	size := int64(z.metaBlockSize)
+	for i := 1; i < len(z.ustarts); i++ {
+		if n := z.ustarts[i] - z.ustarts[i-1]; n > size {
+			size = n
+		}
+	}
+	buf := make([]byte, size)
+	for i := 0; ; i++ {
+		want := len(buf)
+		if z.ustarts != nil && i+1 < len(z.ustarts) {
+			want = int(z.ustarts[i+1] - z.ustarts[i])
+		}
+		var n int
+		var err error
+		for n < want && err == nil {
+			var m int
+			m, err = z.Read(buf[n:want])
+			n += m
+		}
+		if n > 0 {
+			if ferr := fn(i, buf[:n]); ferr != nil {
+				return ferr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ReadBlock returns the uncompressed data of block index, as numbered by
+// the metadata: from 0 to NumBlocks-1, the last being the empty block
+// ending the stream. If the source of the Reader is an io.ReaderAt, such
+// as for NewRandomReader or a *bytes.Reader, only the compressed data of
+// the block is read, with a single ReadAt call, and the position of the
+// Reader does not change, so that several goroutines can call ReadBlock
+// at once, for example to process the blocks of a file in parallel.
+// Otherwise the Reader seeks to the block and is positioned after it.
+//
+// The data is checked against the checksum of the block if the metadata
+// has one, unless SetSkipChecksum is set. ErrUnsupported is returned for
+// Readers without metadata.
+func (z *Reader) ReadBlock(index int) ([]byte, error) {
+	if !z.canSeek {
+		return nil, ErrUnsupported
+	}
+	if n := len(z.blockStarts) - 2; index < 0 || index >= n {
+		return nil, fmt.Errorf("gzip: block %d out of range [0, %d)", index, n)
+	}
+	start, end := z.blockBounds(index)
+	data := make([]byte, end-start)
+	if ra, off, ok := z.sourceAt(); ok {
+		comp := make([]byte, z.blockStarts[index+1]-z.blockStarts[index])
+		if n, err := ra.ReadAt(comp, off+z.blockStarts[index]); n != len(comp) {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		br := bytes.NewReader(comp)
+		fr := flate.NewReader(br)
+		defer fr.Close()
+		for n := 0; ; {
+			m, err := io.ReadFull(fr, data[n:])
+			n += m
+			if err == nil {
+				break
+			}
+			if err != io.ErrUnexpectedEOF && err != io.EOF {
+				return nil, err
+			}
+			// A member ends inside the block, as in merged metadata:
+			// continue after its trailer and the next header.
+			if _, err := br.Seek(8, io.SeekCurrent); err != nil || br.Len() == 0 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			if _, err := ReadHeader(br); err != nil {
+				return nil, noEOF(err)
+			}
+			fr.(flate.Resetter).Reset(br, nil)
+		}
+	} else {
+		if _, err := z.seek(start, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(z, data); err != nil {
+			return nil, noEOF(err)
+		}
+	}
+	if z.blockCRC != nil && !z.skipChecksum {
+		digest := z.newDigest()
+		digest.Write(data)
+		if digest.Sum32() != z.blockCRC[index] {
+			return nil, ErrChecksum
+		}
+	}
+	return data, nil
+}
+
+// Stream decompresses the rest of the stream and calls fn with each chunk
+// of uncompressed data and its offset in the uncompressed stream. The
+// offsets are consecutive: each chunk starts where the previous one ended.
+// Streaming stops at the first error returned by fn, which is then
+// returned by Stream. Stream returns nil when the end of the stream is
+// reached.
+//
+// The chunks are the Reader's internal buffers, so p is only valid until
+// fn returns and must not be modified. Unlike ForEachBlock, Stream does not
+// need metadata, and chunks are not aligned to the blocks of the stream.
+func (z *Reader) Stream(fn func(offset int64, p []byte) error) error {
+	_, err := z.WriteTo(&streamWriter{fn: fn, off: z.pos - z.origin})
+	return err
+}
+
+// streamWriter passes the data written to it to a Stream callback.
+type streamWriter struct {
+	fn  func(offset int64, p []byte) error
+	off int64
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if err := s.fn(s.off, p); err != nil {
+		return 0, err
+	}
+	s.off += int64(len(p))
+	return len(p), nil
+}
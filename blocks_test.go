@@ -0,0 +1,181 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestForEachBlock(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 100000, 16<<10)
+	r, err := NewSeekingReader(bytes.NewReader(compressed), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var got []byte
+	var blocks int
+	err = r.ForEachBlock(func(i int, data []byte) error {
+		if i != blocks {
+			t.Errorf("got block %d, want %d", i, blocks)
+		}
+		if i < 6 && len(data) != meta.BlockSize {
+			t.Errorf("block %d has %d bytes, want %d", i, len(data), meta.BlockSize)
+		}
+		blocks++
+		got = append(got, data...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blocks != 7 {
+		t.Errorf("got %d blocks, want 7", blocks)
+	}
+	if !bytes.Equal(got, in) {
+		t.Error("content does not match")
+	}
+
+	stop := errors.New("stop")
+	err = r.ForEachBlock(func(i int, data []byte) error {
+		if i == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Errorf("got error %v, want %v", err, stop)
+	}
+
+	plain, err := NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+	if err := plain.ForEachBlock(func(int, []byte) error { return nil }); err != ErrUnsupported {
+		t.Errorf("got error %v, want %v", err, ErrUnsupported)
+	}
+}
+
+func TestStream(t *testing.T) {
+	in, compressed, _ := testSeekableData(t, 300000, 16<<10)
+	r, err := NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// Start after a partial read.
+	head := make([]byte, 1000)
+	if _, err := io.ReadFull(r, head); err != nil {
+		t.Fatal(err)
+	}
+	got := append([]byte{}, head...)
+	err = r.Stream(func(off int64, p []byte) error {
+		if off != int64(len(got)) {
+			t.Fatalf("chunk at offset %d, want %d", off, len(got))
+		}
+		got = append(got, p...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, in) {
+		t.Error("content does not match")
+	}
+
+	r.Reset(bytes.NewReader(compressed))
+	stop := errors.New("stop")
+	var calls int
+	err = r.Stream(func(off int64, p []byte) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("got error %v after %d calls, want %v after 1", err, calls, stop)
+	}
+}
+
+func TestReadBlock(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 100000, 16<<10)
+	ra := &countingReaderAt{ra: bytes.NewReader(compressed)}
+	r, err := NewRandomReader(ra, &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	seeker, err := NewSeekingReader(struct{ io.ReadSeeker }{bytes.NewReader(compressed)}, &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer seeker.Close()
+
+	for _, i := range []int{3, 0, 6, 7} {
+		info, err := meta.BlockInfo(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := in[info.UncompressedOffset : info.UncompressedOffset+info.UncompressedLength]
+		calls, bytesRead := ra.stats()
+		got, err := r.ReadBlock(i)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("block %d: got %d bytes, %v, want %d", i, len(got), err, len(want))
+		}
+		if c, n := ra.stats(); c-calls != 1 || n-bytesRead != info.CompressedLength {
+			t.Errorf("block %d: %d reads of %d bytes, want 1 of %d", i, c-calls, n-bytesRead, info.CompressedLength)
+		}
+		got, err = seeker.ReadBlock(i)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("block %d without ReadAt: got %d bytes, %v, want %d", i, len(got), err, len(want))
+		}
+	}
+	for _, i := range []int{-1, meta.NumBlocks()} {
+		if _, err := r.ReadBlock(i); err == nil {
+			t.Errorf("block %d: expected error", i)
+		}
+	}
+
+	meta.BlockCRC = append([]uint32{}, meta.BlockCRC...)
+	meta.BlockCRC[2]++
+	r, err = NewSeekingReader(bytes.NewReader(compressed), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReadBlock(2); !errors.Is(err, ErrChecksum) {
+		t.Errorf("bad block checksum: got %v, want ErrChecksum", err)
+	}
+	r.SetSkipChecksum(true)
+	if _, err := r.ReadBlock(2); err != nil {
+		t.Errorf("with SetSkipChecksum: %v", err)
+	}
+}
+
+func TestReadBlockMerged(t *testing.T) {
+	in, compA, metaA := testSeekableData(t, 64<<10, 16<<10)
+	inB, compB, metaB := testSeekableData(t, 40000, 16<<10)
+	in = append(in, inB...)
+	var comp bytes.Buffer
+	meta, err := Concat(&comp, []SeekablePart{{bytes.NewReader(compA), metaA}, {bytes.NewReader(compB), metaB}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewSeekingReader(bytes.NewReader(comp.Bytes()), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var got []byte
+	for i := 0; i < meta.NumBlocks(); i++ {
+		data, err := r.ReadBlock(i)
+		if err != nil {
+			t.Fatalf("block %d: %v", i, err)
+		}
+		got = append(got, data...)
+	}
+	if !bytes.Equal(got, in) {
+		t.Errorf("got %d bytes, want %d", len(got), len(in))
+	}
+}
@@ -0,0 +1,48 @@
+package sgzip
+
+// Limits of the block sizes suggested by SuggestBlockSize.
+const (
+	suggestMaxBlockSize = 64 << 20
+	suggestMinStored    = 4 << 10   // NoCompression: only stored block headers are added
+	suggestMinHuffman   = 16 << 10  // HuffmanOnly: a code table per block
+	suggestMinFast      = 64 << 10  // levels up to 6
+	suggestMinBest      = 128 << 10 // levels 7 to 9, which find longer matches
+)
+
+// SuggestBlockSize returns a block size for compressing at level so that a
+// seek decompresses and discards no more than about targetDiscardBytes of
+// data, which bounds the latency of a seek. It is a heuristic that codifies
+// the usual tuning, not a guarantee; pass the result to
+// NewWriterLevelBlockSize or SetConcurrency.
+//
+// Seeking discards on average half a block, and at most a whole one, so the
+// suggestion is the largest power of two not above targetDiscardBytes.
+// Since every block is compressed on its own, starting without the history
+// of the previous block, small blocks compress worse. The suggestion is
+// therefore at least 64 KiB, 128 KiB for levels above 6, where blocks cost
+// about 1% or less of the output for typical data, and lower only for
+// NoCompression and HuffmanOnly, which lose little from splitting. It is at
+// most 64 MiB. A targetDiscardBytes of 0 or less returns the default block
+// size, and an invalid level returns -1.
+func SuggestBlockSize(targetDiscardBytes int64, level int) int {
+	if !ValidLevel(level) {
+		return -1
+	}
+	if targetDiscardBytes <= 0 {
+		return defaultBlockSize
+	}
+	min := suggestMinFast
+	switch {
+	case level == NoCompression:
+		min = suggestMinStored
+	case level == HuffmanOnly:
+		min = suggestMinHuffman
+	case level > 6:
+		min = suggestMinBest
+	}
+	size := min
+	for size < suggestMaxBlockSize && int64(size)*2 <= targetDiscardBytes {
+		size *= 2
+	}
+	return size
+}
@@ -0,0 +1,74 @@
+package sgzip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"testing"
+)
+
+func TestSuggestBlockSize(t *testing.T) {
+	tests := []struct {
+		target int64
+		level  int
+		want   int
+	}{
+		{0, DefaultCompression, defaultBlockSize},
+		{1 << 20, DefaultCompression, 1 << 20},
+		{1<<20 + 1000, BestSpeed, 1 << 20},
+		{300 << 10, DefaultCompression, 256 << 10},
+		{1000, DefaultCompression, 64 << 10},
+		{1000, BestCompression, 128 << 10},
+		{1000, NoCompression, 4 << 10},
+		{1000, HuffmanOnly, 16 << 10},
+		{10000, NoCompression, 8 << 10},
+		{1 << 40, DefaultCompression, 64 << 20},
+		{1 << 20, 42, -1},
+	}
+	for _, tt := range tests {
+		if got := SuggestBlockSize(tt.target, tt.level); got != tt.want {
+			t.Errorf("SuggestBlockSize(%d, %d) = %d, want %d", tt.target, tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestNewWriterLevelBlockSize(t *testing.T) {
+	in := bytes.Repeat([]byte("block size "), 20000)
+	var buf bytes.Buffer
+	blockSize := SuggestBlockSize(70000, BestSpeed)
+	w, err := NewWriterLevelBlockSize(&buf, BestSpeed, blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(in)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	meta := w.MetaData()
+	if meta.BlockSize != blockSize {
+		t.Errorf("BlockSize = %d, want %d", meta.BlockSize, blockSize)
+	}
+	if want := runtime.GOMAXPROCS(0); w.blocks != want {
+		t.Errorf("blocks = %d, want the default %d", w.blocks, want)
+	}
+	r, err := NewSeekingReader(bytes.NewReader(buf.Bytes()), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := r.Seek(150000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(got, in[150000:]) {
+		t.Errorf("ReadAll after Seek: %d bytes, %v", len(got), err)
+	}
+
+	if _, err := NewWriterLevelBlockSize(&buf, BestSpeed, 0); err == nil {
+		t.Error("expected error for block size 0")
+	}
+	if _, err := NewWriterLevelBlockSize(&buf, 42, 1<<20); err == nil {
+		t.Error("expected error for invalid level")
+	}
+}
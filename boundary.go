@@ -0,0 +1,47 @@
+package sgzip
+
+import "errors"
+
+// A boundaryFunc decides where blocks end, see SetBoundaryFunc.
+type boundaryFunc func(written int64, lastByte byte) bool
+
+// SetBoundaryFunc makes the Writer end blocks where fn says so, instead
+// of only every BlockSize bytes, for example after a newline to align
+// blocks with the lines of a log file. fn is called for every byte written
+// with the number of bytes in the current block up to and including that
+// byte, and the block ends after the byte if fn returns true. A block
+// still ends when it holds the block size set by SetConcurrency, so that
+// is the largest block size. The size of each block is recorded in the
+// BlockLens field of the metadata, and MetaData().BlockSize is the
+// largest size. Passing nil restores fixed-size blocks.
+//
+// Every block is compressed on its own and costs a few bytes for its end
+// marker and its metadata entry, so blocks of a few kilobytes or less
+// compress noticeably worse and make the metadata large. fn should
+// enforce a sensible minimum, such as ending blocks only at the first
+// newline after 64 KiB. Calling fn for every byte also slows down Write.
+//
+// It must be called before the first Write, cannot be combined with
+// SetAdaptiveBlocks and is kept across Reset.
+func (z *Writer) SetBoundaryFunc(fn func(written int64, lastByte byte) bool) error {
+	if z.wroteHeader {
+		return errors.New("gzip: boundary function must be set before writing")
+	}
+	if z.adaptMin > 0 {
+		return errors.New("gzip: boundary function cannot be combined with adaptive blocks")
+	}
+	z.boundary = fn
+	return nil
+}
+
+// findBoundary returns the index of the first byte of p after which the
+// boundary function ends the current block, or -1 if there is none.
+func (z *Writer) findBoundary(p []byte) int {
+	n := int64(z.flushed + len(z.currentBuffer))
+	for i, b := range p {
+		if z.boundary(n+int64(i)+1, b) {
+			return i
+		}
+	}
+	return -1
+}
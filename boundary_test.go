@@ -0,0 +1,152 @@
+package sgzip
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+func TestBoundaryFunc(t *testing.T) {
+	var in bytes.Buffer
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; in.Len() < 200000; i++ {
+		fmt.Fprintf(&in, "line %d %s\n", i, bytes.Repeat([]byte{'x'}, rng.Intn(200)))
+		if i == 300 {
+			// A line longer than the block size is split.
+			in.Write(bytes.Repeat([]byte{'y'}, 40000))
+		}
+	}
+	data := in.Bytes()
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetConcurrency(16<<10, 4)
+	if err := w.SetBoundaryFunc(func(written int64, b byte) bool {
+		return written >= 4096 && b == '\n'
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetAdaptiveBlocks(1024, 16<<10); err == nil {
+		t.Error("SetAdaptiveBlocks with a boundary function: expected error")
+	}
+	// Split the data so that boundaries fall inside and at the end of writes.
+	for off := 0; off < len(data); {
+		n := 1 + rng.Intn(10000)
+		if off+n > len(data) {
+			n = len(data) - off
+		}
+		w.Write(data[off : off+n])
+		off += n
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	meta := w.MetaData()
+	if err := Verify(bytes.NewReader(buf.Bytes()), &meta); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewSeekingReader(bytes.NewReader(buf.Bytes()), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	split := 0
+	for i := 0; i < meta.NumBlocks()-1; i++ {
+		bi, _ := meta.BlockInfo(i)
+		block := data[bi.UncompressedOffset : bi.UncompressedOffset+bi.UncompressedLength]
+		switch {
+		case block[len(block)-1] == '\n':
+			if len(block) < 4096 && i < meta.NumBlocks()-2 {
+				t.Errorf("block %d holds %d bytes, want at least 4096", i, len(block))
+			}
+		case len(block) == 16<<10:
+			split++
+		default:
+			t.Errorf("block %d of %d bytes does not end a line", i, len(block))
+		}
+		if _, err := r.Seek(bi.UncompressedOffset, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, bi.UncompressedLength)
+		if _, err := io.ReadFull(r, got); err != nil || !bytes.Equal(got, block) {
+			t.Fatalf("block %d: read %v", i, err)
+		}
+	}
+	if split == 0 {
+		t.Error("the long line was not split at the block size")
+	}
+
+	w.Reset(ioutil.Discard)
+	w.Write([]byte("x"))
+	if err := w.SetBoundaryFunc(nil); err == nil {
+		t.Error("SetBoundaryFunc after Write: expected error")
+	}
+}
+
+func TestRecordBoundaries(t *testing.T) {
+	var lines, objects bytes.Buffer
+	rng := rand.New(rand.NewSource(1))
+	// A stray close byte is ignored.
+	objects.WriteString("}\n")
+	for i := 0; lines.Len() < 1<<20; i++ {
+		fmt.Fprintf(&lines, "{\"n\": %d, \"s\": %q}\n", i, bytes.Repeat([]byte{'x'}, rng.Intn(200)))
+		fmt.Fprintf(&objects, "{\"n\": %d, \"o\": {\"s\": %q}}\n", i, bytes.Repeat([]byte{'x'}, rng.Intn(200)))
+	}
+	tests := []struct {
+		name  string
+		data  []byte
+		fn    func(int64, byte) bool
+		last  byte
+		first byte
+	}{
+		{"newline", lines.Bytes(), NewlineBoundary(), '\n', '{'},
+		{"delimiter", objects.Bytes(), DelimiterBoundary('{', '}'), '}', '\n'},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.SetConcurrency(256<<10, 4)
+		if err := w.SetBoundaryFunc(tt.fn); err != nil {
+			t.Fatal(err)
+		}
+		w.Write(tt.data)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		meta := w.MetaData()
+		if err := Verify(bytes.NewReader(buf.Bytes()), &meta); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if meta.NumBlocks() < 5 {
+			t.Errorf("%s: %d blocks", tt.name, meta.NumBlocks())
+		}
+		for i := 0; i < meta.NumBlocks()-2; i++ {
+			bi, _ := meta.BlockInfo(i)
+			block := tt.data[bi.UncompressedOffset : bi.UncompressedOffset+bi.UncompressedLength]
+			if len(block) < recordMinBlock || block[len(block)-1] != tt.last || tt.data[bi.UncompressedOffset+bi.UncompressedLength] != tt.first {
+				t.Errorf("%s: block %d of %d bytes does not end a record", tt.name, i, len(block))
+			}
+		}
+	}
+
+	// An unclosed record ends blocks only at the block size.
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetConcurrency(100<<10, 4)
+	w.SetBoundaryFunc(DelimiterBoundary('{', '}'))
+	w.Write([]byte("{"))
+	w.Write(objects.Bytes()[2 : 300<<10])
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	meta := w.MetaData()
+	for i := 0; i < meta.NumBlocks()-2; i++ {
+		if bi, _ := meta.BlockInfo(i); bi.UncompressedLength != 100<<10 {
+			t.Errorf("unclosed: block %d holds %d bytes", i, bi.UncompressedLength)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+)
+
+// A SeekableBuffer compresses the data written to it into a seekable gzip
+// stream held in memory, together with its metadata. It is convenient for
+// caches and tests that would otherwise keep a bytes.Buffer and the
+// metadata side by side.
+type SeekableBuffer struct {
+	buf    bytes.Buffer
+	w      *Writer
+	closed bool
+}
+
+// NewSeekableBuffer returns an empty SeekableBuffer compressing with the
+// given compression level and block size.
+func NewSeekableBuffer(level, blockSize int) (*SeekableBuffer, error) {
+	b := new(SeekableBuffer)
+	w, err := NewWriterLevel(&b.buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if blockSize <= 0 {
+		return nil, errors.New("gzip: block size must be positive")
+	}
+	if err := w.SetConcurrency(blockSize, w.blocks); err != nil {
+		return nil, err
+	}
+	b.w = w
+	return b, nil
+}
+
+// Write compresses p into the buffer. It returns an error once the stream
+// has been finished by Close or Reader.
+func (b *SeekableBuffer) Write(p []byte) (int, error) {
+	if b.closed {
+		return 0, errors.New("gzip: write to a finished SeekableBuffer")
+	}
+	return b.w.Write(p)
+}
+
+// Close finishes the compressed stream. Calling it more than once has no
+// effect.
+func (b *SeekableBuffer) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	return b.w.Close()
+}
+
+// Reader finishes the compressed stream, if that has not been done yet,
+// and returns a Reader that can seek within it. Each call returns a new
+// Reader, and all of them share the buffer.
+func (b *SeekableBuffer) Reader() (*Reader, error) {
+	if err := b.Close(); err != nil {
+		return nil, err
+	}
+	meta := b.w.MetaData()
+	return NewSeekingReader(bytes.NewReader(b.buf.Bytes()), &meta)
+}
+
+// Bytes returns the compressed stream written so far, which is complete
+// after Close or Reader. The slice must not be modified.
+func (b *SeekableBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+// MetaData returns the metadata of the compressed stream. It is only
+// complete after Close or Reader.
+func (b *SeekableBuffer) MetaData() GzipMetadata {
+	return b.w.MetaData()
+}
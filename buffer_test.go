@@ -0,0 +1,51 @@
+package sgzip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestSeekableBuffer(t *testing.T) {
+	in, _, _ := testSeekableData(t, 100000, 16<<10)
+	b, err := NewSeekableBuffer(DefaultCompression, 16<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Write(in[:30000])
+	b.Write(in[30000:])
+	r, err := b.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := r.Seek(70000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(got, in[70000:]) {
+		t.Errorf("read after Seek: %d bytes, %v", len(got), err)
+	}
+	if _, err := b.Write([]byte("more")); err == nil {
+		t.Error("Write after Reader: expected error")
+	}
+
+	// A second Reader is independent of the first.
+	r2, err := b.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Close()
+	if got, err := ioutil.ReadAll(r2); err != nil || !bytes.Equal(got, in) {
+		t.Errorf("second Reader: %d bytes, %v", len(got), err)
+	}
+	meta := b.MetaData()
+	if err := Verify(bytes.NewReader(b.Bytes()), &meta); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := NewSeekableBuffer(DefaultCompression, 0); err == nil {
+		t.Error("block size 0: expected error")
+	}
+}
@@ -0,0 +1,301 @@
+package sgzip
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// SetBlockCacheSize makes a Reader created with metadata keep the
+// decompressed data of the n most recently used blocks. A Seek into a
+// cached block serves its data from memory instead of decompressing the
+// block again, which speeds up many small reads close to each other.
+// With a cache, Seek decompresses the block containing the new position
+// right away, and read-ahead only starts once that block has been read.
+//
+// Up to n*BlockSize bytes are kept in addition to the read-ahead buffers.
+// A value of 0, the default, disables the cache. SetBlockCache sets a
+// cache that can be shared and limited in bytes.
+func (z *Reader) SetBlockCacheSize(n int) {
+	z.ownCache = n > 0
+	if n <= 0 {
+		z.cache = nil
+		return
+	}
+	z.cache, _ = NewBlockCache(n, 0)
+}
+
+// SetBlockCache makes the Reader use c as described for
+// SetBlockCacheSize. c may be shared by Readers, which only share blocks
+// if they were created with the same metadata: blocks are identified by
+// their index and a checksum of the block layout of the metadata. A nil
+// cache disables caching.
+//
+// The cache is kept by Seek and ResetKeepOptions, and dropped by Reset.
+// It has no effect on Readers without metadata.
+func (z *Reader) SetBlockCache(c *BlockCache) {
+	z.cache = c
+	z.ownCache = false
+}
+
+// cacheStream returns the key identifying the stream of z in a block
+// cache, a checksum of the block layout given by its metadata, so that
+// blocks of other streams sharing the cache are never returned.
+func (z *Reader) cacheStream() uint32 {
+	if z.cacheKey != 0 {
+		return z.cacheKey
+	}
+	h := crc32.NewIEEE()
+	var b [8]byte
+	add := func(v int64) {
+		binary.LittleEndian.PutUint64(b[:], uint64(v))
+		h.Write(b[:])
+	}
+	add(z.isize)
+	add(int64(z.metaBlockSize))
+	for _, s := range z.blockStarts {
+		add(s)
+	}
+	for _, s := range z.ustarts {
+		add(s)
+	}
+	for _, c := range z.blockCRC {
+		add(int64(c))
+	}
+	// 0 means not computed yet.
+	z.cacheKey = h.Sum32() | 1
+	return z.cacheKey
+}
+
+// BlockCacheStats returns the statistics of the block cache of the Reader,
+// or zero if it has none.
+func (z *Reader) BlockCacheStats() CacheStats {
+	if z.cache == nil {
+		return CacheStats{}
+	}
+	return z.cache.Stats()
+}
+
+// Prepare seeks to offset, as Seek(offset, io.SeekStart) does, and
+// decompresses the block holding it, so that the following Read returns
+// data without waiting for decompression. It is meant to be called ahead
+// of time, for example while waiting for the next request. With a block
+// cache, the block is taken from or added to the cache. Without one, it
+// is decompressed into the read-ahead buffers, and the read-ahead goes on
+// with the following blocks in the background.
+//
+// Readers without metadata cannot seek ahead of time, so Prepare does
+// nothing for them and returns nil. At the end of the data there is
+// nothing to prepare.
+func (z *Reader) Prepare(offset int64) error {
+	if !z.canSeek {
+		return nil
+	}
+	if _, err := z.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	// The read-ahead has not started yet unless the block was cached.
+	for len(z.current) == 0 && (z.startRA || !z.lastBlock) {
+		if err := z.nextBlock(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadCachedBlock makes the block containing pos the current block of the
+// Reader, taking it from the cache or decompressing it with the
+// decompressor set up by Seek, and continues after it. Blocks whose size
+// the metadata does not give reliably are read as usual.
+func (z *Reader) loadCachedBlock(pos int64) error {
+	b, _, discard := locateBlock(z.blockStarts, z.metaBlockSize, z.ustarts, pos)
+	start, end, ok := z.cacheableBlock(b)
+	if !ok || pos >= end {
+		return nil
+	}
+	data := z.cache.get(z.cacheStream(), b)
+	if data == nil {
+		data = make([]byte, end-start)
+		n, err := io.ReadFull(z.decompressor, data)
+		atomic.AddInt64(&z.decoded, int64(n))
+		z.countInput()
+		if err == nil {
+			err = z.checkExpansion()
+		}
+		if err != nil {
+			return noEOF(err)
+		}
+		z.cache.add(z.cacheStream(), b, data)
+	} else {
+		// Continue with the next block.
+		z.decompressor.Close()
+		if err := z.seekSource(z.blockStarts[b+1]); err != nil {
+			return err
+		}
+		z.decompressor = z.newDecompressor(end)
+	}
+	buf := <-z.blockPool
+	z.current = append(buf[:0], data...)
+	z.roff = int(discard)
+	z.blockOffset = 0
+	z.lastBlock = false
+	if z.checkBlockSize() != nil {
+		// Read and WriteTo report the error.
+		return nil
+	}
+	z.observeBlock()
+	return nil
+}
+
+// cacheableBlock returns the uncompressed start and end of block b, and
+// whether it can be cached. That requires the metadata to describe every
+// block of the stream, so that the next block starts where the metadata
+// says. The last block of a padded stream is not cached, since the padding
+// after it is checked by the decompressor.
+func (z *Reader) cacheableBlock(b int) (start, end int64, ok bool) {
+	blocks := len(z.blockStarts) - 3 // data blocks, followed by the final marker block
+	if b >= blocks {
+		return 0, 0, false
+	}
+	if z.ustarts != nil {
+		if len(z.ustarts) <= blocks || z.ustarts[blocks] != z.isize {
+			return 0, 0, false
+		}
+		start, end = z.ustarts[b], z.ustarts[b+1]
+	} else {
+		bs := int64(z.metaBlockSize)
+		if int64(blocks)*bs < z.isize || int64(blocks-1)*bs >= z.isize {
+			return 0, 0, false
+		}
+		start, end = int64(b)*bs, int64(b+1)*bs
+		if end > z.isize {
+			end = z.isize
+		}
+	}
+	if z.padding > 0 && end == z.isize {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// A BlockCache holds the decompressed data of recently used blocks of a
+// stream, see Reader.SetBlockCache. When it is full, the least recently
+// used blocks are evicted. It is safe for concurrent use, so several
+// Readers of the same stream can share one, for example when serving
+// overlapping range requests from different goroutines.
+type BlockCache struct {
+	maxBlocks int
+	maxBytes  int64
+
+	mu     sync.Mutex
+	lru    *list.List // of *cachedBlock, most recently used first
+	blocks map[cacheKey]*list.Element
+	bytes  int64
+	stats  CacheStats
+}
+
+// CacheStats describes the use of a BlockCache.
+type CacheStats struct {
+	Hits      int64 // seeks served from the cache
+	Misses    int64 // seeks that decompressed a block
+	Evictions int64 // blocks removed to make room
+	Blocks    int   // blocks currently cached
+	Bytes     int64 // size of the data currently cached
+}
+
+// cacheKey identifies a block: its index in the stream identified by
+// stream, see Reader.cacheStream.
+type cacheKey struct {
+	stream uint32
+	index  int
+}
+
+type cachedBlock struct {
+	key  cacheKey
+	data []byte
+}
+
+// NewBlockCache returns a BlockCache holding up to maxBlocks blocks and up
+// to maxBytes bytes of data. A limit of 0 means no limit, but at least one
+// of them must be positive. Blocks larger than maxBytes are not cached.
+func NewBlockCache(maxBlocks int, maxBytes int64) (*BlockCache, error) {
+	if maxBlocks < 0 || maxBytes < 0 || (maxBlocks == 0 && maxBytes == 0) {
+		return nil, errors.New("gzip: block cache needs a positive limit")
+	}
+	return &BlockCache{
+		maxBlocks: maxBlocks,
+		maxBytes:  maxBytes,
+		lru:       list.New(),
+		blocks:    make(map[cacheKey]*list.Element),
+	}, nil
+}
+
+// Stats returns the number of hits and misses since the cache was created
+// and its current size.
+func (c *BlockCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Blocks = c.lru.Len()
+	s.Bytes = c.bytes
+	return s
+}
+
+// get returns the data of block i of stream, or nil if it is not cached,
+// and counts the lookup as a hit or miss.
+func (c *BlockCache) get(stream uint32, i int) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.blocks[cacheKey{stream, i}]
+	if !ok {
+		c.stats.Misses++
+		return nil
+	}
+	c.stats.Hits++
+	c.lru.MoveToFront(e)
+	return e.Value.(*cachedBlock).data
+}
+
+// add caches data as block i of stream, evicting the least recently used
+// blocks until the cache is within its limits. data must not be modified
+// afterwards.
+func (c *BlockCache) add(stream uint32, i int, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.maxBytes > 0 && int64(len(data)) > c.maxBytes {
+		return
+	}
+	key := cacheKey{stream, i}
+	if e, ok := c.blocks[key]; ok {
+		// Added by another Reader in the meantime.
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.blocks[key] = c.lru.PushFront(&cachedBlock{key: key, data: data})
+	c.bytes += int64(len(data))
+	for (c.maxBlocks > 0 && c.lru.Len() > c.maxBlocks) || (c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		b := c.lru.Remove(c.lru.Back()).(*cachedBlock)
+		delete(c.blocks, b.key)
+		c.bytes -= int64(len(b.data))
+		c.stats.Evictions++
+	}
+}
+
+// drop removes the blocks of stream.
+func (c *BlockCache) drop(stream uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for e := c.lru.Front(); e != nil; {
+		next := e.Next()
+		if b := e.Value.(*cachedBlock); b.key.stream == stream {
+			c.lru.Remove(e)
+			delete(c.blocks, b.key)
+			c.bytes -= int64(len(b.data))
+		}
+		e = next
+	}
+}
@@ -0,0 +1,346 @@
+package sgzip
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestBlockCache(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 300000, 16<<10)
+	var decoded [2]int64
+	for k, size := range []int{0, 4} {
+		r, err := NewSeekingReader(bytes.NewReader(compressed), &meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.SetBlockCacheSize(size)
+		rnd := rand.New(rand.NewSource(1))
+		p := make([]byte, 100)
+		for i := 0; i < 500; i++ {
+			// Mostly seek within two hot blocks.
+			pos := int64(5*16<<10 + rnd.Intn(2*16<<10))
+			if i%10 == 0 {
+				pos = int64(rnd.Intn(len(in)))
+			}
+			if _, err := r.Seek(pos, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			n, err := io.ReadFull(r, p)
+			if err != nil && err != io.ErrUnexpectedEOF {
+				t.Fatalf("Read at %d: %v", pos, err)
+			}
+			if !bytes.Equal(p[:n], in[pos:pos+int64(n)]) {
+				t.Fatalf("cache size %d: Read at %d: content does not match", size, pos)
+			}
+		}
+		decoded[k] = r.DecodedBytes()
+		r.Close()
+	}
+	if decoded[1] > decoded[0]/4 {
+		t.Errorf("decoded %d bytes with cache, %d without", decoded[1], decoded[0])
+	}
+
+	r, err := NewSeekingReader(bytes.NewReader(compressed), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.SetBlockCacheSize(2)
+	// Reading on from a cached block continues with the following blocks.
+	for _, pos := range []int64{5*16<<10 + 10, 6*16<<10 + 1000, int64(len(in)) - 10} {
+		for _, writeTo := range []bool{false, true} {
+			if _, err := r.Seek(pos, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			var got []byte
+			if writeTo {
+				var buf bytes.Buffer
+				_, err = r.WriteTo(&buf)
+				got = buf.Bytes()
+			} else {
+				got, err = ioutil.ReadAll(r)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, in[pos:]) {
+				t.Errorf("from %d (WriteTo %v): content does not match", pos, writeTo)
+			}
+		}
+	}
+
+	r.SetBlockCacheSize(0)
+	if _, err := r.Seek(100, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(got, in[100:]) {
+		t.Errorf("without cache: %v", err)
+	}
+}
+
+func TestBlockCacheCoarseMetadata(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 300000, 16<<10)
+	// Describe the data as a single block, and as a few large blocks.
+	var rest uint32
+	for _, d := range meta.BlockData[1:] {
+		rest += d
+	}
+	single := GzipMetadata{BlockSize: meta.BlockSize, Size: meta.Size, BlockData: []uint32{meta.BlockData[0], rest}}
+	for _, m := range []GzipMetadata{single, meta.Downsample(8)} {
+		r, err := NewSeekingReader(bytes.NewReader(compressed), &m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.SetBlockCacheSize(4)
+		for _, pos := range []int64{200000, 100, 200000, 140000} {
+			if _, err := r.Seek(pos, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(r)
+			if err != nil || !bytes.Equal(got, in[pos:]) {
+				t.Errorf("%d blocks: from %d: content does not match, %v", m.NumBlocks(), pos, err)
+			}
+		}
+		r.Close()
+	}
+}
+
+func TestBlockCachePadded(t *testing.T) {
+	in := make([]byte, 100000)
+	for i := range in {
+		in[i] = byte(i*7 + i/1000)
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetConcurrency(16<<10, 4)
+	if err := w.SetPadLastBlock(true); err != nil {
+		t.Fatal(err)
+	}
+	w.Write(in)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	meta := w.MetaData()
+	r, err := NewSeekingReader(bytes.NewReader(buf.Bytes()), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.SetBlockCacheSize(8)
+	for _, pos := range []int64{99990, 40000, 99990, 40000, 0} {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil || !bytes.Equal(got, in[pos:]) {
+			t.Errorf("from %d: content does not match, %v", pos, err)
+		}
+	}
+}
+
+func TestSharedBlockCache(t *testing.T) {
+	if _, err := NewBlockCache(0, 0); err == nil {
+		t.Error("expected error for a cache without limits")
+	}
+	in, compressed, meta := testSeekableData(t, 300000, 16<<10)
+	cache, err := NewBlockCache(0, 5*16<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r, err := NewRandomReader(bytes.NewReader(compressed), &meta)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer r.Close()
+			r.SetBlockCache(cache)
+			rnd := rand.New(rand.NewSource(seed))
+			p := make([]byte, 200)
+			for i := 0; i < 200; i++ {
+				pos := int64(rnd.Intn(4 * 16 << 10))
+				if _, err := r.Seek(pos, io.SeekStart); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := io.ReadFull(r, p); err != nil {
+					errs <- err
+					return
+				}
+				if !bytes.Equal(p, in[pos:pos+200]) {
+					errs <- fmt.Errorf("content at %d does not match", pos)
+					return
+				}
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	s := cache.Stats()
+	if s.Hits+s.Misses != 800 || s.Hits < 700 {
+		t.Errorf("got %d hits and %d misses", s.Hits, s.Misses)
+	}
+	if s.Bytes > 5*16<<10 || s.Blocks != 4 {
+		t.Errorf("cache holds %d blocks, %d bytes", s.Blocks, s.Bytes)
+	}
+
+	// The byte limit evicts blocks.
+	r, err := NewSeekingReader(bytes.NewReader(compressed), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.SetBlockCache(cache)
+	for _, pos := range []int64{100000, 120000, 200000} {
+		r.Seek(pos, io.SeekStart)
+	}
+	if s := r.BlockCacheStats(); s.Evictions != 2 || s.Blocks != 5 {
+		t.Errorf("got %d evictions, %d blocks, want 2 and 5", s.Evictions, s.Blocks)
+	}
+}
+
+func BenchmarkHotBlockSeeks(b *testing.B) {
+	in, compressed, meta := testSeekableData(b, 16<<20, 64<<10)
+	for _, size := range []int{0, 1, 8} {
+		b.Run(fmt.Sprintf("cache=%d", size), func(b *testing.B) {
+			r, err := NewSeekingReader(bytes.NewReader(compressed), &meta)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer r.Close()
+			r.SetBlockCacheSize(size)
+			rnd := rand.New(rand.NewSource(1))
+			p := make([]byte, 64)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				// Most reads hit a few hot blocks.
+				pos := int64(rnd.Intn(4 * 64 << 10))
+				if i%16 == 0 {
+					pos = int64(rnd.Intn(len(in) - len(p)))
+				}
+				if _, err := r.Seek(pos, io.SeekStart); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := io.ReadFull(r, p); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 300000, 16<<10)
+	for _, size := range []int{0, 4} {
+		r, err := NewSeekingReader(bytes.NewReader(compressed), &meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.SetBlockCacheSize(size)
+		for _, pos := range []int64{100000, 5, 16 << 10, int64(len(in)) - 1, int64(len(in))} {
+			if err := r.Prepare(pos); err != nil {
+				t.Fatalf("cache size %d: Prepare(%d): %v", size, pos, err)
+			}
+			if pos < int64(len(in)) && len(r.current)-r.roff == 0 {
+				t.Errorf("cache size %d: Prepare(%d) decompressed nothing", size, pos)
+			}
+			got, err := ioutil.ReadAll(r)
+			if err != nil || !bytes.Equal(got, in[pos:]) {
+				t.Errorf("cache size %d: read after Prepare(%d): %d bytes, %v", size, pos, len(got), err)
+			}
+		}
+		if err := r.Prepare(int64(len(in)) + 1); err != ErrInvalidSeek {
+			t.Errorf("cache size %d: Prepare beyond the end: got %v, want %v", size, err, ErrInvalidSeek)
+		}
+		r.Close()
+	}
+
+	// Without metadata Prepare does nothing.
+	r, err := NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err := r.Prepare(1000); err != nil {
+		t.Fatal(err)
+	}
+	p := make([]byte, 10)
+	if _, err := io.ReadFull(r, p); err != nil || !bytes.Equal(p, in[:10]) {
+		t.Errorf("read after Prepare without metadata: %v", err)
+	}
+}
+
+func TestBlockCacheStreams(t *testing.T) {
+	inA, compA, metaA := testSeekableData(t, 100000, 16<<10)
+	inB := make([]byte, len(inA))
+	for i := range inB {
+		inB[i] = inA[i] ^ 0x55
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetConcurrency(16<<10, 4)
+	w.Write(inB)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	compB, metaB := buf.Bytes(), w.MetaData()
+
+	// Readers of different streams sharing a cache get their own blocks.
+	cache, _ := NewBlockCache(8, 0)
+	p := make([]byte, 100)
+	for _, s := range []struct {
+		in, comp []byte
+		meta     GzipMetadata
+	}{{inA, compA, metaA}, {inB, compB, metaB}} {
+		r, err := NewSeekingReader(bytes.NewReader(s.comp), &s.meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.SetBlockCache(cache)
+		if _, err := r.Seek(1000, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(r, p); err != nil || !bytes.Equal(p, s.in[1000:1100]) {
+			t.Errorf("shared cache: got other data, %v", err)
+		}
+		r.Close()
+	}
+	if s := cache.Stats(); s.Misses != 2 || s.Blocks != 2 {
+		t.Errorf("shared cache: got %d misses, %d blocks, want 2 and 2", s.Misses, s.Blocks)
+	}
+
+	// ResetKeepOptions keeps the cache, without the blocks of the
+	// previous stream.
+	r, err := NewSeekingReader(bytes.NewReader(compA), &metaA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.SetBlockCacheSize(4)
+	if _, err := r.Seek(1000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ResetKeepOptions(bytes.NewReader(compB)); err != nil {
+		t.Fatal(err)
+	}
+	if s := r.BlockCacheStats(); s.Misses != 1 || s.Blocks != 0 {
+		t.Errorf("after ResetKeepOptions: got %d misses, %d blocks, want 1 and 0", s.Misses, s.Blocks)
+	}
+	if got, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(got, inB) {
+		t.Errorf("after ResetKeepOptions: ReadAll: %v", err)
+	}
+}
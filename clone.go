@@ -0,0 +1,102 @@
+package sgzip
+
+import "io"
+
+// Clone returns a new Reader positioned at the current offset of z, which
+// reads the same stream independently of z, for example to look ahead and
+// then return to where z is. It needs a Reader created with metadata over
+// a source implementing io.ReaderAt, such as a *bytes.Reader, an *os.File
+// or the source of NewRandomReader, and returns ErrUnsupported otherwise.
+//
+// The clone reads the source with ReadAt and shares nothing with z that
+// changes while decompressing, so both can be used at the same time. It
+// shares the block cache, the metadata and the seek points found so far,
+// and has the options of z. Like after a Seek, the checksum of the data
+// is only verified if the clone starts at the beginning of the stream.
+// Clone must not be called concurrently with other methods of z. It is
+// the caller's responsibility to call Close on the clone when done.
+func (z *Reader) Clone() (*Reader, error) {
+	if !z.canSeek {
+		return nil, ErrUnsupported
+	}
+	src, ok := z.cloneSource()
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	c := &Reader{
+		Header:            z.Header,
+		r:                 trackSeeks(src),
+		flg:               z.flg,
+		xfl:               z.xfl,
+		multistream:       z.multistream,
+		canSeek:           true,
+		noGarbage:         z.noGarbage,
+		memberEnd:         z.memberEnd,
+		expectSize:        z.expectSize,
+		expectedSize:      z.expectedSize,
+		partialOnChecksum: z.partialOnChecksum,
+		skipBadMembers:    z.skipBadMembers,
+		skipChecksum:      z.skipChecksum,
+		progress:          z.progress,
+		observer:          z.observer,
+		utf8Names:         z.utf8Names,
+		strict:            z.strict,
+		rawName:           z.rawName,
+		readTimeout:       z.readTimeout,
+		readBufSize:       z.readBufSize,
+		newCRC:            z.newCRC,
+		blockSize:         z.blockSize,
+		concurrentBlocks:  z.concurrentBlocks,
+		blockStarts:       z.blockStarts,
+		ustarts:           z.ustarts,
+		blockCRC:          z.blockCRC,
+		metaBlockSize:     z.metaBlockSize,
+		isize:             z.isize,
+		padding:           z.padding,
+		origin:            z.origin,
+		limited:           z.limited,
+		limit:             z.limit,
+		cache:             z.cache,
+	}
+	c.digest = c.newDigest()
+	z.refineMu.Lock()
+	c.refined = append([]refinePoint(nil), z.refined...)
+	z.refineMu.Unlock()
+
+	if z.pos != 0 || !z.verifyChecksum {
+		if _, err := c.seek(z.pos, io.SeekStart); err != nil {
+			c.Close()
+			return nil, err
+		}
+		return c, nil
+	}
+	// At the start of the stream, read the header as NewSeekingReader does
+	// so that the checksum is verified.
+	if err := c.seekSource(0); err != nil {
+		return nil, err
+	}
+	c.verifyChecksum = true
+	c.blockPool = make(chan []byte, c.concurrentBlocks)
+	for i := 0; i < c.concurrentBlocks; i++ {
+		c.blockPool <- nil // allocated by the read-ahead when needed
+	}
+	if err := c.readHeader(true); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// cloneSource returns a new source of the compressed stream of z that
+// reads from the same io.ReaderAt, if there is one.
+func (z *Reader) cloneSource() (io.ReadSeeker, bool) {
+	if s, ok := z.r.(*blockSource); ok {
+		return &blockSource{ra: s.ra, bounds: s.bounds, prefetch: s.prefetch}, true
+	}
+	ra, start, ok := z.sourceAt()
+	if !ok {
+		return nil, false
+	}
+	// The stream ends with the trailer after the last block.
+	end := z.blockStarts[len(z.blockStarts)-1] + 8
+	return io.NewSectionReader(ra, start, end), true
+}
@@ -0,0 +1,100 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestClone(t *testing.T) {
+	in, comp, meta := testSeekableData(t, 300000, 32<<10)
+	prefixed := append(bytes.Repeat([]byte{'x'}, 100), comp...)
+	open := map[string]func() (*Reader, error){
+		"bytes.Reader": func() (*Reader, error) { return NewSeekingReader(bytes.NewReader(comp), &meta) },
+		"random":       func() (*Reader, error) { return NewRandomReader(bytes.NewReader(comp), &meta) },
+		"offset": func() (*Reader, error) {
+			return NewSeekingReaderOffset(bytes.NewReader(prefixed), &meta, 100)
+		},
+	}
+	for name, fn := range open {
+		r, err := fn()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		head := make([]byte, 70000)
+		if _, err := io.ReadFull(r, head); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		c, err := r.Clone()
+		if err != nil {
+			t.Fatalf("%s: Clone: %v", name, err)
+		}
+		// Reading from the clone does not move r.
+		got, err := ioutil.ReadAll(c)
+		if err != nil || !bytes.Equal(got, in[70000:]) {
+			t.Errorf("%s: clone read %d bytes, %v, want %d", name, len(got), err, len(in)-70000)
+		}
+		got, err = ioutil.ReadAll(r)
+		if err != nil || !bytes.Equal(got, in[70000:]) {
+			t.Errorf("%s: original read %d bytes, %v, want %d", name, len(got), err, len(in)-70000)
+		}
+		c.Close()
+
+		if _, err := r.Seek(250000, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		c, err = r.Clone()
+		if err != nil {
+			t.Fatalf("%s: Clone after Seek: %v", name, err)
+		}
+		if _, err := c.Seek(10, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got = make([]byte, 100)
+		if _, err := io.ReadFull(c, got); err != nil || !bytes.Equal(got, in[10:110]) {
+			t.Errorf("%s: clone after Seek: got %v", name, err)
+		}
+		got = make([]byte, 100)
+		if _, err := io.ReadFull(r, got); err != nil || !bytes.Equal(got, in[250000:250100]) {
+			t.Errorf("%s: original after Seek: got %v", name, err)
+		}
+		c.Close()
+		r.Close()
+	}
+
+	// A clone at the start of the stream verifies the checksum.
+	corrupt := append([]byte{}, comp...)
+	corrupt[len(corrupt)-6]++
+	noFingerprint := meta
+	noFingerprint.Fingerprint = 0
+	r, err := NewSeekingReader(bytes.NewReader(corrupt), &noFingerprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := r.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(c); !errors.Is(err, ErrChecksum) {
+		t.Errorf("corrupt trailer: got %v, want ErrChecksum", err)
+	}
+	c.Close()
+	r.Close()
+
+	r, err = NewSeekingReader(struct{ io.ReadSeeker }{bytes.NewReader(comp)}, &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Clone(); err != ErrUnsupported {
+		t.Errorf("source without ReadAt: got %v, want ErrUnsupported", err)
+	}
+	r, err = NewReader(bytes.NewReader(comp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Clone(); err != ErrUnsupported {
+		t.Errorf("reader without metadata: got %v, want ErrUnsupported", err)
+	}
+}
@@ -0,0 +1,153 @@
+package sgzip
+
+import (
+	"bytes"
+	"io"
+)
+
+// compareBufferSize is the size of the chunks compared by FirstDifference.
+const compareBufferSize = 64 << 10
+
+// EqualContent reports whether a and b hold the same data from their
+// current positions to the end, as described for FirstDifference.
+func EqualContent(a, b *Reader) (bool, error) {
+	off, err := FirstDifference(a, b)
+	return off < 0 && err == nil, err
+}
+
+// FirstDifference reads a and b in lockstep from their current positions
+// and returns the number of bytes before the first byte that differs, or
+// -1 if they hold the same data up to the end. If one ends before the
+// other, the difference is at its end. Reading stops at the first
+// difference, and only a chunk of 64 KiB of each Reader is held in
+// memory. The positions of a and b afterwards are unspecified.
+//
+// All data up to the first difference is decompressed and compared; see
+// FirstDifferenceByChecksum for a faster comparison of Readers with
+// metadata.
+func FirstDifference(a, b *Reader) (int64, error) {
+	return compareStreams(a, b, 0)
+}
+
+// FirstDifferenceByChecksum is FirstDifference, except that if both
+// Readers were created with metadata that has per-block checksums, have
+// the same block boundaries and are at the same position, blocks whose
+// checksums match are skipped without decompressing them, so streams of
+// the same data are compared from their metadata alone. Only blocks with
+// different checksums, and the part of the current block after the
+// position, are compared byte by byte. Other Readers are compared as by
+// FirstDifference.
+//
+// Skipping trusts the checksums: different data has the same CRC-32 with
+// a chance of about 1 in 4 billion per block, in which case the
+// difference is missed.
+func FirstDifferenceByChecksum(a, b *Reader) (int64, error) {
+	if !sameBlocks(a, b) {
+		return compareStreams(a, b, 0)
+	}
+	start := a.pos
+	for i := 0; i < len(a.blockCRC); {
+		bs, be := a.blockBounds(i)
+		if be <= a.pos || be == bs {
+			i++
+			continue
+		}
+		if a.pos > bs || a.blockCRC[i] != b.blockCRC[i] {
+			off, err := compareStreams(io.LimitReader(a, be-a.pos), io.LimitReader(b, be-b.pos), a.pos-start)
+			if err != nil || off >= 0 {
+				return off, err
+			}
+			i++
+			continue
+		}
+		// Skip the run of blocks with matching checksums.
+		for i < len(a.blockCRC) && a.blockCRC[i] == b.blockCRC[i] {
+			_, be = a.blockBounds(i)
+			i++
+		}
+		if _, err := a.seek(be, io.SeekStart); err != nil {
+			return -1, err
+		}
+		if _, err := b.seek(be, io.SeekStart); err != nil {
+			return -1, err
+		}
+	}
+	return -1, nil
+}
+
+// sameBlocks reports whether a and b are at the same position of streams
+// of the same size with the same block boundaries and checksums for every
+// block, so that FirstDifferenceByChecksum can compare them block by
+// block.
+func sameBlocks(a, b *Reader) bool {
+	if !a.canSeek || !b.canSeek || a.blockCRC == nil || len(a.blockCRC) != len(b.blockCRC) {
+		return false
+	}
+	if a.pos != b.pos || a.isize != b.isize || a.origin != b.origin || a.padding != 0 || b.padding != 0 {
+		return false
+	}
+	for i := range a.blockCRC {
+		as, ae := a.blockBounds(i)
+		bs, be := b.blockBounds(i)
+		if as != bs || ae != be {
+			return false
+		}
+	}
+	return true
+}
+
+// blockBounds returns the uncompressed start and end of block i of a
+// Reader with metadata.
+func (z *Reader) blockBounds(i int) (start, end int64) {
+	if z.ustarts != nil {
+		start, end = z.ustarts[i], z.isize
+		if i+1 < len(z.ustarts) {
+			end = z.ustarts[i+1]
+		}
+		return start, end
+	}
+	bs := int64(z.metaBlockSize)
+	start, end = int64(i)*bs, int64(i+1)*bs
+	if start > z.isize {
+		start = z.isize
+	}
+	if end > z.isize {
+		end = z.isize
+	}
+	return start, end
+}
+
+// compareStreams compares a and b chunk by chunk and returns off plus the
+// offset of the first difference, or -1 if there is none.
+func compareStreams(a, b io.Reader, off int64) (int64, error) {
+	bufA := make([]byte, compareBufferSize)
+	bufB := make([]byte, compareBufferSize)
+	for {
+		na, err := io.ReadFull(a, bufA)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return -1, err
+		}
+		nb, err := io.ReadFull(b, bufB)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return -1, err
+		}
+		n := na
+		if nb < n {
+			n = nb
+		}
+		if !bytes.Equal(bufA[:n], bufB[:n]) {
+			i := 0
+			for bufA[i] == bufB[i] {
+				i++
+			}
+			return off + int64(i), nil
+		}
+		if na != nb {
+			return off + int64(n), nil
+		}
+		if na < len(bufA) {
+			return -1, nil
+		}
+		off += int64(n)
+	}
+}
@@ -0,0 +1,84 @@
+package sgzip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestFirstDifference(t *testing.T) {
+	in := levelTestData(300000)
+	changed := append([]byte{}, in...)
+	changed[200000]++
+	compress := func(data []byte, level int) ([]byte, GzipMetadata) {
+		var buf bytes.Buffer
+		w, _ := NewWriterLevel(&buf, level)
+		w.SetConcurrency(16<<10, 4)
+		w.Write(data)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes(), w.MetaData()
+	}
+	compA, metaA := compress(in, BestSpeed)
+	compB, metaB := compress(in, BestCompression)
+	compC, metaC := compress(changed, BestSpeed)
+	compD, metaD := compress(in[:250000], BestSpeed)
+
+	open := func(comp []byte, meta GzipMetadata, seeking bool) *Reader {
+		var r *Reader
+		var err error
+		if seeking {
+			r, err = NewSeekingReader(bytes.NewReader(comp), &meta)
+		} else {
+			r, err = NewReader(bytes.NewReader(comp))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	for _, seeking := range []bool{true, false} {
+		for _, tt := range []struct {
+			name string
+			comp []byte
+			meta GzipMetadata
+			skip int64 // read from both before comparing
+			want int64
+		}{
+			{"same data", compB, metaB, 0, -1},
+			{"same data after a read", compB, metaB, 1000, -1},
+			{"changed byte", compC, metaC, 0, 200000},
+			{"changed byte after a read", compC, metaC, 1000, 199000},
+			{"shorter", compD, metaD, 0, 250000},
+		} {
+			for _, byChecksum := range []bool{false, true} {
+				a, b := open(compA, metaA, seeking), open(tt.comp, tt.meta, seeking)
+				io.CopyN(ioutil.Discard, a, tt.skip)
+				io.CopyN(ioutil.Discard, b, tt.skip)
+				compare := FirstDifference
+				if byChecksum {
+					compare = FirstDifferenceByChecksum
+				}
+				got, err := compare(a, b)
+				if err != nil || got != tt.want {
+					t.Errorf("%s (seeking %v, by checksum %v): got %d, %v, want %d", tt.name, seeking, byChecksum, got, err, tt.want)
+				}
+				// Only checksums allow skipping blocks. The block with the
+				// difference and those decoded by the read-ahead are
+				// decompressed: once the block has been read, its buffer
+				// goes back to the read-ahead, which may fill all of them.
+				skipped := a.DecodedBytes() <= (1+defaultBlocks)*16<<10
+				if seeking && tt.skip == 0 && tt.meta.Size == metaA.Size && skipped != byChecksum {
+					t.Errorf("%s (by checksum %v): decompressed %d bytes", tt.name, byChecksum, a.DecodedBytes())
+				}
+				a.Close()
+				b.Close()
+			}
+			if eq, err := EqualContent(open(compA, metaA, seeking), open(tt.comp, tt.meta, seeking)); err != nil || eq != (tt.want < 0) {
+				t.Errorf("%s (seeking %v): EqualContent = %v, %v", tt.name, seeking, eq, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package sgzip
+
+import (
+	"bytes"
+	oldgz "compress/gzip"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+// The API shared with compress/gzip, which code replacing its import
+// relies on.
+var (
+	_ func(io.Reader) (*Reader, error)      = NewReader
+	_ func(io.Writer) *Writer               = NewWriter
+	_ func(io.Writer, int) (*Writer, error) = NewWriterLevel
+	_ func(*Reader, io.Reader) error        = (*Reader).Reset
+	_ func(*Reader, bool)                   = (*Reader).Multistream
+	_ func(*Writer, io.Writer)              = (*Writer).Reset
+	_ func(*Writer) error                   = (*Writer).Flush
+	_ io.ReadCloser                         = (*Reader)(nil)
+	_ io.WriteCloser                        = (*Writer)(nil)
+)
+
+func TestCompressGzipCompatibility(t *testing.T) {
+	if NoCompression != oldgz.NoCompression || BestSpeed != oldgz.BestSpeed ||
+		BestCompression != oldgz.BestCompression || DefaultCompression != oldgz.DefaultCompression ||
+		HuffmanOnly != oldgz.HuffmanOnly {
+		t.Error("compression levels differ from compress/gzip")
+	}
+	hdr := Header{Comment: "comment", Extra: []byte("extra"), ModTime: time.Unix(1e9, 0), Name: "name", OS: 3}
+	in := bytes.Repeat([]byte("compatible "), 10000)
+
+	// Written here, read by compress/gzip.
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Header = hdr
+	w.Write(in)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	or, err := oldgz.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(or)
+	if err != nil || !bytes.Equal(got, in) {
+		t.Errorf("compress/gzip read %d bytes, %v", len(got), err)
+	}
+	if or.Name != hdr.Name || or.Comment != hdr.Comment || !or.ModTime.Equal(hdr.ModTime) ||
+		or.OS != hdr.OS || !bytes.Equal(or.Extra, hdr.Extra) {
+		t.Errorf("compress/gzip read header %+v, want %+v", or.Header, hdr)
+	}
+
+	// Written by compress/gzip as two members, read here.
+	buf.Reset()
+	for i := 0; i < 2; i++ {
+		ow := oldgz.NewWriter(&buf)
+		ow.Header = oldgz.Header{Comment: hdr.Comment, Extra: hdr.Extra, ModTime: hdr.ModTime, Name: hdr.Name, OS: hdr.OS}
+		ow.Write(in)
+		ow.Close()
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.Multistream(false)
+	got, err = ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(got, in) {
+		t.Errorf("read %d bytes, %v, want the first member", len(got), err)
+	}
+	if r.Name != hdr.Name || r.Comment != hdr.Comment || !r.ModTime.Equal(hdr.ModTime) {
+		t.Errorf("read header %+v, want %+v", r.Header, hdr)
+	}
+}
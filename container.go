@@ -0,0 +1,237 @@
+package sgzip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+)
+
+// A container is a gzip file that carries its own index. It is a valid
+// multistream gzip file whose data is that of the data members, so other
+// gzip tools decompress it as usual:
+//
+//	the data members: one member for each block of the data, the first
+//	of which has the header set on the Writer, holding an index
+//	pointer, see RegisterSubfield, and the others only the fixed fields
+//	index members: empty members whose FEXTRA field holds a subfield
+//	"SI" with up to containerChunk bytes of the binary index each
+//	the footer: an empty member whose FEXTRA field holds a subfield "SF"
+//	with "SGZC", the size of the data members and the size of the index
+//	(uint64 each, little-endian)
+//
+// The footer has a fixed size, so a reader finds the index from the end
+// of the file without any limit on its size. The index describes the
+// data members as one stream, whose blocks after the first start with
+// the end of the previous member and the header of their own, as in the
+// result of MergeMetadata.
+const (
+	containerMagic  = "SGZC"
+	containerChunk  = 0xffff - 4       // index bytes per member, the largest FEXTRA subfield
+	containerFooter = 12 + 4 + 20 + 10 // size of the footer member
+)
+
+// NewContainerWriter returns a new Writer compressing to w with the given
+// compression level and block size, which appends the metadata to the
+// stream when it is closed, making a self-contained seekable file that
+// OpenContainer reads. Unlike an index in a sidecar file, it cannot get
+// lost, and unlike metadata in the header it has no size limit.
+//
+// The file remains a valid gzip file: each block is written as a gzip
+// member of its own, and the metadata is stored in empty gzip members
+// after the data, so other tools decompress the data and skip the index.
+// The settings must not be changed with SetConcurrency. They are kept
+// across Reset, which starts a new container. If w is an io.WriteSeeker,
+// such as an *os.File, Close also records the size of the data and of the
+// container in the header, and leaves w at the end of the container.
+func NewContainerWriter(w io.Writer, level, blockSize int) (*Writer, error) {
+	z, err := NewWriterLevel(w, level)
+	if err != nil {
+		return nil, err
+	}
+	if blockSize <= 0 {
+		return nil, errors.New("gzip: block size must be positive")
+	}
+	if err := z.SetConcurrency(blockSize, runtime.GOMAXPROCS(0)); err != nil {
+		return nil, err
+	}
+	z.container = true
+	z.startContainer(w)
+	return z, nil
+}
+
+// startContainer records where the container written to w starts, so that
+// Close can write the index pointer, see NewContainerWriter.
+func (z *Writer) startContainer(w io.Writer) {
+	z.containerAt = -1
+	if ws, ok := w.(io.WriteSeeker); ok {
+		if off, err := ws.Seek(0, io.SeekCurrent); err == nil {
+			z.containerAt = off
+		}
+	}
+}
+
+// startMember returns buf, the compressed data starting a block of a
+// container, preceded by the end of the member holding the previous block
+// and the header of the member holding this one.
+func (z *Writer) startMember(buf []byte) []byte {
+	m := make([]byte, 0, len(eofMarker)+8+len(z.memberHeader)+len(buf))
+	m = append(m, eofMarker...)
+	var trailer [8]byte
+	put4(trailer[0:4], z.memberCRC)
+	put4(trailer[4:8], z.memberLen)
+	m = append(m, trailer[:]...)
+	m = append(m, z.memberHeader...)
+	m = append(m, buf...)
+	z.dstPool.Put(buf)
+	return m
+}
+
+// writeContainerIndex writes the index members and the footer after the
+// data member, see NewContainerWriter.
+func (z *Writer) writeContainerIndex() error {
+	meta := z.MetaData()
+	var idx bytes.Buffer
+	if err := EncodeIndex(&idx, &meta); err != nil {
+		return err
+	}
+	dataLen := int64(8) // the trailer
+	for _, d := range meta.BlockData {
+		dataLen += int64(d)
+	}
+	indexLen := idx.Len()
+	length := dataLen + containerFooter
+	for idx.Len() > 0 {
+		m := emptyMember("SI", idx.Next(containerChunk))
+		if _, err := z.w.Write(m); err != nil {
+			return err
+		}
+		length += int64(len(m))
+	}
+	footer := make([]byte, 20)
+	copy(footer, containerMagic)
+	binary.LittleEndian.PutUint64(footer[4:12], uint64(dataLen))
+	binary.LittleEndian.PutUint64(footer[12:20], uint64(indexLen))
+	if _, err := z.w.Write(emptyMember("SF", footer)); err != nil {
+		return err
+	}
+	return z.writeIndexPointer(meta.Size, length)
+}
+
+// emptyMember returns a gzip member without data whose FEXTRA field holds
+// a single subfield with the given ID and data.
+func emptyMember(id string, data []byte) []byte {
+	m := make([]byte, 0, 12+4+len(data)+10)
+	m = append(m, gzipID1, gzipID2, gzipDeflate, flagExtra, 0, 0, 0, 0, 0, 255)
+	m = append(m, byte(len(data)+4), byte((len(data)+4)>>8))
+	m = append(m, id[0], id[1], byte(len(data)), byte(len(data)>>8))
+	m = append(m, data...)
+	// An empty final block with fixed codes, and the trailer of no data.
+	return append(m, 3, 0, 0, 0, 0, 0, 0, 0, 0, 0)
+}
+
+// OpenContainer returns a Reader for a file written by NewContainerWriter,
+// using the metadata stored in it. The size of ra must be known: it must
+// have a Size method, as *bytes.Reader and *io.SectionReader do, or be an
+// *os.File. The Reader reads ra as NewRandomReader does. An error wrapping
+// ErrIndex is returned if ra does not end with a valid index.
+//
+// NewReader does the same for a container whose header holds an index
+// pointer, if its source is an io.ReaderAt.
+func OpenContainer(ra io.ReaderAt) (*Reader, error) {
+	size, err := readerAtSize(ra)
+	if err != nil {
+		return nil, err
+	}
+	return openContainer(ra, size)
+}
+
+// readerAtSize returns the size of ra, see OpenContainer.
+func readerAtSize(ra io.ReaderAt) (int64, error) {
+	switch s := ra.(type) {
+	case interface{ Size() int64 }:
+		return s.Size(), nil
+	case *os.File:
+		fi, err := s.Stat()
+		if err != nil {
+			return 0, err
+		}
+		return fi.Size(), nil
+	}
+	return 0, errors.New("gzip: container size unknown")
+}
+
+// openContainer implements OpenContainer for a container of size bytes.
+func openContainer(ra io.ReaderAt, size int64) (*Reader, error) {
+	if size < containerFooter {
+		return nil, fmt.Errorf("%w: no container footer", ErrIndex)
+	}
+	footer := make([]byte, containerFooter)
+	if n, err := ra.ReadAt(footer, size-containerFooter); n < len(footer) {
+		return nil, noEOF(err)
+	}
+	fields, err := memberFields(footer)
+	if err != nil || len(fields) != 1 || string(fields[0].id[:]) != "SF" || len(fields[0].data) != 20 || string(fields[0].data[:4]) != containerMagic {
+		return nil, fmt.Errorf("%w: no container footer", ErrIndex)
+	}
+	dataLen := int64(binary.LittleEndian.Uint64(fields[0].data[4:12]))
+	indexLen := int64(binary.LittleEndian.Uint64(fields[0].data[12:20]))
+	if dataLen < 0 || indexLen < 0 || dataLen > size-containerFooter {
+		return nil, fmt.Errorf("%w: container footer out of range", ErrIndex)
+	}
+
+	members := make([]byte, size-containerFooter-dataLen)
+	if n, err := ra.ReadAt(members, dataLen); n < len(members) {
+		return nil, noEOF(err)
+	}
+	var idx bytes.Buffer
+	for len(members) > 0 {
+		n := 12 + 4 + 10
+		if len(members) >= 12 {
+			n += int(binary.LittleEndian.Uint16(members[10:12])) - 4
+		}
+		if n > len(members) {
+			return nil, fmt.Errorf("%w: truncated index member", ErrIndex)
+		}
+		fields, err := memberFields(members[:n])
+		if err != nil || len(fields) != 1 || string(fields[0].id[:]) != "SI" {
+			return nil, fmt.Errorf("%w: invalid index member", ErrIndex)
+		}
+		idx.Write(fields[0].data)
+		members = members[n:]
+	}
+	if int64(idx.Len()) != indexLen {
+		return nil, fmt.Errorf("%w: index has %d bytes, footer says %d", ErrIndex, idx.Len(), indexLen)
+	}
+	meta, err := DecodeIndex(&idx)
+	if err != nil {
+		return nil, err
+	}
+	z, err := NewRandomReader(io.NewSectionReader(ra, 0, dataLen), &meta)
+	if err != nil {
+		return nil, err
+	}
+	// Read all of the data members.
+	z.Multistream(true)
+	return z, nil
+}
+
+// memberFields returns the subfields of the FEXTRA field of m, which must
+// be a complete member without data, as written by emptyMember.
+func memberFields(m []byte) ([]subfield, error) {
+	hdr, err := ReadHeader(bytes.NewReader(m))
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasSuffix(m, []byte{3, 0, 0, 0, 0, 0, 0, 0, 0, 0}) || len(m) != 12+len(hdr.Extra)+10 {
+		return nil, ErrHeader
+	}
+	fields, ok := splitSubfields(hdr.Extra)
+	if !ok {
+		return nil, ErrHeader
+	}
+	return fields, nil
+}
@@ -0,0 +1,204 @@
+package sgzip
+
+import (
+	"bufio"
+	"bytes"
+	oldgz "compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestContainer(t *testing.T) {
+	for _, tt := range []struct {
+		size, blockSize int
+	}{
+		{0, 16 << 10},
+		{300000, 16 << 10},
+		// An index of more than one member.
+		{2 << 20, 128},
+	} {
+		in := levelTestData(tt.size)
+		var buf bytes.Buffer
+		w, err := NewContainerWriter(&buf, BestSpeed, tt.blockSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(in)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		file := buf.Bytes()
+
+		// Other tools see the data only.
+		zr, err := oldgz.NewReader(bytes.NewReader(file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(zr)
+		if err != nil || !bytes.Equal(got, in) {
+			t.Errorf("size %d: compress/gzip: got %d bytes, %v", tt.size, len(got), err)
+		}
+
+		// Each block is a member of its own.
+		members, err := ListMembers(bytes.NewReader(file))
+		if err != nil {
+			t.Fatalf("size %d: %v", tt.size, err)
+		}
+		blocks := (tt.size + tt.blockSize - 1) / tt.blockSize
+		if blocks == 0 {
+			blocks = 1
+		}
+		if len(members) < blocks+1 {
+			t.Fatalf("size %d: %d members, want %d for the data and the index", tt.size, len(members), blocks)
+		}
+		for i, m := range members[:blocks] {
+			want := tt.size - i*tt.blockSize
+			if want > tt.blockSize {
+				want = tt.blockSize
+			}
+			if m.Size != int64(want) {
+				t.Errorf("size %d: member %d holds %d bytes, want %d", tt.size, i, m.Size, want)
+			}
+		}
+
+		r, err := OpenContainer(bytes.NewReader(file))
+		if err != nil {
+			t.Fatalf("size %d: %v", tt.size, err)
+		}
+		if r.Info().Size != int64(tt.size) {
+			t.Errorf("size %d: Size = %d", tt.size, r.Info().Size)
+		}
+		for _, pos := range []int64{int64(tt.size) / 2, 0, int64(tt.size)} {
+			if _, err := r.Seek(pos, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(r)
+			if err != nil || !bytes.Equal(got, in[pos:]) {
+				t.Errorf("size %d: read from %d: got %d bytes, %v", tt.size, pos, len(got), err)
+			}
+		}
+		r.Close()
+	}
+
+	// Reset starts a new container.
+	var buf bytes.Buffer
+	w, _ := NewContainerWriter(ioutil.Discard, BestSpeed, 16<<10)
+	w.Write([]byte("discarded"))
+	w.Close()
+	w.Reset(&buf)
+	w.Write([]byte("container"))
+	w.Close()
+	file := buf.Bytes()
+	r, err := OpenContainer(bytes.NewReader(file))
+	if err != nil {
+		t.Fatalf("after Reset: %v", err)
+	}
+	if got, err := ioutil.ReadAll(r); err != nil || string(got) != "container" {
+		t.Errorf("after Reset: got %q, %v", got, err)
+	}
+	r.Close()
+	// A full read of the footer may come with io.EOF.
+	r, err = OpenContainer(eofReaderAt(file))
+	if err != nil {
+		t.Fatalf("io.EOF with full reads: %v", err)
+	}
+	if got, err := ioutil.ReadAll(r); err != nil || string(got) != "container" {
+		t.Errorf("io.EOF with full reads: got %q, %v", got, err)
+	}
+	r.Close()
+	for _, bad := range [][]byte{
+		file[:len(file)-1],
+		file[:len(file)-containerFooter-1],
+		append(append([]byte{}, file[:len(file)-containerFooter-5]...), file[len(file)-containerFooter:]...),
+	} {
+		if _, err := OpenContainer(bytes.NewReader(bad)); !errors.Is(err, ErrIndex) {
+			t.Errorf("%d bytes of %d: got %v, want ErrIndex", len(bad), len(file), err)
+		}
+	}
+	if _, err := OpenContainer(struct{ io.ReaderAt }{bytes.NewReader(file)}); err == nil {
+		t.Error("expected error for a source of unknown size")
+	}
+}
+
+func TestContainerIndexPointer(t *testing.T) {
+	in := levelTestData(500000)
+	f, err := os.Create(filepath.Join(t.TempDir(), "c.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Write([]byte("prefix"))
+	w, err := NewContainerWriter(f, BestSpeed, 64<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Name = "data"
+	w.Write(in)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	end, _ := f.Seek(0, io.SeekCurrent)
+	fi, _ := f.Stat()
+	if end != fi.Size() {
+		t.Errorf("file left at %d, want %d", end, fi.Size())
+	}
+	// Data after the container does not confuse the pointer.
+	f.Write([]byte("suffix"))
+
+	f.Seek(6, io.SeekStart)
+	hdr, err := ReadHeader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, length, ok := indexPointer(hdr.Extra)
+	if !ok || size != int64(len(in)) || length != end-6 {
+		t.Errorf("index pointer = %d, %d, %v, want %d, %d", size, length, ok, len(in), end-6)
+	}
+
+	f.Seek(6, io.SeekStart)
+	r, err := NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.CanSeek(0) || r.Name != "data" {
+		t.Fatalf("NewReader did not use the index: CanSeek = %v, Name = %q", r.CanSeek(0), r.Name)
+	}
+	if _, err := r.Seek(-1000, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(got, in[len(in)-1000:]) {
+		t.Errorf("read after Seek: got %d bytes, %v", len(got), err)
+	}
+	r.Close()
+
+	// Without a seekable output the pointer is empty, and the index is
+	// found at the end of the file.
+	var buf bytes.Buffer
+	w, _ = NewContainerWriter(&buf, BestSpeed, 64<<10)
+	w.Write(in)
+	w.Close()
+	r, err = NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.CanSeek(0) {
+		t.Error("NewReader did not use the index of a bytes.Reader")
+	}
+	r.Close()
+	r, err = NewReader(bufio.NewReader(bytes.NewReader(buf.Bytes())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.CanSeek(0) {
+		t.Error("NewReader used the index of a stream")
+	}
+	got, err = ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(got, in) {
+		t.Errorf("stream: got %d bytes, %v", len(got), err)
+	}
+}
@@ -0,0 +1,57 @@
+package sgzip
+
+import (
+	"context"
+	"io"
+)
+
+// WriteToContext is like WriteTo, but stops when ctx is done and then
+// returns ctx.Err(), leaving the Reader unusable until Reset or Seek, like
+// any other error of WriteTo.
+//
+// The goroutine decompressing ahead of WriteTo is told to stop as well and
+// exits once the block it is decompressing is done; it is not waited for,
+// so a read of the source that does not return keeps it running, see
+// SetBlockReadTimeout. ctx is checked before each block is written to w,
+// so a write to w that does not return is not interrupted either.
+func (z *Reader) WriteToContext(ctx context.Context, w io.Writer) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	z.ctx = ctx
+	defer func() { z.ctx = nil }()
+	return z.WriteTo(w)
+}
+
+// receive returns the next block decompressed ahead, or the error of the
+// context of WriteToContext once it is done, which also stops reading
+// ahead.
+func (z *Reader) receive() (read, error) {
+	if z.ctx == nil {
+		return <-z.readAhead, nil
+	}
+	var r read
+	err := z.ctx.Err()
+	if err == nil {
+		select {
+		case r = <-z.readAhead:
+			return r, nil
+		case <-z.ctx.Done():
+			err = z.ctx.Err()
+		}
+	}
+	z.stopReadAhead()
+	z.err = err
+	return r, err
+}
+
+// stopReadAhead tells the read-ahead goroutine to stop, without waiting
+// for it as killReadAhead does; killReadAhead collects its result later.
+func (z *Reader) stopReadAhead() {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.activeRA && z.closeReader != nil {
+		close(z.closeReader)
+		z.closeReader = nil
+	}
+}
@@ -0,0 +1,132 @@
+package sgzip
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// cancelReaderAt cancels a context once after reads ReadAt calls.
+type cancelReaderAt struct {
+	ra     io.ReaderAt
+	reads  int64
+	n      int64
+	cancel context.CancelFunc
+}
+
+func (c *cancelReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if atomic.AddInt64(&c.n, 1) == c.reads {
+		c.cancel()
+	}
+	return c.ra.ReadAt(p, off)
+}
+
+// cancelWriter cancels a context once more than after bytes have been
+// written to it.
+type cancelWriter struct {
+	after  int
+	n      int
+	cancel context.CancelFunc
+}
+
+func (c *cancelWriter) Write(p []byte) (int, error) {
+	c.n += len(p)
+	if c.n > c.after {
+		c.cancel()
+	}
+	return len(p), nil
+}
+
+// checkGoroutines fails t if more goroutines than before are still running
+// after a while.
+func checkGoroutines(t *testing.T, before int) {
+	t.Helper()
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("%d goroutines left running, %d before", n, before)
+	}
+}
+
+func TestVerifyContext(t *testing.T) {
+	_, comp, meta := testSeekableData(t, 1<<20, 8<<10)
+	if err := VerifyContext(context.Background(), bytes.NewReader(comp), &meta, 4); err != nil {
+		t.Fatal(err)
+	}
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cra := &cancelReaderAt{ra: bytes.NewReader(comp), reads: 10, cancel: cancel}
+	if err := VerifyContext(ctx, cra, &meta, 4); err != context.Canceled {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	// Each worker finishes at most the block it was verifying.
+	if n := atomic.LoadInt64(&cra.n); n > 10+4 {
+		t.Errorf("read %d of %d blocks after cancelling at 10", n, meta.NumBlocks())
+	}
+	checkGoroutines(t, before)
+
+	if err := VerifyContext(ctx, bytes.NewReader(comp), &meta, 4); err != context.Canceled {
+		t.Errorf("done context: got %v, want context.Canceled", err)
+	}
+
+	// Cancelling at any point, including after the last block was handed
+	// out, reports the cancellation and never a checksum error.
+	for reads := int64(1); reads <= int64(meta.NumBlocks()); reads++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		cra := &cancelReaderAt{ra: bytes.NewReader(comp), reads: reads, cancel: cancel}
+		if err := VerifyContext(ctx, cra, &meta, 4); err != nil && err != context.Canceled {
+			t.Fatalf("cancelled at block read %d: %v", reads, err)
+		}
+		cancel()
+	}
+}
+
+func TestWriteToContext(t *testing.T) {
+	in, comp, meta := testSeekableData(t, 1<<20, 8<<10)
+	var buf bytes.Buffer
+	r, err := NewSeekingReader(bytes.NewReader(comp), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.WriteToContext(context.Background(), &buf); err != nil || !bytes.Equal(buf.Bytes(), in) {
+		t.Fatalf("got %d bytes, %v", buf.Len(), err)
+	}
+
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	r.SetConcurrency(8<<10, 4)
+	cw := &cancelWriter{after: 100 << 10, cancel: cancel}
+	n, err := r.WriteToContext(ctx, cw)
+	if err != context.Canceled {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	if n != int64(cw.n) || n > 100<<10+8<<10 {
+		t.Errorf("wrote %d bytes, %d passed to the writer", n, cw.n)
+	}
+	checkGoroutines(t, before)
+	if _, err := r.Read(make([]byte, 1)); err != context.Canceled {
+		t.Errorf("Read after cancel: got %v, want context.Canceled", err)
+	}
+
+	// The Reader can be used again after a Seek.
+	buf.Reset()
+	if _, err := r.Seek(n, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.WriteTo(&buf); err != nil || !bytes.Equal(buf.Bytes(), in[n:]) {
+		t.Errorf("after Seek: got %d bytes, %v", buf.Len(), err)
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package sgzip
+
+import (
+	"bufio"
+	"io"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/flate"
+)
+
+// Counters returns the number of compressed bytes consumed from the source
+// and the number of uncompressed bytes produced since the Reader was
+// created or last Reset. uncompressed is DecodedBytes. compressed counts
+// the header, the compressed data and the trailer of each member read, but
+// not data skipped by Seek, so after reading a stream to the end,
+// uncompressed/compressed is its compression ratio.
+//
+// Both grow as reading proceeds; data decompressed ahead of the caller is
+// counted once it has been decompressed. compressed is 0 for sources that
+// are read directly and whose position cannot be told without slowing
+// down reading, which are the io.ByteReader sources other than
+// *bytes.Reader, *bytes.Buffer and *strings.Reader, such as a
+// *bufio.Reader. Like DecodedBytes, Counters may be called concurrently
+// with reads.
+func (z *Reader) Counters() (compressed, uncompressed int64) {
+	return atomic.LoadInt64(&z.consumed), atomic.LoadInt64(&z.decoded)
+}
+
+// countInput adds the input consumed since the last call to the count
+// returned by Counters. It must be called by the goroutine reading the
+// source.
+func (z *Reader) countInput() {
+	if off, ok := z.inputOffset(); ok {
+		atomic.AddInt64(&z.consumed, off-z.inputLast)
+		z.inputLast = off
+	}
+}
+
+// restartInputCount makes countInput count from the current position,
+// after the source has been replaced or repositioned.
+func (z *Reader) restartInputCount() {
+	z.inputLast, _ = z.inputOffset()
+}
+
+// inputOffset returns a position in the source that grows with the input
+// consumed by the decompressor, if there is one. Only differences between
+// positions are meaningful.
+func (z *Reader) inputOffset() (int64, bool) {
+	if z.input != nil {
+		if br, ok := z.bufr.(*bufio.Reader); ok {
+			return z.input.n - int64(br.Buffered()), true
+		}
+	}
+	switch s := z.bufr.(type) {
+	case *byteSeekTracker:
+		return s.pos, s.known
+	case *byteCounter:
+		return s.n, true
+	}
+	return 0, false
+}
+
+// lenByteScanner is implemented by *bytes.Reader, *bytes.Buffer and
+// *strings.Reader, which are read directly and wrapped in a byteCounter.
+type lenByteScanner interface {
+	io.Reader
+	io.ByteScanner
+	Len() int
+}
+
+// countBytes wraps r in a byteCounter if it is one of the sources read
+// directly whose position is known.
+func countBytes(r flate.Reader) flate.Reader {
+	if s, ok := r.(lenByteScanner); ok {
+		return &byteCounter{r: s}
+	}
+	return r
+}
+
+// byteCounter counts the bytes read from r. The count belongs to the
+// goroutine reading, so that the source itself is never asked for its
+// position while another goroutine may use it.
+type byteCounter struct {
+	r lenByteScanner
+	n int64
+}
+
+func (c *byteCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *byteCounter) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
+
+func (c *byteCounter) UnreadByte() error {
+	err := c.r.UnreadByte()
+	if err == nil {
+		c.n--
+	}
+	return err
+}
+
+// inputCounter counts the bytes read from r, below the buffer of a Reader.
+type inputCounter struct {
+	r io.Reader
+	n int64
+}
+
+func (c *inputCounter) Read(p []byte) (int, error) {
+	n, err := readSource(c.r, p, nil)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,71 @@
+package sgzip
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestCounters(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 300000, 16<<10)
+	two := append(append([]byte{}, compressed...), compressed...)
+
+	for _, tt := range []struct {
+		name string
+		src  func() io.Reader
+		comp int64
+		size int64
+	}{
+		{"bytes.Reader", func() io.Reader { return bytes.NewReader(compressed) }, int64(len(compressed)), int64(len(in))},
+		{"bytes.Buffer", func() io.Reader { return bytes.NewBuffer(compressed) }, int64(len(compressed)), int64(len(in))},
+		{"buffered here", func() io.Reader { return struct{ io.Reader }{bytes.NewReader(compressed)} }, int64(len(compressed)), int64(len(in))},
+		{"two members", func() io.Reader { return struct{ io.Reader }{bytes.NewReader(two)} }, int64(len(two)), 2 * int64(len(in))},
+		{"bufio.Reader", func() io.Reader { return bufio.NewReader(bytes.NewReader(compressed)) }, 0, int64(len(in))},
+	} {
+		r, err := NewReader(tt.src())
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan struct{})
+		go func() {
+			// Counters may be called while reading.
+			defer close(done)
+			r.Counters()
+		}()
+		if _, err := io.Copy(ioutil.Discard, r); err != nil {
+			t.Fatal(err)
+		}
+		<-done
+		if comp, size := r.Counters(); comp != tt.comp || size != tt.size {
+			t.Errorf("%s: Counters = %d, %d, want %d, %d", tt.name, comp, size, tt.comp, tt.size)
+		}
+
+		if err := r.Reset(tt.src()); err != nil {
+			t.Fatal(err)
+		}
+		if comp, size := r.Counters(); size != 0 || comp > 100 {
+			t.Errorf("%s: after Reset: Counters = %d, %d, want the header only", tt.name, comp, size)
+		}
+		r.Close()
+	}
+
+	// Data skipped by Seek is not counted.
+	r, err := NewSeekingReader(bytes.NewReader(compressed), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := r.Seek(200000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		t.Fatal(err)
+	}
+	blockStarts := parseBlockData(meta.BlockData, meta.BlockSize)
+	want := int64(len(compressed)) - blockStarts[200000/(16<<10)] + blockStarts[0]
+	if comp, size := r.Counters(); comp != want || size < 100000 || size > 100000+16<<10 {
+		t.Errorf("after Seek: Counters = %d, %d, want %d and about 100000", comp, size, want)
+	}
+}
@@ -0,0 +1,96 @@
+package sgzip
+
+import (
+	"errors"
+	"hash"
+	"hash/crc32"
+)
+
+// crcCheck is the CRC-32 (IEEE) of "123456789", the standard check value.
+const crcCheck = 0xcbf43926
+
+// checkCRC32Func returns an error unless the hashes created by f compute
+// the gzip checksum, both in one call and when data is written in parts.
+func checkCRC32Func(f func() hash.Hash32) error {
+	h := f()
+	if h == nil {
+		return errors.New("gzip: CRC-32 function returned nil")
+	}
+	data := []byte("123456789")
+	h.Write(data)
+	if h.Sum32() != crcCheck {
+		return errors.New("gzip: CRC-32 function does not compute the IEEE checksum")
+	}
+	h.Reset()
+	h.Write(data[:4])
+	h.Write(data[4:])
+	if h.Sum32() != crcCheck {
+		return errors.New("gzip: CRC-32 function does not compute the IEEE checksum")
+	}
+	return nil
+}
+
+// SetCRC32Func makes the Writer compute checksums with hashes created by
+// f, such as an implementation using CRC instructions of the CPU, instead
+// of hash/crc32. The hashes must compute the IEEE CRC-32 used by gzip, so
+// the output does not change; an error is returned if f fails a check of
+// that. A nil f restores the default.
+//
+// hash/crc32 already uses such instructions on amd64, arm64 and s390x.
+// It must be called before the first Write and is kept across Reset.
+func (z *Writer) SetCRC32Func(f func() hash.Hash32) error {
+	if z.wroteHeader {
+		return errors.New("gzip: SetCRC32Func called after Write")
+	}
+	if f == nil {
+		z.newCRC = nil
+		z.digest = crc32.NewIEEE()
+		return nil
+	}
+	if err := checkCRC32Func(f); err != nil {
+		return err
+	}
+	z.newCRC = f
+	z.digest = f()
+	return nil
+}
+
+// blockChecksum returns the checksum of the block p.
+func (z *Writer) blockChecksum(p []byte) uint32 {
+	if z.newCRC == nil {
+		return crc32.ChecksumIEEE(p)
+	}
+	h := z.newCRC()
+	h.Write(p)
+	return h.Sum32()
+}
+
+// SetCRC32Func makes the Reader verify the data with hashes created by f
+// instead of hash/crc32, as Writer.SetCRC32Func does for writing. A nil f
+// restores the default.
+//
+// It must be called before reading, or after Reset or Seek; it returns an
+// error while decompression is under way. It is kept across Reset.
+func (z *Reader) SetCRC32Func(f func() hash.Hash32) error {
+	if f != nil {
+		if err := checkCRC32Func(f); err != nil {
+			return err
+		}
+	}
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.activeRA {
+		return errors.New("gzip: SetCRC32Func called while reading")
+	}
+	z.newCRC = f
+	z.digest = z.newDigest()
+	return nil
+}
+
+// newDigest returns a hash for the checksum of the data.
+func (z *Reader) newDigest() hash.Hash32 {
+	if z.newCRC == nil {
+		return crc32.NewIEEE()
+	}
+	return z.newCRC()
+}
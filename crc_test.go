@@ -0,0 +1,98 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+)
+
+// countingHash counts the bytes written to a CRC-32 hash. The Writer
+// hashes blocks concurrently.
+type countingHash struct {
+	hash.Hash32
+	n *int64
+}
+
+func (h countingHash) Write(p []byte) (int, error) {
+	atomic.AddInt64(h.n, int64(len(p)))
+	return h.Hash32.Write(p)
+}
+
+func TestSetCRC32Func(t *testing.T) {
+	in := levelTestData(3 << 20)
+	var want bytes.Buffer
+	w := NewWriter(&want)
+	w.SetConcurrency(256<<10, 4)
+	w.Write(in)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var written int64
+	f := func() hash.Hash32 { return countingHash{crc32.NewIEEE(), &written} }
+	var got bytes.Buffer
+	w = NewWriter(&got)
+	w.SetConcurrency(256<<10, 4)
+	if err := w.SetCRC32Func(f); err != nil {
+		t.Fatal(err)
+	}
+	w.Write(in)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Error("output differs from the default checksum")
+	}
+	if atomic.LoadInt64(&written) < int64(len(in)) {
+		t.Errorf("custom hash saw %d bytes, want at least %d", written, len(in))
+	}
+	if err := w.SetCRC32Func(f); err == nil {
+		t.Error("SetCRC32Func after Write: expected error")
+	}
+
+	atomic.StoreInt64(&written, 0)
+	r, err := NewReader(bytes.NewReader(got.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetCRC32Func(f); err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, in) {
+		t.Error("decompressed data differs")
+	}
+	// The header is hashed as well.
+	if atomic.LoadInt64(&written) < int64(len(in)) {
+		t.Errorf("custom hash saw %d bytes, want at least %d", written, len(in))
+	}
+
+	// The function is kept across Reset and still catches corrupt data.
+	corrupt := append([]byte{}, got.Bytes()...)
+	corrupt[len(corrupt)-6]++
+	atomic.StoreInt64(&written, 0)
+	if err := r.Reset(bytes.NewReader(corrupt)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(r); !errors.Is(err, ErrChecksum) {
+		t.Errorf("corrupt trailer: got %v, want ErrChecksum", err)
+	}
+	if atomic.LoadInt64(&written) < int64(len(in)) {
+		t.Errorf("after Reset, custom hash saw %d bytes, want at least %d", written, len(in))
+	}
+
+	bad := func() hash.Hash32 { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) }
+	if err := NewWriter(ioutil.Discard).SetCRC32Func(bad); err == nil {
+		t.Error("Writer accepted a CRC-32C function")
+	}
+	if err := r.SetCRC32Func(bad); err == nil {
+		t.Error("Reader accepted a CRC-32C function")
+	}
+}
@@ -0,0 +1,52 @@
+package sgzip
+
+import "errors"
+
+// ChangedBlocks returns the indexes, in increasing order, of the blocks of
+// the stream described by newMeta whose data differs from that of the
+// block with the same index in the stream described by oldMeta, for
+// updating a copy of the old stream: only the compressed ranges of the
+// returned blocks, given by newMeta.BlockInfo, need to be fetched from the
+// new stream. A block differs if the old stream has no block at its index,
+// if it holds a different number of bytes or starts at a different
+// uncompressed offset, or if its checksum differs. Data inserted or
+// removed thus changes every block after it. Empty blocks, such as the
+// one ending streams written by Writer, only differ in length.
+//
+// Both metadata must have a checksum for every block, which Writer
+// records; an error is returned otherwise, since the blocks cannot be
+// compared without decompressing them. Like FirstDifferenceByChecksum,
+// ChangedBlocks trusts the checksums: different data has the same CRC-32
+// with a chance of about 1 in 4 billion per block.
+func ChangedBlocks(oldMeta, newMeta GzipMetadata) ([]int, error) {
+	if err := checkVersion(&oldMeta); err != nil {
+		return nil, err
+	}
+	if err := checkVersion(&newMeta); err != nil {
+		return nil, err
+	}
+	if !hasBlockCRC(&oldMeta) || !hasBlockCRC(&newMeta) {
+		return nil, errors.New("gzip: metadata does not have a checksum for every block")
+	}
+	var changed []int
+	var oldOff, newOff int64
+	for i := 0; i < newMeta.NumBlocks(); i++ {
+		newLen := blockLen(&newMeta, i)
+		if i >= oldMeta.NumBlocks() {
+			changed = append(changed, i)
+			continue
+		}
+		oldLen := blockLen(&oldMeta, i)
+		if (oldOff != newOff && newLen > 0) || oldLen != newLen || oldMeta.BlockCRC[i] != newMeta.BlockCRC[i] {
+			changed = append(changed, i)
+		}
+		oldOff += oldLen
+		newOff += newLen
+	}
+	return changed, nil
+}
+
+// hasBlockCRC reports whether meta has a checksum for every block.
+func hasBlockCRC(meta *GzipMetadata) bool {
+	return meta.NumBlocks() > 0 && len(meta.BlockCRC) == meta.NumBlocks()
+}
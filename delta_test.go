@@ -0,0 +1,84 @@
+package sgzip
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestChangedBlocks(t *testing.T) {
+	compress := func(data []byte) ([]byte, GzipMetadata) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.SetConcurrency(1000, 2)
+		w.Write(data)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes(), w.MetaData()
+	}
+	old := levelTestData(10000)
+	_, oldMeta := compress(old)
+
+	edited := append([]byte(nil), old...)
+	edited[1500]++
+	edited[7999]++
+	grown := append(append([]byte(nil), old...), "more data"...)
+	inserted := append(append(append([]byte(nil), old[:4500]...), 'x'), old[4500:]...)
+	tests := []struct {
+		name string
+		data []byte
+		want []int
+	}{
+		{"same", old, nil},
+		{"edited", edited, []int{1, 7}},
+		// The old stream ends with the empty marker block 10.
+		{"grown", grown, []int{10, 11}},
+		{"truncated", old[:9500], []int{9}},
+		{"inserted", inserted, []int{4, 5, 6, 7, 8, 9, 10, 11}},
+	}
+	for _, tt := range tests {
+		comp, newMeta := compress(tt.data)
+		got, err := ChangedBlocks(oldMeta, newMeta)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+		// Patching the changed blocks into the old data gives the new.
+		r, err := NewRandomReader(bytes.NewReader(comp), &newMeta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		patched := append([]byte(nil), old...)
+		for _, i := range got {
+			info, _ := newMeta.BlockInfo(i)
+			block := make([]byte, info.UncompressedLength)
+			if _, err := r.Seek(info.UncompressedOffset, io.SeekStart); err != nil {
+				t.Fatalf("%s: block %d: %v", tt.name, i, err)
+			}
+			if _, err := io.ReadFull(r, block); err != nil {
+				t.Fatalf("%s: block %d: %v", tt.name, i, err)
+			}
+			for int64(len(patched)) < info.UncompressedOffset+info.UncompressedLength {
+				patched = append(patched, 0)
+			}
+			copy(patched[info.UncompressedOffset:], block)
+		}
+		if !bytes.Equal(patched[:newMeta.Size], tt.data) {
+			t.Errorf("%s: patched data differs", tt.name)
+		}
+		r.Close()
+	}
+
+	noCRC := oldMeta
+	noCRC.BlockCRC = nil
+	if _, err := ChangedBlocks(noCRC, oldMeta); err == nil {
+		t.Error("no checksums: no error")
+	}
+	if _, err := ChangedBlocks(oldMeta, noCRC); err == nil {
+		t.Error("no checksums: no error")
+	}
+}
@@ -0,0 +1,23 @@
+package sgzip
+
+import (
+	"io"
+	"io/ioutil"
+)
+
+// discard skips n bytes of data, or the rest of the stream if n is
+// negative, and returns the number of bytes skipped, with io.EOF if the
+// stream ends before n bytes. The blocks are passed over as WriteTo
+// passes them to ioutil.Discard, without the copy into a buffer that a
+// loop of Read calls makes, and their checksums are verified as usual.
+func (z *Reader) discard(n int64) (int64, error) {
+	if n < 0 {
+		n, err := z.WriteTo(ioutil.Discard)
+		if err == io.EOF {
+			// Left by an earlier end of the stream.
+			err = nil
+		}
+		return n, err
+	}
+	return z.WriteToN(ioutil.Discard, n)
+}
@@ -0,0 +1,40 @@
+package sgzip
+
+import "errors"
+
+// SetOmitEmpty makes the metadata of a stream holding no data describe
+// no blocks at all, instead of the empty final block that ends the
+// stream. Close still writes a complete gzip stream: the header, the
+// empty final block and the trailer. BlockData then has a single entry
+// covering the header and the final block, so that it still adds up to
+// the length of the stream, and BlockCRC and BlockLens are empty. Empty
+// writes and Flush do not count as data.
+//
+// By default, the metadata of a Writer closed without data holds the
+// length of the header and of the final block in BlockData, describing
+// one empty block. Streams written by NewContainerWriter and
+// CreateSeekable store their index in the stream, which describes the
+// final block, and SetOmitEmpty returns an error for them.
+//
+// It must be called before the first Write and is kept across Reset.
+func (z *Writer) SetOmitEmpty(ok bool) error {
+	if z.wroteHeader {
+		return errors.New("gzip: SetOmitEmpty called after Write")
+	}
+	if ok && (z.container || z.index != nil) {
+		return errors.New("gzip: SetOmitEmpty cannot be used with an index")
+	}
+	z.omitEmpty = ok
+	return nil
+}
+
+// omitBlocks merges the blocks of a stream holding no data into the entry
+// of the header, see SetOmitEmpty.
+func (z *Writer) omitBlocks() {
+	var n uint32
+	for _, d := range z.blockData {
+		n += d
+	}
+	z.blockData = []uint32{n}
+	z.blockCRC, z.blockLens = nil, nil
+}
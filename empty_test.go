@@ -0,0 +1,99 @@
+package sgzip
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+// TestEmptyInput checks that closing a Writer without data writes a
+// stream of the same shape as emptyStream: a header, an empty final block
+// and the trailer.
+func TestEmptyInput(t *testing.T) {
+	for _, level := range []int{NoCompression, BestSpeed, DefaultCompression, BestCompression, HuffmanOnly} {
+		var buf bytes.Buffer
+		w, err := NewWriterLevel(&buf, level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		meta := w.MetaData()
+		want := []uint32{10, uint32(len(eofMarker))}
+		if meta.Size != 0 || meta.BlockSize != defaultBlockSize || !reflect.DeepEqual(meta.BlockData, want) {
+			t.Errorf("level %d: metadata = %+v, want Size 0, BlockSize %d, BlockData %v", level, meta, defaultBlockSize, want)
+		}
+		if got := buf.Len(); got != 10+len(eofMarker)+8 {
+			t.Errorf("level %d: wrote %d bytes, want %d", level, got, 10+len(eofMarker)+8)
+		}
+		if !bytes.Equal(buf.Bytes()[10:], emptyStream.gzip[20:]) {
+			t.Errorf("level %d: stream ends with %x, want %x", level, buf.Bytes()[10:], emptyStream.gzip[20:])
+		}
+		r, err := NewSeekingReader(bytes.NewReader(buf.Bytes()), &meta)
+		if err != nil {
+			t.Fatalf("level %d: NewSeekingReader: %v", level, err)
+		}
+		if got, err := ioutil.ReadAll(r); err != nil || len(got) != 0 {
+			t.Errorf("level %d: read %d bytes, %v", level, len(got), err)
+		}
+		r.Close()
+	}
+}
+
+func TestSetOmitEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.SetOmitEmpty(true); err != nil {
+		t.Fatal(err)
+	}
+	w.Write(nil)
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	meta := w.MetaData()
+	if meta.Size != 0 || meta.BlockSize == 0 || meta.NumBlocks() != 0 || len(meta.BlockCRC) != 0 {
+		t.Errorf("metadata = %+v, want Size 0 and no blocks", meta)
+	}
+	if len(meta.BlockData) != 1 || int(meta.BlockData[0])+8 != buf.Len() {
+		t.Errorf("BlockData = %v for a stream of %d bytes", meta.BlockData, buf.Len())
+	}
+	r, err := NewSeekingReader(bytes.NewReader(buf.Bytes()), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadAll(r); err != nil || len(got) != 0 {
+		t.Errorf("read %d bytes, %v", len(got), err)
+	}
+	r.Close()
+	buf.Reset()
+
+	// The option is kept across Reset, and data is written as usual.
+	w.Reset(&buf)
+	w.Write([]byte("data"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if meta := w.MetaData(); meta.Size != 4 || meta.NumBlocks() == 0 {
+		t.Errorf("metadata = %+v, want Size 4 and blocks", meta)
+	}
+	r, err = NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadAll(r); err != nil || string(got) != "data" {
+		t.Errorf("got %q, %v", got, err)
+	}
+	if err := w.SetOmitEmpty(false); err == nil {
+		t.Error("SetOmitEmpty after Write: expected error")
+	}
+
+	c, _ := NewContainerWriter(ioutil.Discard, BestSpeed, 1<<20)
+	if err := c.SetOmitEmpty(true); err == nil {
+		t.Error("SetOmitEmpty on a container: expected error")
+	}
+}
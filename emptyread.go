@@ -0,0 +1,44 @@
+package sgzip
+
+import (
+	"io"
+	"runtime"
+	"time"
+)
+
+// maxEmptyReadPause is the longest pause between two reads of a source
+// that returned no data and no error.
+const maxEmptyReadPause = 10 * time.Millisecond
+
+// readSource reads from r into p, reading again while r returns no data
+// and no error, which a source such as a ring buffer may do while it
+// waits for data. io.Reader allows it, and it does not mean the end of the
+// data. The first 128 retries yield the processor, later ones pause for
+// increasing times up to maxEmptyReadPause, so a source that stays idle
+// does not keep a core busy. Once stop is closed, readSource gives up
+// retrying and returns no data; a nil stop retries until data arrives.
+func readSource(r io.Reader, p []byte, stop <-chan struct{}) (int, error) {
+	if len(p) == 0 {
+		return r.Read(p)
+	}
+	for i := 0; ; i++ {
+		n, err := r.Read(p)
+		if n > 0 || err != nil {
+			return n, err
+		}
+		select {
+		case <-stop:
+			return 0, nil
+		default:
+		}
+		if i < 128 {
+			runtime.Gosched()
+			continue
+		}
+		pause := time.Duration(i-127) * 100 * time.Microsecond
+		if pause > maxEmptyReadPause {
+			pause = maxEmptyReadPause
+		}
+		time.Sleep(pause)
+	}
+}
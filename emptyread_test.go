@@ -0,0 +1,70 @@
+package sgzip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// idleReader returns no data and no error idle times before each read of
+// at most 7 bytes from r, as a ring buffer waiting for data may do. Once
+// closed is set it returns io.EOF.
+type idleReader struct {
+	r      io.Reader
+	idle   int
+	n      int
+	closed int32
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	if atomic.LoadInt32(&r.closed) != 0 {
+		return 0, io.EOF
+	}
+	if r.n < r.idle {
+		r.n++
+		return 0, nil
+	}
+	r.n = 0
+	if len(p) > 7 {
+		p = p[:7]
+	}
+	return r.r.Read(p)
+}
+
+func TestEmptyReads(t *testing.T) {
+	in := levelTestData(20000)
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Write(in)
+	w.Close()
+	// Two members, so that reading continues after a trailer.
+	w = NewWriter(&buf)
+	w.Write(in[:1000])
+	w.Close()
+	want := append(append([]byte(nil), in...), in[:1000]...)
+
+	for _, idle := range []int{1, 3, 120} {
+		src := &idleReader{r: bytes.NewReader(buf.Bytes()), idle: idle}
+		r, err := NewReader(src)
+		if err != nil {
+			t.Fatalf("idle %d: %v", idle, err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("idle %d: got %d bytes, %v, want %d", idle, len(got), err, len(want))
+		}
+		r.Close()
+	}
+
+	// A source that never sends data times out instead of reading forever.
+	var r Reader
+	r.SetBlockReadTimeout(50 * time.Millisecond)
+	src := &idleReader{r: bytes.NewReader(buf.Bytes()), idle: 1 << 62}
+	if err := r.Reset(src); err != ErrReadTimeout {
+		t.Errorf("idle source: got %v, want ErrReadTimeout", err)
+	}
+	atomic.StoreInt32(&src.closed, 1)
+}
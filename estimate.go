@@ -0,0 +1,63 @@
+package sgzip
+
+import "runtime"
+
+// estimateBlocks is the number of blocks compressed by
+// EstimateCompressedSize before it starts extrapolating.
+const estimateBlocks = 8
+
+// EstimateCompressedSize returns the approximate size of the output a
+// Writer with the given compression level and block size produces for
+// sample, including the gzip header and trailer but no header fields.
+// It returns -1 if level or blockSize is invalid.
+//
+// Samples of up to 8 blocks are compressed completely, so the result is
+// exact. For larger samples, 8 evenly spaced blocks are compressed and
+// the result is extrapolated from them; it is within a few percent for
+// data that is uniform across the sample, but can be off by more for
+// data whose compressibility varies a lot. To estimate the output for a
+// larger input, scale the result by the ratio of the input size to the
+// sample size.
+func EstimateCompressedSize(sample []byte, level, blockSize int) int64 {
+	if !ValidLevel(level) || blockSize <= 0 {
+		return -1
+	}
+	blocks := (len(sample) + blockSize - 1) / blockSize
+	data := sample
+	if blocks > estimateBlocks {
+		data = make([]byte, 0, estimateBlocks*blockSize)
+		for i := 0; i < estimateBlocks; i++ {
+			start := i * blocks / estimateBlocks * blockSize
+			end := start + blockSize
+			if end > len(sample) {
+				end = len(sample)
+			}
+			data = append(data, sample[start:end]...)
+		}
+	}
+
+	var cw countWriter
+	w, _ := NewWriterLevel(&cw, level)
+	if err := w.SetConcurrency(blockSize, runtime.GOMAXPROCS(0)); err != nil {
+		return -1
+	}
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		return -1
+	}
+	if len(data) == len(sample) {
+		return cw.n
+	}
+	const overhead = 10 + 8 // header and trailer
+	return overhead + (cw.n-overhead)*int64(len(sample))/int64(len(data))
+}
+
+// countWriter counts the bytes written to it.
+type countWriter struct {
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
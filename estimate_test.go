@@ -0,0 +1,28 @@
+package sgzip
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEstimateCompressedSize(t *testing.T) {
+	in, compressed, _ := testSeekableData(t, 200000, 32<<10)
+	if got := EstimateCompressedSize(in, DefaultCompression, 32<<10); got != int64(len(compressed)) {
+		t.Errorf("small sample: got %d, want %d", got, len(compressed))
+	}
+
+	in = bytes.Repeat([]byte("estimate the compressed size of this text "), 100000)
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetConcurrency(16<<10, 4)
+	w.Write(in)
+	w.Close()
+	got := EstimateCompressedSize(in, DefaultCompression, 16<<10)
+	if diff := got - int64(buf.Len()); diff > int64(buf.Len())/20 || -diff > int64(buf.Len())/20 {
+		t.Errorf("large sample: got %d, want about %d", got, buf.Len())
+	}
+
+	if got := EstimateCompressedSize(in, 42, 16<<10); got != -1 {
+		t.Errorf("invalid level: got %d", got)
+	}
+}
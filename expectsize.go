@@ -0,0 +1,42 @@
+package sgzip
+
+import "errors"
+
+// ErrSizeMismatch is returned when the decompressed data is larger or
+// smaller than the size set by SetExpectedSize.
+var ErrSizeMismatch = errors.New("gzip: decompressed size does not match expected size")
+
+// SetExpectedSize makes Read and WriteTo fail with ErrSizeMismatch if the
+// decompressed data is not exactly size bytes long, for data whose size
+// is known from elsewhere, such as a manifest. Unlike the size in the
+// gzip trailer, which only holds the size modulo 4 GiB and is checked at
+// the end of each member, this catches both truncated data and data that
+// expands beyond its expected size. Data beyond size is detected as soon
+// as a decompressed block reaches beyond it, before any data of that
+// block is returned; data that ends short is reported instead of io.EOF
+// at the end of the stream. The size counts the data of all members read
+// with Multistream, and is the position returned by Seek at the end of
+// the data for Readers created with metadata.
+//
+// A negative size, the default, disables the check. The setting is kept
+// across calls to Reset.
+func (z *Reader) SetExpectedSize(size int64) {
+	z.expectSize = size >= 0
+	z.expectedSize = size
+	z.checkBlockSize()
+}
+
+// checkBlockSize sets the error of the Reader to ErrSizeMismatch if the
+// unread part of the current block reaches beyond the expected size, and
+// returns the error of the Reader.
+func (z *Reader) checkBlockSize() error {
+	if z.expectSize && z.err == nil && z.pos-z.origin+int64(len(z.current)-z.roff) > z.expectedSize {
+		z.err = ErrSizeMismatch
+	}
+	return z.err
+}
+
+// shortSize reports whether the data ended before the expected size.
+func (z *Reader) shortSize() bool {
+	return z.expectSize && z.pos-z.origin < z.expectedSize
+}
@@ -0,0 +1,274 @@
+package sgzip
+
+import (
+	"bufio"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// A FileOption changes how CompressFile writes a file.
+type FileOption func(*fileOptions)
+
+type fileOptions struct {
+	name        string
+	noName      bool
+	indexPath   string
+	indexFormat IndexFormat
+	sync        bool
+}
+
+// An IndexFormat is a format in which CompressFile writes the metadata.
+type IndexFormat int
+
+const (
+	// IndexBinary is the compact binary index format of EncodeIndex,
+	// read by DecodeIndex and OpenSeekable. It is the default.
+	IndexBinary IndexFormat = iota
+	// IndexGob is the gob encoding of GzipMetadata, which OpenSeekable
+	// reads.
+	IndexGob
+	// IndexJSON is the encoding/json encoding of GzipMetadata.
+	IndexJSON
+)
+
+// WithName makes CompressFile store name in the gzip header instead of
+// the base name of the source file.
+func WithName(name string) FileOption {
+	return func(o *fileOptions) { o.name, o.noName = name, false }
+}
+
+// WithoutName makes CompressFile store no name in the gzip header, as
+// gzip -n does, so that the file does not reveal the name of its source.
+func WithoutName() FileOption {
+	return func(o *fileOptions) { o.name, o.noName = "", true }
+}
+
+// WithIndexPath makes CompressFile write the metadata to path instead of
+// dstPath+".idx". OpenSeekable does not find it there;
+// SidecarOpener.SetMetadataPath tells it where to look.
+func WithIndexPath(path string) FileOption {
+	return func(o *fileOptions) { o.indexPath = path }
+}
+
+// WithIndexFormat makes CompressFile write the metadata in format f
+// instead of IndexBinary. OpenSeekable does not read IndexJSON. Indexes
+// in the .gzi format describe BGZF files, which CompressFile does not
+// write, so it is not offered.
+func WithIndexFormat(f IndexFormat) FileOption {
+	return func(o *fileOptions) { o.indexFormat = f }
+}
+
+// WithSync makes CompressFile, if sync is true, flush the compressed file,
+// the metadata and the directories holding them to stable storage with
+// fsync before returning, so that both files survive a crash once it has
+// returned.
+func WithSync(sync bool) FileOption {
+	return func(o *fileOptions) { o.sync = sync }
+}
+
+// CompressFile compresses the file at srcPath into a seekable gzip file at
+// dstPath, using the given compression level and block size, and writes
+// its metadata in the binary index format to dstPath+".idx", where
+// OpenSeekable finds it, or as set by WithIndexPath and WithIndexFormat.
+// Like gzip(1), it stores the base name of the source and its
+// modification time in the gzip header, unless changed by opts. Names
+// that cannot be written as Latin-1 are stored as UTF-8, which Readers
+// decode with SetUTF8Names. Blocks are compressed on all CPUs.
+//
+// If an error occurs, the files created by the call are removed. Files
+// that existed before are left in place, even if they were overwritten.
+func CompressFile(srcPath, dstPath string, level, blockSize int, opts ...FileOption) (GzipMetadata, error) {
+	var o fileOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.indexFormat < IndexBinary || o.indexFormat > IndexJSON {
+		return GzipMetadata{}, fmt.Errorf("gzip: unknown index format %d", o.indexFormat)
+	}
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return GzipMetadata{}, err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return GzipMetadata{}, err
+	}
+	name := o.name
+	if name == "" && !o.noName {
+		name = filepath.Base(fi.Name())
+	}
+	indexPath := o.indexPath
+	if indexPath == "" {
+		indexPath = dstPath + DefaultIndexSuffix
+	}
+	newDst, newIndex := !exists(dstPath), !exists(indexPath)
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return GzipMetadata{}, err
+	}
+	meta, err := compressFile(dst, src, name, fi.ModTime(), level, blockSize)
+	if err == nil && o.sync {
+		err = dst.Sync()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = writeIndexFile(indexPath, &meta, o.indexFormat, o.sync)
+	}
+	if err == nil && o.sync {
+		err = syncDir(filepath.Dir(dstPath))
+		if idir := filepath.Dir(indexPath); err == nil && idir != filepath.Dir(dstPath) {
+			err = syncDir(idir)
+		}
+	}
+	if err != nil {
+		if newDst {
+			os.Remove(dstPath)
+		}
+		if newIndex {
+			os.Remove(indexPath)
+		}
+		return GzipMetadata{}, err
+	}
+	return meta, nil
+}
+
+// exists reports whether there is a file at path. A file that cannot be
+// examined is assumed to exist, so that it is never removed.
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return !errors.Is(err, os.ErrNotExist)
+}
+
+// syncDir flushes the directory at path to stable storage, so that the
+// entries of files created in it survive a crash.
+func syncDir(path string) error {
+	d, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// writeIndexFile writes meta in format f to the file at path, and flushes
+// it to stable storage if sync is set.
+func writeIndexFile(path string, meta *GzipMetadata, f IndexFormat, sync bool) error {
+	var enc func(w io.Writer, meta *GzipMetadata) error
+	switch f {
+	case IndexBinary:
+		enc = EncodeIndex
+	case IndexGob:
+		enc = func(w io.Writer, meta *GzipMetadata) error { return gob.NewEncoder(w).Encode(meta) }
+	case IndexJSON:
+		enc = func(w io.Writer, meta *GzipMetadata) error { return json.NewEncoder(w).Encode(meta) }
+	default:
+		return fmt.Errorf("gzip: unknown index format %d", f)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(file)
+	err = enc(bw, meta)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil && sync {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func compressFile(dst io.Writer, src io.Reader, name string, modTime time.Time, level, blockSize int) (GzipMetadata, error) {
+	w, err := NewWriterLevel(dst, level)
+	if err != nil {
+		return GzipMetadata{}, err
+	}
+	if err := w.SetConcurrency(blockSize, runtime.GOMAXPROCS(0)); err != nil {
+		return GzipMetadata{}, err
+	}
+	w.Name = headerName(name)
+	w.ModTime = modTime
+	if _, err := io.Copy(w, src); err != nil {
+		w.Close()
+		return GzipMetadata{}, err
+	}
+	if err := w.Close(); err != nil {
+		return GzipMetadata{}, err
+	}
+	return w.MetaData(), nil
+}
+
+// headerName returns name to be stored as Writer.Name: unchanged if it is
+// Latin-1, and otherwise with each byte of its UTF-8 encoding as a rune,
+// so that the Writer stores the UTF-8 bytes.
+func headerName(name string) string {
+	for _, r := range name {
+		if r > 0xff {
+			b := make([]rune, len(name))
+			for i := 0; i < len(name); i++ {
+				b[i] = rune(name[i])
+			}
+			return string(b)
+		}
+	}
+	return name
+}
+
+// DecompressFile decompresses the gzip file at srcPath into dstPath. If
+// meta is not nil, the compressed data is read through the metadata as by
+// NewRandomReader with Multistream enabled, and ErrInvalidMetadata is
+// returned if the decompressed size does not match it. If an error
+// occurs, dstPath is removed.
+func DecompressFile(srcPath, dstPath string, meta *GzipMetadata) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	var z *Reader
+	if meta != nil {
+		z, err = NewRandomReader(src, meta)
+		if err == nil {
+			// Read the whole file, as NewReader does.
+			z.Multistream(true)
+		}
+	} else {
+		z, err = NewReader(src)
+	}
+	if err != nil {
+		return err
+	}
+	defer z.Close()
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+	n, err := z.WriteTo(dst)
+	if err == nil && meta != nil && n != meta.Size {
+		err = fmt.Errorf("%w: decompressed %d bytes, want %d", ErrInvalidMetadata, n, meta.Size)
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dstPath)
+	}
+	return err
+}
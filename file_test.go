@@ -0,0 +1,202 @@
+package sgzip
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompressFile(t *testing.T) {
+	dir := t.TempDir()
+	in, err := ioutil.ReadFile("testdata/test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := filepath.Join(dir, "test.json.gz")
+	meta, err := CompressFile("testdata/test.json", gz, BestSpeed, 64<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Size != int64(len(in)) {
+		t.Errorf("Size = %d, want %d", meta.Size, len(in))
+	}
+
+	b, err := ioutil.ReadFile(gz + DefaultIndexSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeIndex(bytes.NewReader(b)); err != nil {
+		t.Errorf("default index: %v", err)
+	}
+	r, closer, err := OpenSeekable(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Name != "test.json" {
+		t.Errorf("Name = %q, want test.json", r.Name)
+	}
+	closer()
+
+	for _, m := range []*GzipMetadata{nil, &meta} {
+		out := filepath.Join(dir, "out.json")
+		if err := DecompressFile(gz, out, m); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, in) {
+			t.Error("content does not match")
+		}
+	}
+
+	meta.Size--
+	if err := DecompressFile(gz, filepath.Join(dir, "bad"), &meta); !errors.Is(err, ErrInvalidMetadata) {
+		t.Errorf("wrong size: got %v, want ErrInvalidMetadata", err)
+	}
+}
+
+func TestCompressFileName(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "日本語 Grüße.txt")
+	if err := ioutil.WriteFile(src, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	gz := filepath.Join(dir, "out.gz")
+	for _, test := range []struct {
+		opts []FileOption
+		want string
+	}{
+		{nil, "日本語 Grüße.txt"},
+		{[]FileOption{WithName("Grüße.txt")}, "Grüße.txt"},
+		{[]FileOption{WithoutName()}, ""},
+		{[]FileOption{WithoutName(), WithName("x")}, "x"},
+	} {
+		if _, err := CompressFile(src, gz, BestSpeed, 64<<10, test.opts...); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(gz)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r Reader
+		r.SetUTF8Names(true)
+		if err := r.Reset(f); err != nil {
+			t.Fatal(err)
+		}
+		if r.Name != test.want {
+			t.Errorf("Name = %q, want %q", r.Name, test.want)
+		}
+		if data, err := ioutil.ReadAll(&r); err != nil || string(data) != "hello" {
+			t.Errorf("ReadAll = %q, %v", data, err)
+		}
+		f.Close()
+	}
+}
+
+func TestCompressFileIndex(t *testing.T) {
+	dir := t.TempDir()
+	gz := filepath.Join(dir, "test.json.gz")
+	idx := filepath.Join(dir, "index", "test.idx")
+	if err := os.Mkdir(filepath.Dir(idx), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	decoders := []struct {
+		format IndexFormat
+		decode func(b []byte) (GzipMetadata, error)
+	}{
+		{IndexGob, func(b []byte) (meta GzipMetadata, err error) {
+			err = gob.NewDecoder(bytes.NewReader(b)).Decode(&meta)
+			return meta, err
+		}},
+		{IndexBinary, func(b []byte) (GzipMetadata, error) {
+			return DecodeIndex(bytes.NewReader(b))
+		}},
+		{IndexJSON, func(b []byte) (meta GzipMetadata, err error) {
+			err = json.Unmarshal(b, &meta)
+			return meta, err
+		}},
+	}
+	for _, d := range decoders {
+		meta, err := CompressFile("testdata/test.json", gz, BestSpeed, 64<<10, WithIndexPath(idx), WithIndexFormat(d.format), WithSync(true))
+		if err != nil {
+			t.Fatalf("format %d: %v", d.format, err)
+		}
+		if _, err := os.Stat(gz + DefaultIndexSuffix); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("format %d: default sidecar written: %v", d.format, err)
+		}
+		b, err := ioutil.ReadFile(idx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := d.decode(b)
+		if err != nil {
+			t.Fatalf("format %d: %v", d.format, err)
+		}
+		if got.Size != meta.Size || len(got.BlockData) != len(meta.BlockData) {
+			t.Errorf("format %d: got size %d and %d blocks, want %d and %d", d.format, got.Size, got.NumBlocks(), meta.Size, meta.NumBlocks())
+		}
+		if d.format != IndexJSON {
+			// OpenSeekable reads both formats wherever they are.
+			var o SidecarOpener
+			o.SetMetadataPath(idx)
+			r, closer, err := o.Open(gz)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := r.Seek(1000, io.SeekStart); err != nil {
+				t.Error(err)
+			}
+			closer()
+		}
+	}
+
+	if _, err := CompressFile("testdata/test.json", gz, BestSpeed, 64<<10, WithIndexFormat(IndexJSON+1)); err == nil {
+		t.Error("unknown format: no error")
+	}
+}
+
+func TestCompressFileCleanup(t *testing.T) {
+	dir := t.TempDir()
+	gz := filepath.Join(dir, "out.gz")
+	idx := gz + DefaultIndexSuffix
+
+	// The index cannot be created: the new file is removed.
+	missing := filepath.Join(dir, "missing", "out.idx")
+	if _, err := CompressFile("testdata/test.json", gz, BestSpeed, 64<<10, WithIndexPath(missing)); err == nil {
+		t.Fatal("missing index directory: no error")
+	}
+	if _, err := os.Stat(gz); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("new file not removed: %v", err)
+	}
+
+	// The source cannot be read: files that existed are kept.
+	if _, err := CompressFile("testdata/test.json", gz, BestSpeed, 64<<10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CompressFile(dir, gz, BestSpeed, 64<<10); err == nil {
+		t.Fatal("directory source: no error")
+	}
+	for _, path := range []string{gz, idx} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("existing file removed: %v", err)
+		}
+	}
+	other := filepath.Join(dir, "other.gz")
+	if _, err := CompressFile(dir, other, BestSpeed, 64<<10, WithIndexPath(idx)); err == nil {
+		t.Fatal("directory source: no error")
+	}
+	if _, err := os.Stat(other); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("new file not removed: %v", err)
+	}
+	if _, err := os.Stat(idx); err != nil {
+		t.Errorf("existing index removed: %v", err)
+	}
+}
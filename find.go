@@ -0,0 +1,101 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/klauspost/compress/flate"
+)
+
+// findChunk is the number of bytes FindGzipStart scans per ReadAt call.
+const findChunk = 64 << 10
+
+// FindGzipStart returns the offset of the first gzip member in r at or
+// after offset from, for example to locate members embedded at an unknown
+// offset in a larger file, which can then be opened with
+// NewSeekingReaderOffset or NewReader over an io.SectionReader.
+//
+// Candidates are found by the magic bytes followed by the deflate method.
+// Since these also occur by chance in other data, a candidate is only
+// accepted if the rest of the header is plausible (no reserved flags, the
+// extra flags and OS values written by gzip implementations), its
+// optional fields can be read, and the start of the compressed data is
+// valid deflate data. A member truncated after its header is accepted.
+// io.EOF is returned if no member is found.
+func FindGzipStart(r io.ReaderAt, from int64) (int64, error) {
+	if from < 0 {
+		return 0, errors.New("gzip: negative offset")
+	}
+	magic := []byte{gzipID1, gzipID2, gzipDeflate}
+	buf := make([]byte, findChunk)
+	for off := from; ; {
+		n, err := r.ReadAt(buf, off)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		for i := 0; i+len(magic) <= n; {
+			j := bytes.Index(buf[i:n], magic)
+			if j < 0 {
+				break
+			}
+			if plausibleMember(r, off+int64(i+j)) {
+				return off + int64(i+j), nil
+			}
+			i += j + 1
+		}
+		if err == io.EOF || n < len(buf) {
+			return 0, io.EOF
+		}
+		// The magic may span the end of the chunk.
+		off += int64(n - len(magic) + 1)
+	}
+}
+
+// plausibleMember reports whether a gzip member appears to start at off
+// in r, see FindGzipStart.
+func plausibleMember(r io.ReaderAt, off int64) bool {
+	var hdr [10]byte
+	if n, _ := r.ReadAt(hdr[:], off); n < len(hdr) {
+		return false
+	}
+	if hdr[3]&flagReserved != 0 {
+		return false
+	}
+	if xfl := hdr[8]; xfl != 0 && xfl != 2 && xfl != 4 {
+		return false
+	}
+	if os := hdr[9]; os > 13 && os != 255 {
+		return false
+	}
+	// Most headers are the fixed fields alone, so only read more if the
+	// optional fields need it.
+	buf, hlen := hdr[:], 0
+	for size := len(hdr); ; {
+		_, n, err := ParseHeaderStrict(buf)
+		if err == nil {
+			hlen = n
+			break
+		}
+		if !errors.Is(err, io.ErrUnexpectedEOF) || len(buf) < size || size == maxHeaderLen {
+			return false
+		}
+		size *= 64
+		if size > maxHeaderLen {
+			size = maxHeaderLen
+		}
+		buf = make([]byte, size)
+		n, err = r.ReadAt(buf, off)
+		if err != nil && err != io.EOF {
+			return false
+		}
+		buf = buf[:n]
+	}
+	start := off + int64(hlen)
+	fr := flate.NewReader(&byteReader{r: io.NewSectionReader(r, start, 1<<63-1-start)})
+	defer fr.Close()
+	var b [1]byte
+	_, err := fr.Read(b[:])
+	var ce flate.CorruptInputError
+	return !errors.As(err, &ce)
+}
@@ -0,0 +1,72 @@
+package sgzip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestFindGzipStart(t *testing.T) {
+	var member bytes.Buffer
+	w := NewWriter(&member)
+	w.Name = "embedded.txt"
+	w.Write([]byte("hello world"))
+	w.Close()
+
+	// Candidates that are rejected: reserved flags, an unknown OS, and
+	// a valid header followed by an invalid deflate block type.
+	prefix := []byte("junk\x1f\x8b\x08\xe0")
+	prefix = append(prefix, gzipID1, gzipID2, gzipDeflate, 0, 0, 0, 0, 0, 0, 200)
+	prefix = append(prefix, gzipID1, gzipID2, gzipDeflate, 0, 0, 0, 0, 0, 0, 3, 0x07, 0xff, 0xff)
+	for _, at := range []int{0, len(prefix), findChunk - 1, findChunk + 10} {
+		data := make([]byte, at)
+		copy(data, prefix)
+		data = append(data, member.Bytes()...)
+		data = append(data, "trailing"...)
+		off, err := FindGzipStart(bytes.NewReader(data), 0)
+		if err != nil || off != int64(at) {
+			t.Errorf("member at %d: got %d, %v", at, off, err)
+			continue
+		}
+		r, err := NewReader(io.NewSectionReader(bytes.NewReader(data), off, int64(member.Len())))
+		if err != nil {
+			t.Fatalf("member at %d: %v", at, err)
+		}
+		if got, err := ioutil.ReadAll(r); err != nil || string(got) != "hello world" || r.Name != "embedded.txt" {
+			t.Errorf("member at %d: read %q, %v, name %q", at, got, err, r.Name)
+		}
+		if _, err := FindGzipStart(bytes.NewReader(data), off+1); err != io.EOF {
+			t.Errorf("member at %d: searching after it: got %v, want io.EOF", at, err)
+		}
+	}
+
+	// A member truncated after its header is found.
+	if off, err := FindGzipStart(bytes.NewReader(append([]byte("x"), member.Bytes()[:25]...)), 0); err != nil || off != 1 {
+		t.Errorf("truncated member: got %d, %v", off, err)
+	}
+	if _, err := FindGzipStart(bytes.NewReader(nil), 0); err != io.EOF {
+		t.Errorf("empty input: got %v, want io.EOF", err)
+	}
+
+	// Only the fixed fields are read for a header without optional
+	// fields, besides the chunk that is scanned.
+	var plain bytes.Buffer
+	w = NewWriter(&plain)
+	w.Write([]byte("hello world"))
+	w.Close()
+	data := append(plain.Bytes(), make([]byte, 2*maxHeaderLen)...)
+	c := &countingReaderAt{ra: bytes.NewReader(data)}
+	if off, err := FindGzipStart(c, 0); err != nil || off != 0 {
+		t.Fatalf("plain member: got %d, %v", off, err)
+	}
+	if c.bytes > findChunk+100 {
+		t.Errorf("read %d bytes to find a plain member, want at most %d", c.bytes, findChunk+100)
+	}
+
+	// A header at the very end, read in full together with io.EOF.
+	hdrOnly := append([]byte("x"), plain.Bytes()[:10]...)
+	if off, err := FindGzipStart(eofReaderAt(hdrOnly), 0); err != nil || off != 1 {
+		t.Errorf("header at the end: got %d, %v", off, err)
+	}
+}
@@ -0,0 +1,69 @@
+package sgzip
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// The fingerprint of a stream is the CRC-32 of its compressed first block
+// followed by its compressed last block and the trailer. The trailer holds
+// the checksum and size of all data, so unlike the length of the stream it
+// tells apart streams that only differ in their content.
+
+// fingerprintBlock adds a compressed result to the fingerprint.
+// This should only be called from the result writer.
+func (z *Writer) fingerprintBlock(buf []byte, r result) {
+	if !z.fpFirstDone {
+		z.fpFirst = crc32.Update(z.fpFirst, crc32.IEEETable, buf)
+	}
+	z.fpLast = crc32.Update(z.fpLast, crc32.IEEETable, buf)
+	z.fpLastLen += int64(len(buf))
+	if r.partial || r.final {
+		return
+	}
+	z.fpFirstDone = true
+	z.fpLast, z.fpLastLen = 0, 0
+}
+
+// checkFingerprint returns ErrInvalidMetadata if meta records a
+// fingerprint and it does not match the stream read from r, counting from
+// its current position, which is restored. Streams read with ReadAt are
+// not checked, to keep the number of reads predictable.
+func checkFingerprint(r io.ReadSeeker, meta *GzipMetadata) error {
+	if meta.Fingerprint == 0 || len(meta.BlockData) < 2 {
+		return nil
+	}
+	if _, ok := r.(*blockSource); ok {
+		return nil
+	}
+	pos, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	var lastStart int64
+	for _, d := range meta.BlockData[:len(meta.BlockData)-1] {
+		lastStart += int64(d)
+	}
+	h := crc32.NewIEEE()
+	for _, part := range [2][2]int64{
+		{int64(meta.BlockData[0]), int64(meta.BlockData[1])},
+		{lastStart, int64(meta.BlockData[len(meta.BlockData)-1]) + 8},
+	} {
+		if _, err := r.Seek(pos+part[0], io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(h, r, part[1]); err == io.EOF {
+			return fmt.Errorf("%w: stream ends before its trailer", ErrInvalidMetadata)
+		} else if err != nil {
+			return err
+		}
+	}
+	if _, err := r.Seek(pos, io.SeekStart); err != nil {
+		return err
+	}
+	if h.Sum32() != meta.Fingerprint {
+		return fmt.Errorf("%w: fingerprint does not match", ErrInvalidMetadata)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	// Stored blocks make the compressed size depend only on the size of
+	// the data, so a and b only differ in their content.
+	a := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(a)
+	b := append([]byte{}, a...)
+	b[50000]++
+	compress := func(data []byte) ([]byte, GzipMetadata) {
+		var buf bytes.Buffer
+		w, _ := NewWriterLevel(&buf, NoCompression)
+		w.SetConcurrency(16<<10, 4)
+		w.Write(data[:1000])
+		w.Flush()
+		w.Write(data[1000:])
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes(), w.MetaData()
+	}
+	ca, metaA := compress(a)
+	cb, metaB := compress(b)
+	if len(ca) != len(cb) {
+		t.Fatalf("compressed sizes differ: %d, %d", len(ca), len(cb))
+	}
+	if metaA.Fingerprint == 0 || metaA.Fingerprint == metaB.Fingerprint {
+		t.Fatalf("fingerprints %#x, %#x", metaA.Fingerprint, metaB.Fingerprint)
+	}
+
+	r, err := NewSeekingReader(bytes.NewReader(ca), &metaA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if _, err := NewSeekingReader(bytes.NewReader(cb), &metaA); !errors.Is(err, ErrInvalidMetadata) {
+		t.Errorf("wrong stream: got %v, want ErrInvalidMetadata", err)
+	}
+	// Metadata without a fingerprint is not checked.
+	old := metaA
+	old.Fingerprint = 0
+	r, err = NewSeekingReader(bytes.NewReader(cb), &old)
+	if err != nil {
+		t.Fatalf("no fingerprint: %v", err)
+	}
+	r.Close()
+
+	// Inside a container.
+	container := append(append([]byte("prefix"), cb...), "suffix"...)
+	if _, err := NewSeekingReaderOffset(bytes.NewReader(container), &metaA, 6); !errors.Is(err, ErrInvalidMetadata) {
+		t.Errorf("wrong stream in container: got %v, want ErrInvalidMetadata", err)
+	}
+	container = append(append([]byte("prefix"), ca...), "suffix"...)
+	r, err = NewSeekingReaderOffset(bytes.NewReader(container), &metaA, 6)
+	if err != nil {
+		t.Fatalf("stream in container: %v", err)
+	}
+	r.Close()
+}
+
+func TestFingerprintWriters(t *testing.T) {
+	in := make([]byte, 200000)
+	rand.New(rand.NewSource(2)).Read(in)
+
+	var buf, idx bytes.Buffer
+	w, err := CreateSeekable(&buf, &idx, DefaultCompression, 16<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(in)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	meta := w.MetaData()
+	decoded, err := DecodeIndex(&idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Fingerprint != meta.Fingerprint {
+		t.Errorf("index fingerprint %#x, want %#x", decoded.Fingerprint, meta.Fingerprint)
+	}
+	var enc bytes.Buffer
+	if err := EncodeIndex(&enc, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if decoded, err = DecodeIndex(&enc); err != nil || decoded.Fingerprint != meta.Fingerprint {
+		t.Errorf("EncodeIndex round trip: fingerprint %#x, %v", decoded.Fingerprint, err)
+	}
+
+	// NewWriterAt produces the same stream and fingerprint.
+	path := filepath.Join(t.TempDir(), "at.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	wa, err := NewWriterAt(f, DefaultCompression, 16<<10, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wa.Write(in)
+	if err := wa.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := wa.MetaData().Fingerprint; got != meta.Fingerprint {
+		t.Errorf("NewWriterAt fingerprint %#x, want %#x", got, meta.Fingerprint)
+	}
+	r, err := NewSeekingReader(f, &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+}
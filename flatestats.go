@@ -0,0 +1,272 @@
+package sgzip
+
+import "errors"
+
+// Types of deflate blocks, as reported to the function set by
+// SetFlateStats.
+const (
+	FlateStored  = 0 // stored without compression
+	FlateFixed   = 1 // compressed with the fixed Huffman codes
+	FlateDynamic = 2 // compressed with Huffman codes stored in the block
+)
+
+// SetFlateStats sets a function that is called for every deflate block
+// in the output with the type of the block (FlateStored, FlateFixed or
+// FlateDynamic), the number of uncompressed bytes it holds and its
+// compressed size. It helps to find out why data compresses poorly, for
+// example when most of it ends up in stored blocks. The output does not
+// change.
+//
+// Deflate blocks do not end on byte boundaries, so the compressed size of
+// a block is counted from the byte holding its first bit to the byte
+// holding the first bit of the next block; the sizes add up to the size of
+// the compressed data. Each block written by the Writer ends with an empty
+// stored block, which is reported too.
+//
+// fn is called from the goroutine writing the compressed data, in the
+// order of the output, and delays writing while it runs. Finding the
+// blocks requires decoding the compressed data, which takes about as much
+// CPU time as decompressing it. Passing nil disables the reports. It
+// must be called before the first Write and is kept across Reset.
+func (z *Writer) SetFlateStats(fn func(blockType int, inBytes, outBytes int)) error {
+	if z.wroteHeader {
+		return errors.New("gzip: flate stats must be set before writing")
+	}
+	z.flateStats = fn
+	return nil
+}
+
+// reportFlateBlocks calls the function set by SetFlateStats for each
+// deflate block in buf, which holds complete deflate blocks.
+// This should only be called from the result writer.
+func (z *Writer) reportFlateBlocks(buf []byte) {
+	br := bitReader{data: buf}
+	for br.pos < len(buf)*8 && br.err == nil {
+		start := br.pos
+		final := br.bits(1) == 1
+		typ := int(br.bits(2))
+		var n int
+		switch typ {
+		case FlateStored:
+			n = br.stored()
+		case FlateFixed:
+			n = br.codes(&fixedLitLen, &fixedDist)
+		case FlateDynamic:
+			var lit, dist huffman
+			if br.dynamicCodes(&lit, &dist) {
+				n = br.codes(&lit, &dist)
+			}
+		default:
+			return
+		}
+		if br.err != nil {
+			return
+		}
+		end := br.pos / 8
+		if final || br.pos == len(buf)*8 {
+			end = len(buf)
+		}
+		z.flateStats(typ, n, end-start/8)
+		if final {
+			return
+		}
+	}
+}
+
+// A bitReader reads deflate data bit by bit, following the inflate
+// reference implementation puff. After reading beyond the end of data, it
+// returns zero bits and err is set.
+type bitReader struct {
+	data    []byte
+	pos     int // in bits
+	err     error
+	matches int // length and distance pairs read by codes
+}
+
+var errFlateCorrupt = errors.New("gzip: corrupt deflate data")
+
+func (b *bitReader) bits(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		if b.pos >= len(b.data)*8 {
+			b.err = errFlateCorrupt
+			return 0
+		}
+		v |= uint32(b.data[b.pos/8]>>(b.pos%8)&1) << i
+		b.pos++
+	}
+	return v
+}
+
+// stored skips a stored block and returns its length.
+func (b *bitReader) stored() int {
+	b.pos = (b.pos + 7) &^ 7
+	n := b.bits(16)
+	if b.bits(16) != ^n&0xffff {
+		b.err = errFlateCorrupt
+		return 0
+	}
+	b.pos += int(n) * 8
+	if b.pos > len(b.data)*8 {
+		b.err = errFlateCorrupt
+	}
+	return int(n)
+}
+
+// A huffman code is given by the number of codes of each length and the
+// symbols ordered by their codes.
+type huffman struct {
+	count  [16]uint16
+	symbol [288]uint16
+}
+
+// build sets up the code from the code length of each symbol.
+func (h *huffman) build(lengths []uint8) {
+	h.count = [16]uint16{}
+	for _, l := range lengths {
+		h.count[l]++
+	}
+	var offs [16]uint16
+	for i := 1; i < 15; i++ {
+		offs[i+1] = offs[i] + h.count[i]
+	}
+	for sym, l := range lengths {
+		if l != 0 {
+			h.symbol[offs[l]] = uint16(sym)
+			offs[l]++
+		}
+	}
+}
+
+// decode reads one symbol, or returns -1 if the data does not hold a code.
+func (b *bitReader) decode(h *huffman) int {
+	var code, first, index int
+	for l := 1; l < 16; l++ {
+		code |= int(b.bits(1))
+		count := int(h.count[l])
+		if code-count < first {
+			return int(h.symbol[index+code-first])
+		}
+		index += count
+		first += count
+		first <<= 1
+		code <<= 1
+	}
+	b.err = errFlateCorrupt
+	return -1
+}
+
+var (
+	lengthBase  = [29]int{3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31, 35, 43, 51, 59, 67, 83, 99, 115, 131, 163, 195, 227, 258}
+	lengthExtra = [29]int{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0}
+	distExtra   = [30]int{0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13, 13}
+
+	fixedLitLen, fixedDist huffman
+)
+
+func init() {
+	var lengths [288]uint8
+	for i := range lengths {
+		switch {
+		case i < 144:
+			lengths[i] = 8
+		case i < 256:
+			lengths[i] = 9
+		case i < 280:
+			lengths[i] = 7
+		default:
+			lengths[i] = 8
+		}
+	}
+	fixedLitLen.build(lengths[:])
+	for i := 0; i < 30; i++ {
+		lengths[i] = 5
+	}
+	fixedDist.build(lengths[:30])
+}
+
+// codes skips the compressed data of a block and returns the number of
+// uncompressed bytes it holds.
+func (b *bitReader) codes(lit, dist *huffman) int {
+	var n int
+	for b.err == nil {
+		sym := b.decode(lit)
+		switch {
+		case sym < 0:
+			return n
+		case sym < 256:
+			n++
+		case sym == 256:
+			return n
+		case sym-257 < len(lengthBase):
+			sym -= 257
+			b.matches++
+			n += lengthBase[sym] + int(b.bits(lengthExtra[sym]))
+			d := b.decode(dist)
+			if d < 0 || d >= len(distExtra) {
+				b.err = errFlateCorrupt
+				return n
+			}
+			b.bits(distExtra[d])
+		default:
+			b.err = errFlateCorrupt
+		}
+	}
+	return n
+}
+
+// dynamicCodes reads the codes of a dynamic block.
+func (b *bitReader) dynamicCodes(lit, dist *huffman) bool {
+	order := [19]int{16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15}
+	nlen := int(b.bits(5)) + 257
+	ndist := int(b.bits(5)) + 1
+	ncode := int(b.bits(4)) + 4
+	if nlen > 286 || ndist > 30 {
+		b.err = errFlateCorrupt
+		return false
+	}
+	var lengths [316]uint8
+	for i := 0; i < ncode; i++ {
+		lengths[order[i]] = uint8(b.bits(3))
+	}
+	var lencode huffman
+	lencode.build(lengths[:19])
+	lengths = [316]uint8{}
+	for i := 0; i < nlen+ndist && b.err == nil; {
+		sym := b.decode(&lencode)
+		if sym < 16 {
+			if sym < 0 {
+				return false
+			}
+			lengths[i] = uint8(sym)
+			i++
+			continue
+		}
+		var l uint8
+		var rep int
+		switch sym {
+		case 16:
+			if i == 0 {
+				b.err = errFlateCorrupt
+				return false
+			}
+			l = lengths[i-1]
+			rep = 3 + int(b.bits(2))
+		case 17:
+			rep = 3 + int(b.bits(3))
+		default:
+			rep = 11 + int(b.bits(7))
+		}
+		if i+rep > nlen+ndist {
+			b.err = errFlateCorrupt
+			return false
+		}
+		for ; rep > 0; rep-- {
+			lengths[i] = l
+			i++
+		}
+	}
+	lit.build(lengths[:nlen])
+	dist.build(lengths[nlen : nlen+ndist])
+	return b.err == nil
+}
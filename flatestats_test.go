@@ -0,0 +1,69 @@
+package sgzip
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+func TestFlateStats(t *testing.T) {
+	text, err := ioutil.ReadFile("testdata/test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	random := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	for _, tc := range []struct {
+		name  string
+		data  []byte
+		level int
+		want  int // block type that must occur
+	}{
+		{"text", text, DefaultCompression, FlateDynamic},
+		{"text/none", text, NoCompression, FlateStored},
+		{"random", random, BestSpeed, FlateStored},
+		{"empty", nil, DefaultCompression, FlateFixed},
+	} {
+		var plain bytes.Buffer
+		w, _ := NewWriterLevel(&plain, tc.level)
+		w.SetConcurrency(64<<10, 4)
+		w.Write(tc.data)
+		w.Close()
+
+		var buf bytes.Buffer
+		var in, out int
+		var types [3]int
+		w, _ = NewWriterLevel(&buf, tc.level)
+		w.SetConcurrency(64<<10, 4)
+		if err := w.SetFlateStats(func(typ, inBytes, outBytes int) {
+			types[typ]++
+			in += inBytes
+			out += outBytes
+		}); err != nil {
+			t.Fatal(err)
+		}
+		w.Write(tc.data)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), plain.Bytes()) {
+			t.Errorf("%s: output changed by SetFlateStats", tc.name)
+		}
+		meta := w.MetaData()
+		if in != len(tc.data) {
+			t.Errorf("%s: blocks hold %d bytes, want %d", tc.name, in, len(tc.data))
+		}
+		if want := buf.Len() - int(meta.BlockData[0]) - 8; out != want {
+			t.Errorf("%s: blocks have %d compressed bytes, want %d", tc.name, out, want)
+		}
+		if types[tc.want] == 0 {
+			t.Errorf("%s: no blocks of type %d in %v", tc.name, tc.want, types)
+		}
+		if tc.level == NoCompression && types[FlateFixed]+types[FlateDynamic] != 1 {
+			// All blocks but the end of stream marker are stored.
+			t.Errorf("%s: block types %v, want only stored blocks", tc.name, types)
+		}
+	}
+}
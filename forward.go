@@ -0,0 +1,32 @@
+package sgzip
+
+import "io"
+
+// NewForwardSeekingReader creates a new Reader reading the compressed
+// stream described by meta from r, which only needs to be an io.Reader,
+// such as a pipe or standard input. Since the compressed data cannot be
+// skipped, Seek moves forward by decompressing and discarding the data up
+// to the new position, and returns ErrUnsupported for positions before
+// the current one. The size given by meta makes io.SeekEnd work, and is
+// reported by Info, which still reports the Reader as not seekable.
+//
+// Otherwise the Reader behaves as one created by NewReader, and reads
+// multistream files to their end. It is the caller's responsibility to
+// call Close on the Reader when done.
+func NewForwardSeekingReader(r io.Reader, meta *GzipMetadata) (*Reader, error) {
+	if err := checkVersion(meta); err != nil {
+		return nil, err
+	}
+	z, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	if z.canSeek {
+		// r holds a container that NewReader opened with its index.
+		return z, nil
+	}
+	z.forward = true
+	z.src = nil
+	z.isize = meta.Size
+	return z, nil
+}
@@ -0,0 +1,69 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestNewForwardSeekingReader(t *testing.T) {
+	in, comp, meta := testSeekableData(t, 300000, 32<<10)
+	// A pipe cannot seek.
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write(comp)
+		pw.Close()
+	}()
+	r, err := NewForwardSeekingReader(pr, &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if info := r.Info(); info.Size != meta.Size || info.Seekable {
+		t.Errorf("Info: Size = %d, Seekable = %v", info.Size, info.Seekable)
+	}
+
+	got := make([]byte, 100)
+	for _, seek := range []struct {
+		offset int64
+		whence int
+		want   int64
+	}{
+		{1000, io.SeekStart, 1000},
+		{50000, io.SeekCurrent, 51100},
+		{-100000, io.SeekEnd, 200000},
+		{200100, io.SeekStart, 200100},
+	} {
+		pos, err := r.Seek(seek.offset, seek.whence)
+		if err != nil || pos != seek.want {
+			t.Fatalf("Seek(%d, %d) = %d, %v, want %d", seek.offset, seek.whence, pos, err, seek.want)
+		}
+		if _, err := io.ReadFull(r, got); err != nil || !bytes.Equal(got, in[pos:pos+100]) {
+			t.Errorf("read at %d: %v", pos, err)
+		}
+	}
+	if pos, err := r.Seek(0, io.SeekStart); err != ErrUnsupported || pos != 200200 {
+		t.Errorf("backward Seek = %d, %v, want 200200, ErrUnsupported", pos, err)
+	}
+	var se *SeekError
+	if _, err := r.Seek(1, io.SeekEnd); !errors.As(err, &se) {
+		t.Errorf("Seek beyond the end: got %v, want *SeekError", err)
+	}
+	rest, err := ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(rest, in[200200:]) {
+		t.Errorf("read after failed seeks: got %d bytes, %v", len(rest), err)
+	}
+	if pos, err := r.Seek(0, io.SeekEnd); err != nil || pos != meta.Size {
+		t.Errorf("Seek to the end = %d, %v", pos, err)
+	}
+
+	// A Reset stream cannot seek.
+	if err := r.Reset(bytes.NewReader(comp)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Seek(0, io.SeekEnd); err != ErrUnsupported {
+		t.Errorf("Seek after Reset: got %v, want ErrUnsupported", err)
+	}
+}
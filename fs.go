@@ -0,0 +1,54 @@
+package sgzip
+
+import (
+	"io"
+	"io/fs"
+	"path"
+	"time"
+)
+
+// File presents the decompressed content of a gzip stream as an fs.File.
+// Seek is supported when the underlying Reader supports it.
+type File struct {
+	*Reader
+	size int64
+}
+
+// NewFile returns a File reading from r. The size reported by Stat is taken
+// from meta, which may be nil if it is not known.
+func NewFile(r *Reader, meta *GzipMetadata) *File {
+	f := &File{Reader: r, size: -1}
+	if meta != nil {
+		f.size = meta.Size
+	}
+	return f
+}
+
+// Stat returns a FileInfo describing the decompressed content.
+// Name and ModTime are taken from the gzip header.
+func (f *File) Stat() (fs.FileInfo, error) {
+	return fileInfo{header: f.Header, size: f.size}, nil
+}
+
+var (
+	_ fs.File   = (*File)(nil)
+	_ io.Seeker = (*File)(nil)
+)
+
+type fileInfo struct {
+	header Header
+	size   int64
+}
+
+func (fi fileInfo) Name() string {
+	if fi.header.Name == "" {
+		return ""
+	}
+	return path.Base(fi.header.Name)
+}
+
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) Mode() fs.FileMode  { return 0444 }
+func (fi fileInfo) ModTime() time.Time { return fi.header.ModTime }
+func (fi fileInfo) IsDir() bool        { return false }
+func (fi fileInfo) Sys() interface{}   { return nil }
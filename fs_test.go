@@ -0,0 +1,53 @@
+package sgzip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestFile(t *testing.T) {
+	in := bytes.Repeat([]byte("file contents\n"), 10000)
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Name = "dir/file.txt"
+	w.ModTime = time.Unix(1e9, 0)
+	w.Write(in)
+	w.Close()
+	meta := w.MetaData()
+
+	r, err := NewSeekingReader(bytes.NewReader(buf.Bytes()), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := NewFile(r, &meta)
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Name() != "file.txt" {
+		t.Errorf("Name = %q, want %q", fi.Name(), "file.txt")
+	}
+	if fi.Size() != int64(len(in)) {
+		t.Errorf("Size = %d, want %d", fi.Size(), len(in))
+	}
+	if !fi.ModTime().Equal(time.Unix(1e9, 0)) {
+		t.Errorf("ModTime = %v, want %v", fi.ModTime(), time.Unix(1e9, 0))
+	}
+	if fi.IsDir() {
+		t.Error("IsDir = true")
+	}
+	if _, err := f.Seek(14, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, in[14:]) {
+		t.Error("content does not match")
+	}
+}
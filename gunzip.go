@@ -12,31 +12,67 @@
 // so you can use it as a complete replacement for "compress/gzip".
 //
 // See more at https://github.com/klauspost/pgzip
+//
+// Code written against "compress/gzip" compiles unchanged when the import
+// is replaced by this package: the constants, ErrChecksum, ErrHeader,
+// Header, NewReader, NewWriter and NewWriterLevel, and the methods of
+// Reader (Close, Multistream, Read, Reset) and Writer (Close, Flush,
+// Reset, Write) have the same names and signatures. Reader also
+// implements io.Seeker, by decompressing without metadata and using it
+// when created by NewSeekingReader or Open.
+//
+// The behavior differs in a few ways. The Writer compresses blocks in
+// parallel, each without the history of the previous one, and ends the
+// data with an empty final block, so its output is a valid gzip stream
+// that differs from, and is slightly larger than, that of compress/gzip.
+// Write may return an error caused by an earlier call; Flush and Close
+// return all errors up to that point. The Reader decompresses ahead in a
+// goroutine, which runs until the stream is read to its end or Close is
+// called, so Readers should be closed. Header has Text, HeaderCRC and
+// ReservedFlags fields for the FLG byte, so it must be built with field
+// names. Errors are those of this package, so ErrChecksum and ErrHeader
+// are not equal to the errors of compress/gzip with the same names.
 package sgzip
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"hash"
 	"hash/crc32"
 	"io"
+	"io/ioutil"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/klauspost/compress/flate"
 )
 
+// minReadBlockSize is the smallest block size accepted by NewReaderN.
+const minReadBlockSize = 512
+
+// minReadBufferSize is the smallest size accepted by SetReadBufferSize.
+const minReadBufferSize = 64
+
 const (
-	gzipID1     = 0x1f
-	gzipID2     = 0x8b
-	gzipDeflate = 8
-	flagText    = 1 << 0
-	flagHdrCrc  = 1 << 1
-	flagExtra   = 1 << 2
-	flagName    = 1 << 3
-	flagComment = 1 << 4
+	gzipID1      = 0x1f
+	gzipID2      = 0x8b
+	gzipDeflate  = 8
+	flagText     = 1 << 0
+	flagHdrCrc   = 1 << 1
+	flagExtra    = 1 << 2
+	flagName     = 1 << 3
+	flagComment  = 1 << 4
+	flagReserved = 0xe0
 )
 
+// makeReader returns r if it can be read byte by byte efficiently, and r
+// wrapped in a bufio.Reader otherwise.
 func makeReader(r io.Reader) flate.Reader {
 	if rr, ok := r.(flate.Reader); ok {
 		return rr
@@ -44,17 +80,83 @@ func makeReader(r io.Reader) flate.Reader {
 	return bufio.NewReader(r)
 }
 
+// bufferedReader is like makeReader, but uses the buffer size set by
+// SetReadBufferSize.
+// The bytes read from r are counted for Counters.
+func (z *Reader) bufferedReader(r io.Reader) flate.Reader {
+	if rr, ok := r.(flate.Reader); ok {
+		z.input = nil
+		return countBytes(rr)
+	}
+	z.input = &inputCounter{r: r}
+	if z.readBufSize == 0 {
+		return bufio.NewReader(z.input)
+	}
+	return bufio.NewReaderSize(z.input, z.readBufSize)
+}
+
 var (
+	// ErrCorrupt matches, with errors.Is, the errors reporting damaged
+	// data: ErrHeader and ErrChecksum.
+	ErrCorrupt = errors.New("gzip: corrupt data")
+	// ErrSeek matches, with errors.Is, the errors reporting that a seek is
+	// not possible: ErrUnsupported, ErrInvalidSeek and *SeekError.
+	ErrSeek = errors.New("gzip: cannot seek")
+
 	// ErrUnsupported is returned when atempting an unsupported operation.
-	ErrUnsupported = errors.New("gzip: unsupported operation")
+	ErrUnsupported error = &categoryError{"gzip: unsupported operation", ErrSeek}
 	// ErrChecksum is returned when reading GZIP data that has an invalid checksum.
-	ErrChecksum = errors.New("gzip: invalid checksum")
+	ErrChecksum error = &categoryError{"gzip: invalid checksum", ErrCorrupt}
 	// ErrHeader is returned when reading GZIP data that has an invalid header.
-	ErrHeader = errors.New("gzip: invalid header")
+	ErrHeader error = &categoryError{"gzip: invalid header", ErrCorrupt}
 	// ErrInvalidSeek is returned when attempting to seek to negative position or beyond the file size.
-	ErrInvalidSeek = errors.New("gzip: invalid seek position")
+	// Some functions return a *SeekError instead, which matches it with errors.Is but not with ==.
+	ErrInvalidSeek error = &categoryError{"gzip: invalid seek position", ErrSeek}
+	// ErrInvalidMetadata is returned when the supplied metadata does not match the compressed file.
+	ErrInvalidMetadata = errors.New("gzip: metadata does not match stream")
+	// ErrUnsupportedMetadataVersion is returned for metadata written by a newer version of this package.
+	ErrUnsupportedMetadataVersion = errors.New("gzip: unsupported metadata version")
+	// ErrReadTimeout is returned when a read from the underlying reader takes longer than set by SetBlockReadTimeout.
+	ErrReadTimeout = errors.New("gzip: read timed out")
+	// ErrShortBuffer is returned by DecompressInto when the data does not fit the buffer; see ShortBufferError.
+	ErrShortBuffer = errors.New("gzip: short buffer")
+	// ErrSizeLimit matches, with errors.Is, the errors reporting that the
+	// decompressed data exceeds a limit set on the Reader.
+	ErrSizeLimit = errors.New("gzip: size limit exceeded")
+	// ErrExpansionRatio is returned when the data expands more than allowed by SetMaxExpansionRatio.
+	ErrExpansionRatio error = &categoryError{"gzip: expansion ratio limit exceeded", ErrSizeLimit}
 )
 
+// A categoryError is a sentinel error that also matches the broader
+// category it belongs to, such as ErrCorrupt, with errors.Is.
+type categoryError struct {
+	msg      string
+	category error
+}
+
+func (e *categoryError) Error() string { return e.msg }
+
+func (e *categoryError) Unwrap() error { return e.category }
+
+// A SeekError is returned when seeking to a position outside of the data
+// and gives the requested offset and the size. It matches ErrInvalidSeek
+// with errors.Is. Readers created with metadata, such as by
+// NewSeekingReader, return ErrInvalidSeek itself instead, as they always
+// have, so that comparing their errors with == keeps working.
+type SeekError struct {
+	Offset int64 // requested position
+	Size   int64 // size of the data, or -1 if it is not known
+}
+
+func (e *SeekError) Error() string {
+	if e.Size < 0 {
+		return fmt.Sprintf("%v: requested %d", ErrInvalidSeek, e.Offset)
+	}
+	return fmt.Sprintf("%v: requested %d but size is %d", ErrInvalidSeek, e.Offset, e.Size)
+}
+
+func (e *SeekError) Unwrap() error { return ErrInvalidSeek }
+
 // The gzip file stores a header giving metadata about the compressed file.
 // That header is exposed as the fields of the Writer and Reader structs.
 type Header struct {
@@ -63,6 +165,16 @@ type Header struct {
 	ModTime time.Time // modification time
 	Name    string    // file name
 	OS      byte      // operating system type
+	Text    bool      // the data is probably text (the FTEXT flag)
+	// HeaderCRC reports whether the header has a header checksum (the
+	// FHCRC flag), which Readers verify. Writer writes one if it is set.
+	HeaderCRC bool
+	// ReservedFlags holds the reserved bits of the FLG byte, which
+	// Readers accept unless SetStrict is set. Writer writes them as they
+	// are, so that copying a header read from a stream to a Writer keeps
+	// them. Transcode and ExportRemaining clear them. The other flags
+	// follow from the fields above.
+	ReservedFlags byte
 }
 
 // A Reader is an io.Reader that can be read to retrieve
@@ -79,20 +191,52 @@ type Header struct {
 // have the expected length or checksum.  Clients should treat data
 // returned by Read as tentative until they receive the io.EOF
 // marking the end of the data.
+//
+// A Reader is an io.ReadSeekCloser whichever function created it, so the
+// openers of this package can be used where one is expected. Readers that
+// cannot seek return ErrUnsupported from Seek.
 type Reader struct {
+	decoded  int64 // accessed atomically, first for 64-bit alignment
+	consumed int64 // compressed input counted by countInput, accessed atomically
+
 	Header
-	r            io.Reader
-	bufr         flate.Reader
-	decompressor io.ReadCloser
-	digest       hash.Hash32
-	size         uint32
-	pos          int64
-	flg          byte
-	buf          [512]byte
-	err          error
-	closeErr     chan error
-	multistream  bool
-	canSeek      bool
+	r                 io.Reader
+	bufr              flate.Reader
+	decompressor      io.ReadCloser
+	digest            hash.Hash32
+	newCRC            func() hash.Hash32 // see SetCRC32Func
+	size              uint32
+	pos               int64
+	flg               byte
+	xfl               byte // extra flags of the first header, see EstimateLevel
+	buf               [512]byte
+	err               error
+	closeErr          chan error
+	multistream       bool
+	canSeek           bool
+	forward           bool  // seek forward only, see NewForwardSeekingReader
+	noGarbage         bool  // treat invalid data after a member as end of stream
+	memberEnd         bool  // see SetReturnMemberEnd
+	expectSize        bool  // see SetExpectedSize
+	expectedSize      int64 // size set by SetExpectedSize
+	partialOnChecksum bool  // defer checksum errors to the end of the stream
+	skipChecksum      bool  // see SetSkipChecksum
+	checksumErr       error // deferred checksum error
+	skipBadMembers    bool  // see SetStopOnMemberError
+	memberErr         error // first error of a skipped member
+	skippedMembers    int   // number of skipped members
+	atEnd             bool  // the end of the stream has been reached
+	progress          func(uncompressed, total int64)
+	observer          func(offset int64, block []byte)
+	utf8Names         bool   // decode header strings as UTF-8 when valid
+	strict            bool   // reject reserved header flags
+	rawName           []byte // name as stored in the header
+	readTimeout       time.Duration
+	timeout           *timeoutReader // the source limited by readTimeout, if set
+	readBufSize       int            // see SetReadBufferSize
+	maxRatio          float64        // see SetMaxExpansionRatio
+	input             *inputCounter  // counts the input below bufr, if it is buffered here
+	inputLast         int64          // input position at the last countInput
 
 	readAhead        chan read
 	roff             int // read offset
@@ -101,31 +245,67 @@ type Reader struct {
 	lastBlock        bool
 	blockSize        int
 	concurrentBlocks int
-	blockOffset      int
-
-	blockStarts    []int64 // The start of each block. These will be recovered from the block sizes
-	isize          int64   // Size of the extracted data
-	verifyChecksum bool    // verify checksum and size - not possible if the stream has been seeked
-
+	blockOffset      int64 // Uncompressed bytes to discard before returning data
+
+	blockStarts    []int64         // The start of each block. These will be recovered from the block sizes
+	ustarts        []int64         // The uncompressed start of each block if their sizes vary
+	blockCRC       []uint32        // The checksum of each block, if the metadata has them
+	metaBlockSize  int             // BlockSize of the metadata
+	isize          int64           // Size of the extracted data
+	src            io.ReadSeeker   // source of readers without metadata, for Seek
+	srcStart       int64           // offset of the stream in src
+	padding        int             // zero bytes after isize, see SetPadLastBlock
+	origin         int64           // offset reported as 0, see NewReaderWithOrigin
+	limited        bool            // the data ends at limit, see NewSeekableSectionReader
+	limit          int64           // end of the data if limited
+	cache          *BlockCache     // recently used blocks, see SetBlockCache
+	ownCache       bool            // cache was created by SetBlockCacheSize
+	cacheKey       uint32          // see cacheStream, 0 until computed
+	refined        []refinePoint   // seek points found inside blocks, see IndexDensity
+	refineMu       sync.Mutex      // guards refined, which the read-ahead adds to
+	verifyChecksum bool            // verify checksum and size - not possible if the stream has been seeked
+	trailerSize    uint32          // ISIZE of the last trailer read, see ISize
+	outer          *Reader         // the Reader of the layer around this one, see NewNestedReader
+	ctx            context.Context // context of WriteToContext while it runs
+	memberGiven    bool            // MemberReader returned the current member
+
+	startRA  bool       // Start readahead on the next Read or WriteTo
 	activeRA bool       // Indication if readahead is active
 	mu       sync.Mutex // Lock for above
 
 	blockPool chan []byte
 }
 
+var _ io.ReadSeekCloser = (*Reader)(nil)
+
 type read struct {
 	b   []byte
 	err error
 }
 
 // NewReader creates a new Reader reading the given reader.
-// The implementation buffers input and may read more data than necessary from r.
+// If r implements io.ByteReader, as *bufio.Reader and *bytes.Reader do, it
+// is read directly without adding another buffer. Otherwise the
+// implementation buffers input and may read more data than necessary from r.
 // It is the caller's responsibility to call Close on the Reader when done.
+//
+// A Read of r may return no data and no error, for example while r waits
+// for data to arrive; r is then read again, after pauses of up to 10ms
+// once that has happened repeatedly. The wait counts against the
+// timeout set by SetBlockReadTimeout. This does not apply to an r read
+// directly, which must handle it itself; a *bufio.Reader returns
+// io.ErrNoProgress after 100 such reads in a row.
+//
+// If r is an io.ReadSeeker and io.ReaderAt, such as an *os.File, holding a
+// file written by NewContainerWriter, the Reader is opened with the index
+// of the file as by OpenContainer, so it can seek.
 func NewReader(r io.Reader) (*Reader, error) {
 	z := new(Reader)
 	z.concurrentBlocks = defaultBlocks
 	z.blockSize = defaultBlockSize
-	z.bufr = makeReader(r)
+	z.setSource(r)
+	z.bufr = z.bufferedReader(r)
+	z.restartInputCount()
 	z.digest = crc32.NewIEEE()
 
 	z.roff = 0
@@ -135,29 +315,43 @@ func NewReader(r io.Reader) (*Reader, error) {
 
 	z.blockPool = make(chan []byte, z.concurrentBlocks)
 	for i := 0; i < z.concurrentBlocks; i++ {
-		z.blockPool <- make([]byte, z.blockSize)
+		z.blockPool <- nil // allocated by the read-ahead when needed
 	}
 	if err := z.readHeader(true); err != nil {
 		return nil, err
 	}
+	if c, ok := z.openIndexed(); ok {
+		return c, nil
+	}
 	return z, nil
 }
 
 // NewReaderN creates a new Reader reading the given reader.
-// The implementation buffers input and may read more data than necessary from r.
+// If r implements io.ByteReader, as *bufio.Reader and *bytes.Reader do, it
+// is read directly without adding another buffer. Otherwise the
+// implementation buffers input and may read more data than necessary from r.
 // It is the caller's responsibility to call Close on the Reader when done.
 //
-// With this you can control the approximate size of your blocks,
-// as well as how many blocks you want to have prefetched.
+// With this you can control the size of the blocks data is decompressed
+// into, as well as how many blocks can be decompressed ahead of the reader.
+// blockSize must be at least 512 bytes and blocks at least 1.
+// Up to blocks*blockSize bytes are allocated for decompressed data.
+// Both values are kept by Reset.
 //
-// Default values for this is blockSize = 250000, blocks = 16,
-// meaning up to 16 blocks of maximum 250000 bytes will be
-// prefetched.
+// NewReader uses a blockSize of 1 MB and 4 blocks.
 func NewReaderN(r io.Reader, blockSize, blocks int) (*Reader, error) {
+	if blockSize < minReadBlockSize {
+		return nil, fmt.Errorf("gzip: block size %d is smaller than %d", blockSize, minReadBlockSize)
+	}
+	if blocks < 1 {
+		return nil, errors.New("gzip: blocks must be at least 1")
+	}
 	z := new(Reader)
 	z.concurrentBlocks = blocks
 	z.blockSize = blockSize
-	z.bufr = makeReader(r)
+	z.setSource(r)
+	z.bufr = z.bufferedReader(r)
+	z.restartInputCount()
 	z.digest = crc32.NewIEEE()
 
 	z.roff = 0
@@ -165,16 +359,9 @@ func NewReaderN(r io.Reader, blockSize, blocks int) (*Reader, error) {
 	z.multistream = true
 	z.verifyChecksum = true
 
-	// Account for too small values
-	if z.concurrentBlocks <= 0 {
-		z.concurrentBlocks = defaultBlocks
-	}
-	if z.blockSize <= 512 {
-		z.blockSize = defaultBlockSize
-	}
 	z.blockPool = make(chan []byte, z.concurrentBlocks)
 	for i := 0; i < z.concurrentBlocks; i++ {
-		z.blockPool <- make([]byte, z.blockSize)
+		z.blockPool <- nil // allocated by the read-ahead when needed
 	}
 	if err := z.readHeader(true); err != nil {
 		return nil, err
@@ -186,12 +373,73 @@ func NewReaderN(r io.Reader, blockSize, blocks int) (*Reader, error) {
 // This is a special reader that allows seeking in the compressed file
 // using the supplied metadata.
 // It is the caller's responsibility to call Close on the Reader when done.
+//
+// The metadata does not need to describe every block of the stream.
+// When meta.Size extends beyond the last indexed block, for example when
+// the file was written as a single large block, a seek past that block
+// decompresses from its start and discards data up to the requested offset.
+//
+// When the metadata describes more than one block, the first block is
+// decompressed to verify that it is meta.BlockSize bytes long, or holds
+// all of the data, and ErrInvalidMetadata is returned if it does not.
+// ErrInvalidMetadata is also returned if the blocks described by meta
+// extend beyond the end of r, or if meta has a Fingerprint that does not
+// match r, which usually means that the metadata belongs to a different
+// file.
+//
+// If meta describes a multistream file, such as the metadata returned by
+// MergeMetadata, IndexMembers or LoadGZI, the Reader reads on through the
+// members until it has returned meta.Size bytes. Unlike NewReader, it then
+// stops, even if more members follow; Multistream(true) reads them too. A
+// stream that ends before meta.Size bytes is reported as
+// io.ErrUnexpectedEOF.
 func NewSeekingReader(r io.ReadSeeker, meta *GzipMetadata) (*Reader, error) {
+	if err := checkVersion(meta); err != nil {
+		return nil, err
+	}
+	if meta.StreamOffset != 0 {
+		rel, off, err := streamRelative(meta)
+		if err != nil {
+			return nil, err
+		}
+		return NewSeekingReaderOffset(r, rel, off)
+	}
+	if err := checkUBlockData(meta); err != nil {
+		return nil, err
+	}
+	if err := checkUnindexed(meta); err != nil {
+		return nil, err
+	}
+	r = trackSeeks(r)
+	if err := checkLength(r, meta); err != nil {
+		return nil, err
+	}
+	if err := checkFingerprint(r, meta); err != nil {
+		return nil, err
+	}
+	blockStarts := parseBlockData(meta.BlockData, meta.BlockSize)
+	if len(meta.BlockData) > 2 {
+		n, err := firstBlockSize(r, blockStarts)
+		if err != nil {
+			return nil, err
+		}
+		if meta.variableBlocks() {
+			if n != blockLen(meta, 0) {
+				return nil, ErrInvalidMetadata
+			}
+		} else if n > int64(meta.BlockSize) || (n < meta.Size && n != int64(meta.BlockSize)) {
+			// The first block is full unless it holds all the data.
+			return nil, ErrInvalidMetadata
+		}
+	}
+
 	z := new(Reader)
 	z.concurrentBlocks = defaultBlocks
 	z.blockSize = meta.BlockSize
+	z.metaBlockSize = meta.BlockSize
 	z.r = r
-	z.bufr = makeReader(r)
+	z.bufr = z.bufferedReader(r)
+	z.restartInputCount()
 	z.digest = crc32.NewIEEE()
 
 	z.roff = 0
@@ -199,12 +447,17 @@ func NewSeekingReader(r io.ReadSeeker, meta *GzipMetadata) (*Reader, error) {
 	z.multistream = false
 	z.verifyChecksum = true
 
-	z.blockStarts = parseBlockData(meta.BlockData, meta.BlockSize)
+	z.blockStarts = blockStarts
+	z.ustarts = uncompressedStarts(meta)
+	if len(meta.BlockCRC) == meta.NumBlocks() {
+		z.blockCRC = meta.BlockCRC
+	}
 	z.isize = meta.Size
+	z.padding = meta.Padding
 
 	z.blockPool = make(chan []byte, z.concurrentBlocks)
 	for i := 0; i < z.concurrentBlocks; i++ {
-		z.blockPool <- make([]byte, z.blockSize)
+		z.blockPool <- nil // allocated by the read-ahead when needed
 	}
 	if err := z.readHeader(true); err != nil {
 		return nil, err
@@ -212,16 +465,133 @@ func NewSeekingReader(r io.ReadSeeker, meta *GzipMetadata) (*Reader, error) {
 	return z, nil
 }
 
+// Open returns a Reader for r whether or not metadata is available. With
+// meta it is NewSeekingReader: Seek jumps to the block holding the target
+// and io.SeekEnd is supported. Without meta (nil) it is NewReader, and Seek
+// works by decompressing: seeking forward discards data up to the target,
+// seeking backward restarts from the beginning of r, and io.SeekEnd returns
+// ErrUnsupported. CanSeek and Info also report whether metadata was given.
+// Either way the Reader is an io.ReadSeekCloser.
+func Open(r io.ReadSeeker, meta *GzipMetadata) (*Reader, error) {
+	if meta == nil {
+		return NewReader(r)
+	}
+	return NewSeekingReader(r, meta)
+}
+
+// NewSeekingReaderOffset is like NewSeekingReader for a stream stored at
+// baseOffset within r, for example a member inside a larger container
+// file. The offsets in meta are relative to the start of the stream, or,
+// if meta has a StreamOffset, to baseOffset, and data after the end of the
+// stream described by meta is not read. r is positioned at the start of
+// the stream before reading.
+func NewSeekingReaderOffset(r io.ReadSeeker, meta *GzipMetadata, baseOffset int64) (*Reader, error) {
+	if baseOffset < 0 {
+		return nil, ErrInvalidSeek
+	}
+	rel, off, err := streamRelative(meta)
+	if err != nil {
+		return nil, err
+	}
+	meta, baseOffset = rel, baseOffset+off
+	s := &offsetSeeker{r: r, base: baseOffset, size: 8}
+	for _, d := range meta.BlockData {
+		s.size += int64(d)
+	}
+	if _, err := s.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	// s reports the length given by meta, so check r itself.
+	if err := checkLength(r, meta); err != nil {
+		return nil, err
+	}
+	return NewSeekingReader(s, meta)
+}
+
+// checkLength returns ErrInvalidMetadata if the blocks described by meta
+// extend beyond the end of r, counting from its current position, which is
+// restored. Nothing is checked if r does not support io.SeekEnd.
+func checkLength(r io.ReadSeeker, meta *GzipMetadata) error {
+	var need int64
+	for _, d := range meta.BlockData {
+		need += int64(d)
+	}
+	pos, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		// The length of r is not known.
+		return nil
+	}
+	if _, err := r.Seek(pos, io.SeekStart); err != nil {
+		return err
+	}
+	if end-pos < need {
+		return fmt.Errorf("%w: blocks end at byte %d, but the compressed stream has %d bytes", ErrInvalidMetadata, need, end-pos)
+	}
+	return nil
+}
+
+// offsetSeeker is an io.ReadSeeker over the size bytes of r starting at
+// base.
+type offsetSeeker struct {
+	r    io.ReadSeeker
+	base int64
+	size int64
+	pos  int64
+}
+
+func (s *offsetSeeker) Read(p []byte) (int, error) {
+	if s.pos >= s.size {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > s.size-s.pos {
+		p = p[:s.size-s.pos]
+	}
+	n, err := s.r.Read(p)
+	s.pos += int64(n)
+	return n, err
+}
+
+func (s *offsetSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return s.pos, ErrInvalidSeek
+	}
+	if offset < 0 {
+		return s.pos, ErrInvalidSeek
+	}
+	if _, err := s.r.Seek(s.base+offset, io.SeekStart); err != nil {
+		return s.pos, err
+	}
+	s.pos = offset
+	return offset, nil
+}
+
 // NewReaderAt creates a new Reader reading the given reader.
 // This is a special reader that starts at an offset and allows
 // seeking in the compressed file using the supplied metadata.
 // It is the caller's responsibility to call Close on the Reader when done.
+// As with NewSeekingReader, it stops after meta.Size bytes unless
+// multistream mode is enabled.
 func NewReaderAt(r io.ReadSeeker, meta *GzipMetadata, pos int64) (*Reader, error) {
+	if err := checkVersion(meta); err != nil {
+		return nil, err
+	}
 	z := new(Reader)
 	z.concurrentBlocks = defaultBlocks
 	z.blockSize = meta.BlockSize
-	z.r = r
-	z.bufr = makeReader(r)
+	z.metaBlockSize = meta.BlockSize
+	z.r = trackSeeks(r)
+	z.bufr = z.bufferedReader(z.r)
+	z.restartInputCount()
 	z.digest = crc32.NewIEEE()
 
 	z.pos = pos
@@ -231,28 +601,106 @@ func NewReaderAt(r io.ReadSeeker, meta *GzipMetadata, pos int64) (*Reader, error
 	z.verifyChecksum = false
 
 	z.blockStarts = parseBlockData(meta.BlockData, meta.BlockSize)
+	z.ustarts = uncompressedStarts(meta)
+	if len(meta.BlockCRC) == meta.NumBlocks() {
+		z.blockCRC = meta.BlockCRC
+	}
 	z.isize = meta.Size
+	z.padding = meta.Padding
 
-	blockNumber := z.pos / int64(z.blockSize)
-	blockStart := z.blockStarts[blockNumber]        // Start position of blocks to read
-	z.blockOffset = int(z.pos % int64(z.blockSize)) // Offset of data to read in blocks to read
+	var blockStart int64
+	blockStart, z.blockOffset = z.blockFor(z.pos)
 
 	// Seek underlying readseeker
-	_, err := z.r.(io.ReadSeeker).Seek(blockStart, io.SeekStart)
-	if err != nil {
+	if err := z.seekSource(blockStart); err != nil {
 		return nil, err
 	}
-	z.bufr = makeReader(z.r)
 	z.blockPool = make(chan []byte, z.concurrentBlocks)
 	for i := 0; i < z.concurrentBlocks; i++ {
-		z.blockPool <- make([]byte, z.blockSize)
+		z.blockPool <- nil // allocated by the read-ahead when needed
 	}
 
-	z.decompressor = flate.NewReader(z.bufr)
-	z.doReadAhead()
+	z.decompressor = z.newDecompressor(z.pos - z.blockOffset)
+	z.startRA = true
+	return z, nil
+}
+
+// NewReaderWithOrigin is like NewSeekingReader, but treats offset origin
+// of the uncompressed data as its start, for formats that put a header of
+// their own before the data of interest. The Reader starts at origin, and
+// Seek, CanSeek, CopyRange and Stream take and report offsets relative to
+// it, while the metadata still describes the whole stream. Seeking to a
+// position before origin returns ErrInvalidSeek. ForEachBlock still
+// passes all blocks.
+//
+// Since the Reader seeks to origin, checksums are not verified unless
+// origin is 0.
+func NewReaderWithOrigin(r io.ReadSeeker, meta *GzipMetadata, origin int64) (*Reader, error) {
+	if origin < 0 || origin > meta.Size {
+		return nil, ErrInvalidSeek
+	}
+	z, err := NewSeekingReader(r, meta)
+	if err != nil {
+		return nil, err
+	}
+	if origin > 0 {
+		z.origin = origin
+		if _, err := z.seek(origin, io.SeekStart); err != nil {
+			z.Close()
+			return nil, err
+		}
+	}
 	return z, nil
 }
 
+// firstBlockSize returns the uncompressed size of the first block.
+// The position of r is restored afterwards.
+func firstBlockSize(r io.ReadSeeker, blockStarts []int64) (int64, error) {
+	pos, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.Seek(pos+blockStarts[0], io.SeekStart); err != nil {
+		return 0, err
+	}
+	fr := flate.NewReader(io.LimitReader(r, blockStarts[1]-blockStarts[0]))
+	n, err := io.Copy(ioutil.Discard, fr)
+	fr.Close()
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return 0, ErrInvalidMetadata
+	}
+	if _, err := r.Seek(pos, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// RepairMetadata returns a copy of meta with BlockSize corrected to the
+// uncompressed size of the first block of the stream read from r.
+// This fixes metadata whose block size does not match the way the stream
+// was written. The compressed block boundaries are kept as they are.
+// The position of r is restored afterwards.
+func RepairMetadata(r io.ReadSeeker, meta *GzipMetadata) (GzipMetadata, error) {
+	if err := checkVersion(meta); err != nil {
+		return GzipMetadata{}, err
+	}
+	fixed := *meta
+	if len(meta.BlockData) <= 2 || meta.variableBlocks() {
+		return fixed, nil
+	}
+	n, err := firstBlockSize(r, parseBlockData(meta.BlockData, meta.BlockSize))
+	if err != nil {
+		return GzipMetadata{}, err
+	}
+	if n <= 0 {
+		return GzipMetadata{}, ErrInvalidMetadata
+	}
+	if n < meta.Size || n > int64(meta.BlockSize) {
+		fixed.BlockSize = int(n)
+	}
+	return fixed, nil
+}
+
 // Parses block data. Returns the number of blocks, the block start locations for each block, and the decompressed size of the entire file.
 func parseBlockData(blockData []uint32, BlockSize int) (blockStarts []int64) {
 	numBlocks := len(blockData)
@@ -268,43 +716,280 @@ func parseBlockData(blockData []uint32, BlockSize int) (blockStarts []int64) {
 	return blockStarts
 }
 
+// blockFor returns the compressed start of the block containing the
+// uncompressed offset pos and the number of bytes to discard from it.
+func (z *Reader) blockFor(pos int64) (blockStart int64, discard int64) {
+	_, blockStart, discard = locateBlock(z.blockStarts, z.metaBlockSize, z.ustarts, pos)
+	return blockStart, discard
+}
+
+// locateBlock returns the index and compressed start of the block
+// containing the uncompressed offset pos, and the number of bytes to
+// discard from it. ustarts holds the uncompressed offset of each block
+// when their sizes vary, and is nil when they hold blockSize bytes each.
+// Offsets beyond the last indexed block are served from that block.
+func locateBlock(blockStarts []int64, blockSize int, ustarts []int64, pos int64) (block int, blockStart int64, discard int64) {
+	var b int64
+	if ustarts != nil {
+		b = int64(sort.Search(len(ustarts), func(i int) bool { return ustarts[i] > pos }) - 1)
+	} else {
+		b = pos / int64(blockSize)
+	}
+	last := int64(len(blockStarts) - 3) // blockStarts ends with the trailer offset twice
+	if last < 0 {
+		last = 0
+	}
+	if b > last {
+		b = last
+	}
+	if b < 0 {
+		b = 0
+	}
+	start := b * int64(blockSize)
+	if ustarts != nil {
+		start = ustarts[b]
+	}
+	return int(b), blockStarts[b], pos - start
+}
+
 // Reset discards the Reader z's state and makes it equivalent to the
 // result of its original state from NewReader, but reading from r instead.
 // This permits reusing a Reader rather than allocating a new one.
+// The block size and count set by NewReaderN are kept, as are the options
+// set with the Set methods, except for the block cache. Multistream is
+// enabled again; see ResetKeepOptions to keep it disabled.
 func (z *Reader) Reset(r io.Reader) error {
 	z.killReadAhead()
-	z.bufr = makeReader(r)
-	z.digest = crc32.NewIEEE()
+	if z.outer != nil {
+		z.outer.Close()
+		z.outer = nil
+	}
+	z.setSource(r)
+	z.bufr = z.bufferedReader(z.withTimeout(r))
+	z.restartInputCount()
+	z.digest = z.newDigest()
 	z.size = 0
+	z.padding = 0
+	atomic.StoreInt64(&z.decoded, 0)
+	atomic.StoreInt64(&z.consumed, 0)
+	z.trailerSize = 0
 	z.pos = 0
 	z.roff = 0
 	z.err = nil
+	z.checksumErr = nil
+	z.memberErr = nil
+	z.skippedMembers = 0
+	z.memberGiven = false
+	z.atEnd = false
 	z.canSeek = false
+	z.forward = false
 	z.multistream = true
 	z.verifyChecksum = true
+	z.current = nil
+	z.cache = nil
+	z.ownCache = false
+	z.cacheKey = 0
+	z.refined = nil
+	z.origin = 0
+	z.limited = false
 
 	// Account for uninitialized values
 	if z.concurrentBlocks <= 0 {
 		z.concurrentBlocks = defaultBlocks
 	}
-	if z.blockSize <= 512 {
+	if z.blockSize < minReadBlockSize {
 		z.blockSize = defaultBlockSize
 	}
 
 	z.blockPool = make(chan []byte, z.concurrentBlocks)
 	for i := 0; i < z.concurrentBlocks; i++ {
-		z.blockPool <- make([]byte, z.blockSize)
+		z.blockPool <- nil // allocated by the read-ahead when needed
 	}
 
 	return z.readHeader(true)
 }
 
-// Seek ...
+// ResetKeepOptions is like Reset, but keeps the setting of Multistream
+// and the block cache, which is convenient when reading a sequence of
+// streams one at a time. The blocks of the previous stream are removed
+// from a cache set by SetBlockCacheSize, while a cache set by
+// SetBlockCache keeps them for the other Readers sharing it. Either way
+// they are never returned for another stream.
+func (z *Reader) ResetKeepOptions(r io.Reader) error {
+	multistream, cache, own := z.multistream, z.cache, z.ownCache
+	if cache != nil && own && z.canSeek {
+		cache.drop(z.cacheStream())
+	}
+	err := z.Reset(r)
+	z.multistream = multistream
+	z.cache, z.ownCache = cache, own
+	return err
+}
+
+// ISize returns the ISIZE field of the last trailer read, which is the
+// size of the data of its member, including any padding, modulo 2^32, or
+// 0 if no trailer has been read yet. Once Read has returned io.EOF, it is
+// a quick check of the size of a single-member stream smaller than 4 GiB
+// without metadata. For larger streams only the low 32 bits are kept, and
+// the Size of the metadata is authoritative. The value is read even if
+// checksums are not verified, and the trailer of each member of a
+// multistream file replaces it.
+func (z *Reader) ISize() uint32 {
+	return z.trailerSize
+}
+
+// DecodedBytes returns the number of bytes decompressed since the Reader
+// was created or last Reset. It includes data decompressed ahead of the
+// reader and data skipped to reach a Seek position, so unlike the position
+// in the uncompressed stream it only grows. Comparing it with the expected
+// amount helps to diagnose metadata that does not match the stream.
+func (z *Reader) DecodedBytes() int64 {
+	return atomic.LoadInt64(&z.decoded)
+}
+
+// setSource records r as the source to restart from when seeking
+// backward without metadata, if it is an io.ReadSeeker.
+func (z *Reader) setSource(r io.Reader) {
+	z.src = nil
+	if rs, ok := r.(io.ReadSeeker); ok {
+		if off, err := rs.Seek(0, io.SeekCurrent); err == nil {
+			z.src, z.srcStart = rs, off
+		}
+	}
+}
+
+// seekStream implements Seek for readers without metadata, and for
+// readers created by NewForwardSeekingReader.
+func (z *Reader) seekStream(offset int64, whence int) (int64, error) {
+	if z.src == nil && !z.forward {
+		return z.pos, ErrUnsupported
+	}
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = z.pos + offset
+	case io.SeekEnd:
+		if !z.forward {
+			return z.pos, ErrUnsupported
+		}
+		target = z.isize + offset
+	default:
+		return z.pos, ErrUnsupported
+	}
+	if target < 0 {
+		return z.pos, &SeekError{Offset: target, Size: -1}
+	}
+	if z.forward {
+		if target < z.pos {
+			return z.pos, ErrUnsupported
+		}
+		if target > z.isize {
+			return z.pos, &SeekError{Offset: target, Size: z.isize}
+		}
+	} else if target < z.pos || (z.err != nil && target != z.pos) {
+		// Start over from the beginning of the stream. The read-ahead
+		// must be done with the source before it is moved.
+		multistream := z.multistream
+		z.killReadAhead()
+		if err := z.stalled(); err != nil {
+			return z.pos, err
+		}
+		if _, err := z.src.Seek(z.srcStart, io.SeekStart); err != nil {
+			return z.pos, err
+		}
+		if err := z.Reset(z.src); err != nil {
+			return z.pos, err
+		}
+		z.multistream = multistream
+	}
+	_, err := z.discard(target - z.pos)
+	if err == io.EOF {
+		// The stream ended at z.pos.
+		err = &SeekError{Offset: target, Size: z.pos}
+	}
+	return z.pos, err
+}
+
+// CanSeek reports whether offset is a position within the uncompressed
+// data that Seek can move to, that is whether the Reader was created with
+// metadata and 0 <= offset < Size. It lets callers check an offset without
+// calling Seek and handling ErrUnsupported or ErrInvalidSeek.
+func (z *Reader) CanSeek(offset int64) bool {
+	return z.canSeek && offset >= 0 && offset < z.dataEnd()-z.origin
+}
+
+// Seekable reports whether the Reader was created with valid metadata, as
+// by NewSeekingReader or NewRandomReader, so that Seek moves to any
+// position by decompressing only the block holding it. It is false for a
+// Reader created by NewReader, whose Seek decompresses the data up to the
+// new position: forward from the current one, and backward by starting
+// over from the beginning if the input is an io.ReadSeeker.
+func (z *Reader) Seekable() bool {
+	return z.canSeek
+}
+
+// dataEnd returns the offset at which the data of a Reader with metadata
+// ends.
+func (z *Reader) dataEnd() int64 {
+	if z.limited {
+		return z.limit
+	}
+	return z.isize
+}
+
+// metaMore reports whether the metadata of a Reader says that more data
+// follows the current position. The Reader then continues with the next
+// member even if multistream mode is disabled.
+func (z *Reader) metaMore() bool {
+	return z.canSeek && z.pos < z.dataEnd()
+}
+
+// Seek sets the position in the uncompressed data for the next Read,
+// interpreted according to whence as described for io.Seeker.
+//
+// Readers created with metadata start decompressing at the block
+// containing the new position. Readers created by NewReader, NewReaderN
+// or Reset seek by decompressing: forward by discarding data, and backward
+// by starting over from the beginning of the stream, which needs r to be
+// an io.ReadSeeker and costs time proportional to the new offset. They
+// do not support io.SeekEnd, since the size is not known, and return
+// ErrInvalidSeek for positions beyond the end of the data, leaving the
+// Reader at the end. Readers created by NewForwardSeekingReader seek
+// forward the same way and return ErrUnsupported for positions before the
+// current one. ErrUnsupported is returned if seeking is not possible.
+// Positions outside of the data are reported as ErrInvalidSeek by Readers
+// created with metadata over the whole stream, and as a *SeekError
+// otherwise, including for Readers with an origin or a window.
 func (z *Reader) Seek(offset int64, whence int) (int64, error) {
-	z.killReadAhead()
 	if !z.canSeek {
-		return z.pos, ErrUnsupported
+		return z.seekStream(offset, whence)
+	}
+	if z.origin == 0 && !z.limited {
+		return z.seek(offset, whence)
+	}
+	end := z.dataEnd()
+	target := z.pos
+	switch whence {
+	case io.SeekStart:
+		target = z.origin + offset
+	case io.SeekCurrent:
+		target = z.pos + offset
+	case io.SeekEnd:
+		target = end + offset
+	}
+	if target < z.origin || target > end {
+		return z.pos - z.origin, &SeekError{Offset: target - z.origin, Size: end - z.origin}
 	}
+	pos, err := z.seek(target, io.SeekStart)
+	return pos - z.origin, err
+}
+
+// seek implements Seek for Readers created with metadata, using offsets
+// from the start of the data.
+func (z *Reader) seek(offset int64, whence int) (int64, error) {
+	z.killReadAhead()
 
 	if whence == io.SeekStart {
 		z.pos = offset
@@ -319,49 +1004,118 @@ func (z *Reader) Seek(offset int64, whence int) (int64, error) {
 	pos := z.pos
 
 	// Calculate seek position
-	blockNumber := pos / int64(z.blockSize)
-	blockStart := z.blockStarts[blockNumber]      // Start position of blocks to read
-	z.blockOffset = int(pos % int64(z.blockSize)) // Offset of data to read in blocks to read
+	var blockStart int64
+	blockStart, z.blockOffset = z.blockFor(pos)
+	start := pos - z.blockOffset
+	var dict []byte
+	if p, ok := z.refinedPoint(pos, start); ok && z.cache == nil {
+		blockStart, start, dict = p.comp, p.pos, p.dict
+		z.blockOffset = pos - p.pos
+	}
 
 	// Seek underlying readseeker
-	_, err := z.r.(io.ReadSeeker).Seek(blockStart, io.SeekStart)
+	err := z.seekSource(blockStart)
 	if err != nil {
 		return pos, err
 	}
 
 	// Reset everything
-	z.bufr = makeReader(z.r)
 	z.size = 0
 	z.roff = 0
 	z.err = nil
+	z.checksumErr = nil
+	z.atEnd = false
 	z.verifyChecksum = false
 
 	// Account for uninitialized values
 	if z.concurrentBlocks <= 0 {
 		z.concurrentBlocks = defaultBlocks
 	}
-	if z.blockSize <= 512 {
+	if z.blockSize < minReadBlockSize {
 		z.blockSize = defaultBlockSize
 	}
 
 	z.blockPool = make(chan []byte, z.concurrentBlocks)
 	for i := 0; i < z.concurrentBlocks; i++ {
-		z.blockPool <- make([]byte, z.blockSize)
+		z.blockPool <- nil // allocated by the read-ahead when needed
 	}
 
 	// We are not reading the header so we have to this here
-	z.decompressor = flate.NewReader(z.bufr)
-	z.doReadAhead()
+	z.decompressor = z.refine(z.newDecompressorDict(start, dict), start, pos, dict)
+	z.startRA = true
+	z.current = nil
+	if z.cache != nil {
+		if err := z.loadCachedBlock(pos); err != nil {
+			z.err = err
+			return pos, err
+		}
+	}
 	return pos, err
 }
 
+// SetConcurrency sets how the Reader decompresses ahead of its caller:
+// data is decompressed into buffers of blockSize bytes, and up to blocks
+// of them are filled before they are read. A single gzip stream is decompressed
+// sequentially, so this overlaps decompression with the work of the
+// caller rather than splitting it; larger buffers mainly reduce the
+// overhead per buffer for bulk reads such as WriteTo. The output does not
+// change.
+//
+// Up to blocks*blockSize bytes are allocated for decompressed data.
+// blockSize must be at least 512 bytes and blocks at least 1. The
+// arguments are in the order of Writer.SetConcurrency and NewReaderN. The
+// defaults are those of NewReader: 4 blocks of 1 MB, or of the metadata
+// block size for seeking readers. The values are kept by Reset and Seek.
+//
+// SetConcurrency must be called before reading, or after Reset or Seek;
+// it returns an error while decompression is under way.
+func (z *Reader) SetConcurrency(blockSize, blocks int) error {
+	if blockSize < minReadBlockSize {
+		return fmt.Errorf("gzip: block size %d is smaller than %d", blockSize, minReadBlockSize)
+	}
+	if blocks < 1 {
+		return errors.New("gzip: blocks must be at least 1")
+	}
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	if z.activeRA {
+		return errors.New("gzip: SetConcurrency called while reading")
+	}
+	z.concurrentBlocks = blocks
+	z.blockSize = blockSize
+	z.blockPool = make(chan []byte, blocks)
+	for i := 0; i < blocks; i++ {
+		z.blockPool <- nil // allocated by the read-ahead when needed
+	}
+	return nil
+}
+
+// SetReadBufferSize sets the size of the buffer compressed data is read
+// into from sources that do not implement io.ByteReader. Small buffers
+// save memory when many Readers are open, large ones mean fewer, larger
+// reads from the source. The default is 4096 bytes, and n must be at
+// least 64.
+//
+// It takes effect at the next Reset, and at the next Seek of Readers
+// created with metadata. To use it from the start, call it on a zero
+// Reader before Reset.
+func (z *Reader) SetReadBufferSize(n int) error {
+	if n < minReadBufferSize {
+		return fmt.Errorf("gzip: read buffer size %d is smaller than %d", n, minReadBufferSize)
+	}
+	z.readBufSize = n
+	return nil
+}
+
 // Multistream controls whether the reader supports multistream files.
 //
-// If enabled (the default), the Reader expects the input to be a sequence
-// of individually gzipped data streams, each with its own header and
-// trailer, ending at EOF. The effect is that the concatenation of a sequence
-// of gzipped files is treated as equivalent to the gzip of the concatenation
-// of the sequence. This is standard behavior for gzip readers.
+// If enabled (the default, except for Readers with metadata), the Reader
+// expects the input to be a sequence of individually gzipped data streams,
+// each with its own header and trailer, ending at EOF. The effect is that
+// the concatenation of a sequence of gzipped files is treated as
+// equivalent to the gzip of the concatenation of the sequence. This is
+// standard behavior for gzip readers. Readers with metadata read on
+// through the members the metadata covers in either mode.
 //
 // Calling Multistream(false) disables this behavior; disabling the behavior
 // can be useful when reading file formats that distinguish individual gzip
@@ -369,41 +1123,205 @@ func (z *Reader) Seek(offset int64, whence int) (int64, error) {
 // In this mode, when the Reader reaches the end of the data stream,
 // Read returns io.EOF. If the underlying reader implements io.ByteReader,
 // it will be left positioned just after the gzip stream.
-// To start the next stream, call z.Reset(r) followed by z.Multistream(false).
-// If there is no next stream, z.Reset(r) will return io.EOF.
+// To start the next stream, call z.Reset(r) followed by z.Multistream(false),
+// or z.ResetKeepOptions(r). If there is no next stream, both return io.EOF.
 func (z *Reader) Multistream(ok bool) {
 	z.multistream = ok
 }
 
+// StreamInfo describes a gzip stream.
+type StreamInfo struct {
+	Name     string    // file name from the header
+	Comment  string    // comment from the header
+	ModTime  time.Time // modification time from the header
+	OS       byte      // operating system type from the header
+	Size     int64     // uncompressed size, or -1 if unknown
+	Seekable bool      // whether the Reader supports Seek
+}
+
+// IsText reports whether the header has the FTEXT flag set, meaning that
+// the data is probably text. It is a hint only and is the same as z.Text.
+func (z *Reader) IsText() bool {
+	return z.Text
+}
+
+// Info returns the header fields of the first member and what is known
+// about the stream from its metadata.
+func (z *Reader) Info() StreamInfo {
+	info := StreamInfo{
+		Name:     z.Name,
+		Comment:  z.Comment,
+		ModTime:  z.ModTime,
+		OS:       z.OS,
+		Size:     -1,
+		Seekable: z.canSeek,
+	}
+	if z.canSeek || z.forward {
+		info.Size = z.isize
+	}
+	if z.limited {
+		info.Size = z.limit - z.origin
+	}
+	return info
+}
+
+// SetIgnoreTrailingGarbage controls how data following a complete member
+// is handled when reading multistream files.
+//
+// By default the data must be another gzip member, and anything else
+// makes Read return an error. With SetIgnoreTrailingGarbage(true), data
+// that does not start with a valid gzip header ends the stream instead
+// and Read returns io.EOF after the last valid member. Errors of the
+// underlying reader are still returned.
+// The setting is kept across calls to Reset.
+func (z *Reader) SetIgnoreTrailingGarbage(ok bool) {
+	z.noGarbage = ok
+}
+
+// SetUTF8Names controls how the Name and Comment header fields are decoded.
+//
+// The format specifies ISO 8859-1 (Latin-1) for them, but some tools store
+// UTF-8 instead, which then decodes to mojibake. With SetUTF8Names(true),
+// strings that are valid UTF-8 are used as they are, and others are
+// decoded as Latin-1 as usual. RawName returns the undecoded name in
+// either case. The setting applies from the next header read, so it
+// should be set on a zero Reader before calling Reset, and it is kept
+// across calls to Reset.
+func (z *Reader) SetUTF8Names(ok bool) {
+	z.utf8Names = ok
+}
+
+// SetStrict controls whether headers must conform strictly to RFC 1952.
+//
+// By default, like compress/gzip, the reserved bits of the FLG header byte
+// are ignored. With SetStrict(true), a member whose header has any of them
+// set is rejected with ErrHeader. A compression method other than deflate
+// is always rejected. The setting applies from the next header read, so
+// it should be set on a zero Reader before calling Reset, and it is kept
+// across calls to Reset.
+func (z *Reader) SetStrict(ok bool) {
+	z.strict = ok
+}
+
+// RawName returns the bytes of the name stored in the header of the
+// first member, without the terminating NUL, or nil if there is none.
+// The returned slice must not be modified.
+func (z *Reader) RawName() []byte {
+	if len(z.rawName) == 0 {
+		return nil
+	}
+	return z.rawName
+}
+
+// SetReturnPartialOnChecksumError controls what happens when the checksum
+// or size in a member's trailer does not match the decompressed data.
+//
+// By default Read and WriteTo stop with ErrChecksum at the end of that
+// member. With SetReturnPartialOnChecksumError(true), reading continues
+// with any following members, all decompressed data is returned, and
+// ErrChecksum is reported in place of io.EOF at the end of the stream.
+// This allows recovering data from damaged files. Errors in the
+// compressed data itself still stop reading immediately.
+// The setting is kept across calls to Reset.
+func (z *Reader) SetReturnPartialOnChecksumError(ok bool) {
+	z.partialOnChecksum = ok
+}
+
+// SetSkipChecksum controls whether the checksum and size in the trailer
+// of each member are checked. Checking is the default and should only be
+// disabled for data that is trusted and already protected against
+// corruption, for example by a checksum of the compressed file: without
+// it, damaged data is only noticed if it happens to break the deflate
+// format, and is otherwise returned as if it were correct. In return the
+// CRC-32 of the decompressed data is not computed, which saves CPU time
+// on large reads. It must be set before reading and is kept across calls
+// to Reset.
+func (z *Reader) SetSkipChecksum(skip bool) {
+	z.skipChecksum = skip
+}
+
+// SetProgressCallback sets a function that is called as decompressed data
+// is returned by Read and WriteTo. It receives the number of uncompressed
+// bytes returned so far and the total uncompressed size, which is -1
+// unless the Reader was created with metadata.
+//
+// The callback is called at most once per decompressed block, so it adds
+// no per-byte overhead. It is called from the goroutine calling Read or
+// WriteTo. The setting is kept across calls to Reset.
+func (z *Reader) SetProgressCallback(fn func(uncompressed, total int64)) {
+	z.progress = fn
+}
+
+func (z *Reader) reportProgress() {
+	if z.progress == nil {
+		return
+	}
+	total := int64(-1)
+	if z.canSeek || z.forward {
+		total = z.isize
+	}
+	z.progress(z.pos, total)
+}
+
+// nextMember reads the header of the member following the current one.
+func (z *Reader) nextMember() error {
+	if z.skipping() && !z.noGarbage {
+		return z.skipToMember(false)
+	}
+	err := z.readHeader(false)
+	if z.noGarbage && isGarbage(err) {
+		z.err = io.EOF
+		return io.EOF
+	}
+	return err
+}
+
+// isGarbage reports whether err, returned by readHeader after a member,
+// means that the data following the member is not another member: it does
+// not start with a gzip header, or it is too short to hold one. Errors of
+// the underlying reader are not garbage.
+func isGarbage(err error) bool {
+	return err == ErrHeader || err == io.ErrUnexpectedEOF
+}
+
 // GZIP (RFC 1952) is little-endian, unlike ZLIB (RFC 1950).
 func get4(p []byte) uint32 {
 	return uint32(p[0]) | uint32(p[1])<<8 | uint32(p[2])<<16 | uint32(p[3])<<24
 }
 
-func (z *Reader) readString() (string, error) {
-	var err error
+// readString reads a NUL-terminated header string. The raw bytes are
+// left in z.buf[:len(raw)] until the next read.
+func (z *Reader) readString() (s string, raw []byte, err error) {
 	needconv := false
 	for i := 0; ; i++ {
 		if i >= len(z.buf) {
-			return "", ErrHeader
+			return "", nil, ErrHeader
 		}
 		z.buf[i], err = z.bufr.ReadByte()
+		if err == io.EOF {
+			// The string is not terminated.
+			return "", nil, ErrHeader
+		}
 		if err != nil {
-			return "", err
+			return "", nil, err
 		}
 		if z.buf[i] > 0x7f {
 			needconv = true
 		}
 		if z.buf[i] == 0 {
+			raw = z.buf[0:i]
+			if needconv && z.utf8Names && utf8.Valid(raw) {
+				return string(raw), raw, nil
+			}
 			// GZIP (RFC 1952) specifies that strings are NUL-terminated ISO 8859-1 (Latin-1).
 			if needconv {
 				s := make([]rune, 0, i)
-				for _, v := range z.buf[0:i] {
+				for _, v := range raw {
 					s = append(s, rune(v))
 				}
-				return string(s), nil
+				return string(s), raw, nil
 			}
-			return string(z.buf[0:i]), nil
+			return string(raw), raw, nil
 		}
 	}
 }
@@ -416,7 +1334,64 @@ func (z *Reader) read2() (uint32, error) {
 	return uint32(z.buf[0]) | uint32(z.buf[1])<<8, nil
 }
 
+// ReadHeader reads a gzip header from r and returns its fields without
+// reading any of the compressed data that follows, so r is left positioned
+// at the start of the deflate data. Unless r implements io.ByteReader, it
+// is read one byte at a time for the variable length fields; wrap it in a
+// bufio.Reader if that is too slow and the position does not matter.
+// ErrHeader is returned for an invalid header, including one with a
+// header checksum (FHCRC) that does not match.
+func ReadHeader(r io.Reader) (Header, error) {
+	br, ok := r.(flate.Reader)
+	if !ok {
+		br = &byteReader{r: r}
+	}
+	z := &Reader{bufr: br, digest: crc32.NewIEEE()}
+	err := z.parseHeader(true)
+	return z.Header, err
+}
+
+// byteReader implements io.ByteReader for r without reading ahead.
+type byteReader struct {
+	r   io.Reader
+	buf [1]byte
+}
+
+func (b *byteReader) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
+
+func (b *byteReader) ReadByte() (byte, error) {
+	_, err := io.ReadFull(b.r, b.buf[:])
+	return b.buf[0], err
+}
+
 func (z *Reader) readHeader(save bool) error {
+	err := z.parseHeader(save)
+	z.countInput()
+	if err != nil {
+		return err
+	}
+	z.digest.Reset()
+	if save {
+		z.decompressor = z.newDecompressor(0)
+	} else {
+		z.decompressor = flate.NewReader(z.bufr)
+	}
+	z.startRA = true
+	return nil
+}
+
+// parseHeader reads the gzip header, storing its fields in z.Header if
+// save is set.
+//
+// It does not use ParseHeaderStrict, which needs the whole header in a
+// slice: the length of the header is only known once it has been parsed,
+// and reading ahead from the stream would take deflate data the
+// decompressor reads from z.bufr. Unlike ParseHeaderStrict, it also keeps
+// the raw name, decodes UTF-8 names, calls the subfield handlers and,
+// unless SetStrict is used, accepts reserved flags.
+func (z *Reader) parseHeader(save bool) error {
 	_, err := io.ReadFull(z.bufr, z.buf[0:10])
 	if err != nil {
 		z.err = err
@@ -426,10 +1401,22 @@ func (z *Reader) readHeader(save bool) error {
 		return ErrHeader
 	}
 	z.flg = z.buf[3]
+	if z.strict && z.flg&flagReserved != 0 {
+		return ErrHeader
+	}
 	if save {
-		z.ModTime = time.Unix(int64(get4(z.buf[4:8])), 0)
-		// z.buf[8] is xfl, ignored
+		// Fields not present in this header must not keep the values
+		// from a previous stream.
+		z.Header = Header{}
+		// A zero MTIME means no time stamp is available.
+		if t := get4(z.buf[4:8]); t > 0 {
+			z.ModTime = time.Unix(int64(t), 0)
+		}
+		z.xfl = z.buf[8]
 		z.OS = z.buf[9]
+		z.Text = z.flg&flagText != 0
+		z.HeaderCRC = z.flg&flagHdrCrc != 0
+		z.ReservedFlags = z.flg & flagReserved
 	}
 	z.digest.Reset()
 	z.digest.Write(z.buf[0:10])
@@ -439,29 +1426,38 @@ func (z *Reader) readHeader(save bool) error {
 		if err != nil {
 			return err
 		}
+		z.digest.Write(z.buf[0:2])
 		data := make([]byte, n)
 		if _, err = io.ReadFull(z.bufr, data); err != nil {
 			return err
 		}
+		z.digest.Write(data)
 		if save {
 			z.Extra = data
 		}
 	}
 
 	var s string
+	var raw []byte
+	if save {
+		z.rawName = z.rawName[:0]
+	}
 	if z.flg&flagName != 0 {
-		if s, err = z.readString(); err != nil {
+		if s, raw, err = z.readString(); err != nil {
 			return err
 		}
+		z.digest.Write(z.buf[:len(raw)+1])
 		if save {
 			z.Name = s
+			z.rawName = append(z.rawName, raw...)
 		}
 	}
 
 	if z.flg&flagComment != 0 {
-		if s, err = z.readString(); err != nil {
+		if s, raw, err = z.readString(); err != nil {
 			return err
 		}
+		z.digest.Write(z.buf[:len(raw)+1])
 		if save {
 			z.Comment = s
 		}
@@ -477,10 +1473,9 @@ func (z *Reader) readHeader(save bool) error {
 			return ErrHeader
 		}
 	}
-
-	z.digest.Reset()
-	z.decompressor = flate.NewReader(z.bufr)
-	z.doReadAhead()
+	if save && z.Extra != nil {
+		return callSubfieldHandlers(z.Extra)
+	}
 	return nil
 }
 
@@ -508,6 +1503,7 @@ func (z *Reader) killReadAhead() error {
 // Will return on error (including io.EOF)
 // or when z.closeReader is closed.
 func (z *Reader) doReadAhead() {
+	z.startRA = false
 	z.mu.Lock()
 	defer z.mu.Unlock()
 	z.activeRA = true
@@ -515,7 +1511,7 @@ func (z *Reader) doReadAhead() {
 	if z.concurrentBlocks <= 0 {
 		z.concurrentBlocks = defaultBlocks
 	}
-	if z.blockSize <= 512 {
+	if z.blockSize < minReadBlockSize {
 		z.blockSize = defaultBlockSize
 	}
 	ra := make(chan read, z.concurrentBlocks)
@@ -528,12 +1524,14 @@ func (z *Reader) doReadAhead() {
 	z.size = 0
 	z.current = nil
 	decomp := z.decompressor
+	skipChecksum := z.skipChecksum
 
 	go func() {
 		// We hold a local reference to digest, since
 		// it way be changed by reset.
 		digest := z.digest
 		var wg sync.WaitGroup
+		var hashing []byte // the buffer being checksummed while wg is not done
 		defer func() {
 			wg.Wait()
 			closeErr <- decomp.Close()
@@ -547,7 +1545,15 @@ func (z *Reader) doReadAhead() {
 			case <-closeReader:
 				return
 			}
+			if cap(buf) < z.blockSize {
+				buf = make([]byte, z.blockSize)
+			}
 			buf = buf[0:z.blockSize]
+			if len(hashing) > 0 && &hashing[0] == &buf[0] {
+				// The caller passed the buffer back before its checksum
+				// was done.
+				wg.Wait()
+			}
 			// Try to fill the buffer
 			n, err := io.ReadFull(decomp, buf)
 			if err == io.ErrUnexpectedEOF {
@@ -566,13 +1572,20 @@ func (z *Reader) doReadAhead() {
 				buf = buf[0:n]
 			}
 			wg.Wait()
-			wg.Add(1)
-			go func() {
-				digest.Write(buf)
-				wg.Done()
-			}()
+			if !skipChecksum {
+				wg.Add(1)
+				go func() {
+					digest.Write(buf)
+					wg.Done()
+				}()
+				hashing = buf
+			}
 			z.size += uint32(n)
-			z.pos += int64(n)
+			atomic.AddInt64(&z.decoded, int64(n))
+			z.countInput()
+			if err == nil {
+				err = z.checkExpansion()
+			}
 
 			// If we return any error, out digest must be ready
 			if err != nil {
@@ -592,40 +1605,56 @@ func (z *Reader) doReadAhead() {
 }
 
 func (z *Reader) Read(p []byte) (n int, err error) {
+	if z.limited {
+		if z.pos >= z.limit {
+			return 0, io.EOF
+		}
+		if rest := z.limit - z.pos; int64(len(p)) > rest {
+			p = p[:rest]
+		}
+	}
+	if z.err == nil && len(p) < len(z.current)-z.roff {
+		// Small reads are served from the current block.
+		n = copy(p, z.current[z.roff:])
+		z.roff += n
+		z.pos += int64(n)
+		return n, nil
+	}
 	if z.err != nil {
 		return 0, z.err
 	}
+	if z.atEnd {
+		// All blocks have been passed on and the trailer has been read.
+		return 0, z.endErr()
+	}
 	if len(p) == 0 {
 		return 0, nil
 	}
+	if z.startRA && len(z.current) == 0 {
+		z.doReadAhead()
+	}
 
 	for {
 		if len(z.current) == 0 && !z.lastBlock {
-			read := <-z.readAhead
-
-			if read.err != nil {
-				// If not nil, the reader will have exited
-				z.closeReader = nil
-
-				if read.err != io.EOF {
-					z.err = read.err
-					return
-				}
-				if read.err == io.EOF {
-					z.lastBlock = true
-					err = nil
-				}
+			if err := z.nextBlock(); err != nil {
+				return 0, err
+			}
+			if len(z.current) == 0 && !z.lastBlock {
+				// The block was before the seek position.
+				continue
+			}
+			if z.current == nil {
+				break
 			}
-			z.current = read.b
-			z.roff = z.blockOffset
-			z.blockOffset = 0
 		}
 		avail := z.current[z.roff:]
 		if len(p) >= len(avail) {
 			// If len(p) >= len(current), return all content of current
 			n = copy(p, avail)
+			z.pos += int64(n)
 			z.blockPool <- z.current
 			z.current = nil
+			z.reportProgress()
 			if z.lastBlock {
 				err = io.EOF
 				break
@@ -633,32 +1662,28 @@ func (z *Reader) Read(p []byte) (n int, err error) {
 		} else {
 			// We copy as much as there is space for
 			n = copy(p, avail)
+			z.pos += int64(n)
 			z.roff += n
 		}
 		return
 	}
 
 	// Finished file; check checksum + size.
-	if _, err := io.ReadFull(z.bufr, z.buf[0:8]); err != nil {
+	if err := z.readTrailer(); err != nil && !z.recordDamage(err) {
 		z.err = err
 		return 0, err
 	}
-	if z.verifyChecksum {
-		crc32, isize := get4(z.buf[0:4]), get4(z.buf[4:8])
-		sum := z.digest.Sum32()
-		if sum != crc32 || isize != z.size {
-			z.err = ErrChecksum
-			return 0, z.err
-		}
-	}
 
 	// File is ok; should we attempt reading one more?
-	if !z.multistream {
-		return 0, io.EOF
+	if !z.multistream && !z.metaMore() {
+		return 0, z.endErr()
 	}
 
 	// Is there another?
-	if err = z.readHeader(false); err != nil {
+	if err = z.nextMember(); err != nil {
+		if err == io.EOF {
+			err = z.endErr()
+		}
 		z.err = err
 		return
 	}
@@ -667,12 +1692,112 @@ func (z *Reader) Read(p []byte) (n int, err error) {
 	return z.Read(p)
 }
 
+// ReadByte implements io.ByteReader. Bytes are taken from the decompressed
+// block directly, so reading byte by byte, as varint decoders do, costs
+// little more than a Read of the same data. ReadByte can be mixed freely
+// with Read, WriteTo and Seek.
+func (z *Reader) ReadByte() (byte, error) {
+	if z.err == nil && z.roff+1 < len(z.current) && (!z.limited || z.pos < z.limit) {
+		// Not the last byte of the block, which Read hands back to the pool.
+		c := z.current[z.roff]
+		z.roff++
+		z.pos++
+		return c, nil
+	}
+	var b [1]byte
+	for {
+		n, err := z.Read(b[:])
+		if n == 1 {
+			return b[0], nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// nextBlock makes the next block of the read-ahead the current block,
+// skipping the data before the seek position. The current block is left
+// empty if it lies before that position or if the stream has ended.
+func (z *Reader) nextBlock() error {
+	if z.startRA {
+		// The block served from the cache has been read.
+		z.doReadAhead()
+	}
+	read := <-z.readAhead
+	if read.err != nil {
+		// If not nil, the reader will have exited
+		z.closeReader = nil
+
+		if read.err != io.EOF {
+			if z.recordDamage(read.err) {
+				z.blockPool <- read.b
+				err := z.skipToMember(true)
+				if err == io.EOF {
+					err = z.endErr()
+				}
+				if err != nil {
+					z.err = err
+				}
+				return err
+			}
+			z.err = read.err
+			return z.err
+		}
+		z.lastBlock = true
+	}
+	z.current = read.b
+	z.roff = 0
+	if z.blockOffset > 0 {
+		// Discard data before the seek position
+		if z.blockOffset >= int64(len(z.current)) {
+			z.blockOffset -= int64(len(z.current))
+			z.blockPool <- z.current
+			z.current = nil
+			return nil
+		}
+		z.roff = int(z.blockOffset)
+		z.blockOffset = 0
+	}
+	if err := z.checkBlockSize(); err != nil {
+		return err
+	}
+	z.observeBlock()
+	return nil
+}
+
 // WriteTo writes data to w until the buffer is drained or an error occurs.
 // The return value n is the number of bytes written; it always fits into an
 // int, but it is int64 to match the io.WriterTo interface. Any error
 // encountered during the write is also returned.
+//
+// io.Copy uses WriteTo, so copying from a Reader with metadata after a
+// Seek decompresses from the block holding the new position, and only the
+// compressed data from that block on is read.
+//
+// If the size of the data is known from the metadata and w has a Grow
+// method, as *bytes.Buffer does, WriteTo first calls it with the size of
+// the rest of the data, so that w is not grown repeatedly.
 func (z *Reader) WriteTo(w io.Writer) (n int64, err error) {
-	var buf []byte
+	if z.limited {
+		if z.pos >= z.limit {
+			return 0, nil
+		}
+		w = &rangeWriter{w: w, n: z.limit - z.pos}
+		defer func() {
+			if err == errRangeDone {
+				err = nil
+			}
+		}()
+	}
+	if z.atEnd && z.err == nil {
+		// All blocks have been passed on and the trailer has been read.
+		return 0, z.endWriteTo()
+	}
+	z.growFor(w)
+	// Writes to ioutil.Discard, which is io.Discard, are skipped, so that
+	// scans such as DrainAndClose only decompress and verify the data.
+	discard := w == ioutil.Discard
 	var total int64 = 0
 	for {
 		if z.err != nil {
@@ -680,67 +1805,93 @@ func (z *Reader) WriteTo(w io.Writer) (n int64, err error) {
 		}
 		// We write both to output and digest.
 		for {
-			// Read from input
-			read := <-z.readAhead
-			if read.err != nil {
-				// If not nil, the reader will have exited
-				z.closeReader = nil
-
-				if read.err != io.EOF {
-					z.err = read.err
-					return total, z.err
+			// Continue with the block left by Read or a failed write, if any.
+			if len(z.current) == 0 {
+				if z.startRA {
+					z.doReadAhead()
 				}
-				if read.err == io.EOF {
+				if z.lastBlock {
+					break
+				}
+				read, err := z.receive()
+				if err != nil {
+					return total, err
+				}
+				if read.err != nil {
+					// If not nil, the reader will have exited
+					z.closeReader = nil
+
+					if read.err != io.EOF {
+						if z.recordDamage(read.err) {
+							z.blockPool <- read.b
+							err := z.skipToMember(true)
+							if err == io.EOF {
+								return total, z.endWriteTo()
+							}
+							if err != nil {
+								z.err = err
+								return total, err
+							}
+							continue
+						}
+						z.err = read.err
+						return total, z.err
+					}
 					z.lastBlock = true
-					err = nil
 				}
-			}
-
-			// discard initial bytes if we have a block offset
-			if z.blockOffset > 0 {
-				buf = read.b[z.blockOffset:]
-				z.blockOffset = 0
-			} else {
-				buf = read.b
+				z.current = read.b
+				z.roff = 0
+				// discard initial bytes if we have a block offset
+				if z.blockOffset >= int64(len(z.current)) {
+					z.blockOffset -= int64(len(z.current))
+					z.roff = len(z.current)
+				} else if z.blockOffset > 0 {
+					z.roff = int(z.blockOffset)
+					z.blockOffset = 0
+				}
+				if err := z.checkBlockSize(); err != nil {
+					return total, err
+				}
+				z.observeBlock()
 			}
 			// Write what we got
-			n, err := w.Write(buf)
-			if n != len(buf) {
-				return total, io.ErrShortWrite
+			buf := z.current[z.roff:]
+			n, err := len(buf), error(nil)
+			if !discard {
+				n, err = w.Write(buf)
 			}
+			z.roff += n
 			total += int64(n)
+			z.pos += int64(n)
+			if err == nil && n != len(buf) {
+				err = io.ErrShortWrite
+			}
+			if z.roff == len(z.current) {
+				// Put block back
+				z.blockPool <- z.current
+				z.current = nil
+				z.reportProgress()
+			}
 			if err != nil {
+				// Keep the rest of the block, if any, for the next call.
 				return total, err
 			}
-			// Put block back
-			z.blockPool <- read.b
-			if z.lastBlock {
-				break
-			}
 		}
 
 		// Finished file; check checksum + size.
-		if _, err := io.ReadFull(z.bufr, z.buf[0:8]); err != nil {
+		if err := z.readTrailer(); err != nil && !z.recordDamage(err) {
 			z.err = err
 			return total, err
 		}
-		if z.verifyChecksum {
-			crc32, isize := get4(z.buf[0:4]), get4(z.buf[4:8])
-			sum := z.digest.Sum32()
-			if sum != crc32 || isize != z.size {
-				z.err = ErrChecksum
-				return total, z.err
-			}
-		}
 		// File is ok; should we attempt reading one more?
-		if !z.multistream {
-			return total, nil
+		if !z.multistream && !z.metaMore() {
+			return total, z.endWriteTo()
 		}
 
 		// Is there another?
-		err = z.readHeader(false)
+		err = z.nextMember()
 		if err == io.EOF {
-			return total, nil
+			return total, z.endWriteTo()
 		}
 		if err != nil {
 			z.err = err
@@ -749,7 +1900,350 @@ func (z *Reader) WriteTo(w io.Writer) (n int64, err error) {
 	}
 }
 
-// Close closes the Reader. It does not close the underlying io.Reader.
+// CopyRange writes the length uncompressed bytes starting at offset start
+// to w and returns the number of bytes written. The range is clamped to
+// the end of the stream, so fewer bytes are written if it extends beyond
+// it, without an error. The Reader seeks to start unless it is already
+// positioned there, and is left positioned after the last byte written.
+// It uses WriteTo, so blocks are written to w without extra copies.
+func (z *Reader) CopyRange(w io.Writer, start, length int64) (int64, error) {
+	if length < 0 {
+		return 0, ErrInvalidSeek
+	}
+	if start != z.pos-z.origin {
+		if _, err := z.Seek(start, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+	if end := z.dataEnd(); z.canSeek && length > end-z.origin-start {
+		length = end - z.origin - start
+	}
+	return z.writeToN(w, length)
+}
+
+// WriteToN is like WriteTo, but writes at most n bytes, and leaves the
+// Reader positioned after the last byte written, so that reading can
+// continue from there. It returns io.EOF if the stream ends before n bytes
+// have been written.
+func (z *Reader) WriteToN(w io.Writer, n int64) (int64, error) {
+	if n < 0 {
+		return 0, errors.New("gzip: negative count")
+	}
+	written, err := z.writeToN(w, n)
+	if err == nil && written < n {
+		err = io.EOF
+	}
+	return written, err
+}
+
+// writeToN writes up to n bytes with WriteTo.
+func (z *Reader) writeToN(w io.Writer, n int64) (int64, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	written, err := z.WriteTo(&rangeWriter{w: w, n: n})
+	if err == errRangeDone {
+		err = nil
+	}
+	return written, err
+}
+
+// A grower can reserve space for data written to it, as *bytes.Buffer does.
+type grower interface {
+	Grow(n int)
+}
+
+// growFor reserves space in w for the rest of the data, if w is a grower
+// and the size of the data is known.
+func (z *Reader) growFor(w io.Writer) {
+	g, ok := w.(grower)
+	if !ok || (!z.canSeek && !z.forward) || z.err != nil {
+		return
+	}
+	n := z.dataEnd() - z.pos
+	if n <= 0 || int64(int(n)) != n {
+		return
+	}
+	g.Grow(int(n))
+}
+
+// errRangeDone is returned by rangeWriter once the range has been written.
+var errRangeDone = errors.New("gzip: range done")
+
+// rangeWriter writes up to n bytes to w.
+type rangeWriter struct {
+	w io.Writer
+	n int64
+}
+
+// Grow reserves space in the underlying writer for at most the rest of
+// the range.
+func (r *rangeWriter) Grow(n int) {
+	if g, ok := r.w.(grower); ok && r.n > 0 {
+		if int64(n) > r.n {
+			n = int(r.n)
+		}
+		g.Grow(n)
+	}
+}
+
+func (r *rangeWriter) Write(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, errRangeDone
+	}
+	done := false
+	if int64(len(p)) >= r.n {
+		p = p[:r.n]
+		done = true
+	}
+	n, err := r.w.Write(p)
+	r.n -= int64(n)
+	if err == nil && done {
+		err = errRangeDone
+	}
+	return n, err
+}
+
+// WriteToBuffer is like WriteTo, but decompresses into buf and writes
+// from there instead of using the read-ahead buffers, so no memory is
+// allocated apart from the decompressor state (about 40 KiB, most of it
+// the 32 KiB deflate window). buf must be at least 512 bytes long;
+// io.ErrShortBuffer is returned otherwise. Larger buffers mean fewer,
+// larger writes to w.
+//
+// The memory saving only applies if Read or WriteTo have not been called
+// since the Reader was created, reset or seeked, since that starts the
+// read-ahead. In that case, and for Readers created by
+// NewSeekableSectionReader, WriteToBuffer behaves like WriteTo. Like
+// WriteTo, it grows w to the size of the rest of the data if it can.
+func (z *Reader) WriteToBuffer(w io.Writer, buf []byte) (int64, error) {
+	if len(buf) < minReadBlockSize {
+		return 0, io.ErrShortBuffer
+	}
+	if !z.startRA || len(z.current) > 0 || z.limited {
+		return z.WriteTo(w)
+	}
+	z.growFor(w)
+	var total int64
+	for {
+		if z.err != nil {
+			return total, z.err
+		}
+		for {
+			n, err := z.decompressor.Read(buf)
+			if !z.skipChecksum {
+				z.digest.Write(buf[:n])
+			}
+			z.size += uint32(n)
+			atomic.AddInt64(&z.decoded, int64(n))
+			z.countInput()
+			if err == nil {
+				err = z.checkExpansion()
+			}
+			b := buf[:n]
+			if z.blockOffset > 0 {
+				d := z.blockOffset
+				if d > int64(n) {
+					d = int64(n)
+				}
+				b = b[d:]
+				z.blockOffset -= d
+			}
+			if z.expectSize && z.pos-z.origin+int64(len(b)) > z.expectedSize {
+				z.err = ErrSizeMismatch
+				return total, z.err
+			}
+			if len(b) > 0 {
+				if z.observer != nil {
+					z.observer(z.pos-z.origin, b)
+				}
+				written, werr := w.Write(b)
+				total += int64(written)
+				z.pos += int64(written)
+				if werr == nil && written != len(b) {
+					werr = io.ErrShortWrite
+				}
+				if werr != nil {
+					return total, werr
+				}
+				z.reportProgress()
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil && z.recordDamage(err) {
+				if err = z.skipToMember(true); err == nil {
+					continue
+				}
+				if err == io.EOF {
+					return total, z.endWriteTo()
+				}
+			}
+			if err != nil {
+				z.err = err
+				return total, err
+			}
+		}
+
+		// Finished file; check checksum + size.
+		if err := z.readTrailer(); err != nil && !z.recordDamage(err) {
+			z.err = err
+			return total, err
+		}
+		if !z.multistream && !z.metaMore() {
+			return total, z.endWriteTo()
+		}
+		err := z.nextMember()
+		if err == io.EOF {
+			return total, z.endWriteTo()
+		}
+		if err != nil {
+			z.err = err
+			return total, err
+		}
+		z.size = 0
+	}
+}
+
+// readTrailer reads the trailer of the current member and checks the
+// checksum and size, unless that is disabled because the stream was seeked.
+// With SetReturnPartialOnChecksumError a mismatch is recorded and reported
+// at the end of the stream instead.
+func (z *Reader) readTrailer() error {
+	// ReadFull waits for a trailer arriving in pieces. A stream ending
+	// before it is truncated, not at its end.
+	_, err := io.ReadFull(z.bufr, z.buf[0:8])
+	z.countInput()
+	if err != nil {
+		return noEOF(err)
+	}
+	z.trailerSize = get4(z.buf[4:8])
+	if z.verifyChecksum && !z.skipChecksum {
+		if z.padding > 0 {
+			// The padding was decompressed but not passed on.
+			z.digest.Write(make([]byte, z.padding))
+			z.size += uint32(z.padding)
+		}
+		crc32, isize := get4(z.buf[0:4]), get4(z.buf[4:8])
+		sum := z.digest.Sum32()
+		if sum != crc32 || isize != z.size {
+			if !z.partialOnChecksum {
+				return ErrChecksum
+			}
+			z.checksumErr = ErrChecksum
+		}
+	}
+	return nil
+}
+
+// endErr returns the error Read reports at the end of the stream.
+func (z *Reader) endErr() error {
+	z.atEnd = true
+	if z.checksumErr != nil {
+		return z.checksumErr
+	}
+	if z.memberErr != nil {
+		return z.skippedErr()
+	}
+	if z.metaMore() {
+		// The metadata describes data beyond the last member.
+		return io.ErrUnexpectedEOF
+	}
+	if z.shortSize() {
+		return ErrSizeMismatch
+	}
+	if z.memberEnd && !z.multistream && z.moreInput() {
+		return ErrMemberEnd
+	}
+	return io.EOF
+}
+
+// endWriteTo returns the error WriteTo reports at the end of the stream.
+func (z *Reader) endWriteTo() error {
+	z.atEnd = true
+	err := z.checksumErr
+	if err == nil && z.memberErr != nil {
+		err = z.skippedErr()
+	}
+	if err == nil && z.metaMore() {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil && z.shortSize() {
+		err = ErrSizeMismatch
+	}
+	if err != nil {
+		z.err = err
+	}
+	return err
+}
+
+// WellTerminated reports whether the Reader has reached the end of the
+// stream and the stream ends with the empty final block a Writer writes
+// after the last data block. That block is recorded as the last entry of
+// the metadata. A stream that was cut off after a complete block, and
+// whose metadata was taken at that point, decodes without error but
+// reports false.
+//
+// Checking needs the metadata, so WellTerminated always reports false for
+// readers created by NewReader.
+func (z *Reader) WellTerminated() bool {
+	n := len(z.blockStarts)
+	if !z.atEnd || !z.canSeek || n < 3 {
+		return false
+	}
+	start, end := z.blockStarts[n-3], z.blockStarts[n-2]
+	if end-start != int64(len(eofMarker)) {
+		return false
+	}
+	rs, ok := z.r.(io.ReadSeeker)
+	if !ok {
+		return false
+	}
+	pos, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false
+	}
+	defer rs.Seek(pos, io.SeekStart)
+	if _, err := rs.Seek(start, io.SeekStart); err != nil {
+		return false
+	}
+	var marker [2]byte
+	if _, err := io.ReadFull(rs, marker[:]); err != nil {
+		return false
+	}
+	return bytes.Equal(marker[:], eofMarker)
+}
+
+// Close closes the Reader. It does not close the underlying io.Reader,
+// but closes the Readers of the outer layers of a Reader returned by
+// NewNestedReader. Calling Close again has no effect and returns nil.
 func (z *Reader) Close() error {
-	return z.killReadAhead()
+	err := z.killReadAhead()
+	if s, ok := z.r.(*blockSource); ok {
+		s.wait()
+	}
+	if z.outer != nil {
+		if oerr := z.outer.Close(); err == nil {
+			err = oerr
+		}
+	}
+	return err
+}
+
+// DrainAndClose reads and discards the rest of the stream, which verifies
+// the checksums in the trailers, and then closes the Reader. It returns
+// the first error encountered, such as ErrChecksum, so corruption is
+// reported even if the caller stops reading early. If the end of the
+// stream has been reached already, it only closes the Reader.
+//
+// Checksums are not verified after a Seek, see Verify for that.
+func (z *Reader) DrainAndClose() error {
+	_, err := z.WriteTo(ioutil.Discard)
+	if err == io.EOF {
+		err = nil
+	}
+	if cerr := z.Close(); err == nil {
+		err = cerr
+	}
+	return err
 }
@@ -5,19 +5,24 @@
 package sgzip
 
 import (
+	"bufio"
 	"bytes"
 	oldgz "compress/gzip"
 	"crypto/rand"
 	"encoding/gob"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
 	prand "math/rand"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/klauspost/compress/flate"
 	kpgzip "github.com/klauspost/compress/gzip"
 )
 
@@ -69,7 +74,7 @@ var seekingTests = []gunzipTest{
 			BlockSize: defaultBlockSize,
 			Size:      12,
 			BlockData: []uint32{
-				20, 56,
+				20, 14,
 			},
 		},
 		12,
@@ -271,6 +276,34 @@ var errTests = []gunzipTest{
 		0,
 		nil,
 	},
+	{ // concatenation with a corrupt block in the second member
+		"hello.txt",
+		"hello.txt x3 + corrupt member",
+		"hello world\n",
+		[]byte{
+			0x1f, 0x8b, 0x08, 0x08, 0xc8, 0x58, 0x13, 0x4a,
+			0x00, 0x03, 0x68, 0x65, 0x6c, 0x6c, 0x6f, 0x2e,
+			0x74, 0x78, 0x74, 0x00, 0xcb, 0x48, 0xcd, 0xc9,
+			0xc9, 0x57, 0x28, 0xcf, 0x2f, 0xca, 0x49, 0xe1,
+			0x02, 0x00, 0x2d, 0x3b, 0x08, 0xaf, 0x0c, 0x00,
+			0x00, 0x00,
+			0x1f, 0x8b, 0x08, 0x08, 0xc8, 0x58, 0x13, 0x4a,
+			0x00, 0x03, 0x68, 0x65, 0x6c, 0x6c, 0x6f, 0x2e,
+			0x74, 0x78, 0x74, 0x00, 0xff, 0x48, 0xcd, 0xc9,
+			0xc9, 0x57, 0x28, 0xcf, 0x2f, 0xca, 0x49, 0xe1,
+			0x02, 0x00, 0x2d, 0x3b, 0x08, 0xaf, 0x0c, 0x00,
+			0x00, 0x00,
+			0x1f, 0x8b, 0x08, 0x08, 0xc8, 0x58, 0x13, 0x4a,
+			0x00, 0x03, 0x68, 0x65, 0x6c, 0x6c, 0x6f, 0x2e,
+			0x74, 0x78, 0x74, 0x00, 0xcb, 0x48, 0xcd, 0xc9,
+			0xc9, 0x57, 0x28, 0xcf, 0x2f, 0xca, 0x49, 0xe1,
+			0x02, 0x00, 0x2d, 0x3b, 0x08, 0xaf, 0x0c, 0x00,
+			0x00, 0x00,
+		},
+		GzipMetadata{},
+		0,
+		flate.CorruptInputError(1),
+	},
 	{ // has 1 non-empty fixed huffman block then garbage
 		"hello.txt",
 		"hello.txt + garbage",
@@ -384,254 +417,1433 @@ func TestDecompressor(t *testing.T) {
 	}
 }
 
-func TestSeekUnseekable(t *testing.T) {
-	in := bytes.NewReader(emptyStream.gzip)
-	gzip, err := NewReader(in)
+func TestHeaderModTimeOS(t *testing.T) {
+	r, err := NewReader(bytes.NewReader(seekingTests[0].gzip))
 	if err != nil {
-		t.Errorf("%s: NewReader: %v", emptyStream.name, err)
+		t.Fatal(err)
 	}
-	if _, err = gzip.Seek(100000, io.SeekStart); err != ErrUnsupported {
-		t.Errorf("%s: gzip.Seek: %v want %v", emptyStream.name, err, ErrUnsupported)
+	defer r.Close()
+	if want := time.Unix(0x4a1358c8, 0); !r.ModTime.Equal(want) {
+		t.Errorf("ModTime = %v, want %v", r.ModTime, want)
+	}
+	if r.OS != 3 {
+		t.Errorf("OS = %d, want 3", r.OS)
 	}
-	gzip.Close()
-}
 
-func TestInvalidSeek(t *testing.T) {
-	in := bytes.NewReader(emptyStream.gzip)
-	gzip, err := NewSeekingReader(in, &emptyStream.meta)
-	if err != nil {
-		t.Errorf("%s: NewReader: %v", emptyStream.name, err)
+	var buf bytes.Buffer
+	w := oldgz.NewWriter(&buf)
+	w.OS = 11
+	w.Write([]byte("no time"))
+	w.Close()
+	if err := r.Reset(&buf); err != nil {
+		t.Fatal(err)
 	}
-	if _, err = gzip.Seek(100000, io.SeekStart); err != ErrInvalidSeek {
-		t.Errorf("%s: gzip.Seek: %v want %v", emptyStream.name, err, ErrInvalidSeek)
+	if !r.ModTime.IsZero() {
+		t.Errorf("ModTime = %v, want zero time", r.ModTime)
 	}
-	gzip.Close()
-}
-
-func TestDecompressorWithSeek(t *testing.T) {
-	b := new(bytes.Buffer)
-	for _, tt := range seekingTests {
-		fmt.Printf("Name: %s\n", tt.name)
-		in := bytes.NewReader(tt.gzip)
-		gzip, err := NewSeekingReader(in, &tt.meta)
-		if err != nil {
-			t.Errorf("%s: NewReader: %v", tt.name, err)
-			continue
-		}
-		defer gzip.Close()
-		if tt.name != gzip.Name {
-			t.Errorf("%s: got name %s", tt.name, gzip.Name)
-		}
-		b.Reset()
-		if _, err = gzip.Seek(tt.seek, io.SeekStart); err != nil {
-			t.Errorf("%s: gzip.Seek error %v", tt.name, err)
-			continue
-		}
-		n, err := io.Copy(b, gzip)
-		if err != tt.err {
-			t.Errorf("%s: io.Copy: %v want %v", tt.name, err, tt.err)
-		}
-
-		s := b.Bytes()
-		raw := []byte(tt.raw)[tt.seek:]
-		if !bytes.Equal(s, raw) {
-			t.Errorf("%s: got %d-byte %x want %d-byte %x", tt.name, n, s, len(raw), raw)
-		}
+	if r.OS != 11 {
+		t.Errorf("OS = %d, want 11", r.OS)
 	}
 }
 
-func TestReaderAt(t *testing.T) {
-	b := new(bytes.Buffer)
-	tt := seekingTests[2]
-	gzip, err := NewReaderAt(bytes.NewReader(tt.gzip), &tt.meta, tt.seek)
+func TestResetClearsHeader(t *testing.T) {
+	var named, unnamed bytes.Buffer
+	w := NewWriter(&named)
+	w.Name = "name.txt"
+	w.Comment = "comment"
+	w.Extra = []byte("extra")
+	w.ModTime = time.Unix(1e9, 0)
+	w.Write([]byte("named"))
+	w.Close()
+	ow := oldgz.NewWriter(&unnamed)
+	ow.Write([]byte("unnamed"))
+	ow.Close()
+
+	r, err := NewReader(&named)
 	if err != nil {
-		t.Fatalf("NewReaderAt: %v", err)
+		t.Fatal(err)
 	}
-	defer gzip.Close()
-	n, err := io.Copy(b, gzip)
-	if err != nil {
-		t.Errorf("io.Copy: %v", err)
+	defer r.Close()
+	if r.Name != "name.txt" || r.Comment != "comment" {
+		t.Fatalf("got Name %q, Comment %q", r.Name, r.Comment)
 	}
-	s := b.Bytes()
-	raw := []byte(tt.raw)[tt.seek:]
-	if !bytes.Equal(s, raw) {
-		t.Errorf("%s: got %d-byte want %d-byte", tt.name, n, len(raw))
+	if err := r.Reset(&unnamed); err != nil {
+		t.Fatal(err)
+	}
+	if r.Name != "" || r.Comment != "" || r.Extra != nil || !r.ModTime.IsZero() {
+		t.Errorf("header fields kept across Reset: %+v", r.Header)
 	}
 }
 
-func TestDecompressFileWithSeek(t *testing.T) {
-	dat, _ := ioutil.ReadFile("testdata/test.json")
-	dl := len(dat)
-	if len(testbuf) != 200*dl {
-		// Make results predictable
-		testbuf = make([]byte, 200*dl)
-		for j := 0; j < 200; j++ {
-			copy(testbuf[j*dl:j*dl+dl], dat)
-		}
-	}
+func TestReadHeader(t *testing.T) {
+	hdr := []byte{gzipID1, gzipID2, gzipDeflate, flagExtra | flagName | flagComment | flagHdrCrc, 0xc8, 0x58, 0x13, 0x4a, 0, 3}
+	hdr = append(hdr, 2, 0, 'e', 'x')
+	hdr = append(hdr, "name.txt\x00comment\x00"...)
+	sum := crc32.ChecksumIEEE(hdr)
+	hdr = append(hdr, byte(sum), byte(sum>>8))
 
-	br := bytes.NewBuffer(testbuf)
 	var buf bytes.Buffer
-	w, _ := NewWriterLevel(&buf, 6)
-	io.Copy(w, br)
+	w := oldgz.NewWriter(&buf)
+	w.Write([]byte("hello"))
 	w.Close()
-	meta := w.MetaData()
-	//fmt.Printf("%v\n", meta)
+	body := buf.Bytes()[10:]
+	in := append(append([]byte{}, hdr...), body...)
 
-	r, err := NewSeekingReader(bytes.NewReader(buf.Bytes()), &meta)
+	r := bytes.NewReader(in)
+	h, err := ReadHeader(struct{ io.Reader }{r})
 	if err != nil {
-		t.Fatal(err.Error())
-	}
-	if _, err = r.Seek(int64(132*dl), io.SeekStart); err != nil {
-		t.Fatal(err.Error())
+		t.Fatal(err)
 	}
-	decoded, err := ioutil.ReadAll(r)
-	if err != nil {
-		t.Fatal(err.Error())
+	want := Header{Comment: "comment", Extra: []byte("ex"), ModTime: time.Unix(0x4a1358c8, 0), Name: "name.txt", OS: 3, HeaderCRC: true}
+	if !reflect.DeepEqual(h, want) {
+		t.Errorf("got %+v, want %+v", h, want)
 	}
-	if !bytes.Equal(testbuf[132*dl:], decoded) {
-		t.Errorf("decoded content does not match.")
+	if pos := len(in) - r.Len(); pos != len(hdr) {
+		t.Errorf("reader at %d after header, want %d", pos, len(hdr))
 	}
-}
 
-func TestMultiSeek(t *testing.T) {
-	f, err := os.Open("testdata/test.json.gz")
+	zr, err := NewReader(bytes.NewReader(in))
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer f.Close()
-	mf, err := os.Open("testdata/test.json.dat")
-	if err != nil {
-		t.Fatal(err)
+	defer zr.Close()
+	if got, err := ioutil.ReadAll(zr); err != nil || string(got) != "hello" {
+		t.Errorf("got %q, %v", got, err)
 	}
-	defer mf.Close()
-	of, err := os.Open("testdata/test.json")
-	if err != nil {
-		t.Fatal(err)
+
+	hdr[len(hdr)-1]++
+	if _, err := ReadHeader(bytes.NewReader(hdr)); err != ErrHeader {
+		t.Errorf("bad header checksum: got %v, want ErrHeader", err)
 	}
-	defer of.Close()
-	var meta GzipMetadata
-	err = gob.NewDecoder(mf).Decode(&meta)
-	if err != nil {
-		t.Fatalf("Invalid metadata %s", err)
+	if _, err := ReadHeader(bytes.NewReader(hdr[:16])); err != ErrHeader {
+		t.Errorf("truncated name: got %v, want ErrHeader", err)
 	}
-
-	gzip, err := NewSeekingReader(f, &meta)
-	if err != nil {
-		t.Fatalf("NewReader(testdata/test.json.gz): %v", err)
+	if _, err := ReadHeader(bytes.NewReader(hdr[:26])); err != ErrHeader {
+		t.Errorf("truncated comment: got %v, want ErrHeader", err)
 	}
-	defer gzip.Close()
+}
 
-	prand.Seed(1337)
-	var buf1 = make([]byte, 512)
-	var buf2 = make([]byte, 512)
-	for i := 0; i < 10; i++ {
-		pos := prand.Intn(147154)
-		_, err = gzip.Seek(int64(pos), io.SeekStart)
-		if err != nil {
-			t.Errorf("gzip.Seek error %v", err)
+func TestIgnoreTrailingGarbage(t *testing.T) {
+	for _, tt := range gunzipTests {
+		if tt.desc != "hello.txt + garbage" {
+			continue
 		}
-		_, err = of.Seek(int64(pos), io.SeekStart)
+		var r Reader
+		r.SetIgnoreTrailingGarbage(true)
+		if err := r.Reset(bytes.NewReader(tt.gzip)); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(&r)
 		if err != nil {
-			t.Errorf("of.Seek error %v", err)
+			t.Errorf("ReadAll: %v", err)
+		}
+		if string(data) != tt.raw {
+			t.Errorf("got %q, want %q", data, tt.raw)
 		}
 
-		_, err = gzip.Read(buf1)
-		if err != nil {
-			t.Errorf("gzip.Read error %v", err)
+		if err := r.Reset(bytes.NewReader(tt.gzip)); err != nil {
+			t.Fatal(err)
 		}
-		_, err = of.Read(buf2)
-		if err != nil {
-			t.Errorf("of.Read error %v", err)
+		var buf bytes.Buffer
+		if _, err := r.WriteTo(&buf); err != nil {
+			t.Errorf("WriteTo: %v", err)
 		}
-		if !bytes.Equal(buf1, buf2) {
-			t.Errorf("read does not match original file.")
+		if buf.String() != tt.raw {
+			t.Errorf("got %q, want %q", buf.String(), tt.raw)
 		}
 	}
-}
 
-func TestIssue6550(t *testing.T) {
-	f, err := os.Open("testdata/issue6550.gz")
-	if err != nil {
+	// Errors of the source are not garbage.
+	errDisk := errors.New("disk error")
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Write([]byte("hello"))
+	w.Close()
+	var r Reader
+	r.SetIgnoreTrailingGarbage(true)
+	if err := r.Reset(io.MultiReader(&buf, &errReader{errDisk})); err != nil {
 		t.Fatal(err)
 	}
-	defer f.Close()
-	gzip, err := NewReader(f)
-	if err != nil {
-		t.Fatalf("NewReader(testdata/issue6550.gz): %v", err)
-	}
-	defer gzip.Close()
-	done := make(chan bool, 1)
-	go func() {
-		_, err := io.Copy(ioutil.Discard, gzip)
-		if err == nil {
-			t.Errorf("Copy succeeded")
-		} else {
-			t.Logf("Copy failed (correctly): %v", err)
-		}
-		done <- true
-	}()
-	select {
-	case <-time.After(1 * time.Second):
-		t.Errorf("Copy hung")
-	case <-done:
-		// ok
+	if data, err := ioutil.ReadAll(&r); err != errDisk {
+		t.Errorf("ReadAll = %q, %v, want %v", data, err, errDisk)
 	}
 }
 
-func TestInitialReset(t *testing.T) {
+func TestReturnPartialOnChecksumError(t *testing.T) {
+	in, compressed, _ := testSeekableData(t, 100000, 32<<10)
+	bad := append([]byte(nil), compressed...)
+	bad[len(bad)-8]++ // corrupt the CRC of the first member
+	stream := append(bad, compressed...)
+	want := append(append([]byte(nil), in...), in...)
+
 	var r Reader
-	if err := r.Reset(bytes.NewReader(seekingTests[1].gzip)); err != nil {
-		t.Error(err)
+	if err := r.Reset(bytes.NewReader(stream)); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadAll(&r); err != ErrChecksum || len(data) != len(in) {
+		t.Fatalf("strict: got %d bytes, err %v", len(data), err)
+	}
+
+	r.SetReturnPartialOnChecksumError(true)
+	if err := r.Reset(bytes.NewReader(stream)); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(&r)
+	if err != ErrChecksum {
+		t.Errorf("ReadAll: got %v, want ErrChecksum", err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("ReadAll: got %d bytes, want %d", len(data), len(want))
+	}
+
+	if err := r.Reset(bytes.NewReader(stream)); err != nil {
+		t.Fatal(err)
 	}
 	var buf bytes.Buffer
-	if _, err := io.Copy(&buf, &r); err != nil {
-		t.Error(err)
+	if _, err := r.WriteTo(&buf); err != ErrChecksum {
+		t.Errorf("WriteTo: got %v, want ErrChecksum", err)
 	}
-	if s := buf.String(); s != seekingTests[1].raw {
-		t.Errorf("got %q want %q", s, gunzipTests[1].raw)
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("WriteTo: got %d bytes, want %d", buf.Len(), len(want))
+	}
+
+	if err := r.Reset(bytes.NewReader(compressed)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(&r); err != nil {
+		t.Errorf("intact stream: %v", err)
 	}
 }
 
-func TestMultiReset(t *testing.T) {
+func TestSkipChecksum(t *testing.T) {
+	in, compressed, _ := testSeekableData(t, 100000, 32<<10)
+	bad := append([]byte(nil), compressed...)
+	bad[len(bad)-8]++ // corrupt the CRC
+	bad[len(bad)-1]++ // and the size
+
 	var r Reader
-	for i := 0; i < 10; i++ {
-		if err := r.Reset(bytes.NewReader(seekingTests[1].gzip)); err != nil {
-			t.Error(err)
+	r.SetSkipChecksum(true)
+	for _, readAll := range []func(io.Reader) ([]byte, error){
+		ioutil.ReadAll,
+		func(r io.Reader) ([]byte, error) {
+			var buf bytes.Buffer
+			_, err := r.(io.WriterTo).WriteTo(&buf)
+			return buf.Bytes(), err
+		},
+	} {
+		if err := r.Reset(bytes.NewReader(bad)); err != nil {
+			t.Fatal(err)
+		}
+		data, err := readAll(&r)
+		if err != nil || !bytes.Equal(data, in) {
+			t.Errorf("skipping checksum: got %d bytes, err %v", len(data), err)
 		}
 	}
-	var buf bytes.Buffer
-	if _, err := io.Copy(&buf, &r); err != nil {
-		t.Error(err)
+
+	r.SetSkipChecksum(false)
+	if err := r.Reset(bytes.NewReader(bad)); err != nil {
+		t.Fatal(err)
 	}
-	if s := buf.String(); s != seekingTests[1].raw {
-		t.Errorf("got %q want %q", s, seekingTests[1].gzip)
+	if _, err := ioutil.ReadAll(&r); err != ErrChecksum {
+		t.Errorf("checking checksum: got %v, want ErrChecksum", err)
 	}
 }
 
-func TestResetEOF(t *testing.T) {
-	in := bytes.NewReader(seekingTests[1].gzip)
-	r, err := NewReader(in)
-	if err != nil {
+func TestUTF8Names(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Write([]byte("hello"))
+	w.Close()
+	withName := func(name string) []byte {
+		stream := append([]byte{gzipID1, gzipID2, gzipDeflate, flagName, 0, 0, 0, 0, 0, 255}, name...)
+		stream = append(stream, 0)
+		return append(stream, buf.Bytes()[10:]...)
+	}
+	name := "Grüße.txt"
+	stream := withName(name)
+
+	var r Reader
+	if err := r.Reset(bytes.NewReader(stream)); err != nil {
 		t.Fatal(err)
 	}
-	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+	if r.Name == name {
+		t.Errorf("Name decoded as UTF-8 by default")
+	}
+	r.SetUTF8Names(true)
+	if err := r.Reset(bytes.NewReader(stream)); err != nil {
 		t.Fatal(err)
 	}
-	// reset reader with same bytes.Reader that is now EOF
-	if err := r.Reset(in); err != io.EOF {
-		t.Errorf("reset: err=%v, want io.EOF", err)
+	if r.Name != name {
+		t.Errorf("Name = %q, want %q", r.Name, name)
 	}
-	// try reading something
-	if _, err := io.Copy(ioutil.Discard, r); err != io.EOF {
-		t.Errorf("io.Copy: err=%v, want io.EOF", err)
+	if string(r.RawName()) != name {
+		t.Errorf("RawName = %q, want %q", r.RawName(), name)
+	}
+	if data, err := ioutil.ReadAll(&r); err != nil || string(data) != "hello" {
+		t.Errorf("ReadAll = %q, %v", data, err)
 	}
-}
 
-func TestMultistreamFalse(t *testing.T) {
-	// Find concatenation test.
-	var tt gunzipTest
-	for _, tt = range gunzipTests {
+	// Invalid UTF-8 falls back to Latin-1.
+	latin1 := "Gr\xfc\xdfe.txt"
+	if err := r.Reset(bytes.NewReader(withName(latin1))); err != nil {
+		t.Fatal(err)
+	}
+	if r.Name != name {
+		t.Errorf("Name = %q, want %q", r.Name, name)
+	}
+	if string(r.RawName()) != latin1 {
+		t.Errorf("RawName = %q, want %q", r.RawName(), latin1)
+	}
+
+	if err := r.Reset(bytes.NewReader(stream[:14])); err != ErrHeader {
+		t.Errorf("unterminated name: got %v, want ErrHeader", err)
+	}
+}
+
+func TestWellTerminated(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 100000, 16<<10)
+	if last := meta.BlockData[len(meta.BlockData)-1]; last != uint32(len(eofMarker)) {
+		t.Fatalf("last block is %d bytes, want the EOF marker", last)
+	}
+	r, err := NewSeekingReader(bytes.NewReader(compressed), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.WellTerminated() {
+		t.Error("WellTerminated before reaching EOF")
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(data, in) {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !r.WellTerminated() {
+		t.Error("WellTerminated = false for a complete stream")
+	}
+
+	// Metadata taken before the stream was finished.
+	cut := meta
+	cut.BlockData = meta.BlockData[:len(meta.BlockData)-1]
+	cut.Fingerprint = 0 // only set by Close
+	r, err = NewSeekingReader(bytes.NewReader(compressed), &cut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Fatal(err)
+	}
+	if r.WellTerminated() {
+		t.Error("WellTerminated = true without the EOF marker")
+	}
+
+	r, err = NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	ioutil.ReadAll(r)
+	if r.WellTerminated() {
+		t.Error("WellTerminated = true without metadata")
+	}
+}
+
+func TestStrict(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Write([]byte("hello"))
+	w.Close()
+	for _, bit := range []byte{0x20, 0x40, 0x80} {
+		stream := append([]byte(nil), buf.Bytes()...)
+		stream[3] |= bit
+
+		var r Reader
+		if err := r.Reset(bytes.NewReader(stream)); err != nil {
+			t.Fatalf("lenient, flag %#x: %v", bit, err)
+		}
+		if data, err := ioutil.ReadAll(&r); err != nil || string(data) != "hello" {
+			t.Errorf("lenient, flag %#x: got %q, %v", bit, data, err)
+		}
+
+		r.SetStrict(true)
+		if err := r.Reset(bytes.NewReader(stream)); err != ErrHeader {
+			t.Errorf("strict, flag %#x: got %v, want ErrHeader", bit, err)
+		}
+		if err := r.Reset(bytes.NewReader(buf.Bytes())); err != nil {
+			t.Errorf("strict, conforming stream: %v", err)
+		}
+	}
+
+	stream := append([]byte(nil), buf.Bytes()...)
+	stream[2] = 7
+	var r Reader
+	if err := r.Reset(bytes.NewReader(stream)); err != ErrHeader {
+		t.Errorf("unknown method: got %v, want ErrHeader", err)
+	}
+}
+
+func TestReservedFlags(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Name = "hello.txt"
+	w.Write([]byte("hello"))
+	w.Close()
+	if buf.Bytes()[3]&flagReserved != 0 {
+		t.Fatalf("Writer set reserved flags: %#x", buf.Bytes()[3])
+	}
+	stream := append([]byte(nil), buf.Bytes()...)
+	stream[3] |= 0xa0
+
+	hdr, err := ReadHeader(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.ReservedFlags != 0xa0 {
+		t.Errorf("ReservedFlags = %#x, want 0xa0", hdr.ReservedFlags)
+	}
+
+	// Copying the header to a Writer keeps the flags.
+	var out bytes.Buffer
+	w = NewWriter(&out)
+	w.Header = hdr
+	w.Write([]byte("hello"))
+	w.Close()
+	if got := out.Bytes()[3]; got != stream[3] {
+		t.Errorf("rewritten FLG = %#x, want %#x", got, stream[3])
+	}
+
+	// Transcoding clears them.
+	out.Reset()
+	if _, err := Transcode(&out, bytes.NewReader(stream), 64<<10); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.Bytes()[3]; got != stream[3]&^flagReserved {
+		t.Errorf("transcoded FLG = %#x, want %#x", got, stream[3]&^flagReserved)
+	}
+	r, err := NewReader(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadAll(r); err != nil || string(data) != "hello" || r.Name != "hello.txt" {
+		t.Errorf("transcoded stream: read %q, %v, name %q", data, err, r.Name)
+	}
+}
+
+func TestHeaderCRC(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Name = "a.txt"
+	w.ModTime = time.Unix(1000000000, 0)
+	w.HeaderCRC = true
+	w.Write([]byte("hello"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// FLG is FNAME|FHCRC, and the checksum is the low 16 bits of the
+	// CRC-32 of the 16 bytes before it.
+	want := []byte{0x1f, 0x8b, 0x08, 0x0a, 0x00, 0xca, 0x9a, 0x3b, 0x00, 0xff, 'a', '.', 't', 'x', 't', 0x00, 0x04, 0xbb}
+	if got := buf.Bytes()[:len(want)]; !bytes.Equal(got, want) {
+		t.Fatalf("got header % x, want % x", got, want)
+	}
+	if sum := crc32.ChecksumIEEE(want[:16]); byte(sum) != want[16] || byte(sum>>8) != want[17] {
+		t.Fatalf("test vector has checksum %04x", sum&0xffff)
+	}
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.HeaderCRC || r.Name != "a.txt" {
+		t.Errorf("got header %+v", r.Header)
+	}
+	if data, err := ioutil.ReadAll(r); err != nil || string(data) != "hello" {
+		t.Errorf("got %q, %v", data, err)
+	}
+	zr, err := oldgz.NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("compress/gzip: %v", err)
+	}
+	if data, err := ioutil.ReadAll(zr); err != nil || string(data) != "hello" {
+		t.Errorf("compress/gzip: got %q, %v", data, err)
+	}
+
+	bad := append([]byte(nil), buf.Bytes()...)
+	bad[16]++
+	if _, err := NewReader(bytes.NewReader(bad)); err != ErrHeader {
+		t.Errorf("wrong header checksum: got %v, want ErrHeader", err)
+	}
+
+	// The index pointer of a container is covered by the checksum.
+	f, err := os.CreateTemp(t.TempDir(), "hcrc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	in := levelTestData(200000)
+	w, err = NewContainerWriter(f, BestSpeed, 64<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Name = "data"
+	w.HeaderCRC = true
+	w.Write(in)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Seek(0, io.SeekStart)
+	hdr, err := ReadHeader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size, _, ok := indexPointer(hdr.Extra); !ok || size != int64(len(in)) {
+		t.Errorf("index pointer: got %d, %v", size, ok)
+	}
+	f.Seek(0, io.SeekStart)
+	r, err = NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(data, in) {
+		t.Errorf("container: got %d bytes, %v", len(data), err)
+	}
+	r.Close()
+}
+
+func TestCanSeek(t *testing.T) {
+	in, comp, meta := testSeekableData(t, 100000, 16<<10)
+	r, err := NewSeekingReader(bytes.NewReader(comp), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for _, tt := range []struct {
+		off  int64
+		want bool
+	}{{0, true}, {50000, true}, {int64(len(in)) - 1, true}, {int64(len(in)), false}, {-1, false}} {
+		if got := r.CanSeek(tt.off); got != tt.want {
+			t.Errorf("CanSeek(%d) = %v, want %v", tt.off, got, tt.want)
+		}
+	}
+
+	nr, err := NewReader(bytes.NewReader(comp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nr.Close()
+	if nr.CanSeek(0) {
+		t.Error("CanSeek(0) = true without metadata")
+	}
+}
+
+func TestDecodedBytes(t *testing.T) {
+	in, comp, meta := testSeekableData(t, 100000, 16<<10)
+	r, err := NewSeekingReader(bytes.NewReader(comp), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.DecodedBytes(); got != int64(len(in)) {
+		t.Errorf("after full read: DecodedBytes = %d, want %d", got, len(in))
+	}
+	// Seeking into block 3 decodes it from its start.
+	if _, err := r.Seek(50000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := r.DecodedBytes(), int64(2*len(in)-3*16<<10); got != want {
+		t.Errorf("after seek: DecodedBytes = %d, want %d", got, want)
+	}
+	if err := r.Reset(bytes.NewReader(comp)); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.DecodedBytes(); got != 0 {
+		t.Errorf("after Reset: DecodedBytes = %d, want 0", got)
+	}
+}
+
+func TestSeekingReaderOffset(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 200000, 16<<10)
+	container := append(bytes.Repeat([]byte{0xaa}, 777), compressed...)
+	container = append(container, "trailing container data"...)
+
+	r, err := NewSeekingReaderOffset(bytes.NewReader(container), &meta, 777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for _, pos := range []int64{150000, 0, 199999} {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, in[pos:]) {
+			t.Errorf("content at %d does not match", pos)
+		}
+	}
+	if !r.WellTerminated() {
+		t.Error("WellTerminated = false")
+	}
+	if _, err := NewSeekingReaderOffset(bytes.NewReader(container), &meta, 776); err == nil {
+		t.Error("expected error for wrong offset")
+	}
+}
+
+func TestCopyRange(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 200000, 16<<10)
+	r, err := NewSeekingReader(bytes.NewReader(compressed), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for _, tc := range []struct{ start, length, want int64 }{
+		{0, 100, 100},
+		{16 << 10, 16 << 10, 16 << 10},
+		{50000, 70000, 70000},
+		{199000, 5000, 1000},
+		{200000, 10, 0},
+		{123, 0, 0},
+	} {
+		var buf bytes.Buffer
+		n, err := r.CopyRange(&buf, tc.start, tc.length)
+		if err != nil {
+			t.Fatalf("CopyRange(%d, %d): %v", tc.start, tc.length, err)
+		}
+		if n != tc.want || !bytes.Equal(buf.Bytes(), in[tc.start:tc.start+tc.want]) {
+			t.Errorf("CopyRange(%d, %d) = %d bytes, want %d", tc.start, tc.length, n, tc.want)
+		}
+	}
+
+	// Reading continues after the range.
+	if _, err := r.CopyRange(ioutil.Discard, 1000, 5000); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, in[6000:]) {
+		t.Error("content after the range does not match")
+	}
+
+	// Ranges ending at a block boundary or the end of the data leave
+	// nothing of the block behind for Read.
+	for _, start := range []int64{0, 199000} {
+		if _, err := r.CopyRange(ioutil.Discard, start, 16<<10); err != nil {
+			t.Fatal(err)
+		}
+		p := make([]byte, 10)
+		n, err := r.Read(p)
+		if end := start + 16<<10; end < int64(len(in)) {
+			if n != len(p) || err != nil || !bytes.Equal(p, in[end:end+10]) {
+				t.Errorf("Read after CopyRange(%d) = %d, %v", start, n, err)
+			}
+		} else if n != 0 || err != io.EOF {
+			t.Errorf("Read after CopyRange(%d) = %d, %v, want io.EOF", start, n, err)
+		}
+	}
+
+	// WriteTo continues after a partial Read.
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	head := make([]byte, 100)
+	if _, err := io.ReadFull(r, head); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(append(head, buf.Bytes()...), in) {
+		t.Error("Read followed by WriteTo does not match")
+	}
+}
+
+func TestWriteToN(t *testing.T) {
+	in, compressed, _ := testSeekableData(t, 100000, 16<<10)
+	r, err := NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var buf bytes.Buffer
+	for _, n := range []int64{0, 10, 20000, 16 << 10, 1} {
+		m, err := r.WriteToN(&buf, n)
+		if err != nil || m != n {
+			t.Fatalf("WriteToN(%d) = %d, %v", n, m, err)
+		}
+	}
+	head := make([]byte, 100)
+	if _, err := io.ReadFull(r, head); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(head)
+	rest := int64(len(in) - buf.Len())
+	if m, err := r.WriteToN(&buf, 100000); err != io.EOF || m != rest {
+		t.Errorf("WriteToN past the end = %d, %v, want %d, io.EOF", m, err, rest)
+	}
+	if !bytes.Equal(buf.Bytes(), in) {
+		t.Error("content does not match")
+	}
+}
+
+func TestProgressCallback(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 300000, 32<<10)
+	r, err := NewSeekingReader(bytes.NewReader(compressed), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var calls int
+	var last int64
+	r.SetProgressCallback(func(n, total int64) {
+		calls++
+		if n < last {
+			t.Errorf("progress went backwards: %d after %d", n, last)
+		}
+		if total != int64(len(in)) {
+			t.Errorf("total = %d, want %d", total, len(in))
+		}
+		last = n
+	})
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		t.Fatal(err)
+	}
+	if last != int64(len(in)) {
+		t.Errorf("last progress = %d, want %d", last, len(in))
+	}
+	if calls == 0 || calls > 20 {
+		t.Errorf("got %d progress calls", calls)
+	}
+
+	unknown, err := NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unknown.Close()
+	unknown.SetProgressCallback(func(n, total int64) {
+		if total != -1 {
+			t.Errorf("total = %d, want -1", total)
+		}
+		last = n
+	})
+	if _, err := ioutil.ReadAll(unknown); err != nil {
+		t.Fatal(err)
+	}
+	if last != int64(len(in)) {
+		t.Errorf("last progress = %d, want %d", last, len(in))
+	}
+}
+
+func TestSeekCurrent(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 200000, 32<<10)
+	r, err := NewSeekingReader(bytes.NewReader(compressed), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	p := make([]byte, 1000)
+	if _, err := io.ReadFull(r, p); err != nil {
+		t.Fatal(err)
+	}
+	pos, err := r.Seek(50000, io.SeekCurrent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos != 51000 {
+		t.Errorf("Seek returned %d, want %d", pos, 51000)
+	}
+	if _, err := io.ReadFull(r, p); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p, in[51000:52000]) {
+		t.Error("read after relative seek does not match")
+	}
+}
+
+func TestInfo(t *testing.T) {
+	tt := seekingTests[1]
+	r, err := NewSeekingReader(bytes.NewReader(tt.gzip), &tt.meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	want := StreamInfo{
+		Name:     "shesells.txt",
+		ModTime:  time.Unix(0x4a8b6672, 0),
+		OS:       3,
+		Size:     36,
+		Seekable: true,
+	}
+	if info := r.Info(); !reflect.DeepEqual(info, want) {
+		t.Errorf("Info() = %+v, want %+v", info, want)
+	}
+
+	plain, err := NewReader(bytes.NewReader(tt.gzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+	want.Size = -1
+	want.Seekable = false
+	if info := plain.Info(); !reflect.DeepEqual(info, want) {
+		t.Errorf("Info() = %+v, want %+v", info, want)
+	}
+}
+
+func TestSeekUnseekable(t *testing.T) {
+	in := struct{ io.Reader }{bytes.NewReader(emptyStream.gzip)}
+	gzip, err := NewReader(in)
+	if err != nil {
+		t.Errorf("%s: NewReader: %v", emptyStream.name, err)
+	}
+	if gzip.Seekable() {
+		t.Errorf("%s: Seekable without metadata", emptyStream.name)
+	}
+	if _, err = gzip.Seek(100000, io.SeekStart); err != ErrUnsupported {
+		t.Errorf("%s: gzip.Seek: %v want %v", emptyStream.name, err, ErrUnsupported)
+	}
+	gzip.Close()
+
+	gzip, err = NewReader(bytes.NewReader(emptyStream.gzip))
+	if err != nil {
+		t.Errorf("%s: NewReader: %v", emptyStream.name, err)
+	}
+	if _, err = gzip.Seek(100000, io.SeekStart); !errors.Is(err, ErrInvalidSeek) {
+		t.Errorf("%s: gzip.Seek: %v want %v", emptyStream.name, err, ErrInvalidSeek)
+	}
+	if _, err = gzip.Seek(0, io.SeekEnd); err != ErrUnsupported {
+		t.Errorf("%s: gzip.Seek(SeekEnd): %v want %v", emptyStream.name, err, ErrUnsupported)
+	}
+	if gzip.Seekable() {
+		t.Errorf("%s: Seekable without metadata", emptyStream.name)
+	}
+	gzip.Close()
+}
+
+func TestReaderCloseTwice(t *testing.T) {
+	in, comp, meta := testSeekableData(t, 300000, 32<<10)
+	open := map[string]func() (*Reader, error){
+		"stream":  func() (*Reader, error) { return NewReader(bytes.NewReader(comp)) },
+		"seeking": func() (*Reader, error) { return NewSeekingReader(bytes.NewReader(comp), &meta) },
+	}
+	for name, fn := range open {
+		// Closing in the middle of the stream stops the read-ahead once.
+		r, err := fn()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got := make([]byte, 1000)
+		if _, err := io.ReadFull(r, got); err != nil || !bytes.Equal(got, in[:1000]) {
+			t.Fatalf("%s: ReadFull: %v", name, err)
+		}
+		for i := 0; i < 2; i++ {
+			if err := r.Close(); err != nil {
+				t.Errorf("%s: Close #%d: %v", name, i+1, err)
+			}
+		}
+
+		// A deferred Close after reading to the end.
+		r, err = fn()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := ioutil.ReadAll(r); err != nil {
+			t.Fatalf("%s: ReadAll: %v", name, err)
+		}
+		if err := r.Close(); err != nil {
+			t.Errorf("%s: Close: %v", name, err)
+		}
+		if err := r.Close(); err != nil {
+			t.Errorf("%s: second Close: %v", name, err)
+		}
+	}
+}
+
+func TestReadSeekCloser(t *testing.T) {
+	in, comp, meta := testSeekableData(t, 300000, 32<<10)
+	open := map[string]func() (io.ReadSeekCloser, error){
+		"Open":              func() (io.ReadSeekCloser, error) { return Open(bytes.NewReader(comp), &meta) },
+		"Open without meta": func() (io.ReadSeekCloser, error) { return Open(bytes.NewReader(comp), nil) },
+		"NewRandomReader": func() (io.ReadSeekCloser, error) {
+			return NewRandomReader(bytes.NewReader(comp), &meta)
+		},
+	}
+	for name, fn := range open {
+		rsc, err := fn()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := rsc.Seek(200000, io.SeekStart); err != nil {
+			t.Fatalf("%s: Seek: %v", name, err)
+		}
+		got := make([]byte, 100)
+		if _, err := io.ReadFull(rsc, got); err != nil || !bytes.Equal(got, in[200000:200100]) {
+			t.Errorf("%s: read after Seek: %v", name, err)
+		}
+		if err := rsc.Close(); err != nil {
+			t.Errorf("%s: Close: %v", name, err)
+		}
+	}
+
+	var rsc io.ReadSeekCloser
+	rsc, err := NewReader(struct{ io.Reader }{bytes.NewReader(comp)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rsc.Seek(10, io.SeekStart); err != ErrUnsupported {
+		t.Errorf("unseekable source: Seek = %v, want ErrUnsupported", err)
+	}
+	rsc.Close()
+}
+
+func TestOpen(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 100000, 16<<10)
+	for _, m := range []*GzipMetadata{nil, &meta} {
+		r, err := Open(bytes.NewReader(compressed), m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.CanSeek(0) != (m != nil) {
+			t.Errorf("metadata %v: CanSeek = %v", m != nil, r.CanSeek(0))
+		}
+		for _, pos := range []int64{70000, 1000} {
+			if _, err := r.Seek(pos, io.SeekStart); err != nil {
+				t.Fatalf("metadata %v: Seek(%d): %v", m != nil, pos, err)
+			}
+			got := make([]byte, 100)
+			if _, err := io.ReadFull(r, got); err != nil || !bytes.Equal(got, in[pos:pos+100]) {
+				t.Errorf("metadata %v: read at %d: %v", m != nil, pos, err)
+			}
+		}
+		_, err = r.Seek(-10, io.SeekEnd)
+		if want := m == nil; (err == ErrUnsupported) != want {
+			t.Errorf("metadata %v: Seek(SeekEnd): %v", m != nil, err)
+		}
+		r.Close()
+	}
+}
+
+// TestOver4GiB checks streams whose size does not fit the 32-bit ISIZE
+// field of the trailer. The stream repeats one compressed block of zeros,
+// so it is small although it holds more than 4 GiB.
+func TestOver4GiB(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping streams of more than 4 GiB in short mode")
+	}
+	const blockSize, blocks = 1 << 20, 4100
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetConcurrency(blockSize, 2)
+	w.Write(make([]byte, 2*blockSize))
+	w.Close()
+	small := w.MetaData()
+	hdr, blk := small.BlockData[0], small.BlockData[1]
+	block := buf.Bytes()[hdr : hdr+blk]
+	if small.BlockData[2] != blk || !bytes.Equal(buf.Bytes()[hdr+blk:hdr+2*blk], block) {
+		t.Fatal("blocks of zeros do not compress to the same bytes")
+	}
+
+	size := int64(blocks) * blockSize
+	meta := GzipMetadata{Version: 1, BlockSize: blockSize, Size: size, BlockData: []uint32{hdr}}
+	stream := append([]byte(nil), buf.Bytes()[:hdr]...)
+	var crc uint32
+	for i := 0; i < blocks; i++ {
+		stream = append(stream, block...)
+		meta.BlockData = append(meta.BlockData, blk)
+		meta.BlockCRC = append(meta.BlockCRC, small.BlockCRC[0])
+		crc = crc32Combine(crc, small.BlockCRC[0], blockSize)
+	}
+	stream = append(stream, eofMarker...)
+	meta.BlockData = append(meta.BlockData, uint32(len(eofMarker)))
+	meta.BlockCRC = append(meta.BlockCRC, 0)
+	var trailer [8]byte
+	put4(trailer[0:4], crc)
+	put4(trailer[4:8], uint32(size))
+	stream = append(stream, trailer[:]...)
+
+	r, err := NewSeekingReader(bytes.NewReader(stream), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if got := r.Info().Size; got != size {
+		t.Errorf("Info().Size = %d, want %d", got, size)
+	}
+	if pos, err := r.Seek(0, io.SeekEnd); err != nil || pos != size {
+		t.Errorf("Seek(0, SeekEnd) = %d, %v, want %d", pos, err, size)
+	}
+	pos, err := r.Seek(-100, io.SeekEnd)
+	if err != nil || pos != size-100 {
+		t.Fatalf("Seek(-100, SeekEnd) = %d, %v, want %d", pos, err, size-100)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(got, make([]byte, 100)) {
+		t.Errorf("ReadAll at the end: %d bytes, %v", len(got), err)
+	}
+	if pos, err := r.Seek(5<<30, io.SeekStart); err != ErrInvalidSeek {
+		t.Errorf("Seek past the end = %d, %v, want ErrInvalidSeek", pos, err)
+	}
+
+	// The size in the trailer is the size modulo 2^32.
+	if err := VerifyConcurrent(bytes.NewReader(stream), &meta, 0); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	zr, err := NewReader(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	if n, err := zr.WriteTo(ioutil.Discard); err != nil || n != size {
+		t.Errorf("WriteTo = %d, %v, want %d", n, err, size)
+	}
+}
+
+func TestSeekWithoutMetadata(t *testing.T) {
+	in := make([]byte, 300000)
+	for i := range in {
+		in[i] = byte(i * 7 % 253)
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Write(in)
+	w.Close()
+	// Data before the stream must be skipped when starting over.
+	src := bytes.NewReader(append([]byte("prefix"), buf.Bytes()...))
+	src.Seek(6, io.SeekStart)
+
+	r, err := NewReader(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.Multistream(false)
+	for _, pos := range []int64{200000, 1000, 0, 250000, 299999, 100} {
+		if got, err := r.Seek(pos, io.SeekStart); err != nil || got != pos {
+			t.Fatalf("Seek(%d) = %d, %v", pos, got, err)
+		}
+		p := make([]byte, 100)
+		n, err := io.ReadFull(r, p)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			t.Fatalf("Read after Seek(%d): %v", pos, err)
+		}
+		if !bytes.Equal(p[:n], in[pos:pos+int64(n)]) {
+			t.Errorf("Seek(%d): content does not match", pos)
+		}
+	}
+	if pos, err := r.Seek(-50, io.SeekCurrent); err != nil || pos != 150 {
+		t.Errorf("Seek(-50, SeekCurrent) = %d, %v, want 150", pos, err)
+	}
+	if _, err := r.Seek(-1, io.SeekStart); !errors.Is(err, ErrInvalidSeek) {
+		t.Errorf("Seek(-1): %v, want %v", err, ErrInvalidSeek)
+	}
+	if _, err := ioutil.ReadAll(r); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Seek(10, io.SeekStart); err != nil {
+		t.Fatalf("Seek after EOF: %v", err)
+	}
+	if r.multistream {
+		t.Error("Seek enabled multistream mode")
+	}
+}
+
+func TestInvalidSeek(t *testing.T) {
+	in := bytes.NewReader(emptyStream.gzip)
+	gzip, err := NewSeekingReader(in, &emptyStream.meta)
+	if err != nil {
+		t.Errorf("%s: NewReader: %v", emptyStream.name, err)
+	}
+	if _, err = gzip.Seek(100000, io.SeekStart); err != ErrInvalidSeek {
+		t.Errorf("%s: gzip.Seek: %v want %v", emptyStream.name, err, ErrInvalidSeek)
+	}
+	gzip.Close()
+
+	// Without metadata the size is known once the end has been reached.
+	gzip, err = NewReader(bytes.NewReader(emptyStream.gzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gzip.Close()
+	_, err = gzip.Seek(10, io.SeekStart)
+	var se *SeekError
+	if !errors.As(err, &se) || se.Offset != 10 || se.Size != 0 {
+		t.Errorf("%s: Seek without metadata: got %v, want a *SeekError for offset 10 and size 0", emptyStream.name, err)
+	} else if got, want := err.Error(), "gzip: invalid seek position: requested 10 but size is 0"; got != want {
+		t.Errorf("error message %q, want %q", got, want)
+	}
+	_, err = gzip.Seek(-1, io.SeekStart)
+	if !errors.As(err, &se) || se.Offset != -1 || se.Size != -1 {
+		t.Errorf("%s: Seek(-1) without metadata: got %v, want a *SeekError for offset -1", emptyStream.name, err)
+	}
+}
+
+func TestCoarseSeek(t *testing.T) {
+	in := make([]byte, 1<<20)
+	for i := range in {
+		in[i] = byte(i % 251)
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetConcurrency(64<<10, 4)
+	w.Write(in)
+	w.Close()
+	meta := w.MetaData()
+
+	// Collapse the index into a single block.
+	var total uint32
+	for _, b := range meta.BlockData[1:] {
+		total += b
+	}
+	coarse := GzipMetadata{
+		BlockSize: meta.BlockSize,
+		Size:      meta.Size,
+		BlockData: []uint32{meta.BlockData[0], total},
+	}
+
+	r, err := NewSeekingReader(bytes.NewReader(buf.Bytes()), &coarse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for _, pos := range []int64{500000, 100, 1<<20 - 10} {
+		if _, err = r.Seek(pos, io.SeekStart); err != nil {
+			t.Fatalf("Seek(%d): %v", pos, err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("ReadAll after Seek(%d): %v", pos, err)
+		}
+		if !bytes.Equal(got, in[pos:]) {
+			t.Errorf("Seek(%d): got %d bytes, want %d", pos, len(got), len(in)-int(pos))
+		}
+
+		// Same again through WriteTo.
+		if _, err = r.Seek(pos, io.SeekStart); err != nil {
+			t.Fatalf("Seek(%d): %v", pos, err)
+		}
+		var out bytes.Buffer
+		if _, err = io.Copy(&out, r); err != nil {
+			t.Fatalf("Copy after Seek(%d): %v", pos, err)
+		}
+		if !bytes.Equal(out.Bytes(), in[pos:]) {
+			t.Errorf("WriteTo after Seek(%d): got %d bytes, want %d", pos, out.Len(), len(in)-int(pos))
+		}
+	}
+	if _, err = r.Seek(coarse.Size+1, io.SeekStart); err != ErrInvalidSeek {
+		t.Errorf("Seek past end: %v want %v", err, ErrInvalidSeek)
+	}
+}
+
+func TestCoarseSeekOffset(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 300000, 16<<10)
+	coarse := meta.Downsample(8)
+	r, err := NewSeekingReader(bytes.NewReader(compressed), &coarse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// None of these offsets is on a block boundary of the coarse index,
+	// so Seek has to discard data to reach them.
+	size := int64(len(in))
+	tests := []struct {
+		offset int64
+		whence int
+		want   int64
+	}{
+		{100000, io.SeekStart, 100000},
+		{-50000, io.SeekCurrent, 50100},
+		{70001, io.SeekCurrent, 120201},
+		{-12345, io.SeekEnd, size - 12345},
+		{1, io.SeekStart, 1},
+	}
+	buf := make([]byte, 100)
+	for _, tt := range tests {
+		pos, err := r.Seek(tt.offset, tt.whence)
+		if err != nil {
+			t.Fatalf("Seek(%d, %d): %v", tt.offset, tt.whence, err)
+		}
+		if pos != tt.want {
+			t.Errorf("Seek(%d, %d) = %d, want %d", tt.offset, tt.whence, pos, tt.want)
+		}
+		if _, err := io.ReadFull(r, buf); err != nil {
+			t.Fatalf("Read after Seek(%d, %d): %v", tt.offset, tt.whence, err)
+		}
+		if !bytes.Equal(buf, in[tt.want:tt.want+100]) {
+			t.Errorf("Read after Seek(%d, %d) returned the wrong data", tt.offset, tt.whence)
+		}
+	}
+}
+
+func TestMisalignedBlockSize(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 200000, 32<<10)
+	bad := meta
+	bad.BlockSize = 64 << 10
+	rs := bytes.NewReader(compressed)
+	if _, err := NewSeekingReader(rs, &bad); err != ErrInvalidMetadata {
+		t.Fatalf("NewSeekingReader: got %v, want %v", err, ErrInvalidMetadata)
+	}
+
+	fixed, err := RepairMetadata(rs, &bad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fixed.BlockSize != meta.BlockSize {
+		t.Errorf("repaired BlockSize = %d, want %d", fixed.BlockSize, meta.BlockSize)
+	}
+	r, err := NewSeekingReader(rs, &fixed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := r.Seek(150000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, in[150000:]) {
+		t.Error("content does not match")
+	}
+}
+
+func TestDecompressorWithSeek(t *testing.T) {
+	b := new(bytes.Buffer)
+	for _, tt := range seekingTests {
+		fmt.Printf("Name: %s\n", tt.name)
+		in := bytes.NewReader(tt.gzip)
+		gzip, err := NewSeekingReader(in, &tt.meta)
+		if err != nil {
+			t.Errorf("%s: NewReader: %v", tt.name, err)
+			continue
+		}
+		defer gzip.Close()
+		if !gzip.Seekable() {
+			t.Errorf("%s: not Seekable with metadata", tt.name)
+		}
+		if tt.name != gzip.Name {
+			t.Errorf("%s: got name %s", tt.name, gzip.Name)
+		}
+		b.Reset()
+		if _, err = gzip.Seek(tt.seek, io.SeekStart); err != nil {
+			t.Errorf("%s: gzip.Seek error %v", tt.name, err)
+			continue
+		}
+		n, err := io.Copy(b, gzip)
+		if err != tt.err {
+			t.Errorf("%s: io.Copy: %v want %v", tt.name, err, tt.err)
+		}
+
+		s := b.Bytes()
+		raw := []byte(tt.raw)[tt.seek:]
+		if !bytes.Equal(s, raw) {
+			t.Errorf("%s: got %d-byte %x want %d-byte %x", tt.name, n, s, len(raw), raw)
+		}
+	}
+}
+
+func TestReaderAt(t *testing.T) {
+	b := new(bytes.Buffer)
+	tt := seekingTests[2]
+	gzip, err := NewReaderAt(bytes.NewReader(tt.gzip), &tt.meta, tt.seek)
+	if err != nil {
+		t.Fatalf("NewReaderAt: %v", err)
+	}
+	defer gzip.Close()
+	n, err := io.Copy(b, gzip)
+	if err != nil {
+		t.Errorf("io.Copy: %v", err)
+	}
+	s := b.Bytes()
+	raw := []byte(tt.raw)[tt.seek:]
+	if !bytes.Equal(s, raw) {
+		t.Errorf("%s: got %d-byte want %d-byte", tt.name, n, len(raw))
+	}
+}
+
+func TestDecompressFileWithSeek(t *testing.T) {
+	dat, _ := ioutil.ReadFile("testdata/test.json")
+	dl := len(dat)
+	if len(testbuf) != 200*dl {
+		// Make results predictable
+		testbuf = make([]byte, 200*dl)
+		for j := 0; j < 200; j++ {
+			copy(testbuf[j*dl:j*dl+dl], dat)
+		}
+	}
+
+	br := bytes.NewBuffer(testbuf)
+	var buf bytes.Buffer
+	w, _ := NewWriterLevel(&buf, 6)
+	io.Copy(w, br)
+	w.Close()
+	meta := w.MetaData()
+	//fmt.Printf("%v\n", meta)
+
+	r, err := NewSeekingReader(bytes.NewReader(buf.Bytes()), &meta)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err = r.Seek(int64(132*dl), io.SeekStart); err != nil {
+		t.Fatal(err.Error())
+	}
+	decoded, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !bytes.Equal(testbuf[132*dl:], decoded) {
+		t.Errorf("decoded content does not match.")
+	}
+}
+
+func TestMultiSeek(t *testing.T) {
+	f, err := os.Open("testdata/test.json.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	mf, err := os.Open("testdata/test.json.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mf.Close()
+	of, err := os.Open("testdata/test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer of.Close()
+	var meta GzipMetadata
+	err = gob.NewDecoder(mf).Decode(&meta)
+	if err != nil {
+		t.Fatalf("Invalid metadata %s", err)
+	}
+
+	gzip, err := NewSeekingReader(f, &meta)
+	if err != nil {
+		t.Fatalf("NewReader(testdata/test.json.gz): %v", err)
+	}
+	defer gzip.Close()
+
+	prand.Seed(1337)
+	var buf1 = make([]byte, 512)
+	var buf2 = make([]byte, 512)
+	for i := 0; i < 10; i++ {
+		pos := prand.Intn(147154)
+		_, err = gzip.Seek(int64(pos), io.SeekStart)
+		if err != nil {
+			t.Errorf("gzip.Seek error %v", err)
+		}
+		_, err = of.Seek(int64(pos), io.SeekStart)
+		if err != nil {
+			t.Errorf("of.Seek error %v", err)
+		}
+
+		_, err = gzip.Read(buf1)
+		if err != nil {
+			t.Errorf("gzip.Read error %v", err)
+		}
+		_, err = of.Read(buf2)
+		if err != nil {
+			t.Errorf("of.Read error %v", err)
+		}
+		if !bytes.Equal(buf1, buf2) {
+			t.Errorf("read does not match original file.")
+		}
+	}
+}
+
+func TestIssue6550(t *testing.T) {
+	f, err := os.Open("testdata/issue6550.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gzip, err := NewReader(f)
+	if err != nil {
+		t.Fatalf("NewReader(testdata/issue6550.gz): %v", err)
+	}
+	defer gzip.Close()
+	done := make(chan bool, 1)
+	go func() {
+		_, err := io.Copy(ioutil.Discard, gzip)
+		if err == nil {
+			t.Errorf("Copy succeeded")
+		} else {
+			t.Logf("Copy failed (correctly): %v", err)
+		}
+		done <- true
+	}()
+	select {
+	case <-time.After(1 * time.Second):
+		t.Errorf("Copy hung")
+	case <-done:
+		// ok
+	}
+}
+
+func TestInitialReset(t *testing.T) {
+	var r Reader
+	if err := r.Reset(bytes.NewReader(seekingTests[1].gzip)); err != nil {
+		t.Error(err)
+	}
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, &r); err != nil {
+		t.Error(err)
+	}
+	if s := buf.String(); s != seekingTests[1].raw {
+		t.Errorf("got %q want %q", s, gunzipTests[1].raw)
+	}
+}
+
+func TestMultiReset(t *testing.T) {
+	var r Reader
+	for i := 0; i < 10; i++ {
+		if err := r.Reset(bytes.NewReader(seekingTests[1].gzip)); err != nil {
+			t.Error(err)
+		}
+	}
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, &r); err != nil {
+		t.Error(err)
+	}
+	if s := buf.String(); s != seekingTests[1].raw {
+		t.Errorf("got %q want %q", s, seekingTests[1].gzip)
+	}
+}
+
+func TestResetEOF(t *testing.T) {
+	in := bytes.NewReader(seekingTests[1].gzip)
+	r, err := NewReader(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		t.Fatal(err)
+	}
+	// reset reader with same bytes.Reader that is now EOF
+	if err := r.Reset(in); err != io.EOF {
+		t.Errorf("reset: err=%v, want io.EOF", err)
+	}
+	// try reading something
+	if _, err := io.Copy(ioutil.Discard, r); err != io.EOF {
+		t.Errorf("io.Copy: err=%v, want io.EOF", err)
+	}
+}
+
+func TestMultistreamFalse(t *testing.T) {
+	// Find concatenation test.
+	var tt gunzipTest
+	for _, tt = range gunzipTests {
 		if strings.HasSuffix(tt.desc, " x2") {
 			goto Found
 		}
@@ -668,6 +1880,101 @@ Found:
 	}
 }
 
+func TestReturnMemberEnd(t *testing.T) {
+	var buf bytes.Buffer
+	streams := []string{"one", "", "three"}
+	for _, s := range streams {
+		w := NewWriter(&buf)
+		w.Write([]byte(s))
+		w.Close()
+	}
+	sources := []struct {
+		name string
+		r    func() io.Reader
+	}{
+		{"bytes.Reader", func() io.Reader { return bytes.NewReader(buf.Bytes()) }},
+		{"bufio.Reader", func() io.Reader { return bufio.NewReader(bytes.NewReader(buf.Bytes())) }},
+	}
+	for _, src := range sources {
+		br := src.r()
+		var r Reader
+		r.SetReturnMemberEnd(true)
+		if err := r.Reset(br); err != nil {
+			t.Fatal(err)
+		}
+		r.Multistream(false)
+		for i, want := range streams {
+			data, err := ioutil.ReadAll(&r)
+			wantErr := ErrMemberEnd
+			if i == len(streams)-1 {
+				wantErr = nil
+			}
+			if string(data) != want || err != wantErr {
+				t.Errorf("%s: stream %d = %q, %v, want %q, %v", src.name, i, data, err, want, wantErr)
+			}
+			if _, err := r.Read(make([]byte, 1)); wantErr != nil && err != wantErr {
+				t.Errorf("%s: stream %d: Read again: %v, want %v", src.name, i, err, wantErr)
+			}
+			if i < len(streams)-1 {
+				if err := r.ResetKeepOptions(br); err != nil {
+					t.Fatalf("%s: ResetKeepOptions: %v", src.name, err)
+				}
+			}
+		}
+		if err := r.ResetKeepOptions(br); err != io.EOF {
+			t.Errorf("%s: last ResetKeepOptions: %v, want io.EOF", src.name, err)
+		}
+	}
+
+	// Without the setting, and with multistream mode, io.EOF is returned.
+	r, err := NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Multistream(false)
+	if data, err := ioutil.ReadAll(r); string(data) != "one" || err != nil {
+		t.Errorf("default: got %q, %v", data, err)
+	}
+	r.SetReturnMemberEnd(true)
+	if err := r.Reset(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadAll(r); string(data) != "onethree" || err != nil {
+		t.Errorf("multistream: got %q, %v", data, err)
+	}
+}
+
+func TestResetKeepOptions(t *testing.T) {
+	var buf bytes.Buffer
+	for _, s := range []string{"one", "two", "three"} {
+		w := NewWriter(&buf)
+		w.Write([]byte(s))
+		w.Close()
+	}
+	br := bytes.NewReader(buf.Bytes())
+	r, err := NewReader(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Multistream(false)
+	var got []string
+	for {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(data))
+		if err := r.ResetKeepOptions(br); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"one", "two", "three"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got streams %q, want %q", got, want)
+	}
+}
+
 func TestWriteTo(t *testing.T) {
 	input := make([]byte, 100000)
 	n, err := rand.Read(input)
@@ -732,7 +2039,111 @@ func TestWriteTo(t *testing.T) {
 	}
 }
 
-func BenchmarkGunzipCopy(b *testing.B) {
+// growRecorder records the calls to Grow.
+type growRecorder struct {
+	bytes.Buffer
+	grown []int
+}
+
+func (g *growRecorder) Grow(n int) {
+	g.grown = append(g.grown, n)
+	g.Buffer.Grow(n)
+}
+
+func TestWriteToGrow(t *testing.T) {
+	in, comp, meta := testSeekableData(t, 300000, 32<<10)
+	r, err := NewSeekingReader(bytes.NewReader(comp), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var g growRecorder
+	if _, err := r.WriteTo(&g); err != nil || !bytes.Equal(g.Bytes(), in) {
+		t.Fatalf("WriteTo: got %d bytes, %v", g.Len(), err)
+	}
+	if len(g.grown) != 1 || g.grown[0] != len(in) {
+		t.Errorf("full read: grown by %v, want [%d]", g.grown, len(in))
+	}
+
+	g = growRecorder{}
+	if _, err := r.Seek(100000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(&g, r); err != nil || !bytes.Equal(g.Bytes(), in[100000:]) {
+		t.Fatalf("io.Copy after Seek: got %d bytes, %v", g.Len(), err)
+	}
+	if len(g.grown) != 1 || g.grown[0] != len(in)-100000 {
+		t.Errorf("after Seek: grown by %v, want [%d]", g.grown, len(in)-100000)
+	}
+
+	g = growRecorder{}
+	if _, err := r.CopyRange(&g, 1000, 5000); err != nil || !bytes.Equal(g.Bytes(), in[1000:6000]) {
+		t.Fatalf("CopyRange: got %d bytes, %v", g.Len(), err)
+	}
+	if len(g.grown) != 1 || g.grown[0] != 5000 {
+		t.Errorf("CopyRange: grown by %v, want [5000]", g.grown)
+	}
+
+	// Without metadata the size is not known.
+	g = growRecorder{}
+	r2, err := NewReader(bytes.NewReader(comp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Close()
+	if _, err := r2.WriteTo(&g); err != nil || len(g.grown) != 0 {
+		t.Errorf("without metadata: grown by %v, %v", g.grown, err)
+	}
+}
+
+func BenchmarkWriteToGrow(b *testing.B) {
+	in := levelTestData(8 << 20)
+	var comp bytes.Buffer
+	var meta bytes.Buffer
+	w, err := CreateSeekable(&comp, &meta, DefaultCompression, 1<<20)
+	if err != nil {
+		b.Fatal(err)
+	}
+	w.Write(in)
+	if err := w.Close(); err != nil {
+		b.Fatal(err)
+	}
+	m, err := DecodeIndex(&meta)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, bc := range []struct {
+		name string
+		wrap func(*bytes.Buffer) io.Writer
+	}{
+		{"Grow", func(buf *bytes.Buffer) io.Writer { return buf }},
+		{"NoGrow", func(buf *bytes.Buffer) io.Writer { return struct{ io.Writer }{buf} }},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			r, err := NewSeekingReader(bytes.NewReader(comp.Bytes()), &m)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer r.Close()
+			b.ReportAllocs()
+			b.SetBytes(int64(len(in)))
+			for i := 0; i < b.N; i++ {
+				if _, err := r.Seek(0, io.SeekStart); err != nil {
+					b.Fatal(err)
+				}
+				var buf bytes.Buffer
+				if _, err := r.WriteTo(bc.wrap(&buf)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkGunzipCopy(b *testing.B)             { benchmarkGunzipCopy(b, false) }
+func BenchmarkGunzipCopySkipChecksum(b *testing.B) { benchmarkGunzipCopy(b, true) }
+
+func benchmarkGunzipCopy(b *testing.B, skipChecksum bool) {
 	dat, _ := ioutil.ReadFile("testdata/test.json")
 	dat = append(dat, dat...)
 	dat = append(dat, dat...)
@@ -748,6 +2159,7 @@ func BenchmarkGunzipCopy(b *testing.B) {
 	w.Close()
 	input := dst.Bytes()
 	r, err := NewReader(bytes.NewBuffer(input))
+	r.SetSkipChecksum(skipChecksum)
 	b.SetBytes(int64(len(dat)))
 	b.ResetTimer()
 	for n := 0; n < b.N; n++ {
@@ -792,6 +2204,93 @@ func BenchmarkGunzipReadAll(b *testing.B) {
 	}
 }
 
+// BenchmarkDiscard compares discarding the data with a loop of Read calls,
+// as io.Copy does for a Reader hiding WriteTo, with WriteTo to
+// ioutil.Discard, which skips the copies, and with a forward Seek of a
+// Reader without metadata, which discards the data before the target.
+func BenchmarkDiscard(b *testing.B) {
+	dat, _ := ioutil.ReadFile("testdata/test.json")
+	dat = bytes.Repeat(dat, 32)
+	dst := &bytes.Buffer{}
+	w, _ := NewWriterLevel(dst, 1)
+	if _, err := w.Write(dat); err != nil {
+		b.Fatal(err)
+	}
+	w.Close()
+	input := dst.Bytes()
+	discards := []struct {
+		name string
+		fn   func(r *Reader) error
+	}{
+		{"ReadLoop", func(r *Reader) error {
+			_, err := io.Copy(ioutil.Discard, struct{ io.Reader }{r})
+			return err
+		}},
+		{"WriteTo", func(r *Reader) error {
+			_, err := r.WriteTo(ioutil.Discard)
+			return err
+		}},
+		{"Seek", func(r *Reader) error {
+			_, err := r.Seek(int64(len(dat)), io.SeekStart)
+			return err
+		}},
+	}
+	for _, d := range discards {
+		b.Run(d.name, func(b *testing.B) {
+			r, err := NewReader(bytes.NewReader(input))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer r.Close()
+			b.SetBytes(int64(len(dat)))
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				if err := r.Reset(bytes.NewReader(input)); err != nil {
+					b.Fatal(err)
+				}
+				if err := d.fn(r); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkGunzipSmallReads reads in 256 byte chunks, as record readers
+// do, where the cost of each Read call dominates.
+func BenchmarkGunzipSmallReads(b *testing.B) {
+	dat, _ := ioutil.ReadFile("testdata/test.json")
+	dat = bytes.Repeat(dat, 32)
+	dst := &bytes.Buffer{}
+	w, _ := NewWriterLevel(dst, 1)
+	if _, err := w.Write(dat); err != nil {
+		b.Fatal(err)
+	}
+	w.Close()
+	input := dst.Bytes()
+	r, err := NewReader(bytes.NewReader(input))
+	if err != nil {
+		b.Fatal(err)
+	}
+	buf := make([]byte, 256)
+	b.SetBytes(int64(len(dat)))
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := r.Reset(bytes.NewReader(input)); err != nil {
+			b.Fatal(err)
+		}
+		for {
+			_, err := r.Read(buf)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
 func BenchmarkGunzipStdLib(b *testing.B) {
 	dat, _ := ioutil.ReadFile("testdata/test.json")
 	dat = append(dat, dat...)
@@ -852,6 +2351,101 @@ func BenchmarkGunzipFlate(b *testing.B) {
 	}
 }
 
+func TestNoDoubleBuffering(t *testing.T) {
+	_, compressed, _ := testSeekableData(t, 1000, 16<<10)
+	br := bufio.NewReader(bytes.NewReader(compressed))
+	r, err := NewReader(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.bufr != br {
+		t.Error("bufio.Reader was wrapped in another buffer")
+	}
+	if err := r.Reset(struct{ io.Reader }{bytes.NewReader(compressed)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.bufr.(*bufio.Reader); !ok {
+		t.Errorf("plain io.Reader is read through %T, want *bufio.Reader", r.bufr)
+	}
+}
+
+// BenchmarkSmallReaders measures the memory used for small streams when
+// the source is already buffered and when it is not.
+func BenchmarkSmallReaders(b *testing.B) {
+	_, compressed, _ := testSeekableData(b, 1000, 16<<10)
+	for _, bc := range []struct {
+		name string
+		wrap func(io.Reader) io.Reader
+	}{
+		{"bufio", func(r io.Reader) io.Reader { return bufio.NewReaderSize(r, 512) }},
+		{"plain", func(r io.Reader) io.Reader { return struct{ io.Reader }{r} }},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				r, err := NewReaderN(bc.wrap(bytes.NewReader(compressed)), 4096, 1)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := io.Copy(ioutil.Discard, r); err != nil {
+					b.Fatal(err)
+				}
+				r.Close()
+			}
+		})
+	}
+}
+
+func TestWriteToBuffer(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 300000, 64<<10)
+	var twice bytes.Buffer
+	twice.Write(compressed)
+	twice.Write(compressed)
+
+	dec, err := NewReader(bytes.NewReader(twice.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dec.WriteToBuffer(ioutil.Discard, make([]byte, 100)); err != io.ErrShortBuffer {
+		t.Fatalf("short buffer: got %v", err)
+	}
+	var out bytes.Buffer
+	n, err := dec.WriteToBuffer(&out, make([]byte, 4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(2*len(in)) || !bytes.Equal(out.Bytes(), append(in, in...)) {
+		t.Fatal("output did not match input")
+	}
+	dec.Close()
+
+	dec, err = NewSeekingReader(bytes.NewReader(compressed), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dec.Close()
+	if _, err := dec.Seek(100000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if _, err := dec.WriteToBuffer(&out, make([]byte, 4096)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), in[100000:]) {
+		t.Fatal("output after seek did not match input")
+	}
+	// The read-ahead allocates its block buffers lazily, so the pool
+	// only holds nil entries if it never ran.
+	for i := len(dec.blockPool); i > 0; i-- {
+		b := <-dec.blockPool
+		if b != nil {
+			t.Errorf("block buffer of %d bytes allocated", cap(b))
+		}
+		dec.blockPool <- b
+	}
+}
+
 func TestTruncatedGunzip(t *testing.T) {
 	in := []byte(strings.Repeat("ASDFASDFASDFASDFASDF", 1000))
 	var buf bytes.Buffer
@@ -887,6 +2481,100 @@ func TestTruncatedGunzip(t *testing.T) {
 	}
 }
 
+// trailerTrickler returns the data before its last 8 bytes in one piece,
+// and then those bytes one at a time, with an empty read before each.
+type trailerTrickler struct {
+	data  []byte
+	empty bool
+}
+
+func (r *trailerTrickler) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	if len(r.data) > 8 {
+		n := copy(p, r.data[:len(r.data)-8])
+		r.data = r.data[n:]
+		return n, nil
+	}
+	if r.empty = !r.empty; r.empty {
+		return 0, nil
+	}
+	p[0] = r.data[0]
+	r.data = r.data[1:]
+	return 1, nil
+}
+
+func TestFragmentedTrailer(t *testing.T) {
+	in := []byte(strings.Repeat("ASDFASDFASDFASDFASDF", 1000))
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Write(in)
+	w.Close()
+	gz := buf.Bytes()
+	read := map[string]func(r *Reader) ([]byte, error){
+		"Read": func(r *Reader) ([]byte, error) { return ioutil.ReadAll(struct{ io.Reader }{r}) },
+		"WriteTo": func(r *Reader) ([]byte, error) {
+			var out bytes.Buffer
+			_, err := r.WriteTo(&out)
+			return out.Bytes(), err
+		},
+		"WriteToBuffer": func(r *Reader) ([]byte, error) {
+			var out bytes.Buffer
+			_, err := r.WriteToBuffer(&out, make([]byte, 4096))
+			return out.Bytes(), err
+		},
+	}
+	for name, fn := range read {
+		r, err := NewReader(&trailerTrickler{data: gz})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := fn(r)
+		if err != nil || !bytes.Equal(got, in) {
+			t.Errorf("%s: got %d bytes, %v, want %d", name, len(got), err, len(in))
+		}
+		r.Close()
+
+		// A missing trailer is not the end of the stream.
+		r, err = NewReader(&trailerTrickler{data: gz[:len(gz)-8]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fn(r); err != io.ErrUnexpectedEOF {
+			t.Errorf("%s: without trailer: got %v, want io.ErrUnexpectedEOF", name, err)
+		}
+		r.Close()
+	}
+}
+
+func TestNewReaderN(t *testing.T) {
+	gz := seekingTests[2].gzip
+	for _, tc := range []struct{ blockSize, blocks int }{{100, 4}, {0, 4}, {1024, 0}, {1024, -1}} {
+		if _, err := NewReaderN(bytes.NewReader(gz), tc.blockSize, tc.blocks); err == nil {
+			t.Errorf("NewReaderN(%d, %d): expected error", tc.blockSize, tc.blocks)
+		}
+	}
+	r, err := NewReaderN(bytes.NewReader(gz), 512, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil || string(data) != seekingTests[2].raw {
+		t.Fatalf("ReadAll = %d bytes, %v", len(data), err)
+	}
+	if err := r.Reset(bytes.NewReader(gz)); err != nil {
+		t.Fatal(err)
+	}
+	if r.blockSize != 512 || r.concurrentBlocks != 3 {
+		t.Errorf("after Reset: blockSize %d, blocks %d, want 512, 3", r.blockSize, r.concurrentBlocks)
+	}
+	data, err = ioutil.ReadAll(r)
+	if err != nil || string(data) != seekingTests[2].raw {
+		t.Fatalf("ReadAll after Reset = %d bytes, %v", len(data), err)
+	}
+}
+
 func TestTruncatedGunzipBlocks(t *testing.T) {
 	var in = make([]byte, 512*10)
 	rand.Read(in)
@@ -922,3 +2610,473 @@ func TestTruncatedGunzipBlocks(t *testing.T) {
 		}
 	}
 }
+
+func TestReaderSetConcurrency(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 300000, 16<<10)
+	r, err := NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetConcurrency(4096, 0); err == nil {
+		t.Error("expected error for 0 blocks")
+	}
+	if err := r.SetConcurrency(100, 2); err == nil {
+		t.Error("expected error for small blocks")
+	}
+	if err := r.SetConcurrency(4096, 2); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), in) {
+		t.Error("WriteTo: content does not match")
+	}
+	if err := r.SetConcurrency(4096, 8); err == nil {
+		t.Error("expected error while reading")
+	}
+	r.Close()
+
+	r, err = NewSeekingReader(bytes.NewReader(compressed), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err := r.SetConcurrency(1000, 8); err != nil {
+		t.Fatal(err)
+	}
+	for _, pos := range []int64{100000, 17000, 0} {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, in[pos:]) {
+			t.Errorf("Seek(%d): content does not match", pos)
+		}
+	}
+}
+
+func TestSeekingReaderTruncated(t *testing.T) {
+	_, compressed, meta := testSeekableData(t, 300000, 16<<10)
+	truncated := compressed[:len(compressed)/2]
+	if _, err := NewSeekingReader(bytes.NewReader(truncated), &meta); !errors.Is(err, ErrInvalidMetadata) {
+		t.Errorf("NewSeekingReader: got %v, want ErrInvalidMetadata", err)
+	}
+	prefixed := append([]byte("prefix"), truncated...)
+	if _, err := NewSeekingReaderOffset(bytes.NewReader(prefixed), &meta, 6); !errors.Is(err, ErrInvalidMetadata) {
+		t.Errorf("NewSeekingReaderOffset: got %v, want ErrInvalidMetadata", err)
+	}
+	r, err := NewSeekingReader(bytes.NewReader(compressed), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+}
+
+func TestReadAfterEOF(t *testing.T) {
+	for _, multistream := range []bool{true, false} {
+		r, err := NewReader(bytes.NewReader(gunzipTests[1].gzip))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Multistream(multistream)
+		if _, err := ioutil.ReadAll(r); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			if n, err := r.Read(make([]byte, 10)); n != 0 || err != io.EOF {
+				t.Errorf("multistream %v: Read after EOF = %d, %v", multistream, n, err)
+			}
+		}
+		r.Close()
+	}
+}
+
+func TestDrainAndClose(t *testing.T) {
+	in, compressed, _ := testSeekableData(t, 300000, 16<<10)
+	corrupt := append([]byte{}, compressed...)
+	corrupt[len(corrupt)-8] ^= 0xff
+	for _, tc := range []struct {
+		data []byte
+		read int
+		want error
+	}{
+		{compressed, 100, nil},
+		{compressed, len(in), nil},
+		{corrupt, 100, ErrChecksum},
+		{corrupt, 0, ErrChecksum},
+	} {
+		r, err := NewReader(bytes.NewReader(tc.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.read == len(in) {
+			if _, err := ioutil.ReadAll(r); err != nil {
+				t.Fatal(err)
+			}
+		} else if _, err := io.ReadFull(r, make([]byte, tc.read)); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.DrainAndClose(); err != tc.want {
+			t.Errorf("read %d bytes: got %v, want %v", tc.read, err, tc.want)
+		}
+	}
+}
+
+func TestReadBufferSize(t *testing.T) {
+	in, compressed, _ := testSeekableData(t, 100000, 16<<10)
+	var r Reader
+	if err := r.SetReadBufferSize(10); err == nil {
+		t.Error("expected error for a tiny buffer")
+	}
+	if err := r.SetReadBufferSize(256); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reset(struct{ io.Reader }{bytes.NewReader(compressed)}); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if br, ok := r.bufr.(*bufio.Reader); !ok || br.Size() != 256 {
+		t.Errorf("source read through %T", r.bufr)
+	}
+	got, err := ioutil.ReadAll(&r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, in) {
+		t.Error("content does not match")
+	}
+}
+
+// BenchmarkReadBufferSize measures decompression of testdata/test.json.gz
+// read from an unbuffered source with different read buffer sizes.
+func BenchmarkReadBufferSize(b *testing.B) {
+	compressed, err := ioutil.ReadFile("testdata/test.json.gz")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, size := range []int{256, 4 << 10, 64 << 10, 1 << 20} {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			var r Reader
+			r.SetReadBufferSize(size)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := r.Reset(struct{ io.Reader }{bytes.NewReader(compressed)}); err != nil {
+					b.Fatal(err)
+				}
+				n, err := r.WriteTo(ioutil.Discard)
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.SetBytes(n)
+			}
+			r.Close()
+		})
+	}
+}
+
+func TestReaderWithOrigin(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 300000, 16<<10)
+	const origin = 20000
+	if _, err := NewReaderWithOrigin(bytes.NewReader(compressed), &meta, meta.Size+1); err != ErrInvalidSeek {
+		t.Errorf("origin beyond the end: got %v, want %v", err, ErrInvalidSeek)
+	}
+	r, err := NewReaderWithOrigin(bytes.NewReader(compressed), &meta, origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	p := make([]byte, 100)
+	if _, err := io.ReadFull(r, p); err != nil || !bytes.Equal(p, in[origin:origin+100]) {
+		t.Fatalf("first read: %v", err)
+	}
+	if pos, err := r.Seek(0, io.SeekCurrent); err != nil || pos != 100 {
+		t.Errorf("position = %d, %v, want 100", pos, err)
+	}
+	for _, tc := range []struct {
+		offset int64
+		whence int
+		want   int64
+	}{
+		{0, io.SeekStart, 0},
+		{5000, io.SeekStart, 5000},
+		{-1000, io.SeekCurrent, int64(len(in)) - origin - 1000},
+		{-10, io.SeekEnd, int64(len(in)) - origin - 10},
+	} {
+		pos, err := r.Seek(tc.offset, tc.whence)
+		if err != nil || pos != tc.want {
+			t.Fatalf("Seek(%d, %d) = %d, %v, want %d", tc.offset, tc.whence, pos, err, tc.want)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil || !bytes.Equal(got, in[origin+pos:]) {
+			t.Errorf("after Seek(%d, %d): content does not match, %v", tc.offset, tc.whence, err)
+		}
+	}
+	if _, err := r.Seek(-1, io.SeekStart); !errors.Is(err, ErrInvalidSeek) {
+		t.Errorf("Seek before origin: got %v, want %v", err, ErrInvalidSeek)
+	}
+	if _, err := r.Seek(-int64(len(in)), io.SeekEnd); !errors.Is(err, ErrInvalidSeek) {
+		t.Errorf("Seek before origin from end: got %v, want %v", err, ErrInvalidSeek)
+	}
+	if !r.CanSeek(0) || r.CanSeek(int64(len(in))-origin) {
+		t.Error("CanSeek does not use offsets relative to the origin")
+	}
+	var buf bytes.Buffer
+	if n, err := r.CopyRange(&buf, 1000, 50); err != nil || n != 50 || !bytes.Equal(buf.Bytes(), in[origin+1000:origin+1050]) {
+		t.Errorf("CopyRange = %d, %v", n, err)
+	}
+	var blocks int
+	if err := r.ForEachBlock(func(int, []byte) error { blocks++; return nil }); err != nil || blocks != meta.NumBlocks()-1 {
+		t.Errorf("ForEachBlock passed %d blocks, %v", blocks, err)
+	}
+}
+
+func TestReadByte(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 100000, 16<<10)
+	r, err := NewSeekingReader(bytes.NewReader(compressed), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var got []byte
+	buf := make([]byte, 700)
+	for i := 0; ; i++ {
+		if i%50 == 49 {
+			n, err := r.Read(buf)
+			got = append(got, buf[:n]...)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		c, err := r.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, c)
+	}
+	if !bytes.Equal(got, in) {
+		t.Fatalf("got %d bytes, want %d", len(got), len(in))
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Errorf("ReadByte at the end: %v, want io.EOF", err)
+	}
+
+	for _, pos := range []int64{5, 16<<10 - 1, 16 << 10, 99999} {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		c, err := r.ReadByte()
+		if err != nil || c != in[pos] {
+			t.Errorf("ReadByte after Seek(%d) = %d, %v, want %d", pos, c, err, in[pos])
+		}
+		if off, _ := r.Seek(0, io.SeekCurrent); off != pos+1 {
+			t.Errorf("position after ReadByte = %d, want %d", off, pos+1)
+		}
+	}
+}
+
+func TestErrorCategories(t *testing.T) {
+	for _, tt := range []struct {
+		err, category error
+	}{
+		{ErrHeader, ErrCorrupt},
+		{ErrChecksum, ErrCorrupt},
+		{fmt.Errorf("%w: block 3", ErrChecksum), ErrCorrupt},
+		{ErrUnsupported, ErrSeek},
+		{ErrInvalidSeek, ErrSeek},
+		{&SeekError{Offset: 10, Size: 5}, ErrSeek},
+	} {
+		if !errors.Is(tt.err, tt.category) {
+			t.Errorf("errors.Is(%v, %v) = false", tt.err, tt.category)
+		}
+	}
+	for _, err := range []error{ErrInvalidMetadata, ErrReadTimeout, io.ErrUnexpectedEOF, ErrInvalidSeek} {
+		if errors.Is(err, ErrCorrupt) {
+			t.Errorf("errors.Is(%v, ErrCorrupt) = true", err)
+		}
+	}
+	if errors.Is(ErrHeader, ErrSeek) || errors.Is(ErrCorrupt, ErrHeader) {
+		t.Error("categories match the wrong errors")
+	}
+
+	// The sentinels themselves are unchanged.
+	_, err := NewReader(bytes.NewReader([]byte("not gzip data")))
+	if err != ErrHeader || err.Error() != "gzip: invalid header" {
+		t.Errorf("got %v, want ErrHeader", err)
+	}
+}
+
+// dribbleReader returns at most one byte per Read, and every other Read
+// returns no data at all, as a slow network connection may.
+type dribbleReader struct {
+	r     io.Reader
+	empty bool
+}
+
+func (d *dribbleReader) Read(p []byte) (int, error) {
+	d.empty = !d.empty
+	if d.empty || len(p) == 0 {
+		return 0, nil
+	}
+	return d.r.Read(p[:1])
+}
+
+func TestDribbleReader(t *testing.T) {
+	var buf bytes.Buffer
+	var want []byte
+	for i, hdr := range []Header{
+		{Name: "first", Comment: "with a comment", Extra: []byte("extra field")},
+		{Name: "second"},
+	} {
+		w := NewWriter(&buf)
+		w.Header = hdr
+		data := bytes.Repeat([]byte(fmt.Sprintf("member %d ", i)), 20000)
+		w.Write(data)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, data...)
+	}
+	r, err := NewReader(&dribbleReader{r: bytes.NewReader(buf.Bytes())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Name != "first" || r.Comment != "with a comment" || string(r.Extra) != "extra field" {
+		t.Errorf("got header %+v", r.Header)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(got, want) {
+		t.Fatalf("got %d bytes, %v, want %d", len(got), err, len(want))
+	}
+
+	// A truncated trailer is still reported.
+	if err := r.Reset(&dribbleReader{r: bytes.NewReader(buf.Bytes()[:buf.Len()-3])}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(r); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated trailer: got %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestISize(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 300000, 16<<10)
+	r, err := NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ISize() != 0 {
+		t.Errorf("ISize before the end = %d, want 0", r.ISize())
+	}
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		t.Fatal(err)
+	}
+	if r.ISize() != uint32(len(in)) {
+		t.Errorf("ISize = %d, want %d", r.ISize(), len(in))
+	}
+	if err := r.Reset(bytes.NewReader(compressed)); err != nil || r.ISize() != 0 {
+		t.Errorf("after Reset: ISize = %d, %v", r.ISize(), err)
+	}
+
+	// Readers with metadata read the trailer after a Seek as well.
+	s, err := NewSeekingReader(bytes.NewReader(compressed), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.Seek(250000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(ioutil.Discard, s); err != nil {
+		t.Fatal(err)
+	}
+	if s.ISize() != uint32(len(in)) {
+		t.Errorf("after Seek: ISize = %d, want %d", s.ISize(), len(in))
+	}
+}
+
+func TestExpectedSize(t *testing.T) {
+	in, comp, meta := testSeekableData(t, 1<<20, 64<<10)
+	size := int64(len(in))
+	readers := []struct {
+		name string
+		open func() (*Reader, error)
+	}{
+		{"stream", func() (*Reader, error) {
+			r, err := NewReader(bytes.NewReader(comp))
+			if err == nil {
+				err = r.SetConcurrency(64<<10, 4)
+			}
+			return r, err
+		}},
+		{"seeking", func() (*Reader, error) { return NewSeekingReader(bytes.NewReader(comp), &meta) }},
+		{"cached", func() (*Reader, error) {
+			r, err := NewSeekingReader(bytes.NewReader(comp), &meta)
+			if err == nil {
+				r.SetBlockCacheSize(4)
+				_, err = r.Seek(0, io.SeekStart)
+			}
+			return r, err
+		}},
+	}
+	reads := []struct {
+		name string
+		read func(r *Reader, w io.Writer) error
+	}{
+		{"Read", func(r *Reader, w io.Writer) error {
+			_, err := io.Copy(w, struct{ io.Reader }{r})
+			return err
+		}},
+		{"WriteTo", func(r *Reader, w io.Writer) error {
+			_, err := r.WriteTo(w)
+			return err
+		}},
+		{"WriteToBuffer", func(r *Reader, w io.Writer) error {
+			_, err := r.WriteToBuffer(w, make([]byte, 64<<10))
+			return err
+		}},
+	}
+	for _, rd := range readers {
+		for _, m := range reads {
+			for _, expect := range []int64{-1, size, size + 1, size - 1, 100 << 10, 1000} {
+				r, err := rd.open()
+				if err != nil {
+					t.Fatal(err)
+				}
+				r.SetExpectedSize(expect)
+				var buf bytes.Buffer
+				err = m.read(r, &buf)
+				var wantErr error
+				if expect >= 0 && expect != size {
+					wantErr = ErrSizeMismatch
+				}
+				if err != wantErr {
+					t.Errorf("%s %s, expecting %d: got %v, want %v", rd.name, m.name, expect, err, wantErr)
+				}
+				if !bytes.Equal(buf.Bytes(), in[:buf.Len()]) {
+					t.Errorf("%s %s, expecting %d: wrong data", rd.name, m.name, expect)
+				}
+				// Nothing beyond the expected size is returned.
+				if expect >= 0 && int64(buf.Len()) > expect {
+					t.Errorf("%s %s, expecting %d: got %d bytes", rd.name, m.name, expect, buf.Len())
+				}
+				if wantErr != nil {
+					if _, err := r.Read(make([]byte, 1)); err != wantErr {
+						t.Errorf("%s %s, expecting %d: Read again: %v", rd.name, m.name, expect, err)
+					}
+				}
+				r.Close()
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package sgzip
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// bgzfHeaderLen is the length of the gzip header of a BGZF block: the
+// fixed header followed by the extra field holding the BGZF subfield.
+const bgzfHeaderLen = 18
+
+// LoadGZI reads a BGZF index in the .gzi format used by htslib and returns
+// metadata for seeking in the indexed BGZF file with NewSeekingReader.
+//
+// A .gzi file starts with the number of entries as a little-endian uint64,
+// followed by the compressed and uncompressed offset of the start of each
+// BGZF block but the first, as pairs of little-endian uint64 values. Each
+// BGZF block is a gzip member of its own; the metadata describes the
+// deflate data of each member.
+//
+// The index does not record where the data of the last block ends, so the
+// returned Size is the uncompressed offset at which the last block starts,
+// and the length of the last block is given as 0. Seeking is possible up
+// to that offset. A Reader stops there unless Multistream(true) is called,
+// in which case reading continues to the end of the data. ErrIndex
+// is returned if the index is truncated, the number of entries does not
+// match or the offsets do not increase.
+func LoadGZI(r io.Reader) (GzipMetadata, error) {
+	var buf [16]byte
+	if _, err := io.ReadFull(r, buf[:8]); err != nil {
+		return GzipMetadata{}, indexErr(err)
+	}
+	n := binary.LittleEndian.Uint64(buf[:8])
+	meta := GzipMetadata{
+		BlockData: []uint32{bgzfHeaderLen},
+	}
+	var comp, size int64
+	for i := uint64(0); i < n; i++ {
+		if _, err := io.ReadFull(r, buf[:]); err != nil {
+			return GzipMetadata{}, indexErr(err)
+		}
+		c := binary.LittleEndian.Uint64(buf[0:8])
+		u := binary.LittleEndian.Uint64(buf[8:16])
+		if c <= uint64(comp) || u <= uint64(size) || c-uint64(comp) > math.MaxUint32 || u-uint64(size) > math.MaxUint32 {
+			return GzipMetadata{}, fmt.Errorf("%w: gzi entry %d does not follow the previous one", ErrIndex, i)
+		}
+		meta.BlockData = append(meta.BlockData, uint32(c-uint64(comp)))
+		meta.BlockLens = append(meta.BlockLens, uint32(u-uint64(size)))
+		if int(u-uint64(size)) > meta.BlockSize {
+			meta.BlockSize = int(u - uint64(size))
+		}
+		comp, size = int64(c), int64(u)
+	}
+	// A Read may return no data before the end, so use ReadFull.
+	if _, err := io.ReadFull(r, buf[:1]); err == nil {
+		return GzipMetadata{}, fmt.Errorf("%w: gzi has more than %d entries", ErrIndex, n)
+	} else if err != io.EOF {
+		return GzipMetadata{}, err
+	}
+	// The last block, whose extent is not known.
+	meta.BlockData = append(meta.BlockData, 0)
+	meta.BlockLens = append(meta.BlockLens, 0)
+	meta.Size = size
+	meta.Version = metadataVersion(&meta)
+	return meta, nil
+}
+
+// bgzfMaxBlock is the largest size of a BGZF block, both compressed and
+// uncompressed.
+const bgzfMaxBlock = 1 << 16
+
+// WriteGZI writes m to w as a .gzi index, as read by LoadGZI and htslib.
+// m must describe a BGZF file, such as the metadata returned by LoadGZI:
+// each block must be a gzip member of at most 64 KiB with a BGZF header.
+// The metadata does not tell whether the blocks are separate members, but
+// an error is returned if the header length or the size of a block rule
+// out BGZF, which is the case for streams written by Writer.
+func (m GzipMetadata) WriteGZI(w io.Writer) error {
+	if err := checkVersion(&m); err != nil {
+		return err
+	}
+	if len(m.BlockData) < 2 || m.BlockData[0] != bgzfHeaderLen {
+		return errors.New("gzip: metadata does not describe a BGZF file")
+	}
+	n := m.NumBlocks()
+	buf := make([]byte, 8, 8+16*n)
+	binary.LittleEndian.PutUint64(buf, uint64(n-1))
+	var comp, size int64
+	for i := 0; i < n; i++ {
+		clen, ulen := int64(m.BlockData[i+1]), blockLen(&m, i)
+		if clen > bgzfMaxBlock || ulen > bgzfMaxBlock {
+			return fmt.Errorf("gzip: metadata does not describe a BGZF file: block %d is too large", i)
+		}
+		if i > 0 {
+			var e [16]byte
+			binary.LittleEndian.PutUint64(e[0:8], uint64(comp))
+			binary.LittleEndian.PutUint64(e[8:16], uint64(size))
+			buf = append(buf, e[:]...)
+		}
+		comp += clen
+		size += ulen
+	}
+	_, err := w.Write(buf)
+	return err
+}
@@ -0,0 +1,145 @@
+package sgzip
+
+import (
+	"bytes"
+	oldgz "compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+// testBGZF returns data compressed as BGZF blocks of up to blockSize bytes,
+// and its .gzi index.
+func testBGZF(t *testing.T, in []byte, blockSize int) (compressed, gzi []byte) {
+	var buf bytes.Buffer
+	var entries [][2]uint64
+	for off := 0; off < len(in); off += blockSize {
+		if off > 0 {
+			entries = append(entries, [2]uint64{uint64(buf.Len()), uint64(off)})
+		}
+		end := off + blockSize
+		if end > len(in) {
+			end = len(in)
+		}
+		w := oldgz.NewWriter(&buf)
+		w.Extra = []byte{'B', 'C', 2, 0, 0, 0} // BSIZE is not needed here
+		w.Write(in[off:end])
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	idx := make([]byte, 8+16*len(entries))
+	binary.LittleEndian.PutUint64(idx, uint64(len(entries)))
+	for i, e := range entries {
+		binary.LittleEndian.PutUint64(idx[8+16*i:], e[0])
+		binary.LittleEndian.PutUint64(idx[16+16*i:], e[1])
+	}
+	return buf.Bytes(), idx
+}
+
+func TestLoadGZI(t *testing.T) {
+	in := make([]byte, 300000)
+	for i := range in {
+		in[i] = byte(i*7 + i/1000)
+	}
+	compressed, gzi := testBGZF(t, in, 65280)
+	meta, err := LoadGZI(bytes.NewReader(gzi))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slow, err := LoadGZI(&dribbleReader{r: bytes.NewReader(gzi)}); err != nil || !reflect.DeepEqual(slow, meta) {
+		t.Errorf("LoadGZI from a slow reader: %v", err)
+	}
+	if meta.NumBlocks() != 5 || meta.Size != 4*65280 || meta.BlockSize != 65280 {
+		t.Fatalf("got %d blocks, Size %d, BlockSize %d", meta.NumBlocks(), meta.Size, meta.BlockSize)
+	}
+	r, err := NewSeekingReader(bytes.NewReader(compressed), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.Multistream(true)
+	for _, pos := range []int64{200000, 0, 65280, 65279, 4 * 65280} {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			t.Fatalf("Seek(%d): %v", pos, err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("ReadAll after Seek(%d): %v", pos, err)
+		}
+		if !bytes.Equal(got, in[pos:]) {
+			t.Errorf("Seek(%d): content does not match", pos)
+		}
+	}
+
+	// A single block has no entries.
+	single, gzi := testBGZF(t, in[:1000], 65280)
+	meta, err = LoadGZI(bytes.NewReader(gzi))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = NewSeekingReader(bytes.NewReader(single), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if got, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(got, in[:1000]) {
+		t.Errorf("single block: %v", err)
+	}
+}
+
+func TestLoadGZIErrors(t *testing.T) {
+	entry := func(c, u uint64) []byte {
+		b := make([]byte, 16)
+		binary.LittleEndian.PutUint64(b, c)
+		binary.LittleEndian.PutUint64(b[8:], u)
+		return b
+	}
+	count := func(n uint64) []byte {
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint64(b, n)
+		return b
+	}
+	join := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+	for name, gzi := range map[string][]byte{
+		"empty":          nil,
+		"truncated":      join(count(2), entry(100, 1000)),
+		"extra entries":  join(count(1), entry(100, 1000), entry(200, 2000)),
+		"compressed":     join(count(2), entry(100, 1000), entry(100, 2000)),
+		"uncompressed":   join(count(2), entry(100, 1000), entry(200, 500)),
+		"first at start": join(count(1), entry(0, 0)),
+	} {
+		if _, err := LoadGZI(bytes.NewReader(gzi)); !errors.Is(err, ErrIndex) {
+			t.Errorf("%s: got %v, want ErrIndex", name, err)
+		}
+	}
+}
+
+func TestWriteGZI(t *testing.T) {
+	in := make([]byte, 300000)
+	for i := range in {
+		in[i] = byte(i*7 + i/1000)
+	}
+	for _, size := range []int{300000, 65280, 1000} {
+		_, gzi := testBGZF(t, in[:size], 65280)
+		meta, err := LoadGZI(bytes.NewReader(gzi))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := meta.WriteGZI(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), gzi) {
+			t.Errorf("size %d: written index differs from the one loaded", size)
+		}
+	}
+
+	_, _, meta := testSeekableData(t, 300000, 16<<10)
+	if err := meta.WriteGZI(ioutil.Discard); err == nil {
+		t.Error("expected error for a stream written by Writer")
+	}
+}
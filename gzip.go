@@ -11,8 +11,10 @@ import (
 	"hash"
 	"hash/crc32"
 	"io"
+	"io/ioutil"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/klauspost/compress/flate"
@@ -34,11 +36,50 @@ const (
 	HuffmanOnly         = flate.HuffmanOnly
 )
 
+// ValidLevel reports whether level is a compression level accepted by
+// NewWriterLevel: HuffmanOnly, DefaultCompression, NoCompression, or any
+// integer value between BestSpeed and BestCompression inclusive.
+func ValidLevel(level int) bool {
+	return level >= HuffmanOnly && level <= BestCompression
+}
+
 // GzipMetadata stores the Metadata necessary to seek in the compressed file
+//
+// It describes where the blocks are, not how they were compressed. Deflate
+// data describes its own encoding, so the blocks of a file may use
+// different compression levels or deflate implementations, as when parts
+// written at different levels are joined by Concat, or when a
+// DeflateFactory varies the level, and are read and seeked alike.
 type GzipMetadata struct {
+	Version   int // format version; 0 for metadata from before versioning
 	BlockSize int
 	Size      int64
 	BlockData []uint32
+	BlockCRC  []uint32 // CRC-32 of the uncompressed data of each block, if known
+	BlockLens []uint32 // uncompressed size of each block if they vary, see SetAdaptiveBlocks
+	Padding   int      // zero bytes after the data that are not counted in Size, see SetPadLastBlock
+	// Fingerprint identifies the compressed stream, so that metadata used
+	// with the wrong file is detected; 0 if not recorded. It is a CRC-32 of
+	// the first and last compressed blocks and the trailer, and is set by
+	// Writer once it is closed.
+	Fingerprint uint32
+	// Unindexed lists the blocks that each hold a whole member written
+	// without an index, in increasing order, see IndexMembers. Seeking
+	// into such a block decompresses the member from its start.
+	Unindexed []int
+	// UBlockData holds the uncompressed offset at which each block starts,
+	// if given. It takes precedence over BlockLens and BlockSize, and
+	// allows blocks of any size, such as blocks aligned to records.
+	UBlockData []int64
+	// StreamOffset is the offset of the stream in the file that the
+	// compressed offsets count from. It is 0, as written by Writer, if
+	// they count from the start of the stream. Otherwise they count from
+	// the start of an enclosing file in which the stream starts at
+	// StreamOffset, and BlockData[0] is StreamOffset plus the length of
+	// the header. Functions reading blocks from an io.ReaderAt, such as
+	// ReadRange and Verify, read them at these offsets, and the seeking
+	// constructors read the header at StreamOffset. See Rebase.
+	StreamOffset int64
 }
 
 // A Writer is an io.WriteCloser.
@@ -52,10 +93,12 @@ type Writer struct {
 	blocks        int
 	currentBuffer []byte
 	digest        hash.Hash32
+	newCRC        func() hash.Hash32 // see SetCRC32Func
 	size          int64
 	closed        bool
 	buf           [10]byte
 	blockData     []uint32
+	blockCRC      []uint32
 	errMu         sync.RWMutex
 	err           error
 	pushedErr     chan struct{}
@@ -63,10 +106,80 @@ type Writer struct {
 	dictFlatePool sync.Pool
 	dstPool       sync.Pool
 	wg            sync.WaitGroup
+	align         int
+	padLast       bool
+	omitEmpty     bool   // see SetOmitEmpty
+	padding       int    // zero bytes added by padLast
+	flushed       int    // uncompressed bytes of the current block written by Flush
+	pendingLen    uint32 // compressed size of the flushed part of the current block
+	pendingCRC    uint32 // checksum of the flushed part of the current block
+	pendingULen   uint32 // uncompressed size of the flushed part of the current block
+	adaptMin      int    // step size of adaptive blocks, 0 if disabled
+	steps         int    // adaptive steps in the current block
+	blockEntropy  float64
+	boundary      boundaryFunc
+	flateStats    func(blockType int, inBytes, outBytes int)
+	blockLens     []uint32
+	manual        bool   // blocks are written by WriteBlock
+	fpFirst       uint32 // checksum of the first compressed block, see fingerprintBlock
+	fpFirstDone   bool
+	fpLast        uint32 // checksum of the current compressed block
+	fpLastLen     int64
+	fingerprint   uint32         // set by Close
+	started       time.Time      // time of the first Write
+	elapsed       time.Duration  // time from the first Write to Close
+	index         *indexEncoder  // set by CreateSeekable
+	container     bool           // set by NewContainerWriter
+	containerAt   int64          // offset of the container in w, -1 if w cannot seek
+	pointerOff    int64          // offset of the index pointer in the container
+	header        []byte         // the header of a container with a header checksum
+	memberHeader  []byte         // the header of the members after the first in a container
+	memberCRC     uint32         // checksum of the last block of a container
+	memberLen     uint32         // uncompressed size of the last block of a container
+	wa            *offsetWriter  // set when writing to an io.WriterAt
+	writes        sync.WaitGroup // pending writes to wa
+	writeSlots    chan struct{}  // limits the pending writes to wa to blocks
+	pendingLimit  int            // see SetPendingBlockLimit
+	pending       chan struct{}  // holds a value for each pending block if pendingLimit is set
+	listening     chan struct{}  // closed when the goroutine writing results exits
+	spillDir      string         // see SetSpillDir
+	spill         *spillFile     // set by the first Write if spillDir is set
+	spilled       int64          // blocks stored in closed spill files
+	seq           int64          // sequence number of the next result
+}
+
+// A DeflateCompressor produces raw deflate data, as specified in RFC 1951.
+// Both *flate.Writer from compress/flate and from
+// github.com/klauspost/compress/flate implement it.
+type DeflateCompressor interface {
+	io.WriteCloser
+	// Flush writes any pending data, ending on a byte boundary
+	// with an empty stored block (a sync flush).
+	Flush() error
+	// Reset discards the compressor state and makes it write to w.
+	Reset(w io.Writer)
+}
+
+// A DeflateFactory creates the compressors used to compress blocks.
+type DeflateFactory interface {
+	NewCompressor(w io.Writer, level int) (DeflateCompressor, error)
 }
 
+// eofMarker is the last block of every stream written by a Writer: an
+// empty final deflate block with fixed Huffman codes, following the sync
+// flush that ends the preceding block. Like the empty EOF block of BGZF,
+// it allows telling a complete stream from one truncated after a block.
+var eofMarker = []byte{0x03, 0x00}
+
 type result struct {
 	result        chan []byte
+	crc           *uint32 // set before sending on result
+	size          int     // uncompressed size
+	final         bool
+	partial       bool          // written by Flush, the block continues in the next result
+	seq           int64         // position in the order of results
+	spilled       *int          // length of the block in the spill file, set before sending on result
+	pending       chan struct{} // the slot to release once written, see SetPendingBlockLimit
 	notifyWritten chan struct{}
 }
 
@@ -78,6 +191,13 @@ type result struct {
 // Default values for this is SetConcurrency(defaultBlockSize, runtime.GOMAXPROCS(0)),
 // meaning blocks are split at 1 MB and up to the number of CPU threads
 // can be processing at once before the writer blocks.
+//
+// Blocks count as processing until the result writer takes them to write
+// them to the underlying writer, so when it is slower than compression,
+// Write blocks once that many blocks are waiting: at most blocks+1 blocks
+// are pending, plus the one being filled. Writers created by NewWriterAt
+// may have up to blocks further blocks being written. Use
+// SetPendingBlockLimit for a lower limit.
 func (z *Writer) SetConcurrency(blockSize, blocks int) error {
 	if blocks <= 0 {
 		return errors.New("gzip: blocks cannot be zero or less")
@@ -92,6 +212,72 @@ func (z *Writer) SetConcurrency(blockSize, blocks int) error {
 	return nil
 }
 
+// SetPendingBlockLimit makes Write block once n blocks are pending, that
+// is, queued for compression or compressed and not yet written to the
+// underlying writer. This bounds the memory used when the destination is
+// slower than compression to n blocks, each compressed and uncompressed,
+// plus the block being filled, which holds for NewWriterAt too. Flush and
+// Close wait until all pending blocks have been written, as before.
+//
+// SetConcurrency already allows at most blocks+1 pending blocks, so the
+// limit only has an effect below that, and then also limits the blocks
+// compressed in parallel. A limit of 0, the default, leaves the pending
+// blocks to SetConcurrency. It must be called before the first Write and
+// is kept across Reset.
+func (z *Writer) SetPendingBlockLimit(n int) error {
+	if n < 0 {
+		return errors.New("gzip: pending block limit cannot be negative")
+	}
+	if z.wroteHeader {
+		return errors.New("gzip: SetPendingBlockLimit called after Write")
+	}
+	z.pendingLimit = n
+	z.pending = nil
+	if n > 0 {
+		z.pending = make(chan struct{}, n)
+	}
+	return nil
+}
+
+// blockWritten reports that the block of r has been written, or dropped
+// after an error. This should only be called from the result writer or
+// the writes it starts.
+func (z *Writer) blockWritten(r result) {
+	if r.pending != nil {
+		<-r.pending
+	}
+	close(r.notifyWritten)
+}
+
+// SetDeflateFactory makes the Writer compress blocks with compressors
+// created by f instead of the default deflate implementation. Framing,
+// checksums and metadata are still handled by the Writer.
+//
+// It must be called before the first Write and is kept across Reset.
+// An error is returned if it is called later, or if f cannot create a
+// compressor for the Writer's compression level. If f fails to create
+// one later on, the error is returned by Write, Flush or Close.
+func (z *Writer) SetDeflateFactory(f DeflateFactory) error {
+	if z.wroteHeader {
+		return errors.New("gzip: SetDeflateFactory called after Write")
+	}
+	c, err := f.NewCompressor(ioutil.Discard, z.level)
+	if err != nil {
+		return err
+	}
+	level := z.level
+	z.dictFlatePool = sync.Pool{New: func() interface{} {
+		c, err := f.NewCompressor(ioutil.Discard, level)
+		if err != nil {
+			z.pushError(err)
+			return nil
+		}
+		return c
+	}}
+	z.dictFlatePool.Put(c)
+	return nil
+}
+
 // NewWriter returns a new Writer.
 // Writes to the returned writer are compressed and written to w.
 //
@@ -102,7 +288,11 @@ func (z *Writer) SetConcurrency(blockSize, blocks int) error {
 // the first call to Write or Close. The Comment and Name header fields are
 // UTF-8 strings in Go, but the underlying format requires NUL-terminated ISO
 // 8859-1 (Latin-1). NUL or non-Latin-1 runes in those strings will lead to an
-// error on Write.
+// error on Write. The OS field is 255 (unknown) unless set, so the output
+// does not depend on the platform it was written on. Likewise, the Writer
+// never takes the current time: a zero ModTime, the default, is written as
+// no time stamp (an MTIME of 0), as are times before 1970. Leaving it zero
+// or setting a fixed time makes the output bit for bit reproducible.
 func NewWriter(w io.Writer) *Writer {
 	z, _ := NewWriterLevel(w, DefaultCompression)
 	return z
@@ -111,12 +301,12 @@ func NewWriter(w io.Writer) *Writer {
 // NewWriterLevel is like NewWriter but specifies the compression level instead
 // of assuming DefaultCompression.
 //
-// The compression level can be DefaultCompression, NoCompression, or any
-// integer value between BestSpeed and BestCompression inclusive. The error
-// returned will be nil if the level is valid.
+// The compression level can be HuffmanOnly, DefaultCompression, NoCompression,
+// or any integer value between BestSpeed and BestCompression inclusive. The
+// error returned will be nil if the level is valid.
 func NewWriterLevel(w io.Writer, level int) (*Writer, error) {
-	if level < ConstantCompression || level > BestCompression {
-		return nil, fmt.Errorf("gzip: invalid compression level: %d", level)
+	if !ValidLevel(level) {
+		return nil, fmt.Errorf("gzip: invalid compression level: %d (must be between %d and %d)", level, HuffmanOnly, BestCompression)
 	}
 	z := new(Writer)
 	z.SetConcurrency(defaultBlockSize, 1)
@@ -124,6 +314,23 @@ func NewWriterLevel(w io.Writer, level int) (*Writer, error) {
 	return z, nil
 }
 
+// NewWriterLevelBlockSize is like NewWriterLevel but also sets the block
+// size, as SetConcurrency does with the default number of blocks, so that
+// up to runtime.GOMAXPROCS(0) blocks are compressed in parallel, as by
+// NewContainerWriter.
+// SuggestBlockSize helps choose a block size for a given seek latency.
+func NewWriterLevelBlockSize(w io.Writer, level, blockSize int) (*Writer, error) {
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("gzip: invalid block size: %d", blockSize)
+	}
+	z, err := NewWriterLevel(w, level)
+	if err != nil {
+		return nil, err
+	}
+	z.SetConcurrency(blockSize, runtime.GOMAXPROCS(0))
+	return z, nil
+}
+
 // This function must be used by goroutines to set an
 // error condition, since z.err access is restricted
 // to the callers goruotine.
@@ -140,6 +347,7 @@ func (z *Writer) pushError(err error) {
 
 func (z *Writer) init(w io.Writer, level int) {
 	z.wg.Wait()
+	z.closeSpill()
 	digest := z.digest
 	if digest != nil {
 		digest.Reset()
@@ -152,15 +360,37 @@ func (z *Writer) init(w io.Writer, level int) {
 	z.digest = digest
 	z.pushedErr = make(chan struct{}, 0)
 	z.results = make(chan result, z.blocks)
+	if z.pendingLimit > 0 {
+		z.pending = make(chan struct{}, z.pendingLimit)
+	}
 	z.err = nil
 	z.closed = false
 	z.Comment = ""
 	z.Extra = nil
 	z.ModTime = time.Time{}
 	z.wroteHeader = false
+	z.elapsed = 0
+	z.padding = 0
 	z.currentBuffer = nil
 	z.buf = [10]byte{}
 	z.size = 0
+	z.blockData = nil
+	z.blockCRC = nil
+	z.flushed = 0
+	z.pendingLen = 0
+	z.pendingCRC = 0
+	z.pendingULen = 0
+	z.steps = 0
+	z.blockLens = nil
+	z.manual = false
+	z.fpFirst, z.fpFirstDone = 0, false
+	z.fpLast, z.fpLastLen = 0, 0
+	z.fingerprint = 0
+	z.spilled = 0
+	z.seq = 0
+	z.header = nil
+	z.memberHeader = nil
+	z.memberCRC, z.memberLen = 0, 0
 	if z.dictFlatePool.New == nil {
 		z.dictFlatePool.New = func() interface{} {
 			f, _ := flate.NewWriterDict(w, level, nil)
@@ -169,16 +399,41 @@ func (z *Writer) init(w io.Writer, level int) {
 	}
 }
 
+// errWriterReset stops the writing of a stream abandoned by Reset.
+var errWriterReset = errors.New("gzip: writer reset")
+
 // Reset discards the Writer z's state and makes it equivalent to the
 // result of its original state from NewWriter or NewWriterLevel, but
 // writing to w instead. This permits reusing a Writer rather than
 // allocating a new one.
+//
+// The compression level and the settings from SetConcurrency are kept,
+// as are the internal buffers and compressors.
+//
+// A stream that has not been closed is abandoned: blocks of it that have
+// not been written yet are dropped, and Reset waits for the block being
+// written, if any, so nothing of it reaches w or the new metadata.
 func (z *Writer) Reset(w io.Writer) {
 	if z.results != nil && !z.closed {
+		if z.wroteHeader {
+			z.pushError(errWriterReset)
+		}
 		close(z.results)
 	}
-	z.SetConcurrency(defaultBlockSize, runtime.GOMAXPROCS(0))
+	if z.listening != nil {
+		<-z.listening
+		z.listening = nil
+	}
+	z.writes.Wait()
+	z.wa = nil
+	z.index = nil
+	if z.blocks == 0 {
+		z.SetConcurrency(defaultBlockSize, runtime.GOMAXPROCS(0))
+	}
 	z.init(w, z.level)
+	if z.container {
+		z.startContainer(w)
+	}
 }
 
 // GZIP (RFC 1952) is little-endian, unlike ZLIB (RFC 1950).
@@ -239,9 +494,37 @@ func (z *Writer) writeString(s string) (written int, err error) {
 	return written + n, err
 }
 
+// A crcWriter writes to w and computes the CRC-32 of what it writes,
+// keeping a copy of it if keep is set.
+type crcWriter struct {
+	w    io.Writer
+	crc  uint32
+	keep bool
+	data []byte
+}
+
+func (c *crcWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.crc = crc32.Update(c.crc, crc32.IEEETable, p[:n])
+	if c.keep {
+		c.data = append(c.data, p[:n]...)
+	}
+	return n, err
+}
+
 // compressCurrent will compress the data currently buffered
 // This should only be called from the main writer/flush/closer
 func (z *Writer) compressCurrent(flush bool) {
+	r, ok := z.queueCurrent(flush)
+	// Wait if flushing
+	if ok && flush {
+		<-r.notifyWritten
+	}
+}
+
+// queueCurrent starts compressing the data currently buffered and returns
+// its result, or false if the Writer has failed.
+func (z *Writer) queueCurrent(flush bool) (result, bool) {
 	c := z.currentBuffer
 	if len(c) > z.blockSize {
 		// This can never happen through the public interface.
@@ -250,24 +533,38 @@ func (z *Writer) compressCurrent(flush bool) {
 
 	r := result{}
 	r.result = make(chan []byte, 1)
+	r.crc = new(uint32)
 	r.notifyWritten = make(chan struct{}, 0)
+	r.final = z.closed
+	r.size = len(c)
+	r.partial = flush && !z.closed
+	r.seq = z.seq
+	r.spilled = new(int)
+	if z.pending != nil {
+		select {
+		case z.pending <- struct{}{}:
+			r.pending = z.pending
+		case <-z.pushedErr:
+			return r, false
+		}
+	}
 	// Reserve a result slot
 	select {
 	case z.results <- r:
 	case <-z.pushedErr:
-		return
+		if r.pending != nil {
+			<-r.pending
+		}
+		return r, false
 	}
 
+	z.seq++
 	z.wg.Add(1)
 	go z.compressBlock(c, r, z.closed)
 
 	z.currentBuffer = z.dstPool.Get().([]byte) // Put in .compressBlock
 	z.currentBuffer = z.currentBuffer[:0]
-
-	// Wait if flushing
-	if flush {
-		<-r.notifyWritten
-	}
+	return r, true
 }
 
 // Returns an error if it has been set.
@@ -295,14 +592,22 @@ func (z *Writer) Write(p []byte) (int, error) {
 	if err := z.checkError(); err != nil {
 		return 0, err
 	}
+	if z.manual && len(p) > 0 {
+		return 0, errWriteBlockMixed
+	}
 	// Write the GZIP header lazily.
 	if !z.wroteHeader {
 		z.wroteHeader = true
+		z.started = time.Now()
 		z.buf[0] = gzipID1
 		z.buf[1] = gzipID2
 		z.buf[2] = gzipDeflate
 		z.buf[3] = 0
-		if z.Extra != nil {
+		if z.Text {
+			z.buf[3] |= 0x01
+		}
+		extra := z.headerExtra()
+		if extra != nil {
 			z.buf[3] |= 0x04
 		}
 		if z.Name != "" {
@@ -311,7 +616,16 @@ func (z *Writer) Write(p []byte) (int, error) {
 		if z.Comment != "" {
 			z.buf[3] |= 0x10
 		}
-		put4(z.buf[4:8], uint32(z.ModTime.Unix()))
+		if z.HeaderCRC {
+			z.buf[3] |= 0x02
+		}
+		z.buf[3] |= z.ReservedFlags & flagReserved
+		// A zero MTIME means no time stamp, which is also written for
+		// times that cannot be represented.
+		put4(z.buf[4:8], 0)
+		if z.ModTime.After(time.Unix(0, 0)) {
+			put4(z.buf[4:8], uint32(z.ModTime.Unix()))
+		}
 		if z.level == BestCompression {
 			z.buf[8] = 2
 		} else if z.level == BestSpeed {
@@ -320,17 +634,29 @@ func (z *Writer) Write(p []byte) (int, error) {
 			z.buf[8] = 0
 		}
 		z.buf[9] = z.OS
+		if z.container {
+			// The members after the first have the fixed fields only.
+			z.memberHeader = append(z.memberHeader[:0], z.buf[:10]...)
+			z.memberHeader[3] &= flagText
+		}
 		var n int
 		var hs int
 		var err error
+		w := z.w
+		var hw *crcWriter
+		if z.HeaderCRC {
+			// The header checksum covers the bytes written before it.
+			hw = &crcWriter{w: w, keep: z.container}
+			z.w = hw
+		}
 		n, err = z.w.Write(z.buf[0:10])
 		hs += n
 		if err != nil {
 			z.pushError(err)
 			return n, err
 		}
-		if z.Extra != nil {
-			n, err = z.writeBytes(z.Extra)
+		if extra != nil {
+			n, err = z.writeBytes(extra)
 			hs += n
 			if err != nil {
 				z.pushError(err)
@@ -353,10 +679,52 @@ func (z *Writer) Write(p []byte) (int, error) {
 				return n, err
 			}
 		}
+		if hw != nil {
+			z.w = w
+			z.header = hw.data
+			put2(z.buf[0:2], uint16(hw.crc))
+			n, err = z.w.Write(z.buf[0:2])
+			hs += n
+			if err != nil {
+				z.pushError(err)
+				return n, err
+			}
+		}
+		if pad := alignPadding(int64(hs), z.align); pad > 0 {
+			n, err = z.w.Write(deflatePadding(pad))
+			hs += n
+			if err != nil {
+				z.pushError(err)
+				return n, err
+			}
+		}
 		z.blockData = append(z.blockData, uint32(hs))
+		if z.index != nil {
+			flags := byte(indexHasCRC | indexHasFingerprint)
+			if z.variableBlocks() {
+				flags |= indexHasLens
+			}
+			err = z.index.header(z.blockSize, flags, indexVersion(flags, z.padLast))
+			if err == nil {
+				err = z.index.entry(uint32(hs), 0, 0)
+			}
+			if err != nil {
+				z.pushError(err)
+				return 0, err
+			}
+		}
+		if err := z.openSpill(); err != nil {
+			z.pushError(err)
+			return 0, err
+		}
 		// Start receiving data from compressors
+		done := make(chan struct{})
+		z.listening = done
 		go func() {
+			defer close(done)
 			listen := z.results
+			spill := z.spill
+			off := int64(hs)
 			var failed bool
 			for {
 				r, ok := <-listen
@@ -364,27 +732,54 @@ func (z *Writer) Write(p []byte) (int, error) {
 				if !ok {
 					return
 				}
-				if failed {
-					close(r.notifyWritten)
+				if failed || z.checkError() == errWriterReset {
+					z.blockWritten(r)
 					continue
 				}
+				if spill != nil {
+					atomic.StoreInt64(&spill.next, r.seq)
+				}
 				buf := <-r.result
+				if *r.spilled > 0 {
+					var err error
+					if buf, err = spill.load(r, z.dstPool.Get().([]byte)); err != nil {
+						z.pushError(err)
+						z.blockWritten(r)
+						failed = true
+						continue
+					}
+				}
+				if z.container && !r.final && z.pendingLen == 0 && len(z.blockData) > 1 {
+					buf = z.startMember(buf)
+				}
+				if !r.final && !r.partial {
+					buf = append(buf, deflatePadding(alignPadding(off+int64(len(buf)), z.align))...)
+				}
+				off += int64(len(buf))
+				z.fingerprintBlock(buf, r)
+				if z.flateStats != nil {
+					z.reportFlateBlocks(buf)
+				}
+				if z.wa != nil {
+					z.writeBlockAt(buf, r)
+					continue
+				}
 				n, err := z.w.Write(buf)
 				if err != nil {
 					z.pushError(err)
-					close(r.notifyWritten)
+					z.blockWritten(r)
 					failed = true
 					continue
 				}
 				if n != len(buf) {
 					z.pushError(fmt.Errorf("gzip: short write %d should be %d", n, len(buf)))
 					failed = true
-					close(r.notifyWritten)
+					z.blockWritten(r)
 					continue
 				}
-				z.blockData = append(z.blockData, uint32(len(buf)))
+				z.recordBlock(len(buf), r)
 				z.dstPool.Put(buf)
-				close(r.notifyWritten)
+				z.blockWritten(r)
 			}
 		}()
 		z.currentBuffer = z.dstPool.Get().([]byte)
@@ -392,16 +787,28 @@ func (z *Writer) Write(p []byte) (int, error) {
 	}
 	q := p
 	for len(q) > 0 {
+		// Data flushed by Flush is part of the current block.
+		room := z.blockSize - z.flushed
+		if z.adaptMin > 0 {
+			room = z.adaptiveRoom()
+		}
 		length := len(q)
-		if length+len(z.currentBuffer) > z.blockSize {
-			length = z.blockSize - len(z.currentBuffer)
+		if length+len(z.currentBuffer) > room {
+			length = room - len(z.currentBuffer)
+		}
+		cut := false
+		if z.boundary != nil {
+			if i := z.findBoundary(q[:length]); i >= 0 {
+				length, cut = i+1, true
+			}
 		}
 		z.digest.Write(q[:length])
 		z.currentBuffer = append(z.currentBuffer, q[:length]...)
-		if len(z.currentBuffer) > z.blockSize {
+		if len(z.currentBuffer) > room {
 			panic("z.currentBuffer too large (most likely due to concurrent Write race)")
 		}
-		if len(z.currentBuffer) == z.blockSize {
+		if cut || len(z.currentBuffer) == room && (z.adaptMin == 0 || z.endAdaptiveBlock()) {
+			z.flushed = 0
 			z.compressCurrent(false)
 			if err := z.checkError(); err != nil {
 				return len(p) - len(q) - length, err
@@ -413,6 +820,35 @@ func (z *Writer) Write(p []byte) (int, error) {
 	return len(p), z.checkError()
 }
 
+// recordBlock adds a compressed result of n bytes to the metadata.
+// Results written by Flush are collected until the block they are part of
+// is complete, so every block but the last holds blockSize bytes.
+// This should only be called from the result writer.
+func (z *Writer) recordBlock(n int, r result) {
+	z.pendingLen += uint32(n)
+	z.pendingCRC = crc32Combine(z.pendingCRC, *r.crc, int64(r.size))
+	z.pendingULen += uint32(r.size)
+	if r.partial {
+		return
+	}
+	z.blockData = append(z.blockData, z.pendingLen)
+	z.blockCRC = append(z.blockCRC, z.pendingCRC)
+	if z.variableBlocks() {
+		z.blockLens = append(z.blockLens, z.pendingULen)
+	}
+	z.indexBlock(z.pendingLen, z.pendingCRC, z.pendingULen)
+	if z.container && !r.final {
+		z.memberCRC, z.memberLen = z.pendingCRC, z.pendingULen
+	}
+	z.pendingLen, z.pendingCRC, z.pendingULen = 0, 0, 0
+}
+
+// variableBlocks reports whether blocks can hold less than the block size
+// before the end of the stream, so that their sizes must be recorded.
+func (z *Writer) variableBlocks() bool {
+	return z.adaptMin > 0 || z.manual || z.boundary != nil
+}
+
 // Step 1: compresses buffer to buffer
 // Step 2: send writer to channel
 // Step 3: Close result channel to indicate we are done
@@ -422,10 +858,22 @@ func (z *Writer) compressBlock(p []byte, r result, closed bool) {
 		z.wg.Done()
 	}()
 	buf := z.dstPool.Get().([]byte) // Corresponding Put in .Write's result writer
+	if closed && len(p) == 0 {
+		*r.crc = 0
+		z.dstPool.Put(p)
+		r.result <- append(buf[:0], eofMarker...)
+		return
+	}
 	dest := bytes.NewBuffer(buf[:0])
 
-	compressor := z.dictFlatePool.Get().(*flate.Writer) // Put below
-	compressor.ResetDict(dest, nil)
+	*r.crc = z.blockChecksum(p)
+	compressor, ok := z.dictFlatePool.Get().(DeflateCompressor) // Put below
+	if !ok {
+		// The factory failed and has pushed its error.
+		z.dstPool.Put(p)
+		return
+	}
+	compressor.Reset(dest)
 	compressor.Write(p)
 	z.dstPool.Put(p) // Corresponding Get in .Write and .compressCurrent
 
@@ -445,6 +893,11 @@ func (z *Writer) compressBlock(p []byte, r result, closed bool) {
 
 	// Read back buffer
 	buf = dest.Bytes()
+	if z.spill != nil && z.spill.store(buf, r) {
+		z.dstPool.Put(buf)
+		r.result <- nil
+		return
+	}
 	r.result <- buf
 }
 
@@ -456,6 +909,12 @@ func (z *Writer) compressBlock(p []byte, r result, closed bool) {
 // writer returns an error, Flush returns that error.
 //
 // In the terminology of the zlib library, Flush is equivalent to Z_SYNC_FLUSH.
+//
+// Flush does not end the current block: data written after it is added to
+// the same block until it holds the block size, so the metadata stays
+// valid for seeking. The compressed output does depend on when Flush is
+// called; without Flush it depends only on the data and the settings, not
+// on how it is split into Write calls.
 func (z *Writer) Flush() error {
 	if err := z.checkError(); err != nil {
 		return err
@@ -470,7 +929,9 @@ func (z *Writer) Flush() error {
 		}
 	}
 	// We send current block to compression
+	z.flushed += len(z.currentBuffer)
 	z.compressCurrent(true)
+	z.writes.Wait()
 
 	return z.checkError()
 }
@@ -488,16 +949,25 @@ func (z *Writer) BlockData() []uint32 {
 
 // MetaData returns gzip metadata
 func (z *Writer) MetaData() GzipMetadata {
-	return GzipMetadata{
-		BlockSize: z.blockSize,
-		Size:      z.size,
-		BlockData: z.blockData,
+	meta := GzipMetadata{
+		BlockSize:   z.blockSize,
+		Size:        z.size,
+		BlockData:   z.blockData,
+		BlockCRC:    z.blockCRC,
+		BlockLens:   z.blockLens,
+		Padding:     z.padding,
+		Fingerprint: z.fingerprint,
 	}
+	meta.Version = metadataVersion(&meta)
+	return meta
 }
 
 // Close closes the Writer, flushing any unwritten data to the underlying
-// io.Writer, but does not close the underlying io.Writer.
+// io.Writer, but does not close the underlying io.Writer. Calling Close
+// again writes nothing and returns nil, or the error of the first Close,
+// so a deferred Close may follow an explicit one.
 func (z *Writer) Close() error {
+	defer z.closeSpill()
 	if err := z.checkError(); err != nil {
 		return err
 	}
@@ -505,24 +975,52 @@ func (z *Writer) Close() error {
 		return nil
 	}
 
-	z.closed = true
 	if !z.wroteHeader {
 		z.Write(nil)
 		if err := z.checkError(); err != nil {
 			return err
 		}
 	}
+	z.padLastBlock()
+	if len(z.currentBuffer) > 0 || z.flushed > 0 {
+		z.compressCurrent(false)
+	}
+	// End the stream with an empty final block, see eofMarker.
+	z.closed = true
 	z.compressCurrent(true)
+	z.writes.Wait()
 	if err := z.checkError(); err != nil {
 		return err
 	}
 	close(z.results)
+	z.elapsed = time.Since(z.started)
 	put4(z.buf[0:4], z.digest.Sum32())
-	put4(z.buf[4:8], uint32(z.size))
+	put4(z.buf[4:8], uint32(z.size+int64(z.padding)))
+	if z.container {
+		// The last member of the data holds the last block only.
+		put4(z.buf[0:4], z.memberCRC)
+		put4(z.buf[4:8], z.memberLen)
+	}
 	_, err := z.w.Write(z.buf[0:8])
 	if err != nil {
 		z.pushError(err)
 		return err
 	}
+	z.fingerprint = crc32Combine(z.fpFirst, crc32.Update(z.fpLast, crc32.IEEETable, z.buf[0:8]), z.fpLastLen+8)
+	if z.omitEmpty && z.size == 0 {
+		z.omitBlocks()
+	}
+	if z.index != nil {
+		if err := z.index.footer(z.size, z.padding, z.fingerprint); err != nil {
+			z.pushError(err)
+			return err
+		}
+	}
+	if z.container {
+		if err := z.writeContainerIndex(); err != nil {
+			z.pushError(err)
+			return err
+		}
+	}
 	return nil
 }
@@ -7,13 +7,17 @@ package sgzip
 import (
 	"bufio"
 	"bytes"
+	stdflate "compress/flate"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"math/rand"
 	"reflect"
+	"runtime"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -43,7 +47,7 @@ func TestEmpty(t *testing.T) {
 }
 
 func TestEmptyBlockData(t *testing.T) {
-	want := []uint32{10, 7}
+	want := []uint32{10, 2}
 	buf := new(bytes.Buffer)
 
 	w := NewWriter(buf)
@@ -107,7 +111,7 @@ func TestLatin1(t *testing.T) {
 	latin1 := []byte{0xc4, 'u', 0xdf, 'e', 'r', 'u', 'n', 'g', 0}
 	utf8 := "Äußerung"
 	z := Reader{bufr: bufio.NewReader(bytes.NewReader(latin1))}
-	s, err := z.readString()
+	s, _, err := z.readString()
 	if err != nil {
 		t.Fatalf("readString: %v", err)
 	}
@@ -251,6 +255,377 @@ func TestWriterReset(t *testing.T) {
 	}
 }
 
+func TestWriterCloseTwice(t *testing.T) {
+	msg := []byte("hello world")
+	create := map[string]func(w io.Writer) (*Writer, error){
+		"plain":     func(w io.Writer) (*Writer, error) { return NewWriter(w), nil },
+		"container": func(w io.Writer) (*Writer, error) { return NewContainerWriter(w, DefaultCompression, 1<<20) },
+		"index": func(w io.Writer) (*Writer, error) {
+			return CreateSeekable(w, ioutil.Discard, DefaultCompression, 1<<20)
+		},
+	}
+	for name, fn := range create {
+		var buf bytes.Buffer
+		z, err := fn(&buf)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		z.Write(msg)
+		if err := z.Close(); err != nil {
+			t.Fatalf("%s: Close: %v", name, err)
+		}
+		n := buf.Len()
+		if err := z.Close(); err != nil {
+			t.Errorf("%s: second Close: %v", name, err)
+		}
+		if buf.Len() != n {
+			t.Errorf("%s: second Close wrote %d bytes", name, buf.Len()-n)
+		}
+		r, err := NewReader(&buf)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(got, msg) {
+			t.Errorf("%s: ReadAll = %q, %v", name, got, err)
+		}
+	}
+
+	// The error of a failed Close is returned again.
+	z := NewWriter(&errorWriter2{N: 15})
+	z.Write(msg)
+	if err := z.Close(); err != io.ErrClosedPipe {
+		t.Fatalf("Close = %v, want %v", err, io.ErrClosedPipe)
+	}
+	if err := z.Close(); err != io.ErrClosedPipe {
+		t.Errorf("second Close = %v, want %v", err, io.ErrClosedPipe)
+	}
+}
+
+func TestWriterResetKeepsSettings(t *testing.T) {
+	in := bytes.Repeat([]byte("0123456789"), 20000)
+	var buf bytes.Buffer
+	w, _ := NewWriterLevel(&buf, BestSpeed)
+	w.SetConcurrency(64<<10, 2)
+	w.Write(in)
+	w.Close()
+	first := w.MetaData()
+
+	var buf2 bytes.Buffer
+	w.Reset(&buf2)
+	w.Write(in)
+	w.Close()
+	second := w.MetaData()
+	if second.BlockSize != 64<<10 {
+		t.Errorf("BlockSize after Reset = %d, want %d", second.BlockSize, 64<<10)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("metadata after Reset = %+v, want %+v", second, first)
+	}
+	if !bytes.Equal(buf.Bytes(), buf2.Bytes()) {
+		t.Error("output after Reset differs")
+	}
+}
+
+type stdlibDeflate struct{ created int }
+
+func (s *stdlibDeflate) NewCompressor(w io.Writer, level int) (DeflateCompressor, error) {
+	s.created++
+	return stdflate.NewWriter(w, level)
+}
+
+func TestDeflateFactory(t *testing.T) {
+	in := bytes.Repeat([]byte("pluggable deflate "), 20000)
+	var buf bytes.Buffer
+	w, _ := NewWriterLevel(&buf, 6)
+	w.SetConcurrency(64<<10, 2)
+	f := &stdlibDeflate{}
+	if err := w.SetDeflateFactory(f); err != nil {
+		t.Fatal(err)
+	}
+	w.Write(in)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if f.created == 0 {
+		t.Error("factory was not used")
+	}
+	meta := w.MetaData()
+	r, err := NewSeekingReader(bytes.NewReader(buf.Bytes()), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := r.Seek(200000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, in[200000:]) {
+		t.Error("content does not match")
+	}
+
+	w, _ = NewWriterLevel(ioutil.Discard, 6)
+	if err := w.SetDeflateFactory(failingDeflate{}); err == nil {
+		t.Error("expected error from failing factory")
+	}
+	w.Write(in)
+	if err := w.SetDeflateFactory(f); err == nil {
+		t.Error("expected error when called after Write")
+	}
+	w.Close()
+
+	// A factory failing after its first compressor makes Close fail.
+	w, _ = NewWriterLevel(ioutil.Discard, 6)
+	w.SetConcurrency(64<<10, 2)
+	if err := w.SetDeflateFactory(&onceDeflate{}); err != nil {
+		t.Fatal(err)
+	}
+	// Empty the pool, so that a new compressor is needed.
+	runtime.GC()
+	runtime.GC()
+	w.Write(in)
+	if err := w.Close(); err == nil {
+		t.Error("expected error from factory failing later")
+	}
+}
+
+type failingDeflate struct{}
+
+func (failingDeflate) NewCompressor(io.Writer, int) (DeflateCompressor, error) {
+	return nil, errors.New("unsupported level")
+}
+
+// onceDeflate creates one compressor and fails after that.
+type onceDeflate struct{ created int32 }
+
+func (o *onceDeflate) NewCompressor(w io.Writer, level int) (DeflateCompressor, error) {
+	if atomic.AddInt32(&o.created, 1) > 1 {
+		return nil, errors.New("no more compressors")
+	}
+	return stdflate.NewWriter(w, level)
+}
+
+func TestPadLastBlock(t *testing.T) {
+	in := make([]byte, 100000)
+	for i := range in {
+		in[i] = byte(i*7+i/1000) | 1
+	}
+	var buf, idx bytes.Buffer
+	w, err := CreateSeekable(&buf, &idx, DefaultCompression, 16<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetPadLastBlock(true); err != nil {
+		t.Fatal(err)
+	}
+	w.Write(in)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	meta := w.MetaData()
+	if meta.Size != int64(len(in)) || meta.Padding != 7*16<<10-len(in) || meta.Version != 2 {
+		t.Fatalf("got Size %d, Padding %d, Version %d", meta.Size, meta.Padding, meta.Version)
+	}
+	if s := w.Stats(); s.UncompressedSize != int64(len(in)) {
+		t.Errorf("Stats().UncompressedSize = %d, want %d", s.UncompressedSize, len(in))
+	}
+	for i := 0; i < meta.NumBlocks()-1; i++ {
+		if bi, _ := meta.BlockInfo(i); bi.UncompressedLength != 16<<10 {
+			t.Errorf("block %d holds %d bytes", i, bi.UncompressedLength)
+		}
+	}
+	if decoded, err := DecodeIndex(&idx); err != nil || !reflect.DeepEqual(decoded, meta) {
+		t.Errorf("decoded index %+v, %v", decoded, err)
+	}
+	comp := bytes.NewReader(buf.Bytes())
+	if err := Verify(comp, &meta); err != nil {
+		t.Error(err)
+	}
+
+	// Without metadata the padding is part of the data.
+	r, err := NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(got, append(append([]byte{}, in...), make([]byte, meta.Padding)...)) {
+		t.Errorf("plain reader: got %d bytes, %v", len(got), err)
+	}
+
+	r, err = NewSeekingReader(comp, &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for _, pos := range []int64{0, 99000} {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil || !bytes.Equal(got, in[pos:]) {
+			t.Errorf("Seek(%d): got %d bytes, %v", pos, len(got), err)
+		}
+	}
+	if got, err := ReadRange(comp, &meta, 99000, 200000); err != nil || !bytes.Equal(got, in[99000:]) {
+		t.Errorf("ReadRange: got %d bytes, %v", len(got), err)
+	}
+
+	bad := meta
+	bad.Size--
+	bad.Padding++
+	r, err = NewSeekingReader(bytes.NewReader(buf.Bytes()), &bad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := ioutil.ReadAll(r); err != ErrInvalidMetadata {
+		t.Errorf("non-zero padding: got %v, want ErrInvalidMetadata", err)
+	}
+	if _, err := MergeMetadata(meta, meta, int64(buf.Len())); err == nil {
+		t.Error("expected MergeMetadata to reject padded streams")
+	}
+}
+
+func TestBlockAlignment(t *testing.T) {
+	for n := 0; n <= 40; n++ {
+		if !paddable(n) {
+			continue
+		}
+		pad := deflatePadding(n)
+		if len(pad) != n {
+			t.Fatalf("deflatePadding(%d) returned %d bytes", n, len(pad))
+		}
+		got, err := ioutil.ReadAll(stdflate.NewReader(io.MultiReader(bytes.NewReader(pad), bytes.NewReader([]byte{3, 0}))))
+		if err != nil || len(got) != 0 {
+			t.Fatalf("deflatePadding(%d): got %d bytes, err %v", n, len(got), err)
+		}
+	}
+
+	in := bytes.Repeat([]byte("aligned blocks "), 50000)
+	for _, align := range []int{7, 512, 4096} {
+		var buf bytes.Buffer
+		w, _ := NewWriterLevel(&buf, 6)
+		w.SetConcurrency(64<<10, 4)
+		w.Name = "aligned"
+		if err := w.SetBlockAlignment(align); err != nil {
+			t.Fatal(err)
+		}
+		w.Write(in)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		meta := w.MetaData()
+		var off int64
+		for i, d := range meta.BlockData[:len(meta.BlockData)-1] {
+			off += int64(d)
+			if off%int64(align) != 0 {
+				t.Errorf("align %d: block %d starts at %d", align, i, off)
+			}
+		}
+		r, err := NewSeekingReader(bytes.NewReader(buf.Bytes()), &meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Seek(300000, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, in[300000:]) {
+			t.Errorf("align %d: content does not match", align)
+		}
+		r.Close()
+	}
+}
+
+func TestDeterministicChunking(t *testing.T) {
+	in := make([]byte, 300000)
+	rand.New(rand.NewSource(1)).Read(in[:100000])
+	copy(in[100000:], bytes.Repeat([]byte("chunking "), 20000))
+
+	write := func(chunks func(int) int) ([]byte, GzipMetadata) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.SetConcurrency(32<<10, 4)
+		for q := in; len(q) > 0; {
+			n := chunks(len(q))
+			if n > len(q) {
+				n = len(q)
+			}
+			w.Write(q[:n])
+			q = q[n:]
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes(), w.MetaData()
+	}
+	want, wantMeta := write(func(n int) int { return n })
+	rng := rand.New(rand.NewSource(2))
+	for _, chunks := range []func(int) int{
+		func(int) int { return 1000 },
+		func(int) int { return 32 << 10 },
+		func(int) int { return rng.Intn(70000) + 1 },
+	} {
+		got, meta := write(chunks)
+		if !bytes.Equal(got, want) {
+			t.Error("output depends on write chunking")
+		}
+		if !reflect.DeepEqual(meta, wantMeta) {
+			t.Error("metadata depends on write chunking")
+		}
+	}
+}
+
+func TestFlushKeepsBlocks(t *testing.T) {
+	in := bytes.Repeat([]byte("flushed data "), 25000)
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetConcurrency(32<<10, 4)
+	for i, q := 0, in; len(q) > 0; i++ {
+		n := 7000 + i*1000
+		if n > len(q) {
+			n = len(q)
+		}
+		w.Write(q[:n])
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		q = q[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	meta := w.MetaData()
+	if want := (len(in)+(32<<10)-1)/(32<<10) + 2; len(meta.BlockData) != want {
+		t.Errorf("got %d block entries, want %d", len(meta.BlockData), want)
+	}
+	if err := Verify(bytes.NewReader(buf.Bytes()), &meta); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewSeekingReader(bytes.NewReader(buf.Bytes()), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for _, pos := range []int64{200000, 40000} {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, in[pos:]) {
+			t.Errorf("content at %d does not match", pos)
+		}
+	}
+}
+
 var testbuf []byte
 
 func testFile(i int, t *testing.T) {
@@ -519,6 +894,31 @@ func benchmarkGzipN(b *testing.B, level int) {
 	}
 }
 
+func BenchmarkWriterNew(b *testing.B) {
+	dat := bytes.Repeat([]byte("small file "), 100)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(dat)))
+	for n := 0; n < b.N; n++ {
+		w, _ := NewWriterLevel(ioutil.Discard, 1)
+		w.SetConcurrency(64<<10, 1)
+		w.Write(dat)
+		w.Close()
+	}
+}
+
+func BenchmarkWriterReset(b *testing.B) {
+	dat := bytes.Repeat([]byte("small file "), 100)
+	w, _ := NewWriterLevel(ioutil.Discard, 1)
+	w.SetConcurrency(64<<10, 1)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(dat)))
+	for n := 0; n < b.N; n++ {
+		w.Reset(ioutil.Discard)
+		w.Write(dat)
+		w.Close()
+	}
+}
+
 type errorWriter struct {
 	mu          sync.RWMutex
 	returnError bool
@@ -699,3 +1099,353 @@ func copyBuffer(dst io.Writer, src io.Reader, buf []byte) (written int64, err er
 	}
 	return written, err
 }
+
+func TestValidLevel(t *testing.T) {
+	for _, level := range []int{HuffmanOnly, DefaultCompression, NoCompression, BestSpeed, 5, BestCompression} {
+		if !ValidLevel(level) {
+			t.Errorf("ValidLevel(%d) = false", level)
+		}
+		if _, err := NewWriterLevel(ioutil.Discard, level); err != nil {
+			t.Errorf("NewWriterLevel(%d): %v", level, err)
+		}
+	}
+	for _, level := range []int{-3, 10, 100} {
+		if ValidLevel(level) {
+			t.Errorf("ValidLevel(%d) = true", level)
+		}
+		if _, err := NewWriterLevel(ioutil.Discard, level); err == nil {
+			t.Errorf("NewWriterLevel(%d): expected error", level)
+		}
+	}
+}
+
+func TestWriterOS(t *testing.T) {
+	for _, os := range []int{-1, 3, 11} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		if os >= 0 {
+			w.OS = byte(os)
+		}
+		w.Write([]byte("os"))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		want := byte(255)
+		if os >= 0 {
+			want = byte(os)
+		}
+		if got := buf.Bytes()[9]; got != want {
+			t.Errorf("OS byte = %d, want %d", got, want)
+		}
+		r, err := NewReader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.OS != want {
+			t.Errorf("Reader OS = %d, want %d", r.OS, want)
+		}
+		r.Close()
+
+		// Reset restores the default.
+		w.Reset(ioutil.Discard)
+		if w.OS != 255 {
+			t.Errorf("OS after Reset = %d, want 255", w.OS)
+		}
+	}
+}
+
+// gatedWriter lets through one write for each value received on open,
+// after the first, which writes the header. Before each write it records
+// the largest number of blocks accepted by Write but not yet written.
+type gatedWriter struct {
+	open     chan struct{}
+	writes   int
+	accepted *int64
+	lead     int64
+	bytes.Buffer
+}
+
+func (g *gatedWriter) Write(p []byte) (int, error) {
+	if g.writes++; g.writes > 1 {
+		<-g.open
+		// Writes after the header each hold a block.
+		if n := atomic.LoadInt64(g.accepted) - int64(g.writes-2); n > g.lead {
+			g.lead = n
+		}
+	}
+	return g.Buffer.Write(p)
+}
+
+func TestWriterSlowDestination(t *testing.T) {
+	const blockSize, blocks, total = 4096, 3, 60
+	in := make([]byte, total*blockSize)
+	rand.New(rand.NewSource(1)).Read(in)
+	for _, limit := range []int{0, 1, 2} {
+		// Without a limit, the slots of SetConcurrency and the block
+		// being written are pending.
+		want := limit
+		if limit == 0 {
+			want = blocks + 1
+		}
+		var accepted int64
+		dst := &gatedWriter{open: make(chan struct{}), accepted: &accepted}
+		w := NewWriter(dst)
+		w.SetConcurrency(blockSize, blocks)
+		if err := w.SetPendingBlockLimit(limit); err != nil {
+			t.Fatal(err)
+		}
+		acc := make(chan struct{}, total)
+		done := make(chan error, 1)
+		go func() {
+			for off := 0; off < len(in); off += blockSize {
+				if _, err := w.Write(in[off : off+blockSize]); err != nil {
+					done <- err
+					return
+				}
+				atomic.AddInt64(&accepted, 1)
+				acc <- struct{}{}
+			}
+			done <- w.Close()
+		}()
+
+		// Before each block is written, let Write accept as many blocks
+		// as the limit allows. Write must not accept more than that.
+		got := 0
+		for written := 0; written < total; written++ {
+			for got < written+want && got < total {
+				<-acc
+				got++
+			}
+			dst.open <- struct{}{}
+		}
+		close(dst.open)
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		if dst.lead > int64(want) {
+			t.Errorf("limit %d: %d blocks pending, want at most %d", limit, dst.lead, want)
+		}
+		r, err := NewReader(&dst.Buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := ioutil.ReadAll(r)
+		if err != nil || !bytes.Equal(out, in) {
+			t.Errorf("limit %d: decompressed data does not match: %v", limit, err)
+		}
+	}
+	if err := NewWriter(ioutil.Discard).SetPendingBlockLimit(-1); err == nil {
+		t.Error("negative limit accepted")
+	}
+}
+
+func TestTextFlag(t *testing.T) {
+	for _, text := range []bool{false, true} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.Text = text
+		w.Write([]byte("hello\n"))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.Bytes()[3]&flagText != 0; got != text {
+			t.Errorf("Text %v: FTEXT flag is %v", text, got)
+		}
+		r, err := NewReader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.IsText() != text {
+			t.Errorf("Text %v: IsText() = %v", text, r.IsText())
+		}
+		r.Close()
+	}
+}
+
+func TestModTime(t *testing.T) {
+	compress := func(mtime time.Time) []byte {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.ModTime = mtime
+		w.Write([]byte("reproducible"))
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	fixed := time.Unix(1500000000, 0)
+	tests := []struct {
+		mtime time.Time
+		want  uint32
+	}{
+		{time.Time{}, 0},
+		{time.Unix(-1000, 0), 0},
+		{fixed, 1500000000},
+	}
+	for _, tt := range tests {
+		out := compress(tt.mtime)
+		if got := get4(out[4:8]); got != tt.want {
+			t.Errorf("ModTime %v: MTIME = %d, want %d", tt.mtime, got, tt.want)
+		}
+		if again := compress(tt.mtime); !bytes.Equal(out, again) {
+			t.Errorf("ModTime %v: output differs between runs", tt.mtime)
+		}
+		r, err := NewReader(bytes.NewReader(out))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.want == 0 && !r.ModTime.IsZero() {
+			t.Errorf("ModTime %v: read back as %v, want the zero time", tt.mtime, r.ModTime)
+		} else if tt.want != 0 && !r.ModTime.Equal(tt.mtime) {
+			t.Errorf("ModTime %v: read back as %v", tt.mtime, r.ModTime)
+		}
+	}
+}
+
+// alternatingDeflate creates compressors that switch between two levels
+// for each block they compress.
+type alternatingDeflate struct {
+	levels [2]int
+}
+
+func (a alternatingDeflate) NewCompressor(w io.Writer, _ int) (DeflateCompressor, error) {
+	c := &alternatingCompressor{}
+	for i, level := range a.levels {
+		fw, err := stdflate.NewWriter(w, level)
+		if err != nil {
+			return nil, err
+		}
+		c.w[i] = fw
+	}
+	return c, nil
+}
+
+type alternatingCompressor struct {
+	w    [2]*stdflate.Writer
+	next int
+}
+
+func (c *alternatingCompressor) Write(p []byte) (int, error) { return c.w[c.next].Write(p) }
+func (c *alternatingCompressor) Flush() error                { return c.w[c.next].Flush() }
+func (c *alternatingCompressor) Close() error                { return c.w[c.next].Close() }
+
+func (c *alternatingCompressor) Reset(w io.Writer) {
+	c.next ^= 1
+	c.w[c.next].Reset(w)
+}
+
+func TestMixedLevels(t *testing.T) {
+	in := levelTestData(600000)
+	const blockSize = 64 << 10
+	check := func(name string, comp []byte, meta GzipMetadata) {
+		t.Helper()
+		r, err := NewSeekingReader(bytes.NewReader(comp), &meta)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		defer r.Close()
+		for _, pos := range []int64{blockSize - 10, 5 * blockSize, 300000 - 1, 0} {
+			if _, err := r.Seek(pos, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			got := make([]byte, 1000)
+			if _, err := io.ReadFull(r, got); err != nil || !bytes.Equal(got, in[pos:pos+1000]) {
+				t.Errorf("%s: read at %d: %v", name, pos, err)
+			}
+		}
+		var got []byte
+		for i := 0; i < meta.NumBlocks(); i++ {
+			data, err := r.ReadBlock(i)
+			if err != nil {
+				t.Fatalf("%s: block %d: %v", name, i, err)
+			}
+			got = append(got, data...)
+		}
+		if !bytes.Equal(got, in) {
+			t.Errorf("%s: blocks hold %d bytes, want %d", name, len(got), len(in))
+		}
+	}
+
+	// Parts written at levels 1 and 9, joined with a merged index.
+	half := 5 * blockSize
+	var parts []SeekablePart
+	for i, level := range []int{BestSpeed, BestCompression} {
+		var buf bytes.Buffer
+		w, _ := NewWriterLevel(&buf, level)
+		w.SetConcurrency(blockSize, 2)
+		if i == 0 {
+			w.Write(in[:half])
+		} else {
+			w.Write(in[half:])
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, SeekablePart{R: &buf, Meta: w.MetaData()})
+	}
+	var joined bytes.Buffer
+	meta, err := Concat(&joined, parts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("concat", joined.Bytes(), meta)
+
+	// A single stream whose blocks alternate between the levels.
+	var buf bytes.Buffer
+	w, _ := NewWriterLevel(&buf, BestSpeed)
+	w.SetConcurrency(blockSize, 2)
+	if err := w.SetDeflateFactory(alternatingDeflate{[2]int{BestSpeed, BestCompression}}); err != nil {
+		t.Fatal(err)
+	}
+	w.Write(in)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	meta = w.MetaData()
+	check("alternating", buf.Bytes(), meta)
+	if err := Verify(bytes.NewReader(buf.Bytes()), &meta); err != nil {
+		t.Errorf("alternating: Verify: %v", err)
+	}
+}
+
+// slowWriter sleeps before each write.
+type slowWriter struct {
+	w io.Writer
+	d time.Duration
+}
+
+func (s *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(s.d)
+	return s.w.Write(p)
+}
+
+func TestWriterResetUnfinished(t *testing.T) {
+	in := levelTestData(1 << 20)
+	msg := []byte("hello world")
+	var want bytes.Buffer
+	w := NewWriter(&want)
+	w.SetConcurrency(64<<10, 4)
+	w.Write(msg)
+	w.Close()
+	wantMeta := w.MetaData()
+
+	for i := 0; i < 10; i++ {
+		// Reset while blocks of the previous stream are being compressed
+		// and written.
+		var old bytes.Buffer
+		w.Reset(&slowWriter{w: &old, d: time.Millisecond})
+		w.Write(in)
+		var buf bytes.Buffer
+		w.Reset(&buf)
+		w.Write(msg)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), want.Bytes()) {
+			t.Fatalf("output after Reset holds %d bytes, want %d", buf.Len(), want.Len())
+		}
+		if meta := w.MetaData(); !reflect.DeepEqual(meta, wantMeta) {
+			t.Fatalf("metadata after Reset = %+v, want %+v", meta, wantMeta)
+		}
+	}
+}
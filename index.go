@@ -0,0 +1,288 @@
+package sgzip
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+)
+
+// The binary index format stores GzipMetadata compactly and can be written
+// while the stream is compressed. All integers are little-endian:
+//
+//	"SGZI" magic, version (1 byte), flags (1 byte), 2 zero bytes
+//	BlockSize (uint32)
+//	for each BlockData entry: the entry and the CRC-32 of the block (uint32
+//	each; the CRC is 0 for the header entry), followed by the BlockLens
+//	entry (uint32; 0 for the header entry) if the block sizes vary
+//	0xffffffff, Padding (uint32) and Size (uint64)
+//	Fingerprint (uint32) if it is recorded
+//	the number of Unindexed blocks and their indexes (uint32 each) if there
+//	are any
+const (
+	indexMagic          = "SGZI"
+	indexEnd            = 0xffffffff
+	indexHasCRC         = 1 << 0 // the entries hold block checksums
+	indexHasLens        = 1 << 1 // the entries hold uncompressed block sizes
+	indexHasFingerprint = 1 << 2 // the footer is followed by the fingerprint
+	indexHasUnindexed   = 1 << 3 // the footer is followed by the unindexed blocks
+	indexFlags          = indexHasCRC | indexHasLens | indexHasFingerprint | indexHasUnindexed
+)
+
+// indexVersion returns the version to record in an index with the given
+// flags, of a padded stream if pad is set. Older versions of this package
+// cannot skip the data added by the flags other than indexHasCRC.
+func indexVersion(flags byte, pad bool) int {
+	if flags&^indexHasCRC != 0 {
+		return 5
+	}
+	if pad {
+		return 2
+	}
+	return 1
+}
+
+// ErrIndex is returned when decoding an invalid binary index.
+var ErrIndex = errors.New("gzip: invalid index")
+
+// indexEncoder writes the binary index format.
+type indexEncoder struct {
+	w     io.Writer
+	flags byte
+	buf   [16]byte
+}
+
+func (e *indexEncoder) header(blockSize int, flags byte, version int) error {
+	copy(e.buf[:4], indexMagic)
+	e.buf[4] = byte(version)
+	e.buf[5] = flags
+	e.flags = flags
+	e.buf[6], e.buf[7] = 0, 0
+	binary.LittleEndian.PutUint32(e.buf[8:12], uint32(blockSize))
+	_, err := e.w.Write(e.buf[:12])
+	return err
+}
+
+func (e *indexEncoder) entry(size, crc, length uint32) error {
+	binary.LittleEndian.PutUint32(e.buf[:4], size)
+	binary.LittleEndian.PutUint32(e.buf[4:8], crc)
+	n := 8
+	if e.flags&indexHasLens != 0 {
+		binary.LittleEndian.PutUint32(e.buf[8:12], length)
+		n = 12
+	}
+	_, err := e.w.Write(e.buf[:n])
+	return err
+}
+
+func (e *indexEncoder) footer(size int64, padding int, fingerprint uint32) error {
+	binary.LittleEndian.PutUint32(e.buf[:4], indexEnd)
+	binary.LittleEndian.PutUint32(e.buf[4:8], uint32(padding))
+	binary.LittleEndian.PutUint64(e.buf[8:16], uint64(size))
+	_, err := e.w.Write(e.buf[:16])
+	if err == nil && e.flags&indexHasFingerprint != 0 {
+		binary.LittleEndian.PutUint32(e.buf[:4], fingerprint)
+		_, err = e.w.Write(e.buf[:4])
+	}
+	return err
+}
+
+// EncodeIndex writes meta to w in the binary index format. It is more
+// compact than gob and can be produced incrementally, see CreateSeekable.
+// UBlockData is stored as block sizes, which DecodeIndex returns in
+// BlockLens.
+func EncodeIndex(w io.Writer, meta *GzipMetadata) error {
+	if err := checkUBlockData(meta); err != nil {
+		return err
+	}
+	if meta.StreamOffset != 0 {
+		return errors.New("gzip: the index format cannot store a StreamOffset, see Rebase")
+	}
+	var flags byte
+	if len(meta.BlockData) > 0 && len(meta.BlockCRC) == len(meta.BlockData)-1 {
+		flags |= indexHasCRC
+	}
+	if len(meta.BlockData) > 0 && (len(meta.BlockLens) == len(meta.BlockData)-1 || meta.UBlockData != nil) {
+		flags |= indexHasLens
+	}
+	if meta.Fingerprint != 0 {
+		flags |= indexHasFingerprint
+	}
+	if len(meta.Unindexed) > 0 {
+		flags |= indexHasUnindexed
+	}
+	e := &indexEncoder{w: w}
+	if err := e.header(meta.BlockSize, flags, indexVersion(flags, meta.Padding != 0)); err != nil {
+		return err
+	}
+	for i, d := range meta.BlockData {
+		var crc, length uint32
+		if flags&indexHasCRC != 0 && i > 0 {
+			crc = meta.BlockCRC[i-1]
+		}
+		if flags&indexHasLens != 0 && i > 0 {
+			n := blockLen(meta, i-1)
+			if n > math.MaxUint32 {
+				return fmt.Errorf("gzip: block %d of %d bytes too large for the index", i-1, n)
+			}
+			length = uint32(n)
+		}
+		if err := e.entry(d, crc, length); err != nil {
+			return err
+		}
+	}
+	if err := e.footer(meta.Size, meta.Padding, meta.Fingerprint); err != nil {
+		return err
+	}
+	if flags&indexHasUnindexed == 0 {
+		return nil
+	}
+	buf := make([]byte, 4*(len(meta.Unindexed)+1))
+	binary.LittleEndian.PutUint32(buf, uint32(len(meta.Unindexed)))
+	for i, b := range meta.Unindexed {
+		binary.LittleEndian.PutUint32(buf[4*(i+1):], uint32(b))
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// DecodeIndex reads metadata in the binary index format from r.
+// ErrIndex is returned if the data is not a complete index or uses flags
+// unknown to this package, and
+// ErrUnsupportedMetadataVersion if it was written by a newer version of
+// this package.
+func DecodeIndex(r io.Reader) (GzipMetadata, error) {
+	var meta GzipMetadata
+	var buf [16]byte
+	if _, err := io.ReadFull(r, buf[:12]); err != nil {
+		return meta, indexErr(err)
+	}
+	if string(buf[:4]) != indexMagic {
+		return meta, ErrIndex
+	}
+	meta.Version = int(buf[4])
+	if err := checkVersion(&meta); err != nil {
+		return meta, err
+	}
+	flags := buf[5]
+	if flags&^indexFlags != 0 {
+		return meta, fmt.Errorf("%w: unknown flags %#x", ErrIndex, flags&^indexFlags)
+	}
+	meta.BlockSize = int(binary.LittleEndian.Uint32(buf[8:12]))
+	rec := 8
+	if flags&indexHasLens != 0 {
+		rec = 12
+	}
+	for {
+		if _, err := io.ReadFull(r, buf[:rec]); err != nil {
+			return meta, indexErr(err)
+		}
+		size := binary.LittleEndian.Uint32(buf[:4])
+		if size == indexEnd {
+			break
+		}
+		if len(meta.BlockData) > 0 && flags&indexHasCRC != 0 {
+			meta.BlockCRC = append(meta.BlockCRC, binary.LittleEndian.Uint32(buf[4:8]))
+		}
+		if len(meta.BlockData) > 0 && flags&indexHasLens != 0 {
+			meta.BlockLens = append(meta.BlockLens, binary.LittleEndian.Uint32(buf[8:12]))
+		}
+		meta.BlockData = append(meta.BlockData, size)
+	}
+	if _, err := io.ReadFull(r, buf[rec:16]); err != nil {
+		return meta, indexErr(err)
+	}
+	meta.Padding = int(binary.LittleEndian.Uint32(buf[4:8]))
+	meta.Size = int64(binary.LittleEndian.Uint64(buf[8:16]))
+	if flags&indexHasFingerprint != 0 {
+		if _, err := io.ReadFull(r, buf[:4]); err != nil {
+			return meta, indexErr(err)
+		}
+		meta.Fingerprint = binary.LittleEndian.Uint32(buf[:4])
+	}
+	if flags&indexHasUnindexed != 0 {
+		if _, err := io.ReadFull(r, buf[:4]); err != nil {
+			return meta, indexErr(err)
+		}
+		n := binary.LittleEndian.Uint32(buf[:4])
+		if int64(n) > int64(len(meta.BlockData)) {
+			return meta, fmt.Errorf("%w: too many unindexed blocks", ErrIndex)
+		}
+		for i := uint32(0); i < n; i++ {
+			if _, err := io.ReadFull(r, buf[:4]); err != nil {
+				return meta, indexErr(err)
+			}
+			meta.Unindexed = append(meta.Unindexed, int(binary.LittleEndian.Uint32(buf[:4])))
+		}
+	}
+	// The version of the index covers the flags; the metadata gets the
+	// version of the fields it uses, as if it came from the Writer.
+	meta.Version = metadataVersion(&meta)
+	return meta, nil
+}
+
+// indexErr reports a truncated index as ErrIndex.
+func indexErr(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: truncated", ErrIndex)
+	}
+	return err
+}
+
+// CreateSeekable returns a new Writer compressing to dst with the given
+// compression level and block size, which also writes the metadata to idx
+// in the binary index format. The entry for each block is written to idx
+// as soon as the block has been written to dst, and the index is finished
+// when Close returns. idx holds a complete and valid index exactly when
+// Close returns nil.
+//
+// The settings must not be changed with SetConcurrency, and calling Reset
+// stops writing the index.
+func CreateSeekable(dst io.Writer, idx io.Writer, level, blockSize int) (*Writer, error) {
+	z, err := NewWriterLevel(dst, level)
+	if err != nil {
+		return nil, err
+	}
+	if blockSize <= 0 {
+		return nil, errors.New("gzip: block size must be positive")
+	}
+	if err := z.SetConcurrency(blockSize, runtime.GOMAXPROCS(0)); err != nil {
+		return nil, err
+	}
+	z.index = &indexEncoder{w: idx}
+	return z, nil
+}
+
+// WritePair compresses src to dst with the given compression level and
+// block size, and writes its index to meta as CreateSeekable does, block
+// by block as the compressed data is written. It is meant for shipping a
+// file together with its index, such as name.gz and name.gz.idx in a tar
+// archive. Tar headers give the size of each entry, so both outputs are
+// usually written to temporary files or buffers first and then added.
+//
+// Both outputs are complete and valid exactly when WritePair returns nil.
+// Neither dst nor meta is closed.
+func WritePair(dst io.Writer, meta io.Writer, src io.Reader, level, blockSize int) error {
+	z, err := CreateSeekable(dst, meta, level, blockSize)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(z, src); err != nil {
+		z.Close()
+		return err
+	}
+	return z.Close()
+}
+
+// indexBlock writes the index entry for a block that has been written.
+// This should only be called from the result writer.
+func (z *Writer) indexBlock(size, crc, length uint32) {
+	if z.index == nil {
+		return
+	}
+	if err := z.index.entry(size, crc, length); err != nil {
+		z.pushError(err)
+	}
+}
@@ -0,0 +1,131 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestCreateSeekable(t *testing.T) {
+	in := bytes.Repeat([]byte("seekable with index "), 30000)
+	var dst, idx bytes.Buffer
+	w, err := CreateSeekable(&dst, &idx, DefaultCompression, 64<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(in)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	meta, err := DecodeIndex(bytes.NewReader(idx.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := w.MetaData(); !reflect.DeepEqual(meta, want) {
+		t.Fatalf("decoded index %+v, want %+v", meta, want)
+	}
+	r, err := NewSeekingReader(bytes.NewReader(dst.Bytes()), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := r.Seek(400000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, in[400000:]) {
+		t.Error("content does not match")
+	}
+
+	if _, err := DecodeIndex(bytes.NewReader(idx.Bytes()[:idx.Len()-1])); !errors.Is(err, ErrIndex) {
+		t.Errorf("truncated index: got %v", err)
+	}
+
+	w, _ = CreateSeekable(ioutil.Discard, errWriter{}, DefaultCompression, 64<<10)
+	w.Write(in)
+	if err := w.Close(); err == nil {
+		t.Error("expected error from failing index writer")
+	}
+}
+
+func TestWritePair(t *testing.T) {
+	in := bytes.Repeat([]byte("file and index "), 40000)
+	var dst, idx bytes.Buffer
+	if err := WritePair(&dst, &idx, bytes.NewReader(in), BestSpeed, 32<<10); err != nil {
+		t.Fatal(err)
+	}
+	meta, err := DecodeIndex(bytes.NewReader(idx.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Size != int64(len(in)) || meta.BlockSize != 32<<10 {
+		t.Errorf("index has Size %d, BlockSize %d", meta.Size, meta.BlockSize)
+	}
+	r, err := NewSeekingReader(bytes.NewReader(dst.Bytes()), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := r.Seek(500000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(got, in[500000:]) {
+		t.Errorf("read after Seek: got %d bytes, %v", len(got), err)
+	}
+
+	errSource := errors.New("source failed")
+	src := io.MultiReader(bytes.NewReader(in), &errReader{errSource})
+	if err := WritePair(ioutil.Discard, ioutil.Discard, src, BestSpeed, 32<<10); err != errSource {
+		t.Errorf("failing source: got %v, want %v", err, errSource)
+	}
+	if err := WritePair(ioutil.Discard, errWriter{}, bytes.NewReader(in), BestSpeed, 32<<10); err == nil {
+		t.Error("expected error from failing index writer")
+	}
+	if err := WritePair(ioutil.Discard, ioutil.Discard, bytes.NewReader(in), BestSpeed, 0); err == nil {
+		t.Error("expected error for block size 0")
+	}
+}
+
+type errReader struct{ err error }
+
+func (e *errReader) Read([]byte) (int, error) { return 0, e.err }
+
+func TestEncodeIndex(t *testing.T) {
+	meta := GzipMetadata{BlockSize: 1 << 20, Size: 3 << 20, BlockData: []uint32{10, 1000, 1100, 900, 2}}
+	var buf bytes.Buffer
+	if err := EncodeIndex(&buf, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 12+8*len(meta.BlockData)+16 {
+		t.Errorf("encoded index is %d bytes", buf.Len())
+	}
+	got, err := DecodeIndex(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta.Version = 1 // unpadded streams keep version 1
+	if !reflect.DeepEqual(got, meta) {
+		t.Errorf("got %+v, want %+v", got, meta)
+	}
+
+	buf.Reset()
+	if err := EncodeIndex(&buf, &meta); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	b[5] |= 1 << 7
+	if _, err := DecodeIndex(bytes.NewReader(b)); !errors.Is(err, ErrIndex) {
+		t.Errorf("unknown flag: got %v, want ErrIndex", err)
+	}
+}
+
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) { return 0, errors.New("write failed") }
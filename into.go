@@ -0,0 +1,141 @@
+package sgzip
+
+import (
+	"bufio"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/flate"
+)
+
+// A ShortBufferError is returned by DecompressInto when the decompressed
+// data does not fit the buffer. It wraps ErrShortBuffer.
+type ShortBufferError struct {
+	Needed int64 // size of the decompressed data
+	Have   int   // size of the buffer
+}
+
+func (e *ShortBufferError) Error() string {
+	return fmt.Sprintf("gzip: buffer of %d bytes too short, %d bytes needed", e.Have, e.Needed)
+}
+
+func (e *ShortBufferError) Unwrap() error { return ErrShortBuffer }
+
+// DecompressInto decompresses the gzip stream r into dst and returns the
+// number of bytes written. It is meant for decoding many small streams
+// into a buffer that is reused: the data is decompressed directly into
+// dst, and the decompressor is reused across calls.
+//
+// r is usually the compressed stream. If it is a *Reader, the data is read
+// from its current position instead; if that Reader was created with
+// metadata, the size of the data is known in advance and a short dst is
+// reported without decompressing anything. Otherwise a short dst is only
+// detected once it is full, and the rest of the stream is decompressed to
+// find the size needed. In both cases the returned error is a
+// *ShortBufferError, and the bytes written to dst are not meaningful.
+func DecompressInto(dst []byte, r io.Reader) (int, error) {
+	z, ok := r.(*Reader)
+	if !ok {
+		d := intoDecoders.Get().(*intoDecoder)
+		defer intoDecoders.Put(d)
+		return d.decode(dst, r)
+	}
+	if z.canSeek && z.isize-z.pos > int64(len(dst)) {
+		return 0, &ShortBufferError{Needed: z.isize - z.pos, Have: len(dst)}
+	}
+	n, err := io.ReadFull(z, dst)
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		return n, nil
+	case err != nil:
+		return n, err
+	}
+	rest, err := z.discard(-1)
+	if err != nil {
+		return n, err
+	}
+	if rest > 0 {
+		return n, &ShortBufferError{Needed: int64(n) + rest, Have: len(dst)}
+	}
+	return n, nil
+}
+
+var intoDecoders = sync.Pool{New: func() interface{} {
+	return &intoDecoder{
+		z:  Reader{digest: crc32.NewIEEE()},
+		br: bufio.NewReader(nil),
+		fr: flate.NewReader(nil),
+	}
+}}
+
+// intoDecoder decompresses a whole stream for DecompressInto without
+// reading ahead. z is only used to parse the headers.
+type intoDecoder struct {
+	z       Reader
+	br      *bufio.Reader
+	fr      io.ReadCloser
+	scratch []byte // for the data that does not fit dst
+}
+
+func (d *intoDecoder) decode(dst []byte, r io.Reader) (int, error) {
+	src, ok := r.(flate.Reader)
+	if !ok {
+		d.br.Reset(r)
+		defer d.br.Reset(nil)
+		src = d.br
+	}
+	d.z.bufr = src
+	defer func() { d.z.bufr = nil }()
+
+	var n int
+	var total int64
+	for member := 0; ; member++ {
+		if err := d.z.parseHeader(false); err != nil {
+			if member > 0 && err == io.EOF {
+				break
+			}
+			return n, err
+		}
+		if err := d.fr.(flate.Resetter).Reset(src, nil); err != nil {
+			return n, err
+		}
+		var crc uint32
+		var size int64
+		for {
+			var m int
+			var err error
+			if n < len(dst) {
+				m, err = d.fr.Read(dst[n:])
+				crc = crc32.Update(crc, crc32.IEEETable, dst[n:n+m])
+				n += m
+			} else {
+				if d.scratch == nil {
+					d.scratch = make([]byte, 32<<10)
+				}
+				m, err = d.fr.Read(d.scratch)
+				crc = crc32.Update(crc, crc32.IEEETable, d.scratch[:m])
+			}
+			size += int64(m)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return n, noEOF(err)
+			}
+		}
+		total += size
+		var trailer [8]byte
+		if _, err := io.ReadFull(src, trailer[:]); err != nil {
+			return n, noEOF(err)
+		}
+		if get4(trailer[0:4]) != crc || get4(trailer[4:8]) != uint32(size) {
+			return n, ErrChecksum
+		}
+	}
+	if total > int64(n) {
+		return n, &ShortBufferError{Needed: total, Have: len(dst)}
+	}
+	return n, nil
+}
@@ -0,0 +1,74 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestDecompressInto(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 100000, 16<<10)
+
+	dst := make([]byte, len(in)+10)
+	n, err := DecompressInto(dst, bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dst[:n], in) {
+		t.Errorf("got %d bytes, want %d", n, len(in))
+	}
+
+	// Exactly the right size.
+	n, err = DecompressInto(dst[:len(in)], bytes.NewReader(compressed))
+	if err != nil || n != len(in) {
+		t.Errorf("exact buffer: n = %d, err = %v", n, err)
+	}
+
+	_, err = DecompressInto(dst[:1000], bytes.NewReader(compressed))
+	var sbe *ShortBufferError
+	if !errors.As(err, &sbe) || !errors.Is(err, ErrShortBuffer) {
+		t.Fatalf("short buffer: got %v, want a *ShortBufferError", err)
+	}
+	if sbe.Needed != int64(len(in)) || sbe.Have != 1000 {
+		t.Errorf("short buffer: Needed = %d, Have = %d, want %d, 1000", sbe.Needed, sbe.Have, len(in))
+	}
+
+	// With metadata the size is known before decompressing.
+	r, err := NewSeekingReader(bytes.NewReader(compressed), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err = r.Seek(60000, 0); err != nil {
+		t.Fatal(err)
+	}
+	_, err = DecompressInto(dst[:1000], r)
+	if !errors.As(err, &sbe) || sbe.Needed != int64(len(in))-60000 {
+		t.Fatalf("short buffer with metadata: got %v, want %d bytes needed", err, len(in)-60000)
+	}
+	n, err = DecompressInto(dst, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dst[:n], in[60000:]) {
+		t.Errorf("with metadata: got %d bytes, want %d", n, len(in)-60000)
+	}
+
+	if _, err = DecompressInto(dst, bytes.NewReader([]byte("this is not a gzip stream"))); err != ErrHeader {
+		t.Errorf("invalid stream: got %v, want %v", err, ErrHeader)
+	}
+}
+
+func BenchmarkDecompressInto(b *testing.B) {
+	in, compressed, _ := testSeekableData(b, 4096, 1<<20)
+	dst := make([]byte, len(in))
+	src := bytes.NewReader(compressed)
+	b.SetBytes(int64(len(in)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		src.Reset(compressed)
+		if _, err := DecompressInto(dst, src); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package sgzip
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/klauspost/compress/flate"
+)
+
+// levelSample is the amount of data EstimateLevel decompresses and
+// compresses again: a block of the Writer with the default block size, so
+// that the sample ends where the compressor was flushed.
+const levelSample = defaultBlockSize
+
+// EstimateLevel returns the compression level the stream was most likely
+// written with, or -1 if it cannot be told. The result is a best guess:
+// gzip only records whether the fastest or the best compression was used,
+// in the XFL header field, and other compressors may make different
+// choices than this package at the same level.
+//
+// If the source implements io.ReaderAt, as *os.File and *bytes.Reader do,
+// EstimateLevel reads the start of the first member from it, up to the end
+// of the first block for Readers with metadata, and decompresses up to
+// 1 MiB of it. Data held only in stored blocks is reported as
+// NoCompression, and data without any matches as HuffmanOnly. Otherwise
+// the level given by XFL is returned if there is one, or else the one of
+// levels 2 to 8 whose output for the sample comes closest in size, which
+// takes tens of milliseconds. Data that does not compress ends up in
+// stored blocks at any level, and is reported as NoCompression too. The
+// position of the Reader does not change. For other sources only XFL is
+// used.
+func (z *Reader) EstimateLevel() int {
+	xflLevel := -1
+	switch z.xfl {
+	case 2:
+		xflLevel = BestCompression
+	case 4:
+		xflLevel = BestSpeed
+	}
+	data, comp, ok := z.levelSample()
+	if !ok || len(data) == 0 {
+		return xflLevel
+	}
+	st := deflateBlockStats(comp)
+	switch {
+	case st.compressed == 0 && st.stored > 0:
+		return NoCompression
+	case st.compressed == 0:
+		return xflLevel
+	case st.matches == 0 && compressedSize(data, BestSpeed) < int64(len(comp)):
+		// Matches were there to be found.
+		return HuffmanOnly
+	case xflLevel != -1:
+		return xflLevel
+	}
+	best, bestDiff := -1, int64(-1)
+	for level := 2; level <= 8; level++ {
+		diff := compressedSize(data, level) - int64(len(comp))
+		if diff < 0 {
+			diff = -diff
+		}
+		if best == -1 || diff < bestDiff {
+			best, bestDiff = level, diff
+		}
+	}
+	return best
+}
+
+// levelSample returns up to levelSample bytes from the start of the first
+// member and the compressed data holding them.
+func (z *Reader) levelSample() (data, comp []byte, ok bool) {
+	ra, start, ok := z.sourceAt()
+	if !ok {
+		return nil, nil, false
+	}
+	limit := int64(levelSample)
+	if z.canSeek {
+		first := int64(z.metaBlockSize)
+		if z.ustarts != nil && len(z.ustarts) > 1 {
+			first = z.ustarts[1] - z.ustarts[0]
+		}
+		if first < limit {
+			limit = first
+		}
+	}
+	cr := &countingReader{r: bufio.NewReader(io.NewSectionReader(ra, start, 1<<62))}
+	if _, err := ReadHeader(cr); err != nil {
+		return nil, nil, false
+	}
+	hdrLen := cr.n
+	fr := flate.NewReader(cr)
+	defer fr.Close()
+	data = make([]byte, limit)
+	n, err := io.ReadFull(fr, data)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, nil, false
+	}
+	comp = make([]byte, cr.n-hdrLen)
+	if n, _ := ra.ReadAt(comp, start+hdrLen); n < len(comp) {
+		return nil, nil, false
+	}
+	return data[:n], comp, true
+}
+
+// sourceAt returns the compressed source of z as an io.ReaderAt and the
+// offset of the stream in it.
+func (z *Reader) sourceAt() (io.ReaderAt, int64, bool) {
+	var r io.Reader
+	var start int64
+	switch {
+	case z.canSeek:
+		r = z.r
+	case z.src != nil:
+		r, start = z.src, z.srcStart
+	default:
+		return nil, 0, false
+	}
+	for {
+		switch s := r.(type) {
+		case *byteSeekTracker:
+			r = s.r
+		case *seekTracker:
+			r = s.r
+		case *offsetSeeker:
+			r, start = s.r, start+s.base
+		case *blockSource:
+			return s.ra, start, true
+		case io.ReaderAt:
+			return s, start, true
+		default:
+			return nil, 0, false
+		}
+	}
+}
+
+// deflateStats counts what the deflate blocks of a stream hold.
+type deflateStats struct {
+	stored     int // bytes in stored blocks
+	compressed int // non-empty blocks with fixed or dynamic codes
+	matches    int // length and distance pairs
+}
+
+// deflateBlockStats walks the deflate blocks in comp, which may end in the
+// middle of a block.
+func deflateBlockStats(comp []byte) deflateStats {
+	var st deflateStats
+	br := bitReader{data: comp}
+	for br.pos < len(comp)*8 && br.err == nil {
+		final := br.bits(1) == 1
+		switch br.bits(2) {
+		case FlateStored:
+			st.stored += br.stored()
+		case FlateFixed:
+			if br.codes(&fixedLitLen, &fixedDist) > 0 {
+				st.compressed++
+			}
+		case FlateDynamic:
+			var lit, dist huffman
+			if br.dynamicCodes(&lit, &dist) && br.codes(&lit, &dist) > 0 {
+				st.compressed++
+			}
+		default:
+			return st
+		}
+		if final {
+			break
+		}
+	}
+	st.matches = br.matches
+	return st
+}
+
+// compressedSize returns the size of data compressed at level and flushed,
+// as a block of the Writer is.
+func compressedSize(data []byte, level int) int64 {
+	var cw countWriter
+	fw, err := flate.NewWriter(&cw, level)
+	if err != nil {
+		return -1
+	}
+	fw.Write(data)
+	fw.Flush()
+	return cw.n
+}
@@ -0,0 +1,102 @@
+package sgzip
+
+import (
+	"bytes"
+	oldgz "compress/gzip"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+// levelTestData returns text-like data with repeated words.
+func levelTestData(size int) []byte {
+	words := []string{"gzip", "block", "seek", "reader", "writer", "index", "level", "the", "of", "and"}
+	rng := rand.New(rand.NewSource(1))
+	var buf bytes.Buffer
+	for buf.Len() < size {
+		buf.WriteString(words[rng.Intn(len(words))])
+		buf.WriteByte(" \n"[rng.Intn(10)/9])
+		if rng.Intn(4) == 0 {
+			buf.WriteByte(byte('A' + rng.Intn(26)))
+		}
+	}
+	return buf.Bytes()[:size]
+}
+
+func TestEstimateLevel(t *testing.T) {
+	in := levelTestData(300000)
+	for level := HuffmanOnly; level <= BestCompression; level++ {
+		if level == DefaultCompression {
+			continue
+		}
+		var buf bytes.Buffer
+		w, _ := NewWriterLevel(&buf, level)
+		w.Write(in)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		r, err := NewReader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.CopyN(ioutil.Discard, r, 1000); err != nil {
+			t.Fatal(err)
+		}
+		got := r.EstimateLevel()
+		if got != level {
+			t.Errorf("level %d: EstimateLevel = %d", level, got)
+		}
+		// The position does not change.
+		rest, err := ioutil.ReadAll(r)
+		if err != nil || !bytes.Equal(rest, in[1000:]) {
+			t.Errorf("level %d: read after EstimateLevel: %d bytes, %v", level, len(rest), err)
+		}
+		r.Close()
+
+		// Without io.ReaderAt, only XFL is known.
+		r, err = NewReader(struct{ io.Reader }{bytes.NewReader(buf.Bytes())})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := -1
+		if level == BestSpeed || level == BestCompression {
+			want = level
+		}
+		if got := r.EstimateLevel(); got != want {
+			t.Errorf("level %d without io.ReaderAt: EstimateLevel = %d, want %d", level, got, want)
+		}
+	}
+
+	// Streams written by compress/gzip with an index from RebuildIndex.
+	var buf bytes.Buffer
+	w, _ := oldgz.NewWriterLevel(&buf, 6)
+	w.Write(in)
+	w.Close()
+	meta, err := RebuildIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewSeekingReader(bytes.NewReader(buf.Bytes()), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.EstimateLevel(); got < 2 || got > 8 {
+		t.Errorf("compress/gzip level 6: EstimateLevel = %d, want 2 to 8", got)
+	}
+
+	// A source returning io.EOF with a full read of the deflate data,
+	// here because the trailer is missing.
+	buf.Reset()
+	w, _ = oldgz.NewWriterLevel(&buf, 6)
+	w.Write(in[:10000])
+	w.Close()
+	cut := buf.Bytes()[:buf.Len()-8]
+	r, err = NewReader(io.NewSectionReader(eofReaderAt(cut), 0, int64(len(cut))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.EstimateLevel(); got < 2 || got > 8 {
+		t.Errorf("io.EOF with a full read: EstimateLevel = %d, want 2 to 8", got)
+	}
+}
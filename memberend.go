@@ -0,0 +1,55 @@
+package sgzip
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// ErrMemberEnd is returned by Read instead of io.EOF at the end of a
+// member that more data follows, with SetReturnMemberEnd.
+var ErrMemberEnd = errors.New("gzip: end of member")
+
+// SetReturnMemberEnd controls what Read returns at the end of a member
+// with Multistream(false). By default it returns io.EOF, as
+// compress/gzip does, whether or not another member follows. With
+// SetReturnMemberEnd(true), it returns ErrMemberEnd if more data follows
+// the member, and io.EOF only at the end of the input, so that members
+// can be read one by one without trying ResetKeepOptions at the end. As
+// described for Multistream, r must then be an io.ByteReader:
+//
+//	for {
+//		_, err := io.Copy(dst, struct{ io.Reader }{z})
+//		if err != ErrMemberEnd {
+//			return err // nil at the end of the input
+//		}
+//		if err := z.ResetKeepOptions(r); err != nil {
+//			return err
+//		}
+//	}
+//
+// The data following the member is not checked to be a gzip header; a
+// following Reset reports it. Looking for more data reads a byte ahead
+// and puts it back, which is possible if r is an io.ByteScanner, as
+// *bufio.Reader and *bytes.Reader are, or is buffered by the Reader;
+// otherwise Read returns io.EOF as by default. WriteTo still returns nil
+// at the end of a member. The setting is kept across calls to Reset.
+func (z *Reader) SetReturnMemberEnd(ok bool) {
+	z.memberEnd = ok
+}
+
+// moreInput reports whether data follows in the input, without consuming
+// it, if that can be found out.
+func (z *Reader) moreInput() bool {
+	switch r := z.bufr.(type) {
+	case *bufio.Reader:
+		_, err := r.Peek(1)
+		return err == nil
+	case io.ByteScanner:
+		if _, err := r.ReadByte(); err != nil {
+			return false
+		}
+		return r.UnreadByte() == nil
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package sgzip
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math"
+
+	"github.com/klauspost/compress/flate"
+)
+
+// IndexMembers returns the metadata of a multistream file read from r in
+// which only some members carry an index, such as an archive assembled
+// from several sources. metas holds the metadata of each member in order,
+// and nil for members written without an index.
+//
+// A seeking Reader created with the result reads through all members and
+// seeks within the indexed members as usual. Each member without an index
+// is described as a single block and listed in Unindexed; seeking into it
+// decompresses the member from its start. Those members are decompressed
+// once by IndexMembers to learn their size, and ErrChecksum is returned if
+// a trailer does not match their data. Indexed members are skipped
+// without decompressing them.
+//
+// The result has variable block sizes and no Fingerprint. Members with
+// Padding are not supported. An error is returned if r does not hold
+// exactly len(metas) members, or ErrInvalidMetadata if the header of a
+// member does not have the length given by its metadata.
+func IndexMembers(r io.Reader, metas []*GzipMetadata) (GzipMetadata, error) {
+	if len(metas) == 0 {
+		return GzipMetadata{}, errors.New("gzip: no members to index")
+	}
+	var out GzipMetadata
+	hasCRC := true
+	cr := &countingReader{r: makeReader(r)}
+	for i, meta := range metas {
+		start := cr.n
+		if _, err := ReadHeader(cr); err != nil {
+			if err == io.EOF {
+				err = fmt.Errorf("gzip: stream has %d members, want %d", i, len(metas))
+			}
+			return GzipMetadata{}, err
+		}
+		hdrLen := cr.n - start
+		if i == 0 {
+			out.BlockData = []uint32{uint32(hdrLen)}
+		} else {
+			// The trailer of the previous member and this header are
+			// appended to the last block of the previous member.
+			last := len(out.BlockData) - 1
+			gap := int64(out.BlockData[last]) + 8 + hdrLen
+			if gap > math.MaxUint32 {
+				return GzipMetadata{}, fmt.Errorf("gzip: member %d: header too large", i)
+			}
+			out.BlockData[last] = uint32(gap)
+		}
+
+		var err error
+		if meta == nil {
+			err = out.addUnindexed(cr)
+		} else {
+			if len(meta.BlockCRC) != meta.NumBlocks() {
+				hasCRC = false
+			}
+			err = out.addIndexed(cr, meta, hdrLen)
+		}
+		if err != nil {
+			return GzipMetadata{}, fmt.Errorf("%w (member %d)", err, i)
+		}
+	}
+	if _, err := ReadHeader(cr); err != io.EOF {
+		if err == nil {
+			err = fmt.Errorf("gzip: stream has more than %d members", len(metas))
+		}
+		return GzipMetadata{}, err
+	}
+	if metas[len(metas)-1] == nil {
+		// Seeking readers expect the stream to end with an empty block.
+		out.BlockData = append(out.BlockData, 0)
+		out.BlockLens = append(out.BlockLens, 0)
+		out.BlockCRC = append(out.BlockCRC, 0)
+	}
+	if !hasCRC {
+		out.BlockCRC = nil
+	}
+	if out.BlockSize == 0 {
+		out.BlockSize = defaultBlockSize
+	}
+	out.Version = metadataVersion(&out)
+	return out, nil
+}
+
+// addIndexed appends the blocks of the member described by meta, whose
+// header of hdrLen bytes has been read from cr, and skips the rest of it.
+func (m *GzipMetadata) addIndexed(cr *countingReader, meta *GzipMetadata, hdrLen int64) error {
+	if err := checkVersion(meta); err != nil {
+		return err
+	}
+	if meta.Padding != 0 {
+		return errors.New("gzip: cannot index padded members")
+	}
+	if len(meta.BlockData) < 2 || int64(meta.BlockData[0]) != hdrLen {
+		return ErrInvalidMetadata
+	}
+	var skip int64
+	for i, d := range meta.BlockData[1:] {
+		var crc uint32
+		if len(meta.BlockCRC) == meta.NumBlocks() {
+			crc = meta.BlockCRC[i]
+		}
+		m.addBlock(d, blockLen(meta, i), crc)
+		skip += int64(d)
+	}
+	if meta.BlockSize > m.BlockSize {
+		m.BlockSize = meta.BlockSize
+	}
+	m.Size += meta.Size
+	n, err := io.CopyN(ioutil.Discard, cr, skip+8)
+	if err == io.EOF || (err == nil && n < skip+8) {
+		err = fmt.Errorf("%w: member is truncated", ErrInvalidMetadata)
+	}
+	return err
+}
+
+// addUnindexed appends a single block holding the member read from cr,
+// whose header has been read, decompressing it to learn its size.
+func (m *GzipMetadata) addUnindexed(cr *countingReader) error {
+	start := cr.n
+	fr := flate.NewReader(cr)
+	defer fr.Close()
+	digest := crc32.NewIEEE()
+	size, err := io.Copy(digest, fr)
+	if err != nil {
+		return noEOF(err)
+	}
+	comp := cr.n - start
+	var trailer [8]byte
+	if _, err := io.ReadFull(cr, trailer[:]); err != nil {
+		return noEOF(err)
+	}
+	if get4(trailer[:4]) != digest.Sum32() || get4(trailer[4:]) != uint32(size) {
+		return ErrChecksum
+	}
+	if comp > math.MaxUint32 || size > math.MaxUint32 {
+		return errors.New("gzip: member too large to index as a single block")
+	}
+	m.Unindexed = append(m.Unindexed, len(m.BlockData)-1)
+	m.addBlock(uint32(comp), size, digest.Sum32())
+	m.Size += size
+	return nil
+}
+
+// addBlock appends a block of comp compressed bytes holding size bytes
+// with checksum crc.
+func (m *GzipMetadata) addBlock(comp uint32, size int64, crc uint32) {
+	m.BlockData = append(m.BlockData, comp)
+	m.BlockLens = append(m.BlockLens, uint32(size))
+	m.BlockCRC = append(m.BlockCRC, crc)
+}
+
+// checkUnindexed returns ErrInvalidMetadata if the Unindexed field of meta
+// does not list blocks of meta in increasing order.
+func checkUnindexed(meta *GzipMetadata) error {
+	if len(meta.Unindexed) == 0 {
+		return nil
+	}
+	if !meta.variableBlocks() {
+		return fmt.Errorf("%w: unindexed members need variable block sizes", ErrInvalidMetadata)
+	}
+	prev := -1
+	for _, b := range meta.Unindexed {
+		if b <= prev || b >= meta.NumBlocks() {
+			return fmt.Errorf("%w: unindexed block %d", ErrInvalidMetadata, b)
+		}
+		prev = b
+	}
+	return nil
+}
+
+// countingReader counts the bytes read from r. Since the decompressor and
+// ReadHeader do not read ahead of a flate.Reader, the count is the position
+// in the stream.
+type countingReader struct {
+	r flate.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
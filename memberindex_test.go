@@ -0,0 +1,125 @@
+package sgzip
+
+import (
+	"bytes"
+	oldgz "compress/gzip"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+// plainGzip compresses size bytes with compress/gzip, which writes no index.
+func plainGzip(t *testing.T, size int, seed byte) ([]byte, []byte) {
+	in := make([]byte, size)
+	for i := range in {
+		in[i] = byte(i/3) ^ seed
+	}
+	var buf bytes.Buffer
+	w := oldgz.NewWriter(&buf)
+	w.Name = "plain"
+	w.Write(in)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return in, buf.Bytes()
+}
+
+func TestIndexMembers(t *testing.T) {
+	inA, compA, metaA := testSeekableData(t, 100000, 16<<10)
+	inB, compB := plainGzip(t, 70000, 1)
+	inC, compC, metaC := testSeekableData(t, 0, 16<<10)
+	inD, compD, metaD := testSeekableData(t, 40000, 8<<10)
+	inE, compE := plainGzip(t, 30000, 2)
+
+	tests := []struct {
+		name  string
+		in    [][]byte
+		comp  [][]byte
+		metas []*GzipMetadata
+	}{
+		{"mixed", [][]byte{inA, inB, inC, inD, inE}, [][]byte{compA, compB, compC, compD, compE}, []*GzipMetadata{&metaA, nil, &metaC, &metaD, nil}},
+		{"unindexed first", [][]byte{inB, inE, inA}, [][]byte{compB, compE, compA}, []*GzipMetadata{nil, nil, &metaA}},
+		{"unindexed only", [][]byte{inE}, [][]byte{compE}, []*GzipMetadata{nil}},
+	}
+	for _, tt := range tests {
+		in := bytes.Join(tt.in, nil)
+		comp := bytes.Join(tt.comp, nil)
+		meta, err := IndexMembers(bytes.NewReader(comp), tt.metas)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if meta.Size != int64(len(in)) {
+			t.Errorf("%s: Size = %d, want %d", tt.name, meta.Size, len(in))
+		}
+		var unindexed int
+		for _, m := range tt.metas {
+			if m == nil {
+				unindexed++
+			}
+		}
+		if len(meta.Unindexed) != unindexed {
+			t.Errorf("%s: Unindexed = %v, want %d blocks", tt.name, meta.Unindexed, unindexed)
+		}
+		if crc, ok := DecompressedChecksum(&meta); !ok || crc != crc32.ChecksumIEEE(in) {
+			t.Errorf("%s: DecompressedChecksum = %08x, %v, want %08x", tt.name, crc, ok, crc32.ChecksumIEEE(in))
+		}
+
+		var idx bytes.Buffer
+		if err := EncodeIndex(&idx, &meta); err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := DecodeIndex(&idx)
+		if err != nil || !reflect.DeepEqual(decoded, meta) {
+			t.Errorf("%s: index round trip: got %+v, %v, want %+v", tt.name, decoded, err, meta)
+		}
+
+		r, err := NewSeekingReader(bytes.NewReader(comp), &meta)
+		if err != nil {
+			t.Fatalf("%s: NewSeekingReader: %v", tt.name, err)
+		}
+		for _, pos := range []int64{0, 1, 50000, 100000, 130000, 170000, 175000, int64(len(in)) - 1} {
+			if pos >= int64(len(in)) {
+				continue
+			}
+			if _, err := r.Seek(pos, io.SeekStart); err != nil {
+				t.Fatalf("%s: Seek(%d): %v", tt.name, pos, err)
+			}
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("%s: ReadAll after Seek(%d): %v", tt.name, pos, err)
+			}
+			if !bytes.Equal(got, in[pos:]) {
+				t.Errorf("%s: Seek(%d): got %d bytes, want %d", tt.name, pos, len(got), len(in)-int(pos))
+			}
+		}
+		r.Close()
+	}
+
+	comp := bytes.Join([][]byte{compA, compB}, nil)
+	if _, err := IndexMembers(bytes.NewReader(comp), []*GzipMetadata{&metaA}); err == nil {
+		t.Error("expected error for more members than metadata")
+	}
+	if _, err := IndexMembers(bytes.NewReader(comp), []*GzipMetadata{&metaA, nil, nil}); err == nil {
+		t.Error("expected error for fewer members than metadata")
+	}
+	if _, err := IndexMembers(bytes.NewReader(comp), []*GzipMetadata{nil, &metaA}); !errors.Is(err, ErrInvalidMetadata) {
+		t.Errorf("metadata for the wrong member: got %v, want ErrInvalidMetadata", err)
+	}
+	corrupt := append([]byte{}, comp...)
+	corrupt[len(corrupt)-5]++
+	if _, err := IndexMembers(bytes.NewReader(corrupt), []*GzipMetadata{&metaA, nil}); !errors.Is(err, ErrChecksum) {
+		t.Errorf("bad trailer: got %v, want ErrChecksum", err)
+	}
+
+	meta, err := IndexMembers(bytes.NewReader(comp), []*GzipMetadata{&metaA, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta.Unindexed = []int{meta.NumBlocks()}
+	if _, err := NewSeekingReader(bytes.NewReader(comp), &meta); !errors.Is(err, ErrInvalidMetadata) {
+		t.Errorf("out of range unindexed block: got %v, want ErrInvalidMetadata", err)
+	}
+}
@@ -0,0 +1,100 @@
+package sgzip
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+
+	"github.com/klauspost/compress/flate"
+)
+
+// MemberInfo describes a member of a multistream file, see ListMembers.
+type MemberInfo struct {
+	Offset           int64  // offset of the header of the member
+	CompressedLength int64  // length of the member, from its header to the end of its trailer
+	Name             string // name from the header
+	Size             int64  // ISIZE from the trailer: the uncompressed size modulo 2^32
+}
+
+// ListMembers returns the members of the multistream file read from ra,
+// such as one made by concatenating gzip files, in order, so that each
+// can be opened on its own with an io.SectionReader.
+//
+// gzip does not record the length of a member, so ListMembers reads the
+// header and trailer of each member, and finds where a member ends by
+// decompressing its data, which is discarded without verifying its
+// checksum. Members whose header records their length, as the blocks of
+// BGZF files do, are skipped without reading their data.
+//
+// If the file does not end after a member, the members found are returned
+// with the error, ErrHeader for data that is not a gzip header, or
+// io.ErrUnexpectedEOF for a member cut short. An empty file has no
+// members.
+func ListMembers(ra io.ReaderAt) ([]MemberInfo, error) {
+	end, err := readerAtSize(ra)
+	if err != nil {
+		end = math.MaxInt64
+	}
+	var members []MemberInfo
+	br := bufio.NewReader(nil)
+	var fr io.ReadCloser
+	defer func() {
+		if fr != nil {
+			fr.Close()
+		}
+	}()
+	var trailer [8]byte
+	for off := int64(0); off < end; {
+		br.Reset(io.NewSectionReader(ra, off, end-off))
+		cr := &countingReader{r: br}
+		h, err := ReadHeader(cr)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return members, noEOF(err)
+		}
+		m := MemberInfo{Offset: off, Name: h.Name}
+		if n, ok := bgzfLength(h.Extra); ok && n >= cr.n+8 {
+			m.CompressedLength = n
+			if k, err := ra.ReadAt(trailer[:], off+n-8); k < len(trailer) {
+				return members, noEOF(err)
+			}
+		} else {
+			if fr == nil {
+				fr = flate.NewReader(cr)
+			} else {
+				fr.(flate.Resetter).Reset(cr, nil)
+			}
+			if _, err := io.Copy(ioutil.Discard, fr); err != nil {
+				return members, err
+			}
+			if _, err := io.ReadFull(cr, trailer[:]); err != nil {
+				return members, noEOF(err)
+			}
+			m.CompressedLength = cr.n
+		}
+		m.Size = int64(binary.LittleEndian.Uint32(trailer[4:8]))
+		members = append(members, m)
+		off += m.CompressedLength
+	}
+	return members, nil
+}
+
+// bgzfLength returns the length of a BGZF block recorded in the FEXTRA
+// field extra of its header, as BSIZE, the length minus 1, in the subfield
+// "BC".
+func bgzfLength(extra []byte) (int64, bool) {
+	fields, ok := splitSubfields(extra)
+	if !ok {
+		return 0, false
+	}
+	for _, f := range fields {
+		if f.id == [2]byte{'B', 'C'} && len(f.data) == 2 {
+			return int64(binary.LittleEndian.Uint16(f.data)) + 1, true
+		}
+	}
+	return 0, false
+}
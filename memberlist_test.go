@@ -0,0 +1,104 @@
+package sgzip
+
+import (
+	"bytes"
+	oldgz "compress/gzip"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestListMembers(t *testing.T) {
+	names := []string{"a.txt", "b.txt", "c.txt"}
+	var buf bytes.Buffer
+	var contents [][]byte
+	for i, name := range names {
+		data := levelTestData(100000 * (i + 1))
+		contents = append(contents, data)
+		w := NewWriter(&buf)
+		w.Name = name
+		w.Write(data)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file := buf.Bytes()
+	members, err := ListMembers(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != len(names) {
+		t.Fatalf("got %d members, want %d", len(members), len(names))
+	}
+	var off int64
+	for i, m := range members {
+		if m.Offset != off || m.Name != names[i] || m.Size != int64(len(contents[i])) {
+			t.Errorf("member %d: got %+v, want offset %d, size %d", i, m, off, len(contents[i]))
+		}
+		r, err := NewReader(io.NewSectionReader(bytes.NewReader(file), m.Offset, m.CompressedLength))
+		if err != nil {
+			t.Fatalf("member %d: %v", i, err)
+		}
+		if got, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(got, contents[i]) {
+			t.Errorf("member %d: got %d bytes, %v", i, len(got), err)
+		}
+		r.Close()
+		off += m.CompressedLength
+	}
+	if off != int64(len(file)) {
+		t.Errorf("members end at %d, want %d", off, len(file))
+	}
+
+	// Errors after a member are returned with the members found.
+	garbage := append(append([]byte(nil), file...), "garbage!!!"...)
+	if got, err := ListMembers(bytes.NewReader(garbage)); err != ErrHeader || len(got) != 3 {
+		t.Errorf("trailing garbage: got %d members, %v, want 3, ErrHeader", len(got), err)
+	}
+	cut := file[:len(file)-100]
+	if got, err := ListMembers(bytes.NewReader(cut)); err != io.ErrUnexpectedEOF || len(got) != 2 {
+		t.Errorf("truncated: got %d members, %v, want 2, io.ErrUnexpectedEOF", len(got), err)
+	}
+	if got, err := ListMembers(bytes.NewReader(nil)); err != nil || len(got) != 0 {
+		t.Errorf("empty: got %d members, %v", len(got), err)
+	}
+}
+
+func TestListMembersBGZF(t *testing.T) {
+	in := levelTestData(300000)
+	var file []byte
+	for off := 0; off < len(in); off += 65280 {
+		end := off + 65280
+		if end > len(in) {
+			end = len(in)
+		}
+		var buf bytes.Buffer
+		w := oldgz.NewWriter(&buf)
+		w.Extra = []byte{'B', 'C', 2, 0, 0, 0}
+		w.Write(in[off:end])
+		w.Close()
+		block := buf.Bytes()
+		binary.LittleEndian.PutUint16(block[16:18], uint16(len(block)-1))
+		file = append(file, block...)
+	}
+	cra := &countingReaderAt{ra: bytes.NewReader(file)}
+	members, err := ListMembers(cra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 5 {
+		t.Fatalf("got %d members, want 5", len(members))
+	}
+	var size int64
+	for _, m := range members {
+		size += m.Size
+	}
+	if size != int64(len(in)) {
+		t.Errorf("got size %d, want %d", size, len(in))
+	}
+	// Only the headers and trailers are read, with the read-ahead of
+	// the headers.
+	if _, n := cra.stats(); n >= int64(len(file))/2 {
+		t.Errorf("read %d bytes of %d", n, len(file))
+	}
+}
@@ -0,0 +1,122 @@
+package sgzip
+
+import "io"
+
+// Members calls fn for each member of a multistream file in turn, such as
+// a file made by concatenating several gzip files. When fn is called, the
+// header fields of z are those of the member, and reading from z returns
+// the data of that member only, ending with io.EOF. Data that fn does not
+// read is skipped; its checksum is verified all the same. Iteration stops
+// at the first error returned by fn, which is then returned by Members.
+//
+// The first call is for the member z is reading, which is the first one
+// unless data has been read. Members disables multistream mode, see
+// Multistream. It returns ErrUnsupported for Readers created with
+// metadata.
+func (z *Reader) Members(fn func(m *Reader) error) error {
+	if z.canSeek {
+		return ErrUnsupported
+	}
+	z.Multistream(false)
+	for {
+		if err := fn(z); err != nil {
+			return err
+		}
+		if _, err := z.discard(-1); err != nil {
+			return err
+		}
+		err := z.nextMemberReset()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// nextMemberReset reads the header of the member following the current
+// one, resetting the state of z as Reset does but continuing with the
+// same input.
+func (z *Reader) nextMemberReset() error {
+	z.killReadAhead()
+	z.digest = z.newDigest()
+	z.size = 0
+	z.pos = 0
+	z.roff = 0
+	z.current = nil
+	z.err = nil
+	z.atEnd = false
+	z.verifyChecksum = true
+	z.blockPool = make(chan []byte, z.concurrentBlocks)
+	for i := 0; i < z.concurrentBlocks; i++ {
+		z.blockPool <- nil // allocated by the read-ahead when needed
+	}
+	err := z.readHeader(true)
+	if z.noGarbage && isGarbage(err) {
+		err = io.EOF
+	}
+	if err != nil {
+		z.err = err
+	}
+	return err
+}
+
+// MemberReader returns an io.Reader of the data of one member of a
+// multistream file, ending with io.EOF at the end of the member, for
+// handing each member to a different parser. The first call returns the
+// member z is reading. Each further call moves to the next member: the
+// rest of the current one is skipped, with its checksum verified, and the
+// header of the next is read, so that the header fields of z are those of
+// the member returned. Once there is no next member, MemberReader returns
+// nil, so the members are read with
+//
+//	for m := z.MemberReader(); m != nil; m = z.MemberReader() {
+//		...
+//	}
+//
+// An error moving to the next member, such as ErrChecksum for the member
+// skipped or ErrHeader, is returned by the Read of the returned reader.
+// A returned reader should not be used after the next call. MemberReader
+// disables multistream mode, see Multistream, and its readers return
+// ErrUnsupported for Readers created with metadata.
+func (z *Reader) MemberReader() io.Reader {
+	if z.canSeek {
+		return &memberReader{err: ErrUnsupported}
+	}
+	z.Multistream(false)
+	if !z.memberGiven {
+		z.memberGiven = true
+		return &memberReader{z: z}
+	}
+	if _, err := z.discard(-1); err != nil {
+		return &memberReader{err: err}
+	}
+	if err := z.nextMemberReset(); err == io.EOF {
+		return nil
+	} else if err != nil {
+		return &memberReader{err: err}
+	}
+	return &memberReader{z: z}
+}
+
+// memberReader is the io.Reader returned by MemberReader, which reads z,
+// or returns err if it is set.
+type memberReader struct {
+	z   *Reader
+	err error
+}
+
+func (m *memberReader) Read(p []byte) (int, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	return m.z.Read(p)
+}
+
+func (m *memberReader) WriteTo(w io.Writer) (int64, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	return m.z.WriteTo(w)
+}
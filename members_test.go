@@ -0,0 +1,173 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestMembers(t *testing.T) {
+	names := []string{"a.txt", "b.txt", "c.txt"}
+	var buf bytes.Buffer
+	var contents [][]byte
+	for i, name := range names {
+		data := bytes.Repeat([]byte(name), 10000*(i+1))
+		contents = append(contents, data)
+		w := NewWriter(&buf)
+		w.Name = name
+		w.Write(data)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var i int
+	err = r.Members(func(m *Reader) error {
+		if i >= len(names) {
+			t.Fatalf("got more than %d members", len(names))
+		}
+		if m.Name != names[i] {
+			t.Errorf("member %d: Name = %q, want %q", i, m.Name, names[i])
+		}
+		if i == 1 {
+			// Only read part of the member.
+			p := make([]byte, 100)
+			if _, err := io.ReadFull(m, p); err != nil {
+				return err
+			}
+		} else {
+			got, err := ioutil.ReadAll(m)
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(got, contents[i]) {
+				t.Errorf("member %d: content does not match", i)
+			}
+		}
+		i++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i != len(names) {
+		t.Errorf("got %d members, want %d", i, len(names))
+	}
+
+	r, err = NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	stop := errors.New("stop")
+	if err := r.Members(func(m *Reader) error { return stop }); err != stop {
+		t.Errorf("got %v, want %v", err, stop)
+	}
+
+	corrupt := append([]byte{}, buf.Bytes()...)
+	corrupt[len(corrupt)-5] ^= 0xff // checksum of the last member
+	r, err = NewReader(bytes.NewReader(corrupt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err := r.Members(func(m *Reader) error { return nil }); err != ErrChecksum {
+		t.Errorf("corrupt checksum: got %v, want %v", err, ErrChecksum)
+	}
+
+	_, compressed, meta := testSeekableData(t, 1000, 16<<10)
+	sr, err := NewSeekingReader(bytes.NewReader(compressed), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sr.Close()
+	if err := sr.Members(func(m *Reader) error { return nil }); err != ErrUnsupported {
+		t.Errorf("seeking reader: got %v, want %v", err, ErrUnsupported)
+	}
+}
+
+func TestMemberReader(t *testing.T) {
+	names := []string{"a.txt", "b.txt", "c.txt", "d.txt"}
+	var buf bytes.Buffer
+	var contents [][]byte
+	for i, name := range names {
+		data := bytes.Repeat([]byte(name), 10000*i)
+		contents = append(contents, data)
+		w := NewWriter(&buf)
+		w.Name = name
+		w.Write(data)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var i int
+	for m := r.MemberReader(); m != nil; m = r.MemberReader() {
+		if i >= len(contents) {
+			t.Fatalf("got more than %d members", len(contents))
+		}
+		if r.Name != names[i] {
+			t.Errorf("member %d: Name = %q, want %q", i, r.Name, names[i])
+		}
+		if i == 2 {
+			// Only read part of the member, the rest is skipped.
+			if _, err := io.ReadFull(m, make([]byte, 100)); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			var got bytes.Buffer
+			if _, err := io.Copy(&got, m); err != nil || !bytes.Equal(got.Bytes(), contents[i]) {
+				t.Errorf("member %d: got %d bytes, %v, want %d", i, got.Len(), err, len(contents[i]))
+			}
+			if n, err := m.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+				t.Errorf("member %d: Read at end: %d, %v", i, n, err)
+			}
+		}
+		i++
+	}
+	if i != len(contents) {
+		t.Errorf("got %d members, want %d", i, len(contents))
+	}
+	if r.MemberReader() != nil {
+		t.Error("MemberReader after the last member is not nil")
+	}
+
+	// A damaged member is reported when moving past it.
+	corrupt := append([]byte{}, buf.Bytes()...)
+	corrupt[len(corrupt)-5] ^= 0xff // checksum of the last member
+	r, err = NewReader(bytes.NewReader(corrupt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for j := 0; j < 4; j++ {
+		r.MemberReader()
+	}
+	if m := r.MemberReader(); m == nil {
+		t.Error("damaged last member: got nil")
+	} else if _, err := m.Read(make([]byte, 1)); err != ErrChecksum {
+		t.Errorf("damaged last member: got %v, want %v", err, ErrChecksum)
+	}
+
+	_, compressed, meta := testSeekableData(t, 1000, 16<<10)
+	sr, err := NewSeekingReader(bytes.NewReader(compressed), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sr.Close()
+	if _, err := sr.MemberReader().Read(make([]byte, 1)); err != ErrUnsupported {
+		t.Errorf("seeking reader: got %v, want %v", err, ErrUnsupported)
+	}
+}
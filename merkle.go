@@ -0,0 +1,152 @@
+package sgzip
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// The Merkle tree of a stream is built over its blocks as in RFC 6962,
+// section 2.1, with SHA-256 as the hash function. The leaf of block i,
+// counting all blocks of the metadata including the empty one that ends
+// streams written by Writer, is the 12 bytes
+//
+//	uint32	CRC-32 (IEEE) of the uncompressed data of the block
+//	uint64	length of the uncompressed data of the block
+//
+// both little-endian, where the data includes any Padding, as in the
+// trailer. The hash of a leaf is SHA-256(0x00 || leaf). The hash of a
+// tree of n > 1 leaves is
+// SHA-256(0x01 || left || right), where left is the hash of the tree of
+// the first k leaves, k being the largest power of two smaller than n,
+// and right that of the tree of the remaining n-k leaves. A tree of one
+// leaf has the hash of its leaf.
+//
+// A proof for block i is the audit path of RFC 6962, section 2.1.1: the
+// hashes of the subtrees needed to compute the root from the leaf, from
+// the bottom of the tree up.
+
+// MerkleRoot returns the root of the Merkle tree over the block checksums
+// in m, 32 bytes long. A client trusting the root, for example from a
+// signature, can then check a single block it downloaded and decompressed
+// with VerifyBlockProof and a proof from BlockProof, without the rest of
+// the stream or metadata. The tree is described above.
+//
+// The second result is false when m does not have a checksum for every
+// block. CRC-32 only detects accidental changes, so the root does not
+// protect against a block deliberately crafted to match its checksum.
+func (m GzipMetadata) MerkleRoot() ([]byte, bool) {
+	leaves, ok := merkleLeaves(&m)
+	if !ok {
+		return nil, false
+	}
+	return merkleHash(leaves), true
+}
+
+// BlockProof returns the proof for block i of m, to be passed to
+// VerifyBlockProof with the root returned by MerkleRoot.
+func (m GzipMetadata) BlockProof(i int) ([][]byte, error) {
+	leaves, ok := merkleLeaves(&m)
+	if !ok {
+		return nil, errors.New("gzip: metadata does not have a checksum for every block")
+	}
+	if i < 0 || i >= len(leaves) {
+		return nil, fmt.Errorf("gzip: block %d out of range [0, %d)", i, len(leaves))
+	}
+	return merklePath(i, leaves), nil
+}
+
+// VerifyBlockProof reports whether block is the uncompressed data of block
+// i of a stream of n blocks whose Merkle tree has the given root, using
+// the proof returned by GzipMetadata.BlockProof. n is NumBlocks of the
+// metadata, and block the data of the block as decompressed, including
+// any Padding.
+func VerifyBlockProof(root []byte, i, n int, block []byte, proof [][]byte) bool {
+	if i < 0 || i >= n {
+		return false
+	}
+	h := merkleLeaf(crc32.ChecksumIEEE(block), int64(len(block)))
+	fn, sn := i, n-1
+	for _, p := range proof {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			h = merkleNode(p, h)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			h = merkleNode(h, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && bytes.Equal(h, root)
+}
+
+// merkleLeaves returns the leaf hashes of the blocks of meta, and false
+// if it does not have a checksum for every block.
+func merkleLeaves(meta *GzipMetadata) ([][]byte, bool) {
+	n := meta.NumBlocks()
+	if n == 0 || len(meta.BlockCRC) != n {
+		return nil, false
+	}
+	leaves := make([][]byte, n)
+	for i, crc := range meta.BlockCRC {
+		leaves[i] = merkleLeaf(crc, blockLen(meta, i))
+	}
+	return leaves, true
+}
+
+// merkleLeaf returns the hash of the leaf of a block.
+func merkleLeaf(crc uint32, length int64) []byte {
+	var buf [13]byte
+	binary.LittleEndian.PutUint32(buf[1:5], crc)
+	binary.LittleEndian.PutUint64(buf[5:13], uint64(length))
+	sum := sha256.Sum256(buf[:])
+	return sum[:]
+}
+
+// merkleNode returns the hash of the node with the given children.
+func merkleNode(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// merkleSplit returns the largest power of two smaller than n > 1.
+func merkleSplit(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// merkleHash returns the hash of the tree over leaves.
+func merkleHash(leaves [][]byte) []byte {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+	k := merkleSplit(len(leaves))
+	return merkleNode(merkleHash(leaves[:k]), merkleHash(leaves[k:]))
+}
+
+// merklePath returns the audit path of leaf i of the tree over leaves.
+func merklePath(i int, leaves [][]byte) [][]byte {
+	if len(leaves) == 1 {
+		return nil
+	}
+	k := merkleSplit(len(leaves))
+	if i < k {
+		return append(merklePath(i, leaves[:k]), merkleHash(leaves[k:]))
+	}
+	return append(merklePath(i-k, leaves[k:]), merkleHash(leaves[:k]))
+}
@@ -0,0 +1,120 @@
+package sgzip
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"hash/crc32"
+	"testing"
+)
+
+func TestMerkleRoot(t *testing.T) {
+	in, _, meta := testSeekableData(t, 300000, 32<<10)
+	root, ok := meta.MerkleRoot()
+	if !ok || len(root) != sha256.Size {
+		t.Fatalf("MerkleRoot: got %x, %v", root, ok)
+	}
+	n := meta.NumBlocks()
+	for i := 0; i < n; i++ {
+		info, err := meta.BlockInfo(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block := in[info.UncompressedOffset : info.UncompressedOffset+info.UncompressedLength]
+		proof, err := meta.BlockProof(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !VerifyBlockProof(root, i, n, block, proof) {
+			t.Errorf("block %d: proof not verified", i)
+		}
+		if len(block) > 0 {
+			bad := append([]byte(nil), block...)
+			bad[0]++
+			if VerifyBlockProof(root, i, n, bad, proof) {
+				t.Errorf("block %d: changed data verified", i)
+			}
+		}
+		if VerifyBlockProof(root, (i+1)%n, n, block, proof) {
+			t.Errorf("block %d: verified as block %d", i, (i+1)%n)
+		}
+	}
+	if _, err := meta.BlockProof(n); err == nil {
+		t.Error("BlockProof out of range: expected error")
+	}
+
+	// A change to a checksum changes the root.
+	changed := meta
+	changed.BlockCRC = append([]uint32(nil), meta.BlockCRC...)
+	changed.BlockCRC[1]++
+	if other, _ := changed.MerkleRoot(); bytes.Equal(other, root) {
+		t.Error("root unchanged after changing a checksum")
+	}
+
+	noCRC := meta
+	noCRC.BlockCRC = nil
+	if _, ok := noCRC.MerkleRoot(); ok {
+		t.Error("MerkleRoot without block checksums: got true")
+	}
+	if _, err := noCRC.BlockProof(0); err == nil {
+		t.Error("BlockProof without block checksums: expected error")
+	}
+}
+
+// TestMerkleTree checks the documented construction for three blocks.
+func TestMerkleTree(t *testing.T) {
+	blocks := [][]byte{[]byte("first block"), []byte("second"), nil}
+	meta := GzipMetadata{
+		BlockSize: 11,
+		Size:      17,
+		BlockData: []uint32{10, 5, 5, 2},
+		Version:   1,
+	}
+	var leaves [][]byte
+	for _, b := range blocks {
+		meta.BlockCRC = append(meta.BlockCRC, crc32.ChecksumIEEE(b))
+		leaf := []byte{0}
+		leaf = append(leaf, le32(crc32.ChecksumIEEE(b))...)
+		leaf = append(leaf, le64(uint64(len(b)))...)
+		sum := sha256.Sum256(leaf)
+		leaves = append(leaves, sum[:])
+	}
+	node := func(l, r []byte) []byte {
+		sum := sha256.Sum256(append(append([]byte{1}, l...), r...))
+		return sum[:]
+	}
+	want := node(node(leaves[0], leaves[1]), leaves[2])
+	root, ok := meta.MerkleRoot()
+	if !ok || !bytes.Equal(root, want) {
+		t.Fatalf("got root %x, %v, want %x", root, ok, want)
+	}
+	proofs := [][][]byte{
+		{leaves[1], leaves[2]},
+		{leaves[0], leaves[2]},
+		{node(leaves[0], leaves[1])},
+	}
+	for i, want := range proofs {
+		proof, err := meta.BlockProof(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(proof) != len(want) {
+			t.Fatalf("block %d: got %d hashes, want %d", i, len(proof), len(want))
+		}
+		for j := range want {
+			if !bytes.Equal(proof[j], want[j]) {
+				t.Errorf("block %d: hash %d differs", i, j)
+			}
+		}
+		if !VerifyBlockProof(root, i, len(blocks), blocks[i], proof) {
+			t.Errorf("block %d: proof not verified", i)
+		}
+	}
+}
+
+func le32(v uint32) []byte {
+	return []byte{byte(v), byte(v >> 8), byte(v >> 16), byte(v >> 24)}
+}
+
+func le64(v uint64) []byte {
+	return append(le32(uint32(v)), le32(uint32(v>>32))...)
+}
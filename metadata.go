@@ -0,0 +1,481 @@
+package sgzip
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// MetadataVersion is the version of the metadata format written by this
+// package. Version 1 added the Version field itself and BlockCRC;
+// metadata without a version is read as before. Version 2 added Padding,
+// and is only used for streams written with SetPadLastBlock, so that
+// older versions of this package can read all other metadata. Version 3
+// added UBlockData; metadata that sets it should have Version 3, since
+// older versions of this package ignore the field. Version 4 added
+// StreamOffset, likewise. Version 5 covers BlockLens and Unindexed, which
+// were added without a version of their own and which older versions of
+// this package would also ignore.
+const MetadataVersion = 5
+
+// metadataVersion returns the version to record in meta: the oldest
+// version that knows all the fields meta uses.
+func metadataVersion(meta *GzipMetadata) int {
+	switch {
+	case len(meta.BlockLens) > 0 || len(meta.Unindexed) > 0:
+		return 5
+	case meta.StreamOffset != 0:
+		return 4
+	case meta.UBlockData != nil:
+		return 3
+	case meta.Padding != 0:
+		return 2
+	}
+	return 1
+}
+
+// checkVersion returns ErrUnsupportedMetadataVersion if meta was written
+// by a newer version of this package.
+func checkVersion(meta *GzipMetadata) error {
+	if meta.Version < 0 || meta.Version > MetadataVersion {
+		return fmt.Errorf("%w %d (supported up to %d)", ErrUnsupportedMetadataVersion, meta.Version, MetadataVersion)
+	}
+	return nil
+}
+
+// MergeMetadata returns the metadata for the stream formed by appending the
+// stream described by b to the stream described by a. aCompressedLen is the
+// length in bytes of the compressed stream described by a, including its
+// trailer and anything else written before the stream described by b.
+//
+// Both streams must use the same block size, and a must end on a block
+// boundary with an empty last block, which is what Writer produces when
+// the amount of data written is a multiple of the block size. Other
+// streams cannot be merged, since uncompressed offsets are derived from
+// the block size.
+//
+// The result describes a multistream file. Seeking readers continue
+// reading into the following members.
+func MergeMetadata(a, b GzipMetadata, aCompressedLen int64) (GzipMetadata, error) {
+	if err := checkVersion(&a); err != nil {
+		return GzipMetadata{}, err
+	}
+	if err := checkVersion(&b); err != nil {
+		return GzipMetadata{}, err
+	}
+	if a.Padding != 0 || b.Padding != 0 {
+		return GzipMetadata{}, errors.New("gzip: cannot merge metadata of padded streams")
+	}
+	if a.StreamOffset != 0 || b.StreamOffset != 0 {
+		return GzipMetadata{}, errors.New("gzip: cannot merge metadata with a StreamOffset")
+	}
+	if a.variableBlocks() || b.variableBlocks() {
+		return GzipMetadata{}, errors.New("gzip: cannot merge metadata with variable block sizes")
+	}
+	if a.BlockSize != b.BlockSize || a.BlockSize <= 0 {
+		return GzipMetadata{}, errors.New("gzip: cannot merge metadata with different block sizes")
+	}
+	if len(a.BlockData) < 2 || len(b.BlockData) < 2 {
+		return GzipMetadata{}, errors.New("gzip: cannot merge metadata without blocks")
+	}
+	if a.Size != int64(len(a.BlockData)-2)*int64(a.BlockSize) {
+		return GzipMetadata{}, errors.New("gzip: cannot merge metadata that does not end on a block boundary")
+	}
+	var aLen int64
+	for _, v := range a.BlockData {
+		aLen += int64(v)
+	}
+	gap := aCompressedLen - aLen
+	if gap < 8 {
+		return GzipMetadata{}, errors.New("gzip: compressed length too small for metadata")
+	}
+
+	// The empty last block of a, its trailer, the header of b and the
+	// first block of b form a single block in the merged index.
+	joined := int64(a.BlockData[len(a.BlockData)-1]) + gap + int64(b.BlockData[0]) + int64(b.BlockData[1])
+	if joined > math.MaxUint32 {
+		return GzipMetadata{}, errors.New("gzip: merged block too large")
+	}
+	blockData := make([]uint32, 0, len(a.BlockData)+len(b.BlockData)-2)
+	blockData = append(blockData, a.BlockData[:len(a.BlockData)-1]...)
+	blockData = append(blockData, uint32(joined))
+	blockData = append(blockData, b.BlockData[2:]...)
+	var blockCRC []uint32
+	if len(a.BlockCRC) == len(a.BlockData)-1 && len(b.BlockCRC) == len(b.BlockData)-1 {
+		// The joined block holds no data from a.
+		blockCRC = make([]uint32, 0, len(a.BlockCRC)+len(b.BlockCRC)-1)
+		blockCRC = append(blockCRC, a.BlockCRC[:len(a.BlockCRC)-1]...)
+		blockCRC = append(blockCRC, b.BlockCRC...)
+	}
+	out := GzipMetadata{
+		BlockSize: a.BlockSize,
+		Size:      a.Size + b.Size,
+		BlockData: blockData,
+		BlockCRC:  blockCRC,
+	}
+	out.Version = metadataVersion(&out)
+	return out, nil
+}
+
+// A SeekablePart is a seekable gzip stream and its metadata, as passed to
+// Concat.
+type SeekablePart struct {
+	R    io.Reader // the compressed stream
+	Meta GzipMetadata
+}
+
+// Concat writes the compressed streams of parts to dst one after another
+// and returns the metadata of the result, which is a seekable multistream
+// file, see MergeMetadata. The compressed data is copied verbatim, which
+// is much faster than decompressing and compressing it again.
+//
+// The parts must meet the requirements of MergeMetadata: all of them must
+// use the same block size, and all but the last must hold a multiple of
+// the block size bytes. Each part is read up to the end of its trailer as
+// given by its metadata; ErrInvalidMetadata is returned if it is shorter.
+func Concat(dst io.Writer, parts []SeekablePart) (GzipMetadata, error) {
+	if len(parts) == 0 {
+		return GzipMetadata{}, errors.New("gzip: no parts to concatenate")
+	}
+	// Check the metadata before writing anything.
+	merged := parts[0].Meta
+	lengths := make([]int64, len(parts))
+	for i, p := range parts {
+		for _, v := range p.Meta.BlockData {
+			lengths[i] += int64(v)
+		}
+		lengths[i] += 8
+		if i == 0 {
+			continue
+		}
+		var err error
+		if merged, err = MergeMetadata(merged, p.Meta, lengths[i-1]); err != nil {
+			return GzipMetadata{}, fmt.Errorf("%w (part %d)", err, i)
+		}
+		// Following merges see the merged stream as a whole.
+		lengths[i] += lengths[i-1]
+	}
+	var written int64
+	for i, p := range parts {
+		n, err := io.CopyN(dst, p.R, lengths[i]-written)
+		written += n
+		if err == io.EOF {
+			err = fmt.Errorf("%w: part %d is truncated", ErrInvalidMetadata, i)
+		}
+		if err != nil {
+			return GzipMetadata{}, err
+		}
+	}
+	return merged, nil
+}
+
+// DecompressedChecksum returns the CRC-32 of the entire uncompressed
+// content, including any Padding as the gzip trailer does, computed from
+// the per-block checksums in meta without decompressing anything. The
+// second result is false when meta carries no block checksums, in which
+// case the content must be decompressed to get its checksum.
+func DecompressedChecksum(meta *GzipMetadata) (uint32, bool) {
+	n := len(meta.BlockData) - 1
+	if n <= 0 || len(meta.BlockCRC) != n || meta.BlockSize <= 0 {
+		return 0, false
+	}
+	var crc uint32
+	for i, blockCRC := range meta.BlockCRC {
+		crc = crc32Combine(crc, blockCRC, blockLen(meta, i))
+	}
+	return crc, true
+}
+
+// crc32Combine returns the CRC-32 of two concatenated inputs given their
+// checksums and the length of the second input.
+// This is crc32_combine from zlib.
+func crc32Combine(crc1, crc2 uint32, len2 int64) uint32 {
+	if len2 <= 0 {
+		return crc1 ^ crc2
+	}
+	var even, odd [32]uint32
+
+	// Operator for one zero bit in odd.
+	odd[0] = 0xedb88320 // IEEE polynomial, reversed
+	row := uint32(1)
+	for n := 1; n < 32; n++ {
+		odd[n] = row
+		row <<= 1
+	}
+	gf2MatrixSquare(even[:], odd[:]) // two zero bits
+	gf2MatrixSquare(odd[:], even[:]) // four zero bits
+
+	// Apply len2 zero bytes to crc1.
+	for {
+		gf2MatrixSquare(even[:], odd[:])
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(even[:], crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+		gf2MatrixSquare(odd[:], even[:])
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(odd[:], crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+	}
+	return crc1 ^ crc2
+}
+
+func gf2MatrixTimes(mat []uint32, vec uint32) uint32 {
+	var sum uint32
+	for i := 0; vec != 0; i++ {
+		if vec&1 != 0 {
+			sum ^= mat[i]
+		}
+		vec >>= 1
+	}
+	return sum
+}
+
+func gf2MatrixSquare(square, mat []uint32) {
+	for n := range square {
+		square[n] = gf2MatrixTimes(mat, mat[n])
+	}
+}
+
+// BlockInfo describes one block of a stream.
+type BlockInfo struct {
+	Index              int   // index of the block, starting at 0
+	CompressedOffset   int64 // offset of the block in the compressed stream
+	CompressedLength   int64 // length of the compressed block in bytes
+	UncompressedOffset int64 // offset of the block's data in the uncompressed stream, at most Size
+	UncompressedLength int64 // length of the block's data; 0 for the final marker block
+}
+
+// NumBlocks returns the number of blocks described by m, including the
+// empty block that ends streams written by Writer.
+func (m *GzipMetadata) NumBlocks() int {
+	if len(m.BlockData) == 0 {
+		return 0
+	}
+	return len(m.BlockData) - 1
+}
+
+// BlockInfo returns the position of block i. Blocks follow each other
+// without gaps in both streams: block i starts right after block i-1, and
+// block 0 starts right after the header, whose length is BlockData[0].
+// Each block except the last ones holds BlockSize bytes of data, unless
+// the sizes vary and are recorded in BlockLens.
+func (m *GzipMetadata) BlockInfo(i int) (BlockInfo, error) {
+	if i < 0 || i >= m.NumBlocks() {
+		return BlockInfo{}, fmt.Errorf("gzip: block %d out of range [0, %d)", i, m.NumBlocks())
+	}
+	var off int64
+	for _, d := range m.BlockData[:i+1] {
+		off += int64(d)
+	}
+	uoff := int64(i) * int64(m.BlockSize)
+	if starts := uncompressedStarts(m); starts != nil {
+		uoff = starts[i]
+	}
+	if uoff > m.Size {
+		uoff = m.Size
+	}
+	return BlockInfo{
+		Index:              i,
+		CompressedOffset:   off,
+		CompressedLength:   int64(m.BlockData[i+1]),
+		UncompressedOffset: uoff,
+		UncompressedLength: blockLen(m, i),
+	}, nil
+}
+
+// BlocksForRange returns the first and last block holding data in the
+// uncompressed range [start, end), for splitting work along block
+// boundaries. end is clamped to Size. An error is returned if the range is
+// empty or start is not within the data.
+func (m GzipMetadata) BlocksForRange(start, end int64) (firstBlock, lastBlock int, err error) {
+	if m.NumBlocks() == 0 || (!m.variableBlocks() && m.BlockSize <= 0) {
+		return 0, 0, errors.New("gzip: metadata describes no blocks")
+	}
+	if end > m.Size {
+		end = m.Size
+	}
+	if start < 0 || start >= m.Size || end <= start {
+		return 0, 0, fmt.Errorf("gzip: range [%d, %d) outside of data of %d bytes", start, end, m.Size)
+	}
+	blockStarts := parseBlockData(m.BlockData, m.BlockSize)
+	ustarts := uncompressedStarts(&m)
+	firstBlock, _, _ = locateBlock(blockStarts, m.BlockSize, ustarts, start)
+	lastBlock, _, _ = locateBlock(blockStarts, m.BlockSize, ustarts, end-1)
+	return firstBlock, lastBlock, nil
+}
+
+// Coverage returns the fraction of the data that an entry of the index
+// covers on average: the average uncompressed size of the blocks holding
+// data, divided by Size. It is 1 for an index with a single entry, which
+// is as coarse as it gets, and approaches 0 as the index gets finer, so
+// that a Seek discards about Coverage()*Size/2 bytes on average. Compare
+// Coverage()*Size with SuggestBlockSize to decide whether to rebuild the
+// index with Downsample or a smaller block size. Coverage returns 0 for
+// metadata describing no data.
+func (m GzipMetadata) Coverage() float64 {
+	if m.Size <= 0 {
+		return 0
+	}
+	entries := 0
+	for i := 0; i < m.NumBlocks(); i++ {
+		if blockLen(&m, i) > 0 {
+			entries++
+		}
+	}
+	if entries == 0 {
+		return 0
+	}
+	return 1 / float64(entries)
+}
+
+// Rebase returns m with its compressed offsets delta bytes larger, as for
+// the stream moved delta bytes further into the file they count from: it
+// adds delta to BlockData[0] and to StreamOffset. m.Rebase(-m.StreamOffset)
+// returns metadata whose offsets count from the start of the stream, as
+// NewSeekingReaderOffset takes them, and m.Rebase(off) of such metadata
+// makes them count from the start of a file in which the stream starts at
+// off. Rebase panics if StreamOffset would become negative or BlockData[0]
+// would not fit its uint32, which limits offsets counting from an
+// enclosing file to streams starting within its first 4 GiB.
+func (m GzipMetadata) Rebase(delta int64) GzipMetadata {
+	if len(m.BlockData) == 0 {
+		panic("sgzip: Rebase of metadata without blocks")
+	}
+	first := int64(m.BlockData[0]) + delta
+	if m.StreamOffset+delta < 0 || first < 0 || first > math.MaxUint32 {
+		panic("sgzip: Rebase moves the offsets out of range")
+	}
+	m.BlockData = append([]uint32{uint32(first)}, m.BlockData[1:]...)
+	m.StreamOffset += delta
+	if m.StreamOffset != 0 && m.Version < 4 {
+		m.Version = 4
+	}
+	return m
+}
+
+// streamRelative returns meta with offsets counting from the start of the
+// stream, and the offset of the stream, see StreamOffset.
+// ErrInvalidMetadata is returned if StreamOffset is not before the first
+// block.
+func streamRelative(meta *GzipMetadata) (*GzipMetadata, int64, error) {
+	if meta.StreamOffset == 0 {
+		return meta, 0, nil
+	}
+	if meta.StreamOffset < 0 || len(meta.BlockData) == 0 || meta.StreamOffset > int64(meta.BlockData[0]) {
+		return nil, 0, fmt.Errorf("%w: StreamOffset %d is not before the first block", ErrInvalidMetadata, meta.StreamOffset)
+	}
+	rel := meta.Rebase(-meta.StreamOffset)
+	return &rel, meta.StreamOffset, nil
+}
+
+// uncompressedStarts returns the uncompressed offset of each block described
+// by meta followed by the end of the last block, or nil if the blocks hold
+// BlockSize bytes each.
+func uncompressedStarts(meta *GzipMetadata) []int64 {
+	if meta.UBlockData != nil {
+		return append(append(make([]int64, 0, len(meta.UBlockData)+1), meta.UBlockData...), meta.Size)
+	}
+	if meta.BlockLens == nil {
+		return nil
+	}
+	starts := make([]int64, len(meta.BlockLens)+1)
+	for i, n := range meta.BlockLens {
+		starts[i+1] = starts[i] + int64(n)
+	}
+	return starts
+}
+
+// variableBlocks reports whether the uncompressed sizes of the blocks
+// described by m are recorded rather than given by BlockSize.
+func (m *GzipMetadata) variableBlocks() bool {
+	return m.BlockLens != nil || m.UBlockData != nil
+}
+
+// checkUBlockData returns ErrInvalidMetadata if meta has UBlockData that
+// does not give a start for each block, beginning at 0 and increasing up
+// to Size.
+func checkUBlockData(meta *GzipMetadata) error {
+	if meta.UBlockData == nil {
+		return nil
+	}
+	if len(meta.UBlockData) != meta.NumBlocks() || len(meta.UBlockData) == 0 || meta.UBlockData[0] != 0 {
+		return fmt.Errorf("%w: UBlockData does not match the blocks", ErrInvalidMetadata)
+	}
+	prev := int64(0)
+	for i, off := range meta.UBlockData {
+		if off < prev || off > meta.Size {
+			return fmt.Errorf("%w: UBlockData entry %d out of order", ErrInvalidMetadata, i)
+		}
+		prev = off
+	}
+	return nil
+}
+
+// Downsample returns metadata for the same stream that records only every
+// factor-th block boundary, merging each run of factor blocks into one.
+// The result is about factor times smaller, at the cost of decompressing
+// and discarding up to factor times more data when seeking. The empty
+// block that ends the stream is kept as it is.
+//
+// m is returned unchanged if factor is less than 2, if m describes no
+// blocks, if it has Unindexed members or invalid UBlockData, or if the
+// merged blocks would be too large to describe.
+func (m GzipMetadata) Downsample(factor int) GzipMetadata {
+	n := m.NumBlocks() - 1 // blocks holding data
+	if factor < 2 || n < 1 || m.BlockSize <= 0 || len(m.Unindexed) > 0 || checkUBlockData(&m) != nil || int64(m.BlockSize)*int64(factor) > math.MaxInt32 {
+		return m
+	}
+	hasCRC := len(m.BlockCRC) == m.NumBlocks()
+	out := GzipMetadata{
+		Version:   m.Version,
+		BlockSize: m.BlockSize * factor,
+		Size:      m.Size,
+		BlockData: []uint32{m.BlockData[0]},
+		Padding:   m.Padding,
+	}
+	for i := 0; i < n; i += factor {
+		var data, length int64
+		var crc uint32
+		for j := i; j < i+factor && j < n; j++ {
+			data += int64(m.BlockData[j+1])
+			l := blockLen(&m, j)
+			length += l
+			if hasCRC {
+				crc = crc32Combine(crc, m.BlockCRC[j], l)
+			}
+		}
+		if data > math.MaxUint32 || (m.BlockLens != nil && length > math.MaxUint32) {
+			return m
+		}
+		out.BlockData = append(out.BlockData, uint32(data))
+		if m.UBlockData != nil {
+			out.UBlockData = append(out.UBlockData, m.UBlockData[i])
+		}
+		if hasCRC {
+			out.BlockCRC = append(out.BlockCRC, crc)
+		}
+		if m.BlockLens != nil {
+			out.BlockLens = append(out.BlockLens, uint32(length))
+		}
+	}
+	out.BlockData = append(out.BlockData, m.BlockData[n+1])
+	if hasCRC {
+		out.BlockCRC = append(out.BlockCRC, m.BlockCRC[n])
+	}
+	if m.BlockLens != nil {
+		out.BlockLens = append(out.BlockLens, uint32(blockLen(&m, n)))
+	}
+	if m.UBlockData != nil {
+		out.UBlockData = append(out.UBlockData, m.UBlockData[n])
+	}
+	return out
+}
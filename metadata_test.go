@@ -0,0 +1,435 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/flate"
+)
+
+func TestMergeMetadata(t *testing.T) {
+	inA, compA, metaA := testSeekableData(t, 4*16<<10, 16<<10)
+	inB, compB, metaB := testSeekableData(t, 100000, 16<<10)
+	merged, err := MergeMetadata(metaA, metaB, int64(len(compA)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.Size != int64(len(inA)+len(inB)) {
+		t.Errorf("Size = %d, want %d", merged.Size, len(inA)+len(inB))
+	}
+	in := append(append([]byte{}, inA...), inB...)
+	if crc, ok := DecompressedChecksum(&merged); !ok || crc != crc32.ChecksumIEEE(in) {
+		t.Errorf("DecompressedChecksum = %08x, %v, want %08x", crc, ok, crc32.ChecksumIEEE(in))
+	}
+	comp := append(append([]byte{}, compA...), compB...)
+
+	r, err := NewSeekingReader(bytes.NewReader(comp), &merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	// Seeking readers read on into the members the metadata covers.
+	for _, pos := range []int64{0, 10000, 90000, int64(len(inA)), int64(len(inA)) + 40000} {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			t.Fatalf("Seek(%d): %v", pos, err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("ReadAll after Seek(%d): %v", pos, err)
+		}
+		if !bytes.Equal(got, in[pos:]) {
+			t.Errorf("Seek(%d): got %d bytes, want %d", pos, len(got), len(in)-int(pos))
+		}
+	}
+	rr, err := NewRandomReader(bytes.NewReader(comp), &merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rr.Close()
+	var buf bytes.Buffer
+	if n, err := io.Copy(&buf, rr); err != nil || !bytes.Equal(buf.Bytes(), in) {
+		t.Errorf("NewRandomReader: copied %d bytes, %v, want %d", n, err, len(in))
+	}
+
+	if _, err := MergeMetadata(metaB, metaA, int64(len(compB))); err == nil {
+		t.Error("expected error when first stream does not end on a block boundary")
+	}
+	metaA.BlockSize *= 2
+	if _, err := MergeMetadata(metaA, metaB, int64(len(compA))); err == nil {
+		t.Error("expected error for different block sizes")
+	}
+}
+
+func TestConcatSeekable(t *testing.T) {
+	var in []byte
+	var parts []SeekablePart
+	for _, size := range []int{2 * 16 << 10, 5 * 16 << 10, 30000} {
+		data, comp, meta := testSeekableData(t, size, 16<<10)
+		in = append(in, data...)
+		parts = append(parts, SeekablePart{R: bytes.NewReader(comp), Meta: meta})
+	}
+	var dst bytes.Buffer
+	meta, err := Concat(&dst, parts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Size != int64(len(in)) {
+		t.Errorf("Size = %d, want %d", meta.Size, len(in))
+	}
+	r, err := NewSeekingReader(bytes.NewReader(dst.Bytes()), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for _, pos := range []int64{0, 2*16<<10 - 5, 7 * 16 << 10, int64(len(in)) - 1} {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			t.Fatalf("Seek(%d): %v", pos, err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("ReadAll after Seek(%d): %v", pos, err)
+		}
+		if !bytes.Equal(got, in[pos:]) {
+			t.Errorf("Seek(%d): content does not match", pos)
+		}
+	}
+
+	parts[0], parts[2] = parts[2], parts[0]
+	if _, err := Concat(ioutil.Discard, parts); err == nil {
+		t.Error("expected error for a part not ending on a block boundary")
+	}
+	_, comp, m := testSeekableData(t, 16<<10, 16<<10)
+	parts = []SeekablePart{{bytes.NewReader(comp[:len(comp)-1]), m}, {bytes.NewReader(comp), m}}
+	if _, err := Concat(ioutil.Discard, parts); !errors.Is(err, ErrInvalidMetadata) {
+		t.Errorf("truncated part: got %v, want ErrInvalidMetadata", err)
+	}
+}
+
+func TestDecompressedChecksum(t *testing.T) {
+	for _, size := range []int{0, 1000, 64 << 10, 300000} {
+		in, _, meta := testSeekableData(t, size, 16<<10)
+		crc, ok := DecompressedChecksum(&meta)
+		if !ok {
+			t.Fatalf("size %d: no block checksums", size)
+		}
+		if want := crc32.ChecksumIEEE(in); crc != want {
+			t.Errorf("size %d: got %08x, want %08x", size, crc, want)
+		}
+		meta.BlockCRC = nil
+		if _, ok := DecompressedChecksum(&meta); ok {
+			t.Errorf("size %d: expected no checksum without block checksums", size)
+		}
+	}
+}
+
+func TestMetadataVersion(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 100000, 16<<10)
+	// Version 2 is only used for padded streams.
+	if meta.Version != 1 {
+		t.Errorf("Version = %d, want 1", meta.Version)
+	}
+	// Blocks of varying size need version 5, older versions ignore BlockLens.
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if _, err := w.WriteBlock(in[:1000]); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if v := w.MetaData().Version; v != 5 {
+		t.Errorf("Version with BlockLens = %d, want 5", v)
+	}
+	// Explicit uncompressed offsets need version 3.
+	ublocks := meta
+	ublocks.UBlockData = make([]int64, meta.NumBlocks())
+	for i := range ublocks.UBlockData {
+		ublocks.UBlockData[i] = int64(i) * int64(meta.BlockSize)
+	}
+	if v := metadataVersion(&ublocks); v != 3 {
+		t.Errorf("Version with UBlockData = %d, want 3", v)
+	}
+	if v := metadataVersion(&GzipMetadata{UBlockData: ublocks.UBlockData, StreamOffset: 10}); v != 4 {
+		t.Errorf("Version with UBlockData and StreamOffset = %d, want 4", v)
+	}
+
+	legacy := meta
+	legacy.Version = 0
+	got, err := ReadRange(bytes.NewReader(compressed), &legacy, 0, 1000)
+	if err != nil || !bytes.Equal(got, in[:1000]) {
+		t.Errorf("legacy metadata: %v", err)
+	}
+
+	future := meta
+	future.Version = MetadataVersion + 1
+	if _, err := NewSeekingReader(bytes.NewReader(compressed), &future); !errors.Is(err, ErrUnsupportedMetadataVersion) {
+		t.Errorf("NewSeekingReader: got %v", err)
+	}
+	if _, err := ReadRange(bytes.NewReader(compressed), &future, 0, 1000); !errors.Is(err, ErrUnsupportedMetadataVersion) {
+		t.Errorf("ReadRange: got %v", err)
+	}
+	if err := Verify(bytes.NewReader(compressed), &future); !errors.Is(err, ErrUnsupportedMetadataVersion) {
+		t.Errorf("Verify: got %v", err)
+	}
+}
+
+func TestBlockInfo(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 100000, 16<<10)
+	if n := meta.NumBlocks(); n != 8 {
+		t.Fatalf("NumBlocks = %d, want 8", n)
+	}
+	var total int64
+	for i := 0; i < meta.NumBlocks(); i++ {
+		bi, err := meta.BlockInfo(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		comp := compressed[bi.CompressedOffset : bi.CompressedOffset+bi.CompressedLength]
+		data, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(comp)))
+		if err != nil && err != io.ErrUnexpectedEOF {
+			t.Fatal(err)
+		}
+		if int64(len(data)) != bi.UncompressedLength || !bytes.Equal(data, in[bi.UncompressedOffset:bi.UncompressedOffset+bi.UncompressedLength]) {
+			t.Errorf("block %d does not match its data", i)
+		}
+		total += bi.UncompressedLength
+	}
+	if total != int64(len(in)) {
+		t.Errorf("blocks hold %d bytes, want %d", total, len(in))
+	}
+	if _, err := meta.BlockInfo(meta.NumBlocks()); err == nil {
+		t.Error("expected error for out of range block")
+	}
+}
+
+func TestBlocksForRange(t *testing.T) {
+	_, _, meta := testSeekableData(t, 100000, 16<<10)
+	tests := []struct {
+		start, end  int64
+		first, last int
+	}{
+		{0, 1, 0, 0},
+		{0, 16 << 10, 0, 0},
+		{16<<10 - 1, 16<<10 + 1, 0, 1},
+		{16 << 10, 200000, 1, 6},
+		{99999, 100000, 6, 6},
+	}
+	for _, tt := range tests {
+		first, last, err := meta.BlocksForRange(tt.start, tt.end)
+		if err != nil || first != tt.first || last != tt.last {
+			t.Errorf("BlocksForRange(%d, %d) = %d, %d, %v, want %d, %d", tt.start, tt.end, first, last, err, tt.first, tt.last)
+		}
+	}
+	for _, r := range [][2]int64{{100000, 100001}, {-1, 10}, {500, 500}} {
+		if _, _, err := meta.BlocksForRange(r[0], r[1]); err == nil {
+			t.Errorf("BlocksForRange(%d, %d): expected error", r[0], r[1])
+		}
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	_, _, meta := testSeekableData(t, 100000, 16<<10)
+	// 6 full blocks and one of 1696 bytes.
+	if got := meta.Coverage(); got != 1.0/7 {
+		t.Errorf("Coverage = %v, want 1/7", got)
+	}
+	if got := meta.Downsample(4).Coverage(); got != 1.0/2 {
+		t.Errorf("Coverage after Downsample(4) = %v, want 1/2", got)
+	}
+	if got := meta.Downsample(100).Coverage(); got != 1 {
+		t.Errorf("Coverage of a single block = %v, want 1", got)
+	}
+	var empty bytes.Buffer
+	w := NewWriter(&empty)
+	w.Close()
+	if got := w.MetaData().Coverage(); got != 0 {
+		t.Errorf("Coverage without data = %v, want 0", got)
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 300000, 16<<10)
+	if got := meta.Downsample(1); !reflect.DeepEqual(got, meta) {
+		t.Error("Downsample(1) changed the metadata")
+	}
+	for _, factor := range []int{2, 4, 19, 100} {
+		small := meta.Downsample(factor)
+		want := (meta.NumBlocks()-1+factor-1)/factor + 1
+		if small.NumBlocks() != want {
+			t.Errorf("factor %d: NumBlocks = %d, want %d", factor, small.NumBlocks(), want)
+		}
+		if small.BlockSize != meta.BlockSize*factor {
+			t.Errorf("factor %d: BlockSize = %d, want %d", factor, small.BlockSize, meta.BlockSize*factor)
+		}
+		comp := bytes.NewReader(compressed)
+		if err := Verify(comp, &small); err != nil {
+			t.Fatalf("factor %d: Verify: %v", factor, err)
+		}
+		r, err := NewSeekingReader(comp, &small)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, pos := range []int64{0, 16 << 10, 100000, int64(len(in)) - 1} {
+			if _, err := r.Seek(pos, io.SeekStart); err != nil {
+				t.Fatalf("factor %d: Seek(%d): %v", factor, pos, err)
+			}
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("factor %d: ReadAll after Seek(%d): %v", factor, pos, err)
+			}
+			if !bytes.Equal(got, in[pos:]) {
+				t.Errorf("factor %d: Seek(%d): content does not match", factor, pos)
+			}
+		}
+		r.Close()
+	}
+}
+
+func TestUBlockData(t *testing.T) {
+	// Blocks of varying size, as written with WriteBlock.
+	var in []byte
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetConcurrency(64<<10, 2)
+	var starts []int64
+	for i, n := range []int{1000, 50000, 7, 64 << 10, 30000} {
+		block := bytes.Repeat([]byte{byte('a' + i)}, n)
+		starts = append(starts, int64(len(in)))
+		in = append(in, block...)
+		if _, err := w.WriteBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	meta := w.MetaData()
+	meta.Version = MetadataVersion
+	meta.BlockLens = nil
+	meta.BlockSize = 0
+	meta.UBlockData = append(starts, int64(len(in)))
+
+	r, err := NewSeekingReader(bytes.NewReader(buf.Bytes()), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pos := range []int64{0, 999, 1000, 51003, 51007, int64(len(in)) - 1} {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil || !bytes.Equal(got, in[pos:]) {
+			t.Errorf("Seek(%d): got %d bytes, %v", pos, len(got), err)
+		}
+	}
+	var sizes []int
+	if err := r.ForEachBlock(func(i int, data []byte) error {
+		sizes = append(sizes, len(data))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{1000, 50000, 7, 64 << 10, 30000}; !reflect.DeepEqual(sizes, want) {
+		t.Errorf("ForEachBlock sizes = %v, want %v", sizes, want)
+	}
+	r.Close()
+	if bi, err := meta.BlockInfo(3); err != nil || bi.UncompressedOffset != 51007 || bi.UncompressedLength != 64<<10 {
+		t.Errorf("BlockInfo(3) = %+v, %v", bi, err)
+	}
+	if err := Verify(bytes.NewReader(buf.Bytes()), &meta); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+
+	// The binary index stores the offsets as block sizes.
+	var idx bytes.Buffer
+	if err := EncodeIndex(&idx, &meta); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeIndex(&idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := uncompressedStarts(&decoded); !reflect.DeepEqual(got[:len(got)-1], meta.UBlockData) {
+		t.Errorf("decoded starts = %v, want %v", got, meta.UBlockData)
+	}
+
+	bad := meta
+	bad.UBlockData = []int64{0, 2000, 1000, 60000, 70000, int64(len(in))}
+	if _, err := NewSeekingReader(bytes.NewReader(buf.Bytes()), &bad); !errors.Is(err, ErrInvalidMetadata) {
+		t.Errorf("decreasing offsets: got %v, want ErrInvalidMetadata", err)
+	}
+	bad.UBlockData = meta.UBlockData[:3]
+	if _, err := NewSeekingReader(bytes.NewReader(buf.Bytes()), &bad); !errors.Is(err, ErrInvalidMetadata) {
+		t.Errorf("too few offsets: got %v, want ErrInvalidMetadata", err)
+	}
+}
+
+func TestStreamOffset(t *testing.T) {
+	in, comp, meta := testSeekableData(t, 200000, 16<<10)
+	// The stream starts 1000 bytes into a file, which starts 500 bytes
+	// into a container.
+	prefix := bytes.Repeat([]byte{'x'}, 1000)
+	file := append(append(append([]byte(nil), prefix...), comp...), "trailing"...)
+	container := append(append(bytes.Repeat([]byte{'y'}, 500), file...), "more"...)
+
+	abs := meta.Rebase(1000)
+	if abs.StreamOffset != 1000 || abs.BlockData[0] != meta.BlockData[0]+1000 || abs.Version != 4 {
+		t.Fatalf("Rebase(1000): StreamOffset %d, BlockData[0] %d, Version %d", abs.StreamOffset, abs.BlockData[0], abs.Version)
+	}
+	if meta.StreamOffset != 0 || abs.BlockData[1] != meta.BlockData[1] {
+		t.Error("Rebase changed the original")
+	}
+	if back := abs.Rebase(-abs.StreamOffset); !reflect.DeepEqual(back.BlockData, meta.BlockData) || back.StreamOffset != 0 {
+		t.Errorf("Rebase back: got %v, %d", back.BlockData[:2], back.StreamOffset)
+	}
+	info, _ := abs.BlockInfo(3)
+	rel, _ := meta.BlockInfo(3)
+	if info.CompressedOffset != rel.CompressedOffset+1000 {
+		t.Errorf("block 3 at %d, want %d", info.CompressedOffset, rel.CompressedOffset+1000)
+	}
+
+	check := func(name string, r *Reader, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		defer r.Close()
+		if _, err := r.Seek(100000, io.SeekStart); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil || !bytes.Equal(got, in[100000:]) {
+			t.Errorf("%s: got %d bytes, %v", name, len(got), err)
+		}
+	}
+	r, err := NewSeekingReaderOffset(bytes.NewReader(file), &meta, 1000)
+	check("relative, NewSeekingReaderOffset", r, err)
+	r, err = NewSeekingReader(bytes.NewReader(file), &abs)
+	check("absolute, NewSeekingReader", r, err)
+	r, err = NewSeekingReaderOffset(bytes.NewReader(container), &abs, 500)
+	check("absolute, NewSeekingReaderOffset", r, err)
+	r, err = NewRandomReader(bytes.NewReader(file), &abs)
+	check("absolute, NewRandomReader", r, err)
+
+	// Functions reading blocks at their offsets read the file.
+	if got, err := ReadRange(bytes.NewReader(file), &abs, 50000, 60000); err != nil || !bytes.Equal(got, in[50000:60000]) {
+		t.Errorf("ReadRange: got %d bytes, %v", len(got), err)
+	}
+	if err := Verify(bytes.NewReader(file), &abs); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+
+	bad := abs
+	bad.StreamOffset = int64(bad.BlockData[0]) + 1
+	if _, err := NewSeekingReader(bytes.NewReader(file), &bad); !errors.Is(err, ErrInvalidMetadata) {
+		t.Errorf("StreamOffset after the first block: got %v, want ErrInvalidMetadata", err)
+	}
+	if err := EncodeIndex(ioutil.Discard, &abs); err == nil {
+		t.Error("EncodeIndex with a StreamOffset: no error")
+	}
+}
@@ -0,0 +1,64 @@
+package sgzip
+
+import (
+	"errors"
+	"io"
+)
+
+// maxNestedLevels is the number of layers NewNestedReader peels at most
+// when it detects them.
+const maxNestedLevels = 8
+
+// NewNestedReader returns a Reader for data compressed with gzip more than
+// once, as some pipelines do, which reads the innermost content. It peels
+// levels layers of gzip from r, or, if levels is 0 or less, as many layers
+// as it finds, up to 8: each layer whose decompressed data starts with a
+// valid gzip header is read as gzip again. With levels 1 it is NewReader.
+//
+// The returned Reader reads the innermost layer, and its Header is that
+// of the innermost stream. The checksums of all layers are verified as
+// the data is read; an error in an outer layer is returned by Read like
+// one of the innermost layer. Close also closes the Readers of the outer
+// layers, and Reset drops them.
+//
+// The returned Reader cannot seek, since no metadata describes the inner
+// layers, whose offsets are offsets in the data of the layer around them.
+// Seeking needs an index of every layer: open the outermost layer with
+// NewSeekingReader, index the layer it reads with RebuildIndex, and open
+// that layer with NewSeekingReader over the Reader of the outer one.
+func NewNestedReader(r io.Reader, levels int) (*Reader, error) {
+	z, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	for depth := 1; ; depth++ {
+		if levels > 0 && depth >= levels {
+			return z, nil
+		}
+		if levels <= 0 && (depth >= maxNestedLevels || !z.startsWithHeader()) {
+			return z, nil
+		}
+		inner, err := NewReader(z)
+		if err != nil {
+			z.Close()
+			return nil, err
+		}
+		inner.outer = z
+		z = inner
+	}
+}
+
+// startsWithHeader reports whether the data at the current position of z
+// starts with a gzip header, or what may be one if it continues after the
+// current block. It decompresses the first block if needed, without
+// consuming any data. A read error is left to be returned by the next
+// Read.
+func (z *Reader) startsWithHeader() bool {
+	if len(z.current) == 0 && !z.lastBlock && z.err == nil {
+		if err := z.nextBlock(); err != nil {
+			return false
+		}
+	}
+	_, _, err := ParseHeaderStrict(z.current[z.roff:])
+	return err == nil || (errors.Is(err, io.ErrUnexpectedEOF) && !z.lastBlock)
+}
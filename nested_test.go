@@ -0,0 +1,109 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+// gzipLayers compresses data n times.
+func gzipLayers(t *testing.T, data []byte, n int) []byte {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.Name = "layer"
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data = buf.Bytes()
+	}
+	return data
+}
+
+func TestNestedReader(t *testing.T) {
+	in := levelTestData(500000)
+	tests := []struct {
+		layers, levels int
+		want           []byte
+	}{
+		{1, 0, in},
+		{2, 0, in},
+		{3, 0, in},
+		{3, 3, in},
+		{3, 2, gzipLayers(t, in, 1)},
+		{2, 1, gzipLayers(t, in, 1)},
+		{1, 1, in},
+	}
+	for _, tt := range tests {
+		comp := gzipLayers(t, in, tt.layers)
+		r, err := NewNestedReader(bytes.NewReader(comp), tt.levels)
+		if err != nil {
+			t.Fatalf("%d layers, levels %d: %v", tt.layers, tt.levels, err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil || !bytes.Equal(got, tt.want) {
+			t.Errorf("%d layers, levels %d: got %d bytes, %v, want %d", tt.layers, tt.levels, len(got), err, len(tt.want))
+		}
+		if err := r.Close(); err != nil {
+			t.Errorf("%d layers, levels %d: Close: %v", tt.layers, tt.levels, err)
+		}
+		if err := r.Close(); err != nil {
+			t.Errorf("%d layers, levels %d: second Close: %v", tt.layers, tt.levels, err)
+		}
+	}
+
+	// WriteTo reads the first block the detection decompressed.
+	r, err := NewNestedReader(bytes.NewReader(gzipLayers(t, in, 2)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil || !bytes.Equal(buf.Bytes(), in) {
+		t.Errorf("WriteTo: got %d bytes, %v", buf.Len(), err)
+	}
+
+	// Reset drops the outer layers.
+	if err := r.Reset(bytes.NewReader(gzipLayers(t, in, 1))); err != nil {
+		t.Fatal(err)
+	}
+	if r.outer != nil {
+		t.Error("Reset kept the outer layer")
+	}
+	if got, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(got, in) {
+		t.Errorf("after Reset: got %d bytes, %v", len(got), err)
+	}
+	r.Close()
+
+	// More levels than there are layers.
+	if _, err := NewNestedReader(bytes.NewReader(gzipLayers(t, in, 2)), 3); err != ErrHeader {
+		t.Errorf("3 levels of 2 layers: got %v, want ErrHeader", err)
+	}
+
+	// A damaged outer trailer is reported.
+	comp := gzipLayers(t, in, 2)
+	comp[len(comp)-6]++
+	r, err = NewNestedReader(bytes.NewReader(comp), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadAll(r); !errors.Is(err, ErrChecksum) || !bytes.Equal(got, in) {
+		t.Errorf("damaged outer trailer: got %d bytes, %v, want ErrChecksum", len(got), err)
+	}
+	r.Close()
+
+	// Data that starts like a gzip header but is not one.
+	fake := append([]byte{gzipID1, gzipID2, gzipDeflate}, in[:1000]...)
+	r, err = NewNestedReader(bytes.NewReader(gzipLayers(t, fake, 1)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(got, fake) {
+		t.Errorf("fake inner header: got %d bytes, %v, want %d", len(got), err, len(fake))
+	}
+	r.Close()
+}
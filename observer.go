@@ -0,0 +1,27 @@
+package sgzip
+
+// SetBlockObserver sets a function that is called with each block of
+// decompressed data as the Reader takes it up, before its data is returned
+// by Read, WriteTo or Stream, so that an aggregate such as the positions
+// of newlines can be computed in the same decompression pass. offset is
+// the position of block in the uncompressed stream, as returned by Seek.
+//
+// Blocks are passed in order and cover the data from the current position
+// without gaps, including data that Read has not returned yet when the
+// caller stops early. After a Seek, blocks start at the new position, so
+// data may be observed again after seeking backward. The blocks are the
+// buffers of the Reader: block is only valid until fn returns and must
+// not be modified. fn is called from the goroutine calling Read or
+// WriteTo. A nil fn removes the observer. The setting is kept across
+// calls to Reset.
+func (z *Reader) SetBlockObserver(fn func(offset int64, block []byte)) {
+	z.observer = fn
+}
+
+// observeBlock passes the unread part of the current block to the block
+// observer.
+func (z *Reader) observeBlock() {
+	if z.observer != nil && z.roff < len(z.current) {
+		z.observer(z.pos-z.origin, z.current[z.roff:])
+	}
+}
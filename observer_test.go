@@ -0,0 +1,87 @@
+package sgzip
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestSetBlockObserver(t *testing.T) {
+	var in bytes.Buffer
+	for i := 0; in.Len() < 300000; i++ {
+		fmt.Fprintf(&in, "line %d\n", i)
+	}
+	var comp bytes.Buffer
+	w := NewWriter(&comp)
+	w.SetConcurrency(32<<10, 4)
+	w.Write(in.Bytes())
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	meta := w.MetaData()
+	wantLines := bytes.Count(in.Bytes(), []byte("\n"))
+
+	var seen bytes.Buffer
+	var lines int
+	observe := func(t *testing.T) func(int64, []byte) {
+		seen.Reset()
+		lines = 0
+		return func(offset int64, block []byte) {
+			if offset != int64(seen.Len()) {
+				t.Fatalf("block at %d, want %d", offset, seen.Len())
+			}
+			seen.Write(block)
+			lines += bytes.Count(block, []byte("\n"))
+		}
+	}
+	read := map[string]func(r *Reader) error{
+		"WriteTo": func(r *Reader) error {
+			_, err := r.WriteTo(ioutil.Discard)
+			return err
+		},
+		"Read": func(r *Reader) error {
+			_, err := io.CopyBuffer(struct{ io.Writer }{ioutil.Discard}, struct{ io.Reader }{r}, make([]byte, 1000))
+			return err
+		},
+		"WriteToBuffer": func(r *Reader) error {
+			_, err := r.WriteToBuffer(ioutil.Discard, make([]byte, 4096))
+			return err
+		},
+	}
+	for name, fn := range read {
+		t.Run(name, func(t *testing.T) {
+			r, err := NewReader(bytes.NewReader(comp.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			r.SetBlockObserver(observe(t))
+			if err := fn(r); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(seen.Bytes(), in.Bytes()) || lines != wantLines {
+				t.Errorf("observed %d bytes and %d lines, want %d and %d", seen.Len(), lines, in.Len(), wantLines)
+			}
+		})
+	}
+
+	// After a Seek, blocks start at the new position.
+	r, err := NewSeekingReader(bytes.NewReader(comp.Bytes()), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	fn := observe(t)
+	r.SetBlockObserver(func(offset int64, block []byte) { fn(offset-100000, block) })
+	if _, err := r.Seek(100000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.WriteTo(ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(seen.Bytes(), in.Bytes()[100000:]) {
+		t.Errorf("after Seek: observed %d bytes, want %d", seen.Len(), in.Len()-100000)
+	}
+}
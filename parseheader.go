@@ -0,0 +1,144 @@
+package sgzip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// maxHeaderLen is the length of the longest header accepted by Reader:
+// the fixed fields, an FEXTRA field of 65535 bytes, a name and a comment
+// of 511 bytes each with their NUL and the header checksum.
+const maxHeaderLen = 10 + 2 + 65535 + 512 + 512 + 2
+
+// A HeaderError reports an invalid or incomplete header found by
+// ParseHeaderStrict.
+type HeaderError struct {
+	Offset int    // offset in the input at which the header is invalid
+	Reason string // what is wrong with the header
+	Err    error  // ErrHeader, or io.ErrUnexpectedEOF if the input ends early
+}
+
+func (e *HeaderError) Error() string {
+	return fmt.Sprintf("gzip: invalid header at offset %d: %s", e.Offset, e.Reason)
+}
+
+func (e *HeaderError) Unwrap() error { return e.Err }
+
+// ParseHeaderStrict parses the gzip header at the start of b and returns
+// its fields and its length, so that the deflate data starts at b[n:].
+// It accepts the headers a Reader created with SetStrict(true) accepts,
+// with the same results, but works on a slice and checks every length
+// against it, so it can be used on untrusted input without reading from
+// a stream. It never panics, and does not call the handlers registered
+// with RegisterSubfield.
+//
+// Errors are of type *HeaderError. They match ErrHeader with errors.Is
+// for an invalid header, and io.ErrUnexpectedEOF if b ends before the
+// header does, in which case a longer b may hold a valid header; no header
+// is longer than 66573 bytes.
+func ParseHeaderStrict(b []byte) (Header, int, error) {
+	var h Header
+	fail := func(off int, reason string) (Header, int, error) {
+		return Header{}, 0, &HeaderError{Offset: off, Reason: reason, Err: ErrHeader}
+	}
+	short := func(reason string) (Header, int, error) {
+		return Header{}, 0, &HeaderError{Offset: len(b), Reason: reason, Err: io.ErrUnexpectedEOF}
+	}
+	if len(b) < 10 {
+		return short("truncated fixed fields")
+	}
+	if b[0] != gzipID1 || b[1] != gzipID2 {
+		return fail(0, "bad magic")
+	}
+	if b[2] != gzipDeflate {
+		return fail(2, "unknown compression method")
+	}
+	flg := b[3]
+	if flg&flagReserved != 0 {
+		return fail(3, "reserved flags set")
+	}
+	if t := binary.LittleEndian.Uint32(b[4:8]); t > 0 {
+		h.ModTime = time.Unix(int64(t), 0)
+	}
+	h.OS = b[9]
+	h.Text = flg&flagText != 0
+	h.HeaderCRC = flg&flagHdrCrc != 0
+	n := 10
+
+	if flg&flagExtra != 0 {
+		if len(b)-n < 2 {
+			return short("truncated extra length")
+		}
+		xlen := int(binary.LittleEndian.Uint16(b[n : n+2]))
+		n += 2
+		if len(b)-n < xlen {
+			return short("truncated extra field")
+		}
+		h.Extra = append(make([]byte, 0, xlen), b[n:n+xlen]...)
+		n += xlen
+	}
+	if flg&flagName != 0 {
+		s, l, ok := headerString(b[n:])
+		if !ok {
+			if l < 0 {
+				return short("unterminated name")
+			}
+			return fail(n+l, "name too long")
+		}
+		h.Name = s
+		n += l
+	}
+	if flg&flagComment != 0 {
+		s, l, ok := headerString(b[n:])
+		if !ok {
+			if l < 0 {
+				return short("unterminated comment")
+			}
+			return fail(n+l, "comment too long")
+		}
+		h.Comment = s
+		n += l
+	}
+	if flg&flagHdrCrc != 0 {
+		if len(b)-n < 2 {
+			return short("truncated header checksum")
+		}
+		want := uint32(binary.LittleEndian.Uint16(b[n : n+2]))
+		if crc32.ChecksumIEEE(b[:n])&0xffff != want {
+			return fail(n, "header checksum mismatch")
+		}
+		n += 2
+	}
+	return h, n, nil
+}
+
+// headerString decodes the NUL-terminated Latin-1 string at the start of
+// b and returns it with its length including the NUL. If it is not
+// terminated, ok is false and l is -1 if b ends first, or the offset at
+// which it exceeds the length accepted by Reader.
+func headerString(b []byte) (s string, l int, ok bool) {
+	const limit = 512 // the length of z.buf in readString
+	for i := 0; i < len(b); i++ {
+		if i >= limit {
+			return "", i, false
+		}
+		if b[i] != 0 {
+			continue
+		}
+		raw := b[:i]
+		for _, c := range raw {
+			if c > 0x7f {
+				r := make([]rune, len(raw))
+				for j, c := range raw {
+					r[j] = rune(c)
+				}
+				return string(r), i + 1, true
+			}
+		}
+		return string(raw), i + 1, true
+	}
+	return "", -1, false
+}
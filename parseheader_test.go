@@ -0,0 +1,143 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildHeader returns a header with the given flags and optional fields,
+// with a header checksum if flg has FHCRC set.
+func buildHeader(flg byte, extra []byte, name, comment string) []byte {
+	hdr := []byte{gzipID1, gzipID2, gzipDeflate, flg, 0x78, 0x56, 0x34, 0x12, 0, 3}
+	if flg&flagExtra != 0 {
+		hdr = append(hdr, byte(len(extra)), byte(len(extra)>>8))
+		hdr = append(hdr, extra...)
+	}
+	if flg&flagName != 0 {
+		hdr = append(append(hdr, name...), 0)
+	}
+	if flg&flagComment != 0 {
+		hdr = append(append(hdr, comment...), 0)
+	}
+	if flg&flagHdrCrc != 0 {
+		sum := crc32.ChecksumIEEE(hdr)
+		hdr = append(hdr, byte(sum), byte(sum>>8))
+	}
+	return hdr
+}
+
+func TestParseHeaderStrict(t *testing.T) {
+	all := byte(flagText | flagHdrCrc | flagExtra | flagName | flagComment)
+	hdr := buildHeader(all, []byte("AB\x02\x00xy"), "caf\xe9.txt", "a comment")
+	body := append(append([]byte(nil), hdr...), 0x03, 0x00)
+	h, n, err := ParseHeaderStrict(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(hdr) {
+		t.Errorf("got length %d, want %d", n, len(hdr))
+	}
+	want := Header{
+		Comment:   "a comment",
+		Extra:     []byte("AB\x02\x00xy"),
+		ModTime:   time.Unix(0x12345678, 0),
+		Name:      "café.txt",
+		OS:        3,
+		Text:      true,
+		HeaderCRC: true,
+	}
+	if !reflect.DeepEqual(h, want) {
+		t.Errorf("got %+v, want %+v", h, want)
+	}
+	if rh, err := ReadHeader(bytes.NewReader(body)); err != nil || !reflect.DeepEqual(rh, h) {
+		t.Errorf("ReadHeader: got %+v, %v", rh, err)
+	}
+
+	// Every prefix is incomplete.
+	for i := 0; i < len(hdr); i++ {
+		_, _, err := ParseHeaderStrict(hdr[:i])
+		var he *HeaderError
+		if !errors.As(err, &he) || !errors.Is(err, io.ErrUnexpectedEOF) || he.Offset != i {
+			t.Fatalf("prefix of %d bytes: got %v", i, err)
+		}
+	}
+
+	bad := map[string]struct {
+		hdr []byte
+		off int
+	}{
+		"magic":    {append([]byte{0x1f, 0x8c}, hdr[2:]...), 0},
+		"method":   {append([]byte{0x1f, 0x8b, 7}, hdr[3:]...), 2},
+		"reserved": {buildHeader(0x20, nil, "", ""), 3},
+		"checksum": {append(hdr[:len(hdr)-1:len(hdr)-1], hdr[len(hdr)-1]+1), len(hdr) - 2},
+		"name":     {buildHeader(flagName, nil, strings.Repeat("n", 600), ""), 10 + 512},
+		"comment":  {buildHeader(flagName|flagComment, nil, "n", strings.Repeat("c", 512)), 12 + 512},
+	}
+	for name, tt := range bad {
+		_, n, err := ParseHeaderStrict(tt.hdr)
+		var he *HeaderError
+		if !errors.As(err, &he) || !errors.Is(err, ErrHeader) || n != 0 {
+			t.Errorf("%s: got %d, %v, want ErrHeader", name, n, err)
+			continue
+		}
+		if he.Offset != tt.off {
+			t.Errorf("%s: got offset %d, want %d", name, he.Offset, tt.off)
+		}
+	}
+
+	// The longest strings accepted by Reader are accepted.
+	long := buildHeader(flagName, nil, strings.Repeat("n", 511), "")
+	if _, n, err := ParseHeaderStrict(long); err != nil || n != len(long) {
+		t.Errorf("name of 511 bytes: got %d, %v", n, err)
+	}
+	if _, err := ReadHeader(bytes.NewReader(long)); err != nil {
+		t.Errorf("name of 511 bytes: ReadHeader: %v", err)
+	}
+}
+
+func FuzzParseHeader(f *testing.F) {
+	for _, tt := range gunzipTests {
+		f.Add(tt.gzip)
+	}
+	all := byte(flagText | flagHdrCrc | flagExtra | flagName | flagComment)
+	f.Add(buildHeader(all, []byte("AB\x02\x00xy"), "caf\xe9.txt", "a comment"))
+	f.Add(buildHeader(flagExtra, make([]byte, 300), "", ""))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		h, n, err := ParseHeaderStrict(b)
+		if err != nil {
+			var he *HeaderError
+			if !errors.As(err, &he) || n != 0 {
+				t.Fatalf("got %d, %v", n, err)
+			}
+			if !errors.Is(err, ErrHeader) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			z := &Reader{bufr: bytes.NewReader(b), digest: crc32.NewIEEE(), strict: true}
+			if z.parseHeader(true) == nil {
+				t.Fatalf("Reader accepts the header: %v", err)
+			}
+			return
+		}
+		if n < 10 || n > len(b) || n > maxHeaderLen {
+			t.Fatalf("got length %d of %d bytes", n, len(b))
+		}
+		// A strict Reader reads the same header.
+		r := bytes.NewReader(b)
+		z := &Reader{bufr: r, digest: crc32.NewIEEE(), strict: true}
+		if err := z.parseHeader(true); err != nil {
+			t.Fatalf("Reader rejects the header: %v", err)
+		}
+		if !reflect.DeepEqual(z.Header, h) {
+			t.Fatalf("got %+v, Reader got %+v", h, z.Header)
+		}
+		if read := len(b) - r.Len(); read != n {
+			t.Fatalf("got length %d, Reader read %d bytes", n, read)
+		}
+	})
+}
@@ -0,0 +1,292 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/flate"
+)
+
+// NewRandomReader creates a new Reader reading the compressed stream
+// from ra. Like NewSeekingReader it allows seeking using the supplied
+// metadata, but compressed data is fetched with ReadAt one block at a time,
+// so only the blocks that are actually decompressed are read from ra.
+//
+// Opening the reader issues one ReadAt call for the header and two for the
+// first block, which is also read to validate the metadata. A Seek
+// followed by a Read issues one ReadAt call for the block containing the
+// new offset. Read-ahead may fetch up to three following blocks in the
+// background, and reaching the end of the stream issues one more call for
+// the trailer. SetPrefetch makes the reader fetch following blocks ahead
+// of time.
+// It is the caller's responsibility to call Close on the Reader when done.
+func NewRandomReader(ra io.ReaderAt, meta *GzipMetadata) (*Reader, error) {
+	rel, off, err := streamRelative(meta)
+	if err != nil {
+		return nil, err
+	}
+	if off != 0 {
+		ra = io.NewSectionReader(ra, off, math.MaxInt64-off)
+	}
+	return NewSeekingReader(newBlockSource(ra, rel), rel)
+}
+
+// ReadRange returns the uncompressed bytes in [start, end) of the stream
+// described by meta, read from ra. end is clamped to meta.Size, and
+// ErrInvalidSeek is returned if start is not within the stream.
+//
+// Only the compressed blocks covering the range are read, with a single
+// ReadAt call.
+func ReadRange(ra io.ReaderAt, meta *GzipMetadata, start, end int64) ([]byte, error) {
+	compStart, compEnd, discard, err := compressedRange(meta, start, end)
+	if err != nil {
+		return nil, err
+	}
+	if end > meta.Size {
+		end = meta.Size
+	}
+	comp := make([]byte, compEnd-compStart)
+	if n, err := ra.ReadAt(comp, compStart); n != len(comp) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	fr := flate.NewReader(bytes.NewReader(comp))
+	defer fr.Close()
+	if _, err := io.CopyN(ioutil.Discard, fr, discard); err != nil {
+		return nil, noEOF(err)
+	}
+	out := make([]byte, end-start)
+	if _, err := io.ReadFull(fr, out); err != nil {
+		return nil, noEOF(err)
+	}
+	return out, nil
+}
+
+// CompressedRange returns the span [compStart, compEnd) of the compressed
+// stream described by meta that holds the blocks covering the uncompressed
+// bytes in [start, end), for a proxy that stores the compressed bytes of a
+// range of a large remote file to serve it later. end is clamped to
+// meta.Size, and ErrInvalidSeek is returned if start is not within the
+// stream, as by ReadRange.
+//
+// The span is what ReadRange reads, so ReadRange with the same meta
+// decompresses the range from an io.ReaderAt that holds only the stored
+// bytes, at their offsets in the stream. The span includes neither the
+// gzip header nor the trailer.
+func CompressedRange(meta *GzipMetadata, start, end int64) (compStart, compEnd int64, err error) {
+	compStart, compEnd, _, err = compressedRange(meta, start, end)
+	return compStart, compEnd, err
+}
+
+// compressedRange implements CompressedRange, and also returns the number
+// of uncompressed bytes in the first block before start.
+func compressedRange(meta *GzipMetadata, start, end int64) (compStart, compEnd, discard int64, err error) {
+	if err := checkVersion(meta); err != nil {
+		return 0, 0, 0, err
+	}
+	if start < 0 || start >= meta.Size {
+		return 0, 0, 0, &SeekError{Offset: start, Size: meta.Size}
+	}
+	if end < start {
+		return 0, 0, 0, ErrInvalidSeek
+	}
+	if end > meta.Size {
+		end = meta.Size
+	}
+	blockStarts := parseBlockData(meta.BlockData, meta.BlockSize)
+	ustarts := uncompressedStarts(meta)
+	first, compStart, discard := locateBlock(blockStarts, meta.BlockSize, ustarts, start)
+	last := first
+	if end > start {
+		last, _, _ = locateBlock(blockStarts, meta.BlockSize, ustarts, end-1)
+	}
+	return compStart, blockStarts[last+1], discard, nil
+}
+
+// noEOF converts io.EOF to io.ErrUnexpectedEOF.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// SetPrefetch makes a Reader created by NewRandomReader fetch the
+// compressed data of up to n following blocks in the background while the
+// current block is decompressed, which hides the latency of slow sources
+// such as remote storage during sequential reads. Fetches that are no
+// longer needed after a Seek are discarded. A value of 0, the default,
+// fetches blocks only when they are needed. It may be called while
+// reading, and Close waits for the fetches that are still running.
+//
+// It has no effect on other Readers, which read from a stream.
+func (z *Reader) SetPrefetch(n int) {
+	if s, ok := z.r.(*blockSource); ok {
+		if n < 0 {
+			n = 0
+		}
+		if n > math.MaxInt32 {
+			n = math.MaxInt32
+		}
+		atomic.StoreInt32(&s.prefetch, int32(n))
+	}
+}
+
+// blockSource is an io.ReadSeeker over a compressed stream that reads
+// from an io.ReaderAt in whole blocks, as described by the metadata.
+type blockSource struct {
+	ra     io.ReaderAt
+	bounds []int64 // end offset of the header, each block and the trailer
+	off    int64   // offset of buf in the compressed stream
+	buf    []byte
+	roff   int // read offset in buf
+
+	prefetch int32          // accessed atomically, see SetPrefetch
+	pending  map[int]*fetch // background reads by segment index
+	fetches  sync.WaitGroup // background reads, including discarded ones
+}
+
+// fetch is a background read of one segment.
+type fetch struct {
+	done chan struct{}
+	buf  []byte
+	err  error
+}
+
+func newBlockSource(ra io.ReaderAt, meta *GzipMetadata) *blockSource {
+	starts := parseBlockData(meta.BlockData, meta.BlockSize)
+	bounds := make([]int64, len(starts), len(starts)+1)
+	copy(bounds, starts)
+	bounds = append(bounds, starts[len(starts)-1]+8)
+	return &blockSource{ra: ra, bounds: bounds}
+}
+
+// fill reads the segment following the current buffer.
+func (s *blockSource) fill() error {
+	s.off += int64(len(s.buf))
+	s.buf = s.buf[:0]
+	s.roff = 0
+	i := sort.Search(len(s.bounds), func(i int) bool { return s.bounds[i] > s.off })
+	if i == len(s.bounds) {
+		return io.EOF
+	}
+	if f, ok := s.pending[i]; ok && s.off == s.segmentStart(i) {
+		delete(s.pending, i)
+		s.startPrefetch(i)
+		<-f.done
+		s.buf = f.buf
+		return f.err
+	}
+	s.startPrefetch(i)
+	n := int(s.bounds[i] - s.off)
+	if cap(s.buf) < n {
+		s.buf = make([]byte, n)
+	}
+	s.buf = s.buf[:n]
+	read, err := s.ra.ReadAt(s.buf, s.off)
+	s.buf = s.buf[:read]
+	if read == n {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// segmentStart returns the offset of segment i.
+func (s *blockSource) segmentStart(i int) int64 {
+	if i == 0 {
+		return 0
+	}
+	return s.bounds[i-1]
+}
+
+// startPrefetch starts background reads of the segments following
+// segment i that are not already being read.
+func (s *blockSource) startPrefetch(i int) {
+	n := int(atomic.LoadInt32(&s.prefetch))
+	for j := i + 1; j <= i+n && j < len(s.bounds); j++ {
+		if _, ok := s.pending[j]; ok {
+			continue
+		}
+		if s.pending == nil {
+			s.pending = make(map[int]*fetch)
+		}
+		f := &fetch{done: make(chan struct{})}
+		s.pending[j] = f
+		off := s.segmentStart(j)
+		f.buf = make([]byte, s.bounds[j]-off)
+		s.fetches.Add(1)
+		go func() {
+			defer s.fetches.Done()
+			defer close(f.done)
+			n, err := s.ra.ReadAt(f.buf, off)
+			want := len(f.buf)
+			f.buf = f.buf[:n]
+			if n == want {
+				err = nil
+			} else if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			f.err = err
+		}()
+	}
+}
+
+// wait waits for the background reads to finish and discards them.
+func (s *blockSource) wait() {
+	s.fetches.Wait()
+	s.pending = nil
+}
+
+func (s *blockSource) Read(p []byte) (int, error) {
+	if s.roff == len(s.buf) {
+		if err := s.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.buf[s.roff:])
+	s.roff += n
+	return n, nil
+}
+
+func (s *blockSource) ReadByte() (byte, error) {
+	if s.roff == len(s.buf) {
+		if err := s.fill(); err != nil {
+			return 0, err
+		}
+	}
+	b := s.buf[s.roff]
+	s.roff++
+	return b, nil
+}
+
+func (s *blockSource) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.off + int64(s.roff)
+	default:
+		return 0, errors.New("gzip: invalid block source seek")
+	}
+	if offset < 0 {
+		return 0, errors.New("gzip: invalid block source seek")
+	}
+	if offset != s.off+int64(s.roff) {
+		// Drop reads that were started for the old position.
+		s.pending = nil
+	}
+	s.off = offset
+	s.buf = s.buf[:0]
+	s.roff = 0
+	return offset, nil
+}
@@ -0,0 +1,347 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingReaderAt records the number of calls and bytes read.
+type countingReaderAt struct {
+	ra    io.ReaderAt
+	mu    sync.Mutex
+	calls int
+	bytes int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.ra.ReadAt(p, off)
+	c.mu.Lock()
+	c.calls++
+	c.bytes += int64(n)
+	c.mu.Unlock()
+	return n, err
+}
+
+func (c *countingReaderAt) stats() (int, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls, c.bytes
+}
+
+func testSeekableData(t testing.TB, size, blockSize int) ([]byte, []byte, GzipMetadata) {
+	in := make([]byte, size)
+	for i := range in {
+		in[i] = byte(i*7 + i/1000)
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetConcurrency(blockSize, 4)
+	if _, err := w.Write(in); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return in, buf.Bytes(), w.MetaData()
+}
+
+func TestRandomReader(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 1<<20, 32<<10)
+	cra := &countingReaderAt{ra: bytes.NewReader(compressed)}
+	r, err := NewRandomReader(cra, &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	const pos = 900000
+	if _, err := r.Seek(pos, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	p := make([]byte, 1000)
+	if _, err := io.ReadFull(r, p); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p, in[pos:pos+1000]) {
+		t.Error("read does not match input")
+	}
+	if _, n := cra.stats(); n > int64(len(compressed))/2 {
+		t.Errorf("read %d of %d compressed bytes", n, len(compressed))
+	}
+
+	if _, err := r.Seek(100, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, in[100:]) {
+		t.Error("read to end does not match input")
+	}
+}
+
+func TestSeekCopy(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 1<<20, 32<<10)
+	starts := parseBlockData(meta.BlockData, meta.BlockSize)
+	const pos = 900000
+	// The compressed data from the block holding pos to the end.
+	need := int64(len(compressed)) - starts[pos/(32<<10)]
+	open := map[string]func(ra io.ReaderAt) (*Reader, error){
+		"NewRandomReader": func(ra io.ReaderAt) (*Reader, error) { return NewRandomReader(ra, &meta) },
+		"NewSeekingReader": func(ra io.ReaderAt) (*Reader, error) {
+			return NewSeekingReader(io.NewSectionReader(ra, 0, int64(len(compressed))), &meta)
+		},
+	}
+	for name, fn := range open {
+		cra := &countingReaderAt{ra: bytes.NewReader(compressed)}
+		r, err := fn(cra)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		_, before := cra.stats()
+		var out bytes.Buffer
+		if _, err := io.Copy(&out, r); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out.Bytes(), in[pos:]) {
+			t.Errorf("%s: copied data does not match", name)
+		}
+		if _, after := cra.stats(); after-before != need {
+			t.Errorf("%s: read %d compressed bytes, want %d", name, after-before, need)
+		}
+		r.Close()
+	}
+}
+
+func TestReadRange(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 300000, 16<<10)
+	cra := &countingReaderAt{ra: bytes.NewReader(compressed)}
+	for _, tc := range []struct{ start, end int64 }{
+		{0, 10}, {16 << 10, 32 << 10}, {1000, 100000}, {299990, 400000}, {5, 5},
+	} {
+		got, err := ReadRange(cra, &meta, tc.start, tc.end)
+		if err != nil {
+			t.Fatalf("ReadRange(%d, %d): %v", tc.start, tc.end, err)
+		}
+		end := tc.end
+		if end > int64(len(in)) {
+			end = int64(len(in))
+		}
+		if !bytes.Equal(got, in[tc.start:end]) {
+			t.Errorf("ReadRange(%d, %d): content does not match", tc.start, tc.end)
+		}
+	}
+	if calls, _ := cra.stats(); calls != 5 {
+		t.Errorf("got %d ReadAt calls, want 5", calls)
+	}
+	for _, tc := range []struct{ start, end int64 }{{300000, 300001}, {-1, 10}, {10, 5}} {
+		if _, err := ReadRange(cra, &meta, tc.start, tc.end); !errors.Is(err, ErrInvalidSeek) {
+			t.Errorf("ReadRange(%d, %d): got %v, want %v", tc.start, tc.end, err, ErrInvalidSeek)
+		}
+	}
+}
+
+// spanReaderAt holds the bytes of a stream from off on, and fails reads
+// outside of them.
+type spanReaderAt struct {
+	b   []byte
+	off int64
+}
+
+func (s *spanReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < s.off || off+int64(len(p)) > s.off+int64(len(s.b)) {
+		return 0, fmt.Errorf("read of [%d, %d) outside of [%d, %d)", off, off+int64(len(p)), s.off, s.off+int64(len(s.b)))
+	}
+	return copy(p, s.b[off-s.off:]), nil
+}
+
+func TestCompressedRange(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 300000, 16<<10)
+	for _, tc := range []struct {
+		start, end int64
+		blocks     [2]int
+	}{
+		{0, 10, [2]int{0, 0}},
+		{16 << 10, 32 << 10, [2]int{1, 1}},
+		{1000, 100000, [2]int{0, 6}},
+		{299990, 400000, [2]int{18, 18}},
+		{5, 5, [2]int{0, 0}},
+	} {
+		compStart, compEnd, err := CompressedRange(&meta, tc.start, tc.end)
+		if err != nil {
+			t.Fatalf("CompressedRange(%d, %d): %v", tc.start, tc.end, err)
+		}
+		first, _ := meta.BlockInfo(tc.blocks[0])
+		last, _ := meta.BlockInfo(tc.blocks[1])
+		if compStart != first.CompressedOffset || compEnd != last.CompressedOffset+last.CompressedLength {
+			t.Errorf("CompressedRange(%d, %d) = %d, %d, want blocks %d to %d", tc.start, tc.end, compStart, compEnd, tc.blocks[0], tc.blocks[1])
+		}
+		// The stored span is enough to serve the range.
+		span := &spanReaderAt{b: compressed[compStart:compEnd], off: compStart}
+		got, err := ReadRange(span, &meta, tc.start, tc.end)
+		if err != nil {
+			t.Fatalf("ReadRange(%d, %d) of the span: %v", tc.start, tc.end, err)
+		}
+		end := tc.end
+		if end > int64(len(in)) {
+			end = int64(len(in))
+		}
+		if !bytes.Equal(got, in[tc.start:end]) {
+			t.Errorf("ReadRange(%d, %d) of the span: content does not match", tc.start, tc.end)
+		}
+	}
+	for _, tc := range []struct{ start, end int64 }{{300000, 300001}, {-1, 10}, {10, 5}} {
+		if _, _, err := CompressedRange(&meta, tc.start, tc.end); !errors.Is(err, ErrInvalidSeek) {
+			t.Errorf("CompressedRange(%d, %d): got %v, want %v", tc.start, tc.end, err, ErrInvalidSeek)
+		}
+	}
+}
+
+// slowReaderAt adds a fixed latency to every ReadAt call.
+type slowReaderAt struct {
+	ra    io.ReaderAt
+	delay time.Duration
+}
+
+func (s slowReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	time.Sleep(s.delay)
+	return s.ra.ReadAt(p, off)
+}
+
+func TestPrefetch(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 1<<20, 32<<10)
+	cra := &countingReaderAt{ra: bytes.NewReader(compressed)}
+	r, err := NewRandomReader(cra, &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.SetPrefetch(4)
+	for _, pos := range []int64{500000, 10, 900000} {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 100000)
+		if _, err := io.ReadFull(r, buf); err != nil && err != io.ErrUnexpectedEOF {
+			t.Fatal(err)
+		}
+		end := pos + 100000
+		if end > int64(len(in)) {
+			end = int64(len(in))
+		}
+		if !bytes.Equal(buf[:end-pos], in[pos:end]) {
+			t.Fatalf("content at %d does not match", pos)
+		}
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, in) {
+		t.Error("content does not match")
+	}
+
+	// Readers over a stream ignore the setting.
+	plain, err := NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+	plain.SetPrefetch(4)
+}
+
+// activeReaderAt is a slowReaderAt that counts the calls in progress.
+type activeReaderAt struct {
+	slowReaderAt
+	active int32
+}
+
+func (a *activeReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	atomic.AddInt32(&a.active, 1)
+	defer atomic.AddInt32(&a.active, -1)
+	return a.slowReaderAt.ReadAt(p, off)
+}
+
+func TestPrefetchClose(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 1<<20, 32<<10)
+	ara := &activeReaderAt{slowReaderAt: slowReaderAt{ra: bytes.NewReader(compressed), delay: time.Millisecond}}
+	r, err := NewRandomReader(ara, &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetPrefetch(4)
+	buf := make([]byte, 100000)
+	if _, err := io.ReadFull(r, buf); err != nil || !bytes.Equal(buf, in[:len(buf)]) {
+		t.Fatalf("ReadFull: %v", err)
+	}
+	// The read-ahead is fetching blocks while the setting changes.
+	r.SetPrefetch(8)
+	if _, err := io.ReadFull(r, buf); err != nil || !bytes.Equal(buf, in[len(buf):2*len(buf)]) {
+		t.Fatalf("ReadFull: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&ara.active); n != 0 {
+		t.Errorf("%d reads still running after Close", n)
+	}
+}
+
+func BenchmarkPrefetch(b *testing.B) {
+	_, compressed, meta := testSeekableData(b, 1<<20, 32<<10)
+	for _, n := range []int{0, 4} {
+		b.Run(fmt.Sprintf("prefetch-%d", n), func(b *testing.B) {
+			sra := slowReaderAt{ra: bytes.NewReader(compressed), delay: time.Millisecond}
+			r, err := NewRandomReader(sra, &meta)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer r.Close()
+			r.SetPrefetch(n)
+			b.SetBytes(meta.Size - 100)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := r.Seek(100, io.SeekStart); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := io.Copy(ioutil.Discard, r); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSeekCopy(b *testing.B) {
+	_, compressed, meta := testSeekableData(b, 4<<20, 64<<10)
+	r, err := NewRandomReader(bytes.NewReader(compressed), &meta)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer r.Close()
+	const pos = 3 << 20
+	b.SetBytes(meta.Size - pos)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.Copy(ioutil.Discard, r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package sgzip
+
+import (
+	"errors"
+	"math"
+	"sync/atomic"
+)
+
+// ratioMinSize is the amount of data decompressed before the expansion
+// ratio is checked, so that small streams, whose header and trailer
+// weigh more, are not rejected.
+const ratioMinSize = 1 << 20
+
+// SetMaxExpansionRatio makes the Reader fail with ErrExpansionRatio, which
+// matches ErrSizeLimit, as soon as the data decompressed so far is more
+// than ratio times the compressed input consumed, as reported by Counters.
+// It catches decompression bombs early, after decompressing a single
+// buffer beyond the limit, even when their total size would be
+// acceptable. The ratio is checked once 1 MiB has been decompressed. Data
+// repeating the same byte compresses by a factor of up to about 1000, so
+// useful limits are well below that. A ratio of 0, the default, disables
+// the check.
+//
+// It needs the compressed input to be counted, and returns an error for
+// sources for which Counters reports none. Reading fails with
+// ErrExpansionRatio after a Reset to such a source. It is kept across
+// Reset.
+func (z *Reader) SetMaxExpansionRatio(ratio float64) error {
+	if ratio < 0 || math.IsNaN(ratio) {
+		return errors.New("gzip: invalid expansion ratio")
+	}
+	if _, ok := z.inputOffset(); !ok && ratio > 0 {
+		return errors.New("gzip: compressed input of the source cannot be counted")
+	}
+	z.maxRatio = ratio
+	return nil
+}
+
+// checkExpansion returns ErrExpansionRatio if the data decompressed so
+// far exceeds the limit set by SetMaxExpansionRatio.
+func (z *Reader) checkExpansion() error {
+	if z.maxRatio == 0 {
+		return nil
+	}
+	out := atomic.LoadInt64(&z.decoded)
+	if out < ratioMinSize {
+		return nil
+	}
+	if float64(out) > z.maxRatio*float64(atomic.LoadInt64(&z.consumed)) {
+		return ErrExpansionRatio
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package sgzip
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestSetMaxExpansionRatio(t *testing.T) {
+	var bomb bytes.Buffer
+	w, _ := NewWriterLevel(&bomb, BestSpeed)
+	w.Write(make([]byte, 16<<20))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	in := levelTestData(4 << 20)
+	var normal bytes.Buffer
+	w, _ = NewWriterLevel(&normal, BestSpeed)
+	w.Write(in)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(bytes.NewReader(bomb.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetMaxExpansionRatio(100); err != nil {
+		t.Fatal(err)
+	}
+	n, err := io.Copy(ioutil.Discard, r)
+	if !errors.Is(err, ErrExpansionRatio) || !errors.Is(err, ErrSizeLimit) {
+		t.Errorf("bomb: got %v, want ErrExpansionRatio", err)
+	}
+	if n >= 16<<20 {
+		t.Errorf("bomb: read all %d bytes before failing", n)
+	}
+
+	// The option is kept across Reset, and data within the limit is read.
+	if err := r.Reset(bytes.NewReader(normal.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(got, in) {
+		t.Errorf("within limit: got %d bytes, %v", len(got), err)
+	}
+
+	// WriteTo decompresses without read-ahead after a Seek.
+	meta := w.MetaData()
+	sr, err := NewSeekingReader(bytes.NewReader(normal.Bytes()), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sr.SetMaxExpansionRatio(1.5)
+	sr.Seek(1000, io.SeekStart)
+	if _, err := sr.WriteTo(ioutil.Discard); !errors.Is(err, ErrExpansionRatio) {
+		t.Errorf("WriteTo with a low limit: got %v, want ErrExpansionRatio", err)
+	}
+
+	r, err = NewReader(bufio.NewReader(bytes.NewReader(bomb.Bytes())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetMaxExpansionRatio(100); err == nil {
+		t.Error("expected error for a source that cannot be counted")
+	}
+	if err := r.SetMaxExpansionRatio(-1); err == nil {
+		t.Error("expected error for a negative ratio")
+	}
+}
@@ -0,0 +1,271 @@
+package sgzip
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math"
+
+	"github.com/klauspost/compress/flate"
+)
+
+// RebuildIndex reconstructs the metadata of a gzip stream written by
+// Writer by decompressing it once, which restores seeking when the
+// metadata has been lost. Only the first member of r is indexed.
+//
+// Writer ends every block with an empty stored block (a sync flush), so
+// block boundaries are found where the decompressor completes one. The
+// block size is the smallest distance between flushes such that every
+// multiple of it is a flush after which the data decompresses on its own.
+// Since Writer also compresses the parts written by Flush independently,
+// the result can describe smaller blocks than the original metadata; it
+// seeks correctly either way. A stream with a single block is given its
+// size as block size, and streams not written by Writer are described as
+// a single block. ErrChecksum is returned if the trailer does not match
+// the data. The result has no Fingerprint.
+//
+// Output of pigz is seekable the same way if its blocks are compressed
+// independently, which pigz does with -i (--independent), for example
+// "pigz -i -b 1024 file" for blocks of 1 MiB. Without -i, each pigz block
+// uses the previous one as dictionary, and the stream is described as a
+// single block. Since the last pigz block ends the deflate stream, an
+// empty block is added to the result after it, as Writer writes one.
+func RebuildIndex(r io.Reader) (GzipMetadata, error) {
+	mr := &markerReader{r: makeReader(r)}
+	if _, err := ReadHeader(mr); err != nil {
+		return GzipMetadata{}, err
+	}
+	headerLen := mr.n
+	mr.seg.Reset()
+
+	// Decompress, recording the position of each sync flush together
+	// with the size and checksum of the data before it. A block can only
+	// start at a flush if the following data can be decompressed without
+	// the data before it, which is checked by decompressing the
+	// compressed data up to the next flush on its own.
+	type mark struct {
+		comp, size  int64
+		crc         uint32 // checksum of the data since the previous mark
+		independent bool
+	}
+	var marks []mark
+	var size int64
+	var crc uint32
+	probe := newSegmentProbe()
+	defer probe.close()
+	mr.onMarker = func() {
+		if k := len(marks) - 1; k >= 0 {
+			marks[k].independent = probe.decodes(mr.seg.Bytes())
+		}
+		mr.seg.Reset()
+		marks = append(marks, mark{comp: mr.n, size: size, crc: crc})
+		crc = 0
+	}
+	fr := flate.NewReader(mr)
+	defer fr.Close()
+	buf := make([]byte, 64<<10)
+	for {
+		before := len(marks)
+		n, err := fr.Read(buf)
+		if k := len(marks) - 1; k >= before && marks[k].comp == mr.n {
+			// The data of a block is passed on once the flush
+			// following it has been read.
+			marks[k].crc = crc32Combine(marks[k].crc, crc32.ChecksumIEEE(buf[:n]), int64(n))
+			marks[k].size += int64(n)
+		} else {
+			crc = crc32.Update(crc, crc32.IEEETable, buf[:n])
+		}
+		size += int64(n)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return GzipMetadata{}, noEOF(err)
+		}
+	}
+	end := mr.n
+	if k := len(marks) - 1; k >= 0 {
+		marks[k].independent = probe.decodes(mr.seg.Bytes())
+	}
+
+	var trailer [8]byte
+	if _, err := io.ReadFull(mr, trailer[:]); err != nil {
+		return GzipMetadata{}, noEOF(err)
+	}
+	// The data after the last flush, usually none, forms the last block.
+	rest := crc
+	var sum uint32
+	var prev int64
+	for _, m := range marks {
+		sum = crc32Combine(sum, m.crc, m.size-prev)
+		prev = m.size
+	}
+	sum = crc32Combine(sum, rest, size-prev)
+	if get4(trailer[0:4]) != sum || get4(trailer[4:8]) != uint32(size) {
+		return GzipMetadata{}, ErrChecksum
+	}
+
+	// Every multiple of the block size below the end of the data must be
+	// a block boundary.
+	// Where several flushes have the same offset, the last one counts.
+	flushed := make(map[int64]bool, len(marks))
+	for _, m := range marks {
+		flushed[m.size] = m.independent
+	}
+	blockSize := size
+candidates:
+	for _, m := range marks {
+		if m.size == 0 || !flushed[m.size] {
+			continue
+		}
+		for off := m.size; off < size; off += m.size {
+			if !flushed[off] {
+				continue candidates
+			}
+		}
+		blockSize = m.size
+		break
+	}
+	if blockSize == 0 {
+		blockSize = defaultBlockSize
+	}
+	if blockSize > math.MaxInt32 {
+		return GzipMetadata{}, fmt.Errorf("gzip: block size %d too large", blockSize)
+	}
+
+	meta := GzipMetadata{
+		Version:   1,
+		BlockSize: int(blockSize),
+		Size:      size,
+		BlockData: []uint32{uint32(headerLen)},
+	}
+	start := headerLen
+	var blockCRC uint32
+	prev = 0
+	for i, m := range marks {
+		blockCRC = crc32Combine(blockCRC, m.crc, m.size-prev)
+		prev = m.size
+		if m.size%blockSize != 0 && m.size != size {
+			continue
+		}
+		if i+1 < len(marks) && marks[i+1].size == m.size {
+			// Padding follows, it is part of this block.
+			continue
+		}
+		if m.size == 0 {
+			// Padding after the header.
+			meta.BlockData[0] = uint32(m.comp)
+			start = m.comp
+			continue
+		}
+		if m.comp-start > math.MaxUint32 {
+			return GzipMetadata{}, fmt.Errorf("gzip: compressed block of %d bytes too large", m.comp-start)
+		}
+		meta.BlockData = append(meta.BlockData, uint32(m.comp-start))
+		meta.BlockCRC = append(meta.BlockCRC, blockCRC)
+		start, blockCRC = m.comp, 0
+	}
+	if end-start > math.MaxUint32 {
+		return GzipMetadata{}, fmt.Errorf("gzip: compressed block of %d bytes too large", end-start)
+	}
+	meta.BlockData = append(meta.BlockData, uint32(end-start))
+	meta.BlockCRC = append(meta.BlockCRC, crc32Combine(blockCRC, rest, size-prev))
+	if len(meta.BlockData) > 2 && size > prev {
+		// The last block holds data, as with pigz, where it ends the
+		// deflate stream. Seeking readers treat the last block as the
+		// end marker, so an empty one is added.
+		meta.BlockData = append(meta.BlockData, 0)
+		meta.BlockCRC = append(meta.BlockCRC, 0)
+	}
+	return meta, nil
+}
+
+// buildReadSize is the size of the reads BuildIndexAt makes.
+const buildReadSize = 1 << 20
+
+// BuildIndexAt is RebuildIndex for a stream of size bytes read from ra,
+// such as an object in remote storage. If blockSize is larger than the
+// block size found, runs of blocks are merged with Downsample so that
+// they hold at least blockSize bytes; 0 keeps the blocks found.
+//
+// Deflate data has no structure that can be found without decoding it,
+// so the stream is still decompressed from the start. ra is read in
+// sequential calls of 1 MiB, each of them followed by the time it takes
+// to decompress that data, which suits sources with a high latency per
+// request better than many small reads. The whole stream up to the end of
+// the first member is read once: the reads add up to that size, rounded
+// up to the next 1 MiB but no further than size.
+func BuildIndexAt(ra io.ReaderAt, size int64, blockSize int) (GzipMetadata, error) {
+	if size < 0 || blockSize < 0 {
+		return GzipMetadata{}, errors.New("gzip: invalid size or block size")
+	}
+	meta, err := RebuildIndex(bufio.NewReaderSize(io.NewSectionReader(ra, 0, size), buildReadSize))
+	if err != nil {
+		return GzipMetadata{}, err
+	}
+	if meta.BlockSize > 0 && blockSize > meta.BlockSize {
+		meta = meta.Downsample((blockSize + meta.BlockSize - 1) / meta.BlockSize)
+	}
+	return meta, nil
+}
+
+// markerReader counts the bytes read from r and remembers the last four,
+// to detect the end of an empty stored block (0x00 0x00 0xff 0xff).
+type markerReader struct {
+	r        flate.Reader
+	n        int64
+	last     uint32
+	seg      bytes.Buffer // the bytes read since the last marker
+	onMarker func()       // called after the last byte of a marker is read
+}
+
+func (m *markerReader) Read(p []byte) (int, error) {
+	n, err := m.r.Read(p)
+	for _, b := range p[:n] {
+		m.add(b)
+	}
+	return n, err
+}
+
+func (m *markerReader) ReadByte() (byte, error) {
+	b, err := m.r.ReadByte()
+	if err == nil {
+		m.add(b)
+	}
+	return b, err
+}
+
+func (m *markerReader) add(b byte) {
+	m.seg.WriteByte(b)
+	m.last = m.last<<8 | uint32(b)
+	m.n++
+	if m.n >= 4 && m.last == 0x0000ffff && m.onMarker != nil {
+		m.onMarker()
+	}
+}
+
+// segmentProbe checks whether segments of a deflate stream can be
+// decompressed on their own.
+type segmentProbe struct {
+	fr io.ReadCloser
+}
+
+func newSegmentProbe() *segmentProbe {
+	return &segmentProbe{fr: flate.NewReader(bytes.NewReader(nil))}
+}
+
+// decodes reports whether seg decompresses without data before it. seg
+// need not end a deflate stream.
+func (p *segmentProbe) decodes(seg []byte) bool {
+	p.fr.(flate.Resetter).Reset(bytes.NewReader(seg), nil)
+	_, err := io.Copy(ioutil.Discard, p.fr)
+	return err == nil || err == io.ErrUnexpectedEOF
+}
+
+func (p *segmentProbe) close() {
+	p.fr.Close()
+}
@@ -0,0 +1,195 @@
+package sgzip
+
+import (
+	"bytes"
+	oldgz "compress/gzip"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/flate"
+)
+
+func TestRebuildIndex(t *testing.T) {
+	for _, size := range []int{0, 1000, 4 * 16 << 10, 100000} {
+		in, compressed, meta := testSeekableData(t, size, 16<<10)
+		got, err := RebuildIndex(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if size < 16<<10 {
+			// A single block gives no hint of the block size.
+			meta.BlockSize = got.BlockSize
+		}
+		if size == 0 {
+			meta.BlockSize = defaultBlockSize
+		}
+		meta.Fingerprint = 0 // not recorded by RebuildIndex
+		if !reflect.DeepEqual(got, meta) {
+			t.Errorf("size %d: got %+v, want %+v", size, got, meta)
+		}
+		if size == 0 {
+			continue
+		}
+		if data, err := ReadRange(bytes.NewReader(compressed), &got, int64(size/2), int64(size)); err != nil || !bytes.Equal(data, in[size/2:]) {
+			t.Errorf("size %d: ReadRange: %v", size, err)
+		}
+	}
+
+	// Flushes within blocks and alignment padding.
+	in := bytes.Repeat([]byte("rebuilt index "), 20000)
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetConcurrency(32<<10, 4)
+	w.SetBlockAlignment(512)
+	for p := in; len(p) > 0; p = p[10000:] {
+		if len(p) < 10000 {
+			w.Write(p)
+			break
+		}
+		w.Write(p[:10000])
+		w.Flush()
+	}
+	w.Close()
+	meta, err := RebuildIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The flushed parts are compressed independently, so they become
+	// the blocks.
+	if meta.BlockSize != 10000 || meta.Size != int64(len(in)) {
+		t.Errorf("got BlockSize %d, Size %d", meta.BlockSize, meta.Size)
+	}
+	if err := Verify(bytes.NewReader(buf.Bytes()), &meta); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewSeekingReader(bytes.NewReader(buf.Bytes()), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := r.Seek(200000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(got, in[200000:]) {
+		t.Errorf("after Seek: got %d bytes, %v", len(got), err)
+	}
+
+	// Other writers produce a single block.
+	buf.Reset()
+	ow := oldgz.NewWriter(&buf)
+	ow.Write(in)
+	ow.Close()
+	if meta, err := RebuildIndex(bytes.NewReader(buf.Bytes())); err != nil || len(meta.BlockData) != 2 || meta.Size != int64(len(in)) {
+		t.Errorf("compress/gzip stream: got %+v, %v", meta, err)
+	}
+
+	corrupt := append([]byte{}, buf.Bytes()...)
+	corrupt[len(corrupt)-5]++
+	if _, err := RebuildIndex(bytes.NewReader(corrupt)); err != ErrChecksum {
+		t.Errorf("bad trailer: got %v, want ErrChecksum", err)
+	}
+}
+
+// pigzIndependent compresses in like pigz -i: the data is split into
+// blocks of blockSize bytes, each compressed without the history of the
+// previous one and ended with a sync flush, except for the last block,
+// which ends the deflate stream.
+func pigzIndependent(t *testing.T, in []byte, blockSize int) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0x1f, 0x8b, 8, 0x08, 0, 0, 0, 0, 0, 3})
+	buf.WriteString("pigz.dat\x00")
+	for off := 0; off < len(in); off += blockSize {
+		end := off + blockSize
+		if end > len(in) {
+			end = len(in)
+		}
+		fw, _ := flate.NewWriter(&buf, 6)
+		fw.Write(in[off:end])
+		var err error
+		if end == len(in) {
+			err = fw.Close()
+		} else {
+			err = fw.Flush()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var trailer [8]byte
+	put4(trailer[:4], crc32.ChecksumIEEE(in))
+	put4(trailer[4:], uint32(len(in)))
+	buf.Write(trailer[:])
+	return buf.Bytes()
+}
+
+func TestRebuildIndexPigz(t *testing.T) {
+	in, _, _ := testSeekableData(t, 1000000, 16<<10)
+	const blockSize = 128 << 10
+	comp := pigzIndependent(t, in, blockSize)
+	meta, err := RebuildIndex(bytes.NewReader(comp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.BlockSize != blockSize || meta.Size != int64(len(in)) {
+		t.Fatalf("got block size %d and size %d, want %d and %d", meta.BlockSize, meta.Size, blockSize, len(in))
+	}
+	if err := Verify(bytes.NewReader(comp), &meta); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+	r, err := NewSeekingReader(bytes.NewReader(comp), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.Name != "pigz.dat" {
+		t.Errorf("Name = %q", r.Name)
+	}
+	for _, pos := range []int64{0, blockSize + 5, 3 * blockSize, int64(len(in)) - 1000} {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil || !bytes.Equal(got, in[pos:]) {
+			t.Errorf("Seek(%d): got %d bytes, %v", pos, len(got), err)
+		}
+	}
+}
+
+func TestBuildIndexAt(t *testing.T) {
+	in, compressed, _ := testSeekableData(t, 3<<20, 64<<10)
+	want, err := RebuildIndex(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ra := &countingReaderAt{ra: bytes.NewReader(compressed)}
+	got, err := BuildIndexAt(ra, int64(len(compressed)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if calls, n := ra.stats(); n != int64(len(compressed)) || calls > len(compressed)/buildReadSize+2 {
+		t.Errorf("read %d bytes in %d calls for %d bytes", n, calls, len(compressed))
+	}
+
+	got, err = BuildIndexAt(bytes.NewReader(compressed), int64(len(compressed)), 200<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.BlockSize != 256<<10 || got.NumBlocks() != 13 {
+		t.Errorf("downsampled: BlockSize %d, %d blocks", got.BlockSize, got.NumBlocks())
+	}
+	data, err := ReadRange(bytes.NewReader(compressed), &got, 1<<20+5, 1<<20+1005)
+	if err != nil || !bytes.Equal(data, in[1<<20+5:1<<20+1005]) {
+		t.Errorf("ReadRange with downsampled index: %v", err)
+	}
+
+	if _, err := BuildIndexAt(bytes.NewReader(compressed), int64(len(compressed))-10, 0); err == nil {
+		t.Error("expected error for a truncated stream")
+	}
+}
@@ -0,0 +1,53 @@
+package sgzip
+
+// recordMinBlock is the smallest block ending at a record boundary found
+// by the boundary functions of NewlineBoundary and DelimiterBoundary.
+const recordMinBlock = 64 << 10
+
+// NewlineBoundary returns a boundary function for SetBoundaryFunc that
+// ends blocks after a newline once they hold at least 64 KiB, for data
+// made of lines such as log files or newline-delimited JSON. Every block
+// then starts with a new line, so a reader can seek to any block and
+// parse records from there.
+//
+// A line that does not fit into the block size set by SetConcurrency is
+// split at the block size like any other data, and the next block then
+// starts in the middle of that line. Block sizes of 64 KiB or less end
+// blocks only at the block size.
+func NewlineBoundary() func(written int64, lastByte byte) bool {
+	return func(written int64, b byte) bool {
+		return written >= recordMinBlock && b == '\n'
+	}
+}
+
+// DelimiterBoundary returns a boundary function for SetBoundaryFunc that
+// ends blocks after a close byte that balances every open byte before it,
+// once they hold at least 64 KiB, for data made of nested records such as
+// concatenated JSON objects with '{' and '}', or XML elements with '<' and
+// '>' when every element sits at the top level. Every block then starts
+// at a top-level record.
+//
+// The nesting is counted byte by byte, ignoring any quoting or escaping
+// of the format, so it only suits data where the delimiters do not occur
+// inside strings. Malformed data does not make the Writer fail: a close
+// byte without an open one is ignored, a record left open ends its block
+// only at the block size set by SetConcurrency, and the next block then
+// starts in the middle of a record, as it does for records that do not
+// fit into the block size. The function keeps the nesting depth across
+// blocks and Reset, so each Writer needs its own function.
+func DelimiterBoundary(open, close byte) func(written int64, lastByte byte) bool {
+	depth := 0
+	return func(written int64, b byte) bool {
+		switch b {
+		case open:
+			depth++
+		case close:
+			if depth == 0 {
+				return false
+			}
+			depth--
+			return depth == 0 && written >= recordMinBlock
+		}
+		return false
+	}
+}
@@ -0,0 +1,74 @@
+package sgzip
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io"
+
+	"github.com/klauspost/compress/flate"
+)
+
+// RecoverTruncated reads the stream described by meta from r, which may be
+// truncated or damaged, and returns the number of uncompressed bytes at its
+// start that are intact: those of the blocks before the first one that is
+// incomplete, does not decompress to its length, or, if meta has block
+// checksums, does not match its checksum. Copying validBytes from a Reader
+// for the stream, with io.CopyN or CopyRange, then extracts them. Since
+// NewSeekingReader rejects a stream shorter than meta describes, use
+// NewReader for a truncated one.
+//
+// validBytes is meta.Size if the whole stream is intact. Damaged data is
+// not an error; err reports invalid metadata, a header whose length does
+// not match meta, and read errors of r other than its end. The trailer is
+// not checked, so use Verify to check a complete stream.
+func RecoverTruncated(r io.Reader, meta *GzipMetadata) (validBytes int64, err error) {
+	if err := checkVersion(meta); err != nil {
+		return 0, err
+	}
+	if len(meta.BlockData) < 2 {
+		return 0, ErrInvalidMetadata
+	}
+	cr := &countingReader{r: makeReader(r)}
+	if _, err := ReadHeader(cr); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if cr.n != int64(meta.BlockData[0]) {
+		return 0, ErrInvalidMetadata
+	}
+	var comp, data []byte
+	fr := flate.NewReader(nil)
+	defer fr.Close()
+	for i, d := range meta.BlockData[1:] {
+		n := blockLen(meta, i)
+		if cap(comp) < int(d) {
+			comp = make([]byte, d)
+		}
+		comp = comp[:d]
+		if _, err := io.ReadFull(cr, comp); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return validBytes, err
+		}
+		if cap(data) < int(n) {
+			data = make([]byte, n)
+		}
+		data = data[:n]
+		fr.(flate.Resetter).Reset(bytes.NewReader(comp), nil)
+		if _, err := io.ReadFull(fr, data); err != nil {
+			break
+		}
+		if i < len(meta.BlockCRC) && meta.BlockCRC[i] != crc32.ChecksumIEEE(data) {
+			break
+		}
+		validBytes += n
+	}
+	if validBytes > meta.Size {
+		// Padding of the last block.
+		validBytes = meta.Size
+	}
+	return validBytes, nil
+}
@@ -0,0 +1,62 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestRecoverTruncated(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 100000, 16<<10)
+	blockStarts := parseBlockData(meta.BlockData, meta.BlockSize)
+
+	if n, err := RecoverTruncated(bytes.NewReader(compressed), &meta); err != nil || n != meta.Size {
+		t.Errorf("intact stream: got %d, %v, want %d", n, err, meta.Size)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want int64
+	}{
+		{"header only", compressed[:blockStarts[0]], 0},
+		{"partial header", compressed[:5], 0},
+		{"mid block 3", compressed[:blockStarts[3]+100], 3 * 16 << 10},
+		{"end of block 3", compressed[:blockStarts[4]], 4 * 16 << 10},
+		{"no trailer", compressed[:len(compressed)-8], meta.Size},
+	}
+	corrupt := append([]byte{}, compressed...)
+	corrupt[blockStarts[2]+50] ^= 0xff
+	tests = append(tests, struct {
+		name string
+		data []byte
+		want int64
+	}{"corrupt block 2", corrupt, 2 * 16 << 10})
+
+	for _, tt := range tests {
+		n, err := RecoverTruncated(bytes.NewReader(tt.data), &meta)
+		if err != nil || n != tt.want {
+			t.Errorf("%s: got %d, %v, want %d", tt.name, n, err, tt.want)
+			continue
+		}
+		if n == 0 {
+			continue
+		}
+		r, err := NewReader(bytes.NewReader(tt.data))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, r, n); err != nil || !bytes.Equal(buf.Bytes(), in[:n]) {
+			t.Errorf("%s: copying the intact prefix: %d bytes, %v", tt.name, buf.Len(), err)
+		}
+		r.Close()
+	}
+
+	bad := meta
+	bad.BlockData = append([]uint32{meta.BlockData[0] + 1}, meta.BlockData[1:]...)
+	if _, err := RecoverTruncated(bytes.NewReader(compressed), &bad); !errors.Is(err, ErrInvalidMetadata) {
+		t.Errorf("wrong header length: got %v, want ErrInvalidMetadata", err)
+	}
+}
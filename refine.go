@@ -0,0 +1,321 @@
+package sgzip
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sort"
+
+	"github.com/klauspost/compress/flate"
+)
+
+// Limits of the seek points that seeking Readers find inside blocks.
+const (
+	refineSpacing   = 64 << 10 // minimum distance between seek points
+	refineMaxPoints = 128      // each point keeps a 32 KiB dictionary
+	refineWindow    = 32 << 10 // the deflate window
+	refineCheck     = 4 << 10  // data decoded to check a candidate point
+	refinePending   = 4        // candidate points checked at a time
+	syncMarker      = 0x0000ffff
+)
+
+// A refinePoint is a position inside a block where decompression can
+// resume: a sync flush, which ends on a byte boundary. The data after it
+// may refer to the data before it, which is kept in dict. Blocks are
+// independent, so dict holds no data from before the block.
+type refinePoint struct {
+	comp int64  // compressed offset just after the flush
+	pos  int64  // uncompressed offset of the data following the flush
+	dict []byte // the refineWindow bytes before pos
+}
+
+// IndexDensity returns the number of positions that Seek can start
+// decompressing at: the blocks described by the metadata, and the points
+// found inside them so far. It is 0 for Readers without metadata, and is
+// meant for diagnostics.
+//
+// When the metadata is coarse, seeking into a block of more than 128 KiB
+// decompresses it from its start. While doing so, a seeking Reader records
+// the sync flushes it passes, such as those written by Writer.Flush or by
+// the Writer of metadata that was downsampled, at least 64 KiB apart,
+// together with the preceding 32 KiB of data. Later seeks into the same
+// region start at the closest of them, so random access gets cheaper as a
+// file is used. Up to 128 points (4 MiB of data) are kept, and none are
+// recorded while a block cache is set.
+func (z *Reader) IndexDensity() int {
+	if !z.canSeek {
+		return 0
+	}
+	z.refineMu.Lock()
+	defer z.refineMu.Unlock()
+	blocks := len(z.blockStarts) - 3 // data blocks, followed by the final marker block
+	if blocks < 1 {
+		blocks = 1
+	}
+	return blocks + len(z.refined)
+}
+
+// refinedPoint returns the recorded point closest before pos that lies
+// after blockStart, the uncompressed start of the block holding pos.
+func (z *Reader) refinedPoint(pos, blockStart int64) (refinePoint, bool) {
+	z.refineMu.Lock()
+	defer z.refineMu.Unlock()
+	i := sort.Search(len(z.refined), func(i int) bool { return z.refined[i].pos > pos }) - 1
+	if i < 0 || z.refined[i].pos <= blockStart {
+		return refinePoint{}, false
+	}
+	return z.refined[i], true
+}
+
+// wantRefinePoint reports whether a point at pos would be recorded.
+func (z *Reader) wantRefinePoint(pos int64) bool {
+	z.refineMu.Lock()
+	defer z.refineMu.Unlock()
+	if len(z.refined) >= refineMaxPoints {
+		return false
+	}
+	i := sort.Search(len(z.refined), func(i int) bool { return z.refined[i].pos >= pos })
+	if i < len(z.refined) && z.refined[i].pos-pos < refineSpacing {
+		return false
+	}
+	return i == 0 || pos-z.refined[i-1].pos >= refineSpacing
+}
+
+// addRefinePoint records p, keeping the points sorted by position.
+func (z *Reader) addRefinePoint(p refinePoint) {
+	z.refineMu.Lock()
+	defer z.refineMu.Unlock()
+	i := sort.Search(len(z.refined), func(i int) bool { return z.refined[i].pos >= p.pos })
+	z.refined = append(z.refined, refinePoint{})
+	copy(z.refined[i+1:], z.refined[i:])
+	z.refined[i] = p
+}
+
+// refine returns dec, which decompresses the block holding pos from the
+// uncompressed offset start, wrapped so that it records the sync flushes
+// in the rest of the block. dict is the data before start that dec refers
+// to, if any. dec is returned as it is if the block is too small or the
+// position in the compressed input cannot be followed.
+func (z *Reader) refine(dec io.ReadCloser, start, pos int64, dict []byte) io.ReadCloser {
+	var src *seekTracker
+	switch s := z.r.(type) {
+	case *seekTracker:
+		src = s
+	case *byteSeekTracker:
+		src = &s.seekTracker
+	default:
+		return dec
+	}
+	// The previous refiner may have been stopped before the end of its
+	// block.
+	src.stopScan()
+	if z.cache != nil || z.readTimeout > 0 {
+		return dec
+	}
+	br, _ := z.bufr.(*bufio.Reader)
+	if br == nil && z.bufr != z.r {
+		return dec
+	}
+	b, _, discard := locateBlock(z.blockStarts, z.metaBlockSize, z.ustarts, pos)
+	blockStart := pos - discard
+	end := z.isize
+	if z.ustarts != nil && b+1 < len(z.ustarts) {
+		end = z.ustarts[b+1]
+	} else if z.ustarts == nil && blockStart+int64(z.metaBlockSize) < end {
+		end = blockStart + int64(z.metaBlockSize)
+	}
+	if end-blockStart <= 2*refineSpacing || end-start <= refineSpacing {
+		return dec
+	}
+	src.startScan()
+	r := &refiner{
+		ReadCloser: dec,
+		z:          z,
+		src:        src,
+		br:         br,
+		blockStart: blockStart,
+		end:        end,
+		pos:        start,
+		window:     append(make([]byte, 0, refineWindow), dict...),
+		buf:        make([]byte, 2*refineWindow),
+	}
+	r.comp = r.consumed()
+	return r
+}
+
+// A refiner passes on the data of a decompressor and records the sync
+// flushes it passes until the end of the block.
+//
+// The bytes of a flush marker also occur in ordinary compressed data, and
+// in the data of stored blocks, so a marker found where a flush could be
+// is only a candidate. It is recorded once decompressing the input after
+// it, with the data before it as dictionary, gives the next 4 KiB of data
+// the decompressor returned after it.
+//
+// The decompressor returns the data decoded before a flush before it goes
+// on past the flush, unless the flush itself passes that data on, in which
+// case the call returns right after the flush. Otherwise the flush is read
+// in a call that returns data decoded after it, and is at the position
+// reached by the previous call. Since the decompressor reads ahead by at
+// most a couple of bytes, such a flush starts close to the input consumed
+// by the previous call, which also rules out data that only looks like a
+// flush.
+type refiner struct {
+	io.ReadCloser
+	z          *Reader
+	src        *seekTracker
+	br         *bufio.Reader // buffers src, nil if src is read directly
+	blockStart int64         // uncompressed start of the block
+	end        int64         // uncompressed end of the block
+	pos        int64         // uncompressed offset reached by the previous call
+	comp       int64         // compressed input consumed by the previous call
+	window     []byte        // up to refineWindow bytes before pos, within the block
+	buf        []byte        // large enough to take all data of a flush
+	candidates []refineCandidate
+	pending    []byte // data decoded but not yet returned
+	err        error
+}
+
+func (r *refiner) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.pos >= r.end {
+			r.stop()
+			return r.ReadCloser.Read(p)
+		}
+		n, err := r.ReadCloser.Read(r.buf)
+		r.observe(r.buf[:n])
+		r.pending, r.err = r.buf[:n], err
+		if err != nil {
+			// The caller may read the trailer next.
+			r.stop()
+		}
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// A refineCandidate is a possible seek point, and the data that follows
+// it, to check it against.
+type refineCandidate struct {
+	refinePoint
+	next []byte
+}
+
+// stop ends the scan for flushes. It is called before an error of the
+// decompressor is passed on, since the caller may read the trailer from
+// the source after that. Candidates that could not be checked yet are
+// dropped.
+func (r *refiner) stop() {
+	r.src.stopScan()
+	r.candidates = nil
+}
+
+// consumed returns the compressed offset consumed by the decompressor.
+func (r *refiner) consumed() int64 {
+	if r.br != nil {
+		return r.src.pos - int64(r.br.Buffered())
+	}
+	return r.src.pos
+}
+
+// observe records the flushes read by a call of the decompressor that
+// returned data, and adds data to the window.
+func (r *refiner) observe(data []byte) {
+	comp := r.consumed()
+	marks := r.src.marks
+	for len(marks) > 0 && marks[0] < r.comp+2 {
+		marks = marks[1:]
+	}
+	if len(marks) > 0 && marks[0] <= r.comp+5 && (marks[0] < comp || len(data) == 0) {
+		// The flush follows the data of the previous call.
+		r.record(marks[0])
+	}
+	r.addWindow(data)
+	if k := len(marks) - 1; k >= 0 && marks[k] == comp && len(data) > 0 {
+		// The flush was read after the data, which it passed on.
+		r.record(marks[k])
+	}
+	for len(marks) > 0 && marks[0] <= comp {
+		marks = marks[1:]
+	}
+	r.src.marks = append(r.src.marks[:0], marks...)
+	r.comp = comp
+	r.check()
+}
+
+// record adds the flush ending at the compressed offset comp, which is at
+// the current position, to the candidate seek points.
+func (r *refiner) record(comp int64) {
+	if r.pos-r.blockStart < refineSpacing || len(r.candidates) >= refinePending || !r.z.wantRefinePoint(r.pos) {
+		return
+	}
+	r.candidates = append(r.candidates, refineCandidate{refinePoint: refinePoint{
+		comp: comp,
+		pos:  r.pos,
+		dict: append([]byte(nil), r.window...),
+	}})
+}
+
+// check records the candidates followed by enough data if they are real
+// flushes, and drops the captured input that is no longer needed.
+func (r *refiner) check() {
+	keep := r.candidates[:0]
+	for _, c := range r.candidates {
+		if len(c.next) < refineCheck {
+			keep = append(keep, c)
+		} else if r.z.wantRefinePoint(c.pos) && r.resumes(c) {
+			r.z.addRefinePoint(c.refinePoint)
+		}
+	}
+	r.candidates = keep
+	from := r.comp
+	for _, c := range r.candidates {
+		if c.comp < from {
+			from = c.comp
+		}
+	}
+	r.src.discardCaptured(from)
+}
+
+// resumes reports whether decompressing the captured input from c gives
+// the data that followed it.
+func (r *refiner) resumes(c refineCandidate) bool {
+	off := c.comp - r.src.captureAt
+	if !r.src.scan || off < 0 || off > int64(len(r.src.captured)) {
+		return false
+	}
+	fr := flate.NewReaderDict(bytes.NewReader(r.src.captured[off:]), c.dict)
+	defer fr.Close()
+	got := make([]byte, len(c.next))
+	if _, err := io.ReadFull(fr, got); err != nil {
+		return false
+	}
+	return bytes.Equal(got, c.next)
+}
+
+// addWindow appends data to the window and the candidates, and advances
+// the position.
+func (r *refiner) addWindow(data []byte) {
+	for i := range r.candidates {
+		c := &r.candidates[i]
+		if n := refineCheck - len(c.next); n > 0 {
+			if n > len(data) {
+				n = len(data)
+			}
+			c.next = append(c.next, data[:n]...)
+		}
+	}
+	if len(data) >= refineWindow {
+		r.window = append(r.window[:0], data[len(data)-refineWindow:]...)
+	} else {
+		if keep := refineWindow - len(data); len(r.window) > keep {
+			r.window = append(r.window[:0], r.window[len(r.window)-keep:]...)
+		}
+		r.window = append(r.window, data...)
+	}
+	r.pos += int64(len(data))
+}
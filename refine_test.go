@@ -0,0 +1,178 @@
+package sgzip
+
+import (
+	"bytes"
+	oldgz "compress/gzip"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestIndexRefinement(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 4<<20, 16<<10)
+	coarse := meta.Downsample(64)
+	r, err := NewSeekingReader(bytes.NewReader(compressed), &coarse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err := r.SetConcurrency(4096, 1); err != nil {
+		t.Fatal(err)
+	}
+	if d := r.IndexDensity(); d != 4 {
+		t.Fatalf("IndexDensity = %d, want 4", d)
+	}
+
+	// seekRead seeks to pos, reads 1000 bytes and returns how many bytes
+	// were decompressed.
+	seekRead := func(pos int64) int64 {
+		before := r.DecodedBytes()
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, 1000)
+		if _, err := io.ReadFull(r, got); err != nil {
+			t.Fatalf("Seek(%d): %v", pos, err)
+		}
+		if !bytes.Equal(got, in[pos:pos+1000]) {
+			t.Fatalf("Seek(%d): content does not match", pos)
+		}
+		return r.DecodedBytes() - before
+	}
+	if n := seekRead(900000); n < 900000 {
+		t.Errorf("first seek decompressed %d bytes, want the block up to the target", n)
+	}
+	if d := r.IndexDensity(); d <= 4 {
+		t.Fatalf("IndexDensity = %d after decompressing a coarse block, want more than 4", d)
+	}
+	if n := seekRead(500000); n > 100000 {
+		t.Errorf("seek into the refined region decompressed %d bytes", n)
+	}
+	if n := seekRead(2500000); n < 2500000-2<<20 {
+		t.Errorf("seek into another block decompressed only %d bytes", n)
+	}
+	if d := r.IndexDensity(); d > 4+refineMaxPoints {
+		t.Errorf("IndexDensity = %d, want at most %d", d, 4+refineMaxPoints)
+	}
+}
+
+func TestIndexRefinementDict(t *testing.T) {
+	// compress/gzip keeps the history across flushes, so the data after
+	// them refers to the data before, and the stream is a single block.
+	rng := rand.New(rand.NewSource(1))
+	phrase := make([]byte, 5000)
+	rng.Read(phrase)
+	var in []byte
+	var buf bytes.Buffer
+	w := oldgz.NewWriter(&buf)
+	for len(in) < 2<<20 {
+		chunk := append([]byte{}, phrase...)
+		chunk[rng.Intn(len(chunk))]++
+		in = append(in, chunk...)
+		w.Write(chunk)
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	meta, err := RebuildIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.NumBlocks() != 2 || buf.Len() > len(in)/2 {
+		t.Fatalf("got %d blocks and %d compressed bytes, want a single block referring to earlier chunks", meta.NumBlocks(), buf.Len())
+	}
+	r, err := NewSeekingReader(bytes.NewReader(buf.Bytes()), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.SetConcurrency(4096, 1)
+
+	if _, err := r.Seek(int64(len(in))-10, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		t.Fatal(err)
+	}
+	if r.IndexDensity() < 10 {
+		t.Fatalf("IndexDensity = %d, want flushes to be recorded", r.IndexDensity())
+	}
+	for i := 0; i < 50; i++ {
+		pos := rng.Int63n(int64(len(in)) - 3000)
+		before := r.DecodedBytes()
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, 3000)
+		if _, err := io.ReadFull(r, got); err != nil {
+			t.Fatalf("Seek(%d): %v", pos, err)
+		}
+		if !bytes.Equal(got, in[pos:pos+3000]) {
+			t.Fatalf("Seek(%d): content does not match", pos)
+		}
+		if n := r.DecodedBytes() - before; n > 100000 {
+			t.Errorf("Seek(%d): decompressed %d bytes", pos, n)
+		}
+	}
+}
+
+func TestIndexRefinementFalseMarkers(t *testing.T) {
+	// Sync flush markers inside ordinary data must not become seek points.
+	rng := rand.New(rand.NewSource(1))
+	var in []byte
+	for len(in) < 3<<20 {
+		chunk := make([]byte, rng.Intn(200))
+		rng.Read(chunk)
+		in = append(append(in, chunk...), 0, 0, 0xff, 0xff)
+	}
+	for _, level := range []int{NoCompression, BestSpeed, DefaultCompression} {
+		// A single block holds no flushes, and 64 KiB blocks described by
+		// coarse metadata are separated by real ones.
+		for _, blockSize := range []int{4 << 20, 64 << 10} {
+			var buf bytes.Buffer
+			w, _ := NewWriterLevel(&buf, level)
+			w.SetConcurrency(blockSize, 4)
+			w.Write(in)
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			meta := w.MetaData()
+			if blockSize == 64<<10 {
+				meta = meta.Downsample(64)
+			}
+			r, err := NewSeekingReader(bytes.NewReader(buf.Bytes()), &meta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.SetConcurrency(4096, 1)
+			if _, err := io.Copy(io.Discard, r); err != nil {
+				t.Fatalf("level %d, blocks of %d: %v", level, blockSize, err)
+			}
+			seeks, bad := 300, 0
+			if blockSize > 64<<10 {
+				// Every seek decompresses the block up to its target.
+				seeks = 50
+			}
+			for i := 0; i < seeks; i++ {
+				pos := rng.Int63n(int64(len(in)) - 1000)
+				if _, err := r.Seek(pos, io.SeekStart); err != nil {
+					t.Fatal(err)
+				}
+				got := make([]byte, 1000)
+				if _, err := io.ReadFull(r, got); err != nil || !bytes.Equal(got, in[pos:pos+1000]) {
+					bad++
+				}
+			}
+			if bad > 0 {
+				t.Errorf("level %d, blocks of %d: %d of %d seeks failed", level, blockSize, bad, seeks)
+			}
+			if d := r.IndexDensity(); blockSize == 64<<10 && d < 10 {
+				t.Errorf("level %d: IndexDensity = %d, want the flushes between blocks to be recorded", level, d)
+			}
+			r.Close()
+		}
+	}
+}
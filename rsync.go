@@ -0,0 +1,57 @@
+package sgzip
+
+// Parameters of the content-defined block boundaries of SetRsyncable.
+const (
+	rsyncMinBlock = 16 << 10     // smallest block ending at a boundary
+	rsyncMask     = 0xffff << 48 // a boundary every 64 KiB on average
+)
+
+// rsyncGear holds a pseudo-random value for each byte value, for the gear
+// hash used by SetRsyncable. It must not change, so that the same data is
+// split the same way by every version.
+var rsyncGear = func() (g [256]uint64) {
+	x := uint64(0x9e3779b97f4a7c15)
+	for i := range g {
+		// splitmix64
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+		z = (z ^ z>>27) * 0x94d049bb133111eb
+		g[i] = z ^ z>>31
+	}
+	return g
+}()
+
+// SetRsyncable makes the Writer end blocks at points chosen by the data,
+// similar to gzip --rsyncable, so that a local change of the input only
+// changes the compressed output of the blocks around it. Tools like rsync
+// then transfer only those parts of a changed file.
+//
+// A block ends after a byte where a rolling hash of the last 64 bytes
+// written has its top 16 bits cleared, once the block holds at least
+// 16 KiB, which gives blocks of about 80 to 100 KiB on average for varied
+// data. Since the hash only depends on the data, the blocks after a
+// change end at the same points as before it. Blocks still end when they
+// hold the block size set by SetConcurrency, and the block after such a
+// cut ends at the next point chosen by the data again. Every block is an
+// independent seek point, recorded in the BlockLens field of the metadata
+// like the blocks of SetBoundaryFunc.
+//
+// Compressing the blocks independently costs a little: the output is
+// typically about 1% larger than with blocks of 1 MiB, since matches
+// cannot reach into the previous block.
+//
+// SetRsyncable installs a boundary function, replacing one set by
+// SetBoundaryFunc, and passing false removes it again. It must be called
+// before the first Write, cannot be combined with SetAdaptiveBlocks and is
+// kept across Reset.
+func (z *Writer) SetRsyncable(ok bool) error {
+	if !ok {
+		return z.SetBoundaryFunc(nil)
+	}
+	var h uint64
+	return z.SetBoundaryFunc(func(written int64, b byte) bool {
+		h = h<<1 + rsyncGear[b]
+		return written >= rsyncMinBlock && h&rsyncMask == 0
+	})
+}
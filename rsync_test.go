@@ -0,0 +1,81 @@
+package sgzip
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"testing"
+)
+
+// rsyncBlocks compresses in with SetRsyncable and returns the compressed
+// blocks.
+func rsyncBlocks(t *testing.T, in []byte) (blocks [][]byte, size int) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.SetRsyncable(true); err != nil {
+		t.Fatal(err)
+	}
+	w.Write(in)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	meta := w.MetaData()
+	r, err := NewSeekingReader(bytes.NewReader(buf.Bytes()), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil || !bytes.Equal(got, in) {
+		t.Fatalf("round trip: %d bytes, %v", len(got), err)
+	}
+	starts := parseBlockData(meta.BlockData, meta.BlockSize)
+	for i := 0; i+1 < len(starts)-1; i++ {
+		blocks = append(blocks, buf.Bytes()[starts[i]:starts[i+1]])
+	}
+	return blocks, buf.Len()
+}
+
+func TestRsyncable(t *testing.T) {
+	in := levelTestData(4 << 20)
+	blocks, size := rsyncBlocks(t, in)
+	if len(blocks) < 20 {
+		t.Fatalf("only %d blocks", len(blocks))
+	}
+
+	var plain bytes.Buffer
+	w := NewWriter(&plain)
+	w.Write(in)
+	w.Close()
+	if float64(size) > 1.02*float64(plain.Len()) {
+		t.Errorf("rsyncable output is %d bytes, %d without", size, plain.Len())
+	}
+
+	// Insert a few bytes in the middle: the blocks after the change are
+	// the same as before.
+	rng := rand.New(rand.NewSource(2))
+	changed := append(append(append([]byte{}, in[:2<<20]...), "inserted"...), in[2<<20:]...)
+	changed[rng.Intn(len(changed))]++
+	after, _ := rsyncBlocks(t, changed)
+	old := make(map[string]bool)
+	for _, b := range blocks {
+		old[string(b)] = true
+	}
+	var same int
+	for _, b := range after {
+		if old[string(b)] {
+			same++
+		}
+	}
+	if same < len(after)-4 {
+		t.Errorf("%d of %d blocks unchanged", same, len(after))
+	}
+
+	w = NewWriter(ioutil.Discard)
+	w.SetRsyncable(true)
+	if err := w.SetAdaptiveBlocks(1024, 16<<10); err == nil {
+		t.Error("SetAdaptiveBlocks with SetRsyncable: expected error")
+	}
+	if err := w.SetRsyncable(false); err != nil || w.boundary != nil {
+		t.Errorf("SetRsyncable(false): %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package sgzip
+
+import (
+	"io"
+	"sync"
+)
+
+// SafeReader wraps a Reader for use by several goroutines. Its methods
+// hold a lock while they call the Reader, so calls are serialized rather
+// than run in parallel. The position is shared as well: a Seek followed by
+// a Read in one goroutine may be interleaved with calls from another, so
+// use CopyRange to read a range in a single call.
+//
+// For parallel reads, give each goroutine a Reader of its own; Readers of
+// the same stream can share a BlockCache and, with NewRandomReader, a
+// single io.ReaderAt.
+type SafeReader struct {
+	mu sync.Mutex
+	r  *Reader
+}
+
+// NewSafeReader returns a SafeReader using r, which must not be used
+// directly afterwards.
+func NewSafeReader(r *Reader) *SafeReader {
+	return &SafeReader{r: r}
+}
+
+// Read is like Reader.Read.
+func (s *SafeReader) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Read(p)
+}
+
+// Seek is like Reader.Seek.
+func (s *SafeReader) Seek(offset int64, whence int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Seek(offset, whence)
+}
+
+// WriteTo is like Reader.WriteTo.
+func (s *SafeReader) WriteTo(w io.Writer) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.WriteTo(w)
+}
+
+// CopyRange is like Reader.CopyRange. Since the seek and the reads happen
+// under one lock, it can be used to read ranges concurrently.
+func (s *SafeReader) CopyRange(w io.Writer, start, length int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.CopyRange(w, start, length)
+}
+
+// Close is like Reader.Close.
+func (s *SafeReader) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Close()
+}
@@ -0,0 +1,50 @@
+package sgzip
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestSafeReader(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 300000, 16<<10)
+	r, err := NewSeekingReader(bytes.NewReader(compressed), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSafeReader(r)
+	defer s.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			for i := 0; i < 50; i++ {
+				start := int64(rnd.Intn(len(in) - 500))
+				var buf bytes.Buffer
+				if _, err := s.CopyRange(&buf, start, 500); err != nil {
+					errs <- err
+					return
+				}
+				if !bytes.Equal(buf.Bytes(), in[start:start+500]) {
+					errs <- fmt.Errorf("CopyRange(%d): content does not match", start)
+					return
+				}
+				// Unrelated calls must not race either.
+				s.Seek(int64(rnd.Intn(len(in))), io.SeekStart)
+				s.Read(make([]byte, 100))
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
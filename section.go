@@ -0,0 +1,35 @@
+package sgzip
+
+import "io"
+
+// NewSeekableSectionReader returns a Reader that reads the n uncompressed
+// bytes at offset off of the stream described by meta, which is read from
+// ra as by NewRandomReader, analogous to io.NewSectionReader. It presents
+// them as a stream of its own: it starts at offset 0, Read returns io.EOF
+// after n bytes, and Seek, io.SeekEnd included, CanSeek, CopyRange,
+// WriteToRange, Stream and Info use offsets and a size relative to the
+// window. This serves a sub-document of a large file without copying it.
+//
+// The window is clamped to the end of the data, and ErrInvalidSeek is
+// returned if off or n is negative or off is beyond the end. The checksum
+// of the data is only verified if the window covers all of it. Methods
+// working on the blocks of the stream, such as ReadBlock and ForEachBlock,
+// still see all of it. It is the caller's responsibility to call Close on
+// the Reader when done.
+func NewSeekableSectionReader(ra io.ReaderAt, meta *GzipMetadata, off, n int64) (*Reader, error) {
+	if err := checkVersion(meta); err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, ErrInvalidSeek
+	}
+	z, err := NewReaderWithOrigin(newBlockSource(ra, meta), meta, off)
+	if err != nil {
+		return nil, err
+	}
+	if n < meta.Size-off {
+		z.limited = true
+		z.limit = off + n
+	}
+	return z, nil
+}
@@ -0,0 +1,97 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestNewSeekableSectionReader(t *testing.T) {
+	in, comp, meta := testSeekableData(t, 300000, 32<<10)
+	ra := bytes.NewReader(comp)
+	const off, n = 50000, 100000
+	window := in[off : off+n]
+
+	r, err := NewSeekableSectionReader(ra, &meta, off, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if info := r.Info(); info.Size != n {
+		t.Errorf("Info().Size = %d, want %d", info.Size, n)
+	}
+	got, err := ioutil.ReadAll(struct{ io.Reader }{r})
+	if err != nil || !bytes.Equal(got, window) {
+		t.Errorf("Read: got %d bytes, %v, want %d", len(got), err, n)
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Errorf("ReadByte at the end: got %v, want io.EOF", err)
+	}
+
+	if pos, err := r.Seek(-10, io.SeekEnd); err != nil || pos != n-10 {
+		t.Fatalf("Seek(-10, SeekEnd) = %d, %v", pos, err)
+	}
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil || !bytes.Equal(buf.Bytes(), window[n-10:]) {
+		t.Errorf("WriteTo after SeekEnd: got %q, %v", buf.Bytes(), err)
+	}
+	var se *SeekError
+	if _, err := r.Seek(n+1, io.SeekStart); !errors.As(err, &se) || se.Size != n {
+		t.Errorf("Seek beyond the window: got %v", err)
+	}
+	if _, err := r.Seek(-1, io.SeekStart); !errors.As(err, &se) {
+		t.Errorf("Seek before the window: got %v", err)
+	}
+	if r.CanSeek(n) || !r.CanSeek(n-1) {
+		t.Error("CanSeek does not match the window")
+	}
+
+	buf.Reset()
+	if m, err := r.CopyRange(&buf, 1000, n); err != nil || m != n-1000 || !bytes.Equal(buf.Bytes(), window[1000:]) {
+		t.Errorf("CopyRange = %d, %v, want %d", m, err, n-1000)
+	}
+	buf.Reset()
+	if m, err := r.WriteToRange(&buf, n-500, n+500); err != nil || m != 500 || !bytes.Equal(buf.Bytes(), window[n-500:]) {
+		t.Errorf("WriteToRange = %d, %v, want 500", m, err)
+	}
+	if _, err := r.Seek(20, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	c, err := r.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = ioutil.ReadAll(c)
+	if err != nil || !bytes.Equal(got, window[20:]) {
+		t.Errorf("clone: got %d bytes, %v, want %d", len(got), err, n-20)
+	}
+	c.Close()
+
+	// A window reaching beyond the data ends with it.
+	r2, err := NewSeekableSectionReader(ra, &meta, 250000, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = ioutil.ReadAll(r2)
+	if err != nil || !bytes.Equal(got, in[250000:]) {
+		t.Errorf("clamped window: got %d bytes, %v, want %d", len(got), err, len(in)-250000)
+	}
+	r2.Close()
+
+	r3, err := NewSeekableSectionReader(ra, &meta, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadAll(r3); err != nil || len(got) != 0 {
+		t.Errorf("empty window: got %d bytes, %v", len(got), err)
+	}
+	r3.Close()
+
+	for _, w := range [][2]int64{{-1, 10}, {10, -1}, {int64(len(in)) + 1, 0}} {
+		if _, err := NewSeekableSectionReader(ra, &meta, w[0], w[1]); err != ErrInvalidSeek {
+			t.Errorf("window %v: got %v, want ErrInvalidSeek", w, err)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package sgzip
+
+import (
+	"bufio"
+	"io"
+)
+
+// seekTracker is an io.ReadSeeker that keeps track of the position of r,
+// so that seeks that would not move it are skipped, and counts the seeks
+// passed on to r. Seeks can be expensive, for example when r reads from
+// remote storage.
+type seekTracker struct {
+	r     io.ReadSeeker
+	pos   int64
+	known bool // pos is valid
+	seeks int64
+
+	// While scan is set, the offsets just after each sync flush marker
+	// read are appended to marks, and the bytes read from captureAt on
+	// are kept in captured, see refiner.
+	scan      bool
+	last      uint32 // the last four bytes read
+	marks     []int64
+	captured  []byte
+	captureAt int64
+}
+
+// byteSeekTracker is a seekTracker for sources that implement
+// io.ByteReader, which keeps them from being buffered again.
+type byteSeekTracker struct {
+	seekTracker
+	br io.ByteReader
+}
+
+// trackSeeks wraps r in a seekTracker. Sources read with ReadAt by
+// NewRandomReader are not wrapped, since their seeks are free.
+func trackSeeks(r io.ReadSeeker) io.ReadSeeker {
+	if _, ok := r.(*blockSource); ok {
+		return r
+	}
+	if br, ok := r.(io.ByteReader); ok {
+		return &byteSeekTracker{seekTracker: seekTracker{r: r}, br: br}
+	}
+	return &seekTracker{r: r}
+}
+
+func (s *seekTracker) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if s.scan {
+		s.captured = append(s.captured, p[:n]...)
+		for i, b := range p[:n] {
+			s.last = s.last<<8 | uint32(b)
+			if s.last == syncMarker {
+				s.marks = append(s.marks, s.pos+int64(i)+1)
+			}
+		}
+	}
+	s.pos += int64(n)
+	return n, err
+}
+
+func (s *seekTracker) Seek(offset int64, whence int) (int64, error) {
+	if s.known {
+		switch whence {
+		case io.SeekCurrent:
+			if offset == 0 {
+				return s.pos, nil
+			}
+			offset, whence = s.pos+offset, io.SeekStart
+			fallthrough
+		case io.SeekStart:
+			if offset == s.pos {
+				return s.pos, nil
+			}
+		}
+	}
+	s.seeks++
+	s.last = 0
+	if s.scan {
+		// The input captured so far does not continue at the new position.
+		s.stopScan()
+	}
+	pos, err := s.r.Seek(offset, whence)
+	s.pos, s.known = pos, err == nil
+	return pos, err
+}
+
+// startScan starts looking for sync flush markers in the input read from
+// now on.
+func (s *seekTracker) startScan() {
+	s.scan = true
+	s.last = 0
+	s.marks = s.marks[:0]
+	s.captured = s.captured[:0]
+	s.captureAt = s.pos
+}
+
+// stopScan stops looking for sync flush markers.
+func (s *seekTracker) stopScan() {
+	s.scan = false
+	s.marks = s.marks[:0]
+	s.captured = s.captured[:0]
+}
+
+// discardCaptured drops the captured input before offset off.
+func (s *seekTracker) discardCaptured(off int64) {
+	d := off - s.captureAt
+	if d <= 0 {
+		return
+	}
+	if d > int64(len(s.captured)) {
+		d = int64(len(s.captured))
+	}
+	s.captured = s.captured[:copy(s.captured, s.captured[d:])]
+	s.captureAt += d
+}
+
+func (s *byteSeekTracker) ReadByte() (byte, error) {
+	b, err := s.br.ReadByte()
+	if err == nil {
+		if s.scan {
+			s.captured = append(s.captured, b)
+			s.last = s.last<<8 | uint32(b)
+			if s.last == syncMarker {
+				s.marks = append(s.marks, s.pos+1)
+			}
+		}
+		s.pos++
+	}
+	return b, err
+}
+
+// seekSource positions the compressed input at offset off of the stream.
+// Short forward moves are made by reading through the buffer instead of
+// seeking.
+func (z *Reader) seekSource(off int64) error {
+	if err := z.stalled(); err != nil {
+		return err
+	}
+	if s, ok := z.r.(*seekTracker); ok && s.known && z.readTimeout <= 0 {
+		if br, ok := z.bufr.(*bufio.Reader); ok {
+			// Reading a little further is cheaper than seeking.
+			start := s.pos - int64(br.Buffered())
+			if off >= start && off-s.pos <= int64(br.Size()) {
+				_, err := br.Discard(int(off - start))
+				z.restartInputCount()
+				return err
+			}
+		}
+	}
+	if _, err := z.r.(io.ReadSeeker).Seek(off, io.SeekStart); err != nil {
+		return err
+	}
+	z.bufr = z.bufferedReader(z.withTimeout(z.r))
+	z.restartInputCount()
+	return nil
+}
+
+// SourceSeeks returns the number of Seek calls made on the compressed
+// stream of a Reader created with metadata. Seeks to the current position
+// are skipped, and a Seek of the Reader to a block that starts in or
+// shortly after the data in its buffer reads on instead, which helps with
+// sources where seeking is slow, such as remote storage. The count is
+// meant for diagnostics.
+func (z *Reader) SourceSeeks() int64 {
+	switch s := z.r.(type) {
+	case *seekTracker:
+		return s.seeks
+	case *byteSeekTracker:
+		return s.seeks
+	}
+	return 0
+}
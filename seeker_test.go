@@ -0,0 +1,72 @@
+package sgzip
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+)
+
+// plainSeeker hides all methods of its source but Read and Seek.
+type plainSeeker struct {
+	r io.ReadSeeker
+}
+
+func (s plainSeeker) Read(p []byte) (int, error) { return s.r.Read(p) }
+
+func (s plainSeeker) Seek(off int64, whence int) (int64, error) { return s.r.Seek(off, whence) }
+
+func TestSourceSeeks(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 300000, 16<<10)
+	r, err := NewSeekingReader(plainSeeker{bytes.NewReader(compressed)}, &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, ok := r.bufr.(*bufio.Reader); !ok {
+		t.Fatalf("source read through %T, want *bufio.Reader", r.bufr)
+	}
+	// Keep the read-ahead from moving far beyond the data that is read.
+	if err := r.SetConcurrency(512, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(pos int64) {
+		t.Helper()
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		p := make([]byte, 10)
+		if _, err := io.ReadFull(r, p); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(p, in[pos:pos+10]) {
+			t.Fatalf("content at %d does not match", pos)
+		}
+	}
+	read(100000)
+	seeks := r.SourceSeeks()
+	if seeks == 0 {
+		t.Fatal("no seeks counted")
+	}
+	// The following blocks are small enough to be buffered already.
+	read(150000)
+	read(200000)
+	if n := r.SourceSeeks(); n != seeks {
+		t.Errorf("seeks within the buffer: got %d seeks, want %d", n, seeks)
+	}
+	read(10)
+	if n := r.SourceSeeks(); n != seeks+1 {
+		t.Errorf("seek backward: got %d seeks, want %d", n, seeks+1)
+	}
+
+	// Sources that can be read byte by byte are still read directly.
+	r2, err := NewSeekingReader(bytes.NewReader(compressed), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r2.Close()
+	if _, ok := r2.bufr.(*bufio.Reader); ok {
+		t.Error("bytes.Reader was wrapped in a buffer")
+	}
+}
@@ -0,0 +1,166 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// An Index gives access to the block layout of a seekable stream described
+// by its GzipMetadata: which block holds an uncompressed offset, where a
+// block starts, and so on, answered without recomputing the layout for
+// every query. GzipMetadata remains the format in which metadata is
+// stored and exchanged; an Index wraps it once it has been loaded.
+//
+// Open and OpenAt create Readers from an Index. NewSeekingReader and
+// NewRandomReader keep taking a *GzipMetadata, which Metadata returns.
+// An Index must not be modified while it is in use, and it is safe for
+// concurrent use.
+type Index struct {
+	meta        GzipMetadata
+	blockStarts []int64 // compressed start of each block, see parseBlockData
+	ustarts     []int64 // uncompressed start of each block if their sizes vary
+}
+
+// NewIndex returns an Index for meta, which must describe at least one
+// block. The Index keeps meta, which must not be modified afterwards.
+// ErrInvalidMetadata is returned if meta is inconsistent, and
+// ErrUnsupportedMetadataVersion if it was written by a newer version of
+// this package.
+func NewIndex(meta GzipMetadata) (*Index, error) {
+	if err := checkVersion(&meta); err != nil {
+		return nil, err
+	}
+	if err := checkUBlockData(&meta); err != nil {
+		return nil, err
+	}
+	if meta.NumBlocks() == 0 || (!meta.variableBlocks() && meta.BlockSize <= 0) {
+		return nil, fmt.Errorf("%w: no blocks", ErrInvalidMetadata)
+	}
+	return &Index{
+		meta:        meta,
+		blockStarts: parseBlockData(meta.BlockData, meta.BlockSize),
+		ustarts:     uncompressedStarts(&meta),
+	}, nil
+}
+
+// ReadIndex reads an Index stored in the binary index format, as written
+// by WriteTo or EncodeIndex, from r.
+func ReadIndex(r io.Reader) (*Index, error) {
+	meta, err := DecodeIndex(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewIndex(meta)
+}
+
+// Metadata returns the metadata of x, for functions taking metadata such
+// as NewSeekingReader. It must not be modified.
+func (x *Index) Metadata() *GzipMetadata {
+	return &x.meta
+}
+
+// NumBlocks returns the number of blocks, as GzipMetadata.NumBlocks does.
+func (x *Index) NumBlocks() int {
+	return x.meta.NumBlocks()
+}
+
+// Size returns the size of the uncompressed data.
+func (x *Index) Size() int64 {
+	return x.meta.Size
+}
+
+// BlockForOffset returns the index of the block holding the uncompressed
+// offset off, found by a binary search if the block sizes vary. Offsets
+// after the last indexed block are in that block, as for Seek. An error
+// is returned if off is not within the data.
+func (x *Index) BlockForOffset(off int64) (int, error) {
+	if off < 0 || off >= x.meta.Size {
+		return 0, &SeekError{Offset: off, Size: x.meta.Size}
+	}
+	block, _, _ := locateBlock(x.blockStarts, x.meta.BlockSize, x.ustarts, off)
+	return block, nil
+}
+
+// OffsetForBlock returns the uncompressed offset at which block i starts.
+func (x *Index) OffsetForBlock(i int) (int64, error) {
+	b, err := x.Block(i)
+	return b.UncompressedOffset, err
+}
+
+// Block returns the position of block i in both streams, as
+// GzipMetadata.BlockInfo does.
+func (x *Index) Block(i int) (BlockInfo, error) {
+	if i < 0 || i >= x.NumBlocks() {
+		return BlockInfo{}, fmt.Errorf("gzip: block %d out of range [0, %d)", i, x.NumBlocks())
+	}
+	uoff := int64(i) * int64(x.meta.BlockSize)
+	if x.ustarts != nil {
+		uoff = x.ustarts[i]
+	}
+	if uoff > x.meta.Size {
+		uoff = x.meta.Size
+	}
+	return BlockInfo{
+		Index:              i,
+		CompressedOffset:   x.blockStarts[i],
+		CompressedLength:   x.blockStarts[i+1] - x.blockStarts[i],
+		UncompressedOffset: uoff,
+		UncompressedLength: blockLen(&x.meta, i),
+	}, nil
+}
+
+// Coverage returns the fraction of the data an entry covers on average,
+// see GzipMetadata.Coverage.
+func (x *Index) Coverage() float64 {
+	return x.meta.Coverage()
+}
+
+// Open returns a Reader for the stream read from r that seeks with x, as
+// NewSeekingReader does.
+func (x *Index) Open(r io.ReadSeeker) (*Reader, error) {
+	return NewSeekingReader(r, &x.meta)
+}
+
+// OpenAt returns a Reader for the stream read from ra that seeks with x,
+// as NewRandomReader does.
+func (x *Index) OpenAt(ra io.ReaderAt) (*Reader, error) {
+	return NewRandomReader(ra, &x.meta)
+}
+
+// WriteTo writes x to w in the binary index format, which ReadIndex
+// reads.
+func (x *Index) WriteTo(w io.Writer) (int64, error) {
+	b, err := x.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(b)
+	return int64(n), err
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler with the binary index
+// format.
+func (x *Index) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := EncodeIndex(&buf, &x.meta); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, replacing x with
+// the Index stored in data in the binary index format.
+func (x *Index) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	y, err := ReadIndex(r)
+	if err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return errors.New("gzip: data after the index")
+	}
+	*x = *y
+	return nil
+}
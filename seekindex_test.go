@@ -0,0 +1,99 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	in, comp, meta := testSeekableData(t, 100000, 4096)
+	x, err := NewIndex(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.NumBlocks() != meta.NumBlocks() || x.Size() != int64(len(in)) || x.Coverage() != meta.Coverage() {
+		t.Errorf("got %d blocks, size %d, coverage %v", x.NumBlocks(), x.Size(), x.Coverage())
+	}
+	for i := 0; i < x.NumBlocks(); i++ {
+		got, err := x.Block(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, _ := meta.BlockInfo(i); got != want {
+			t.Errorf("block %d: got %+v, want %+v", i, got, want)
+		}
+		off, err := x.OffsetForBlock(i)
+		if err != nil || off != got.UncompressedOffset {
+			t.Errorf("OffsetForBlock(%d) = %d, %v", i, off, err)
+		}
+	}
+	for _, off := range []int64{0, 1, 4095, 4096, 50000, int64(len(in)) - 1} {
+		i, err := x.BlockForOffset(off)
+		if err != nil {
+			t.Fatalf("BlockForOffset(%d): %v", off, err)
+		}
+		b, _ := x.Block(i)
+		if off < b.UncompressedOffset || off >= b.UncompressedOffset+b.UncompressedLength {
+			t.Errorf("BlockForOffset(%d) = %d, holding [%d, %d)", off, i, b.UncompressedOffset, b.UncompressedOffset+b.UncompressedLength)
+		}
+	}
+	for _, off := range []int64{-1, int64(len(in))} {
+		if _, err := x.BlockForOffset(off); !errors.Is(err, ErrInvalidSeek) {
+			t.Errorf("BlockForOffset(%d): got %v", off, err)
+		}
+	}
+	for _, i := range []int{-1, x.NumBlocks()} {
+		if _, err := x.OffsetForBlock(i); err == nil {
+			t.Errorf("OffsetForBlock(%d): no error", i)
+		}
+	}
+
+	// Round trip through the binary index format.
+	b, err := x.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var y Index
+	if err := y.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if y.NumBlocks() != x.NumBlocks() || y.Size() != x.Size() {
+		t.Errorf("after round trip: %d blocks, size %d", y.NumBlocks(), y.Size())
+	}
+	if err := y.UnmarshalBinary(append(b, 0)); err == nil {
+		t.Error("trailing data: no error")
+	}
+	var buf bytes.Buffer
+	if n, err := x.WriteTo(&buf); err != nil || n != int64(len(b)) {
+		t.Fatalf("WriteTo: %d, %v", n, err)
+	}
+	z, err := ReadIndex(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := z.Open(bytes.NewReader(comp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Seek(50000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(got, in[50000:]) {
+		t.Errorf("Open: got %d bytes, %v", len(got), err)
+	}
+	ra, err := z.OpenAt(bytes.NewReader(comp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadAll(ra); err != nil || !bytes.Equal(got, in) {
+		t.Errorf("OpenAt: got %d bytes, %v", len(got), err)
+	}
+
+	if _, err := NewIndex(GzipMetadata{}); !errors.Is(err, ErrInvalidMetadata) {
+		t.Errorf("empty metadata: got %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package sgzip
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// CompressSharded compresses src into shards seekable gzip files of about
+// equal uncompressed size, for processing the parts of a large input in
+// parallel. Shard i is written to the writer returned by open(i), which
+// is called when the shard is started, and holds the data following that
+// of shard i-1. The shards are split on block boundaries: the blocks of
+// src are divided evenly between them, so their sizes differ by at most
+// one block. Each shard is a complete gzip file, with no name in its
+// header, and the returned slice holds the metadata of each, in order.
+//
+// The size of src must be known: it is taken from a Len method, as
+// *bytes.Reader and *strings.Reader have, from an *os.File, or by seeking
+// an io.Seeker, from its current position. Data beyond that size is added
+// to the last shard. If src holds fewer blocks than shards, the last
+// shards are empty gzip files.
+//
+// The writers are not closed. If an error occurs, the metadata of the
+// shards finished before it is returned with it.
+func CompressSharded(src io.Reader, shards int, level, blockSize int, open func(i int) (io.Writer, error)) ([]GzipMetadata, error) {
+	if shards <= 0 {
+		return nil, fmt.Errorf("gzip: invalid number of shards: %d", shards)
+	}
+	if !ValidLevel(level) {
+		return nil, fmt.Errorf("gzip: invalid compression level: %d (must be between %d and %d)", level, HuffmanOnly, BestCompression)
+	}
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("gzip: invalid block size: %d", blockSize)
+	}
+	size, err := remainingSize(src)
+	if err != nil {
+		return nil, err
+	}
+	blocks := (size + int64(blockSize) - 1) / int64(blockSize)
+	metas := make([]GzipMetadata, 0, shards)
+	for i := 0; i < shards; i++ {
+		dst, err := open(i)
+		if err != nil {
+			return metas, err
+		}
+		r := src
+		if i < shards-1 {
+			n := blocks / int64(shards)
+			if int64(i) < blocks%int64(shards) {
+				n++
+			}
+			r = io.LimitReader(src, n*int64(blockSize))
+		}
+		meta, err := compressFile(dst, r, "", time.Time{}, level, blockSize)
+		if err != nil {
+			return metas, err
+		}
+		metas = append(metas, meta)
+	}
+	return metas, nil
+}
+
+// remainingSize returns the number of bytes left to read from r, see
+// CompressSharded.
+func remainingSize(r io.Reader) (int64, error) {
+	switch s := r.(type) {
+	case interface{ Len() int }:
+		return int64(s.Len()), nil
+	case *os.File:
+		fi, err := s.Stat()
+		if err != nil {
+			return 0, err
+		}
+		if fi.Mode().IsRegular() {
+			pos, err := s.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return 0, err
+			}
+			return fi.Size() - pos, nil
+		}
+	case io.Seeker:
+		pos, err := s.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, err
+		}
+		end, err := s.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := s.Seek(pos, io.SeekStart); err != nil {
+			return 0, err
+		}
+		return end - pos, nil
+	}
+	return 0, errors.New("gzip: input size unknown")
+}
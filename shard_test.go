@@ -0,0 +1,93 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestCompressSharded(t *testing.T) {
+	in := levelTestData(9500)
+	var outs []*bytes.Buffer
+	open := func(i int) (io.Writer, error) {
+		if i != len(outs) {
+			t.Fatalf("opened shard %d after %d", i, len(outs))
+		}
+		outs = append(outs, new(bytes.Buffer))
+		return outs[i], nil
+	}
+	metas, err := CompressSharded(bytes.NewReader(in), 3, DefaultCompression, 1000, open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metas) != 3 || len(outs) != 3 {
+		t.Fatalf("got %d metadata and %d shards, want 3", len(metas), len(outs))
+	}
+	var got []byte
+	for i, want := range []int64{4000, 3000, 2500} {
+		if metas[i].Size != want {
+			t.Errorf("shard %d: size %d, want %d", i, metas[i].Size, want)
+		}
+		r, err := NewRandomReader(bytes.NewReader(outs[i].Bytes()), &metas[i])
+		if err != nil {
+			t.Fatalf("shard %d: %v", i, err)
+		}
+		if _, err := r.Seek(metas[i].Size-10, io.SeekStart); err != nil {
+			t.Fatalf("shard %d: %v", i, err)
+		}
+		tail, err := ioutil.ReadAll(r)
+		if err != nil || !bytes.Equal(tail, in[int64(len(got))+metas[i].Size-10:int64(len(got))+metas[i].Size]) {
+			t.Errorf("shard %d: tail %q, %v", i, tail, err)
+		}
+		r.Close()
+		data, err := ioutil.ReadAll(mustReader(t, outs[i].Bytes()))
+		if err != nil {
+			t.Fatalf("shard %d: %v", i, err)
+		}
+		got = append(got, data...)
+	}
+	if !bytes.Equal(got, in) {
+		t.Error("shards do not hold the input")
+	}
+
+	// More shards than blocks.
+	outs = nil
+	metas, err = CompressSharded(bytes.NewReader(in[:1500]), 4, DefaultCompression, 1000, open)
+	if err != nil || len(outs) != 4 {
+		t.Fatalf("got %d shards, %v", len(outs), err)
+	}
+	for i, want := range []int64{1000, 500, 0, 0} {
+		if metas[i].Size != want {
+			t.Errorf("4 shards: shard %d: size %d, want %d", i, metas[i].Size, want)
+		}
+	}
+
+	// A source of unknown size.
+	if _, err := CompressSharded(ioutil.NopCloser(bytes.NewReader(in)), 3, DefaultCompression, 1000, open); err == nil {
+		t.Error("unknown size: no error")
+	}
+
+	// An error of open stops with the shards finished.
+	outs = nil
+	errOpen := errors.New("open failed")
+	metas, err = CompressSharded(bytes.NewReader(in), 3, DefaultCompression, 1000, func(i int) (io.Writer, error) {
+		if i == 2 {
+			return nil, errOpen
+		}
+		return open(i)
+	})
+	if err != errOpen || len(metas) != 2 {
+		t.Errorf("failed open: got %d metadata, %v", len(metas), err)
+	}
+}
+
+func mustReader(t *testing.T, b []byte) *Reader {
+	t.Helper()
+	r, err := NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
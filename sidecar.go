@@ -0,0 +1,179 @@
+package sgzip
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultSidecarSuffix is the suffix of metadata sidecar files.
+const DefaultSidecarSuffix = ".dat"
+
+// DefaultIndexSuffix is the suffix of the binary index files written by
+// CompressFile, which OpenSeekable looks for if there is no sidecar file.
+const DefaultIndexSuffix = ".idx"
+
+// OpenSeekable opens the gzip file at gzPath together with its metadata,
+// which is read from the gob encoded sidecar file gzPath+".dat" or, if
+// that does not exist and gzPath ends in ".gz", from the file with the
+// ".gz" suffix replaced by ".dat" (as in testdata/test.json.dat). If
+// neither exists, the binary index gzPath+".idx" written by CompressFile
+// is read instead. It returns a seeking Reader over it. The returned
+// function closes the Reader and the underlying file.
+//
+// An error wrapping the os error is returned if the sidecar cannot be
+// opened, and ErrInvalidMetadata if it does not describe the file.
+// Use a SidecarOpener to change how the sidecar is found.
+func OpenSeekable(gzPath string) (*Reader, func() error, error) {
+	var o SidecarOpener
+	return o.Open(gzPath)
+}
+
+// A SidecarOpener opens gzip files together with their metadata sidecar
+// files, like OpenSeekable. The zero value behaves like OpenSeekable.
+type SidecarOpener struct {
+	suffix   string
+	metaPath string
+	foldCase bool
+}
+
+// SetSidecarSuffix sets the suffix of sidecar files, which is
+// DefaultSidecarSuffix if s is empty. Open only falls back to
+// DefaultIndexSuffix with the default suffix.
+func (o *SidecarOpener) SetSidecarSuffix(s string) {
+	o.suffix = s
+}
+
+// SetMetadataPath makes Open read the metadata from path instead of
+// looking for a sidecar file. An empty path restores the lookup.
+func (o *SidecarOpener) SetMetadataPath(path string) {
+	o.metaPath = path
+}
+
+// SetIgnoreCase makes Open match the ".gz" and sidecar suffixes without
+// regard to case, so that for example FILE.GZ finds FILE.dat or
+// FILE.GZ.DAT. This helps with files created on case-insensitive file
+// systems.
+func (o *SidecarOpener) SetIgnoreCase(ok bool) {
+	o.foldCase = ok
+}
+
+// Open opens the gzip file at gzPath and its metadata as configured, and
+// returns a seeking Reader over it and a function closing both. Errors
+// are reported as by OpenSeekable.
+func (o *SidecarOpener) Open(gzPath string) (*Reader, func() error, error) {
+	dat, err := o.sidecarPath(gzPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	meta, err := readSidecar(dat)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(gzPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	var compressed int64
+	for _, d := range meta.BlockData {
+		compressed += int64(d)
+	}
+	if len(meta.BlockData) == 0 || compressed+8 != fi.Size() {
+		f.Close()
+		return nil, nil, fmt.Errorf("%w: %s describes %d bytes, file has %d", ErrInvalidMetadata, dat, compressed+8, fi.Size())
+	}
+	z, err := NewSeekingReader(f, &meta)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	closer := func() error {
+		err := z.Close()
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+	return z, closer, nil
+}
+
+// sidecarPath returns the path of the metadata file of gzPath.
+func (o *SidecarOpener) sidecarPath(gzPath string) (string, error) {
+	if o.metaPath != "" {
+		return o.metaPath, nil
+	}
+	suffix := o.suffix
+	if suffix == "" {
+		suffix = DefaultSidecarSuffix
+	}
+	candidates := []string{gzPath + suffix}
+	if ext := filepath.Ext(gzPath); ext == ".gz" || o.foldCase && strings.EqualFold(ext, ".gz") {
+		candidates = append(candidates, strings.TrimSuffix(gzPath, ext)+suffix)
+	}
+	if o.suffix == "" {
+		candidates = append(candidates, gzPath+DefaultIndexSuffix)
+	}
+	var firstErr error
+	for _, c := range candidates {
+		p, err := o.find(c)
+		if err == nil {
+			return p, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return "", fmt.Errorf("gzip: metadata sidecar: %w", firstErr)
+}
+
+// find returns path if it exists or, when ignoring case, the path of a
+// file in the same directory whose name differs only in case.
+func (o *SidecarOpener) find(path string) (string, error) {
+	_, err := os.Stat(path)
+	if err == nil || !o.foldCase || !errors.Is(err, os.ErrNotExist) {
+		return path, err
+	}
+	dir, name := filepath.Split(path)
+	entries, derr := os.ReadDir(filepath.Clean(dir))
+	if derr != nil {
+		return path, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() && strings.EqualFold(e.Name(), name) {
+			return filepath.Join(dir, e.Name()), nil
+		}
+	}
+	return path, err
+}
+
+// readSidecar decodes the metadata stored in the file at path, either gob
+// encoded or in the binary index format.
+func readSidecar(path string) (GzipMetadata, error) {
+	var meta GzipMetadata
+	mf, err := os.Open(path)
+	if err != nil {
+		return meta, fmt.Errorf("gzip: metadata sidecar: %w", err)
+	}
+	defer mf.Close()
+	br := bufio.NewReader(mf)
+	if magic, _ := br.Peek(len(indexMagic)); string(magic) == indexMagic {
+		meta, err = DecodeIndex(br)
+		if err != nil {
+			return meta, fmt.Errorf("gzip: metadata sidecar %s: %w", path, err)
+		}
+		return meta, nil
+	}
+	if err := gob.NewDecoder(br).Decode(&meta); err != nil {
+		return meta, fmt.Errorf("gzip: metadata sidecar %s: %w", path, err)
+	}
+	return meta, checkVersion(&meta)
+}
@@ -0,0 +1,142 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestOpenSeekableMultiSeek reads at random positions of a file opened
+// with OpenSeekable, as TestMultiSeek does with the metadata decoded by
+// hand.
+func TestOpenSeekableMultiSeek(t *testing.T) {
+	r, closer, err := OpenSeekable("testdata/test.json.gz")
+	if err != nil {
+		t.Fatalf("OpenSeekable(testdata/test.json.gz): %v", err)
+	}
+	defer closer()
+	want, err := ioutil.ReadFile("testdata/test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rnd := rand.New(rand.NewSource(1337))
+	buf := make([]byte, 512)
+	for i := 0; i < 10; i++ {
+		pos := rnd.Intn(len(want) - len(buf))
+		if _, err := r.Seek(int64(pos), io.SeekStart); err != nil {
+			t.Fatalf("Seek(%d): %v", pos, err)
+		}
+		if _, err := io.ReadFull(r, buf); err != nil {
+			t.Fatalf("Read at %d: %v", pos, err)
+		}
+		if !bytes.Equal(buf, want[pos:pos+len(buf)]) {
+			t.Errorf("read at %d does not match original file", pos)
+		}
+	}
+}
+
+func TestOpenSeekable(t *testing.T) {
+	r, closer, err := OpenSeekable("testdata/test.json.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile("testdata/test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Seek(100000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want[100000:]) {
+		t.Error("content does not match")
+	}
+	if err := closer(); err != nil {
+		t.Error(err)
+	}
+
+	dir := t.TempDir()
+	gz, err := ioutil.ReadFile("testdata/test.json.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "test.json.gz")
+	if err := ioutil.WriteFile(path, gz, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := OpenSeekable(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing sidecar: got %v", err)
+	}
+
+	dat, err := ioutil.ReadFile("testdata/test.json.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "test.json.dat"), dat, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, gz[:len(gz)-1], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := OpenSeekable(path); !errors.Is(err, ErrInvalidMetadata) {
+		t.Errorf("truncated file: got %v", err)
+	}
+}
+
+func TestSidecarOpener(t *testing.T) {
+	gz, err := ioutil.ReadFile("testdata/test.json.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dat, err := ioutil.ReadFile("testdata/test.json.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "TEST.JSON.GZ")
+	if err := ioutil.WriteFile(path, gz, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "test.json.DAT"), dat, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "meta.idx"), dat, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	open := func(o *SidecarOpener) error {
+		_, closer, err := o.Open(path)
+		if err == nil {
+			err = closer()
+		}
+		return err
+	}
+	var o SidecarOpener
+	_, err = os.Stat(filepath.Join(dir, "TEST.JSON.DAT"))
+	if foldingFS := err == nil; !foldingFS {
+		if err := open(&o); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("case sensitive: got %v, want os.ErrNotExist", err)
+		}
+	}
+	o.SetIgnoreCase(true)
+	if err := open(&o); err != nil {
+		t.Errorf("ignoring case: %v", err)
+	}
+	o.SetIgnoreCase(false)
+	o.SetSidecarSuffix(".idx")
+	if err := open(&o); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("suffix .idx: got %v, want os.ErrNotExist", err)
+	}
+	o.SetMetadataPath(filepath.Join(dir, "meta.idx"))
+	if err := open(&o); err != nil {
+		t.Errorf("explicit metadata path: %v", err)
+	}
+}
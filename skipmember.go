@@ -0,0 +1,140 @@
+package sgzip
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/flate"
+)
+
+// SetStopOnMemberError controls what happens when a member of a
+// multistream file is damaged: its compressed data is corrupt, its
+// trailer does not match the data, or what follows it is not a valid
+// gzip header.
+//
+// By default (stop is true) reading stops with the error, as it does for
+// a single member. With SetStopOnMemberError(false) reading is best
+// effort: the damaged member is skipped, the input is searched for the
+// next gzip header and reading continues with that member. Part of the
+// data of the damaged member may have been returned. At the end of the
+// stream Read and WriteTo report an error wrapping the first error in
+// place of io.EOF and nil, so that the data read is known to be
+// incomplete.
+//
+// An input that is not gzip data at all still fails in NewReader or Reset.
+//
+// A member is only found again if its header starts with the usual three
+// bytes, 1f 8b 08, which the search may also find inside damaged data.
+// Data after a member is left to SetIgnoreTrailingGarbage if that is set.
+// The setting only applies to multistream Readers created without
+// metadata, and is kept across Reset.
+func (z *Reader) SetStopOnMemberError(stop bool) {
+	z.skipBadMembers = !stop
+}
+
+// skipping reports whether damaged members are skipped.
+func (z *Reader) skipping() bool {
+	return z.skipBadMembers && z.multistream && !z.canSeek
+}
+
+// recordDamage reports whether err is caused by a damaged member that
+// is to be skipped, and records it if so.
+func (z *Reader) recordDamage(err error) bool {
+	if !z.skipping() {
+		return false
+	}
+	var ce flate.CorruptInputError
+	if err != ErrChecksum && err != ErrHeader && !errors.As(err, &ce) {
+		return false
+	}
+	if z.memberErr == nil {
+		z.memberErr = err
+	}
+	z.skippedMembers++
+	return true
+}
+
+// skippedErr returns the error reported at the end of a stream with
+// skipped members.
+func (z *Reader) skippedErr() error {
+	return fmt.Errorf("gzip: skipped %d damaged members: %w", z.skippedMembers, z.memberErr)
+}
+
+// skipToMember searches the input for the next member and reads its
+// header. Like nextMember, it returns io.EOF if there is none. Data
+// before the member is recorded as a damaged member with ErrHeader,
+// unless it is the rest of one already recorded as damaged.
+func (z *Reader) skipToMember(damaged bool) error {
+	z.current = nil
+	z.roff = 0
+	z.lastBlock = false
+	z.size = 0
+	defer z.countInput()
+	var magic [3]byte
+	n := 0
+	for {
+		c, err := z.bufr.ReadByte()
+		if err == io.EOF && n > 0 && !damaged {
+			z.recordDamage(ErrHeader)
+		}
+		if err != nil {
+			return err
+		}
+		n++
+		magic[0], magic[1], magic[2] = magic[1], magic[2], c
+		if magic != [3]byte{gzipID1, gzipID2, gzipDeflate} {
+			continue
+		}
+		// The header is parsed from the start again.
+		br := z.bufr
+		z.bufr = &replayReader{b: magic[:], r: br}
+		err = z.parseHeader(false)
+		z.bufr = br
+		if err == nil {
+			if n > 3 && !damaged {
+				z.recordDamage(ErrHeader)
+			}
+			z.digest.Reset()
+			z.decompressor = flate.NewReader(z.bufr)
+			z.startRA = true
+			return nil
+		}
+		if !damaged {
+			z.recordDamage(ErrHeader)
+			damaged = true
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			z.err = nil
+			return io.EOF
+		}
+		if err != ErrHeader {
+			return err
+		}
+		magic = [3]byte{}
+	}
+}
+
+// replayReader returns b before reading from r.
+type replayReader struct {
+	b []byte
+	r flate.Reader
+}
+
+func (r *replayReader) Read(p []byte) (int, error) {
+	if len(r.b) == 0 {
+		return r.r.Read(p)
+	}
+	n := copy(p, r.b)
+	r.b = r.b[n:]
+	return n, nil
+}
+
+func (r *replayReader) ReadByte() (byte, error) {
+	if len(r.b) == 0 {
+		return r.r.ReadByte()
+	}
+	c := r.b[0]
+	r.b = r.b[1:]
+	return c, nil
+}
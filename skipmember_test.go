@@ -0,0 +1,124 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/klauspost/compress/flate"
+)
+
+// readSkipping reads all of the stream in with SetStopOnMemberError(false),
+// with Read, WriteTo and WriteToBuffer in turn, and checks that each
+// returns want and an error matching check.
+func readSkipping(t *testing.T, name string, in, want []byte, check func(error) bool) {
+	t.Helper()
+	r, err := NewReaderN(bytes.NewReader(in), 64<<10, 4)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	defer r.Close()
+	r.SetStopOnMemberError(false)
+	read := map[string]func() ([]byte, error){
+		"Read": func() ([]byte, error) { return ioutil.ReadAll(r) },
+		"WriteTo": func() ([]byte, error) {
+			var buf bytes.Buffer
+			_, err := r.WriteTo(&buf)
+			return buf.Bytes(), err
+		},
+		"WriteToBuffer": func() ([]byte, error) {
+			var buf bytes.Buffer
+			_, err := r.WriteToBuffer(&buf, make([]byte, 4096))
+			return buf.Bytes(), err
+		},
+	}
+	for _, method := range []string{"Read", "WriteTo", "WriteToBuffer"} {
+		// The setting is kept across Reset.
+		if err := r.Reset(bytes.NewReader(in)); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := read[method]()
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: %s: got %d bytes, want %d", name, method, len(got), len(want))
+		}
+		if !check(err) {
+			t.Errorf("%s: %s: unexpected error %v", name, method, err)
+		}
+	}
+}
+
+func TestStopOnMemberError(t *testing.T) {
+	isCorrupt := func(err error) bool {
+		var ce flate.CorruptInputError
+		return errors.As(err, &ce)
+	}
+	for _, tt := range errTests {
+		if tt.desc != "hello.txt x3 + corrupt member" {
+			continue
+		}
+		// The first and third member are returned.
+		readSkipping(t, tt.desc, tt.gzip, []byte(tt.raw+tt.raw), isCorrupt)
+	}
+
+	var parts [][]byte
+	var comp [][]byte
+	for i := 0; i < 3; i++ {
+		data := levelTestData(300000 + i*1000)
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.SetConcurrency(64<<10, 4)
+		w.Write(data)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, data)
+		comp = append(comp, buf.Bytes())
+	}
+	join := func(p ...[]byte) []byte { return bytes.Join(p, nil) }
+	all := join(comp...)
+
+	// Without damage, all is read without error.
+	isNil := func(err error) bool { return err == nil }
+	readSkipping(t, "intact", all, join(parts...), isNil)
+
+	// A member whose trailer does not match is returned in full.
+	bad := append([]byte(nil), comp[1]...)
+	bad[len(bad)-8]++
+	isChecksum := func(err error) bool { return errors.Is(err, ErrChecksum) }
+	readSkipping(t, "checksum", join(comp[0], bad, comp[2]), join(parts...), isChecksum)
+
+	// Data that is not a member is skipped.
+	garbage := []byte("garbage\x1f\x8b")
+	isHeader := func(err error) bool { return errors.Is(err, ErrHeader) }
+	readSkipping(t, "garbage", join(comp[0], garbage, comp[1], comp[2]), join(parts...), isHeader)
+	readSkipping(t, "trailing garbage", join(comp[0], comp[1], comp[2], garbage), join(parts...), isHeader)
+
+	// A block of the last member is corrupt, so only part of it is
+	// returned.
+	bad = append([]byte(nil), comp[2]...)
+	bad[len(bad)/2] = 0xff
+	bad[len(bad)/2+1] = 0xff
+	r, err := NewReader(bytes.NewReader(join(comp[0], comp[1], bad)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetStopOnMemberError(false)
+	got, err := ioutil.ReadAll(r)
+	if err == nil {
+		t.Error("corrupt last member: no error")
+	}
+	if want := join(parts[0], parts[1]); !bytes.HasPrefix(got, want) || len(got) >= len(want)+len(parts[2]) {
+		t.Errorf("corrupt last member: got %d bytes, want more than %d", len(got), len(want))
+	}
+
+	// By default, reading stops at the damaged member.
+	if err := r.Reset(bytes.NewReader(join(comp[0], garbage, comp[1]))); err != nil {
+		t.Fatal(err)
+	}
+	r.SetStopOnMemberError(true)
+	got, err = ioutil.ReadAll(r)
+	if err != ErrHeader || !bytes.Equal(got, parts[0]) {
+		t.Errorf("stop: got %d bytes, %v, want %d bytes, ErrHeader", len(got), err, len(parts[0]))
+	}
+}
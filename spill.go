@@ -0,0 +1,110 @@
+package sgzip
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+)
+
+// SetSpillDir makes the Writer keep compressed blocks in a temporary file
+// in dir instead of memory while they wait to be written: with many
+// blocks compressed at once, a block that is finished before all earlier
+// blocks have been written waits in the file, and is read back when its
+// turn comes. This bounds the memory held by finished blocks when
+// compressing large inputs on many cores, at the cost of writing them to
+// disk once more. The output and metadata are the same as without it.
+//
+// Blocks that compress to more than the block size, which only happens
+// for incompressible data, are kept in memory. The file holds up to
+// SetConcurrency's blocks+1 blocks; it is created by the first Write and
+// removed by Close, so a Writer using it must be closed. An empty dir
+// disables spilling, which is the default. It must be called before the
+// first Write and is kept across Reset.
+func (z *Writer) SetSpillDir(dir string) error {
+	if z.wroteHeader {
+		return errors.New("gzip: SetSpillDir called after Write")
+	}
+	if dir != "" {
+		fi, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("gzip: spill directory %s is not a directory", dir)
+		}
+	}
+	z.spillDir = dir
+	return nil
+}
+
+// A spillFile holds finished blocks waiting to be written, each in the
+// slot given by its sequence number.
+type spillFile struct {
+	next   int64 // sequence number of the block the result writer waits for, accessed atomically
+	stored int64 // blocks stored so far, accessed atomically
+	f      *os.File
+	slot   int64 // size of a slot
+	slots  int64
+}
+
+// openSpill creates the spill file, if spilling is enabled. Since results
+// are written in order and at most blocks of them are queued while the
+// result writer handles another one, blocks+1 slots are never in use at
+// the same time.
+func (z *Writer) openSpill() error {
+	if z.spillDir == "" {
+		return nil
+	}
+	f, err := ioutil.TempFile(z.spillDir, "sgzip-spill-*")
+	if err != nil {
+		return err
+	}
+	z.spill = &spillFile{
+		f:     f,
+		slot:  int64(z.blockSize + z.blockSize>>4),
+		slots: int64(z.blocks + 1),
+	}
+	return nil
+}
+
+// closeSpill removes the spill file, once no block is being compressed.
+func (z *Writer) closeSpill() {
+	if z.spill == nil {
+		return
+	}
+	z.wg.Wait()
+	z.spilled += atomic.LoadInt64(&z.spill.stored)
+	z.spill.f.Close()
+	os.Remove(z.spill.f.Name())
+	z.spill = nil
+}
+
+// store writes the compressed block buf of r to its slot and reports
+// whether it did, which it does not for the block the result writer waits
+// for, blocks larger than a slot, or if writing fails, so that the block
+// is kept in memory.
+func (s *spillFile) store(buf []byte, r result) bool {
+	if r.seq == atomic.LoadInt64(&s.next) || int64(len(buf)) > s.slot {
+		return false
+	}
+	if _, err := s.f.WriteAt(buf, (r.seq%s.slots)*s.slot); err != nil {
+		return false
+	}
+	*r.spilled = len(buf)
+	atomic.AddInt64(&s.stored, 1)
+	return true
+}
+
+// load reads the block of r stored by store into buf.
+func (s *spillFile) load(r result, buf []byte) ([]byte, error) {
+	if cap(buf) < *r.spilled {
+		buf = make([]byte, *r.spilled)
+	}
+	buf = buf[:*r.spilled]
+	if _, err := s.f.ReadAt(buf, (r.seq%s.slots)*s.slot); err != nil {
+		return nil, fmt.Errorf("gzip: reading spilled block: %w", err)
+	}
+	return buf, nil
+}
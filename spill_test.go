@@ -0,0 +1,107 @@
+package sgzip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/flate"
+)
+
+// slowDeflate creates compressors that take a while to flush blocks
+// starting with 0xff, so that the following blocks finish first.
+type slowDeflate struct{}
+
+func (slowDeflate) NewCompressor(w io.Writer, level int) (DeflateCompressor, error) {
+	fw, err := flate.NewWriter(w, level)
+	if err != nil {
+		return nil, err
+	}
+	return &slowCompressor{Writer: fw}, nil
+}
+
+type slowCompressor struct {
+	*flate.Writer
+	started, slow bool
+}
+
+func (c *slowCompressor) Write(p []byte) (int, error) {
+	if !c.started && len(p) > 0 {
+		c.started, c.slow = true, p[0] == 0xff
+	}
+	return c.Writer.Write(p)
+}
+
+func (c *slowCompressor) Flush() error {
+	if c.slow {
+		time.Sleep(20 * time.Millisecond)
+	}
+	return c.Writer.Flush()
+}
+
+func (c *slowCompressor) Reset(w io.Writer) {
+	c.started, c.slow = false, false
+	c.Writer.Reset(w)
+}
+
+func TestSetSpillDir(t *testing.T) {
+	const blockSize = 64 << 10
+	in := levelTestData(40 * blockSize)
+	for i := 0; i < len(in); i += 4 * blockSize {
+		in[i] = 0xff
+	}
+	compress := func(dir string) ([]byte, GzipMetadata, WriterStats) {
+		var buf bytes.Buffer
+		w := NewWriter(&buf)
+		w.SetConcurrency(blockSize, 8)
+		if err := w.SetDeflateFactory(slowDeflate{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.SetSpillDir(dir); err != nil {
+			t.Fatal(err)
+		}
+		w.Write(in[:len(in)/2])
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		w.Write(in[len(in)/2:])
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes(), w.MetaData(), w.Stats()
+	}
+	want, wantMeta, _ := compress("")
+	dir := t.TempDir()
+	got, meta, stats := compress(dir)
+	if !bytes.Equal(got, want) {
+		t.Error("output differs from the Writer without spilling")
+	}
+	if !reflect.DeepEqual(meta, wantMeta) {
+		t.Error("metadata differs from the Writer without spilling")
+	}
+	if stats.SpilledBlocks == 0 {
+		t.Error("no block was spilled")
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("%d files left in the spill directory", len(files))
+	}
+	r, err := NewReader(bytes.NewReader(got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(out, in) {
+		t.Errorf("decompressed %d bytes, %v", len(out), err)
+	}
+
+	w := NewWriter(ioutil.Discard)
+	if err := w.SetSpillDir(dir + "/missing"); err == nil {
+		t.Error("SetSpillDir accepted a missing directory")
+	}
+	w.Write([]byte("x"))
+	if err := w.SetSpillDir(dir); err == nil {
+		t.Error("SetSpillDir after Write: expected error")
+	}
+}
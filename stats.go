@@ -0,0 +1,55 @@
+package sgzip
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// WriterStats holds statistics about the output of a Writer.
+type WriterStats struct {
+	UncompressedSize int64         // bytes written to the Writer
+	CompressedSize   int64         // bytes written to the underlying io.Writer, including header and trailer
+	Blocks           int           // number of blocks holding data
+	Elapsed          time.Duration // time from the first Write to Close
+	SpilledBlocks    int64         // compressed blocks kept in the spill file, see SetSpillDir
+}
+
+// Ratio returns the compressed size divided by the uncompressed size, or 0
+// if nothing was written.
+func (s WriterStats) Ratio() float64 {
+	if s.UncompressedSize == 0 {
+		return 0
+	}
+	return float64(s.CompressedSize) / float64(s.UncompressedSize)
+}
+
+// Stats returns statistics about the data written so far. They are
+// complete after Close; before that, blocks that are still being
+// compressed are not counted and Elapsed is 0. The compressed size of each
+// block is available from MetaData, which can be used to find how well
+// individual blocks compress.
+//
+// Stats only sums the block sizes that are recorded anyway, so it does not
+// slow down writing.
+func (z *Writer) Stats() WriterStats {
+	s := WriterStats{
+		UncompressedSize: z.size,
+		Elapsed:          z.elapsed,
+	}
+	for _, n := range z.blockData {
+		s.CompressedSize += int64(n)
+	}
+	s.SpilledBlocks = z.spilled
+	if z.spill != nil {
+		s.SpilledBlocks += atomic.LoadInt64(&z.spill.stored)
+	}
+	if len(z.blockData) > 0 {
+		s.Blocks = len(z.blockData) - 1
+	}
+	if z.closed {
+		// The trailer and the end of stream marker, see eofMarker.
+		s.CompressedSize += 8
+		s.Blocks--
+	}
+	return s
+}
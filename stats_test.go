@@ -0,0 +1,42 @@
+package sgzip
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriterStats(t *testing.T) {
+	in := bytes.Repeat([]byte("statistics "), 50000)
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.SetConcurrency(100000, 4); err != nil {
+		t.Fatal(err)
+	}
+	w.Write(in)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	s := w.Stats()
+	if s.UncompressedSize != int64(len(in)) {
+		t.Errorf("UncompressedSize = %d, want %d", s.UncompressedSize, len(in))
+	}
+	if s.CompressedSize != int64(buf.Len()) {
+		t.Errorf("CompressedSize = %d, want %d", s.CompressedSize, buf.Len())
+	}
+	if want := (len(in) + 99999) / 100000; s.Blocks != want {
+		t.Errorf("Blocks = %d, want %d", s.Blocks, want)
+	}
+	if r := s.Ratio(); r <= 0 || r >= 0.1 {
+		t.Errorf("Ratio = %v", r)
+	}
+	if s.Elapsed <= 0 {
+		t.Errorf("Elapsed = %v", s.Elapsed)
+	}
+
+	buf.Reset()
+	w.Reset(&buf)
+	w.Close()
+	if s := w.Stats(); s.Blocks != 0 || s.CompressedSize != int64(buf.Len()) || s.Ratio() != 0 {
+		t.Errorf("empty stream: got %+v", s)
+	}
+}
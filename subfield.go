@@ -0,0 +1,200 @@
+package sgzip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+)
+
+// The FEXTRA field of a gzip header holds subfields, each made of a two
+// byte ID, a two byte length and its data (RFC 1952, section 2.3.1.1).
+// This package uses these IDs, which RegisterSubfield does not accept:
+//
+//	"SI"	a part of the index of a container, see NewContainerWriter
+//	"SF"	the footer of a container
+//	"SP"	the index pointer in the header of the data of a container
+//
+// The index pointer holds the uncompressed size of the data and the
+// length of the container counted from the start of the data member
+// (uint64 each, little-endian). Both are zero if they were not known when
+// the header was written, in which case the container ends at the end of
+// the file.
+const indexPointerLen = 16
+
+var reservedSubfields = map[[2]byte]bool{
+	{'S', 'I'}: true,
+	{'S', 'F'}: true,
+	{'S', 'P'}: true,
+}
+
+var (
+	subfieldMu       sync.RWMutex
+	subfieldHandlers = map[[2]byte]func([]byte) error{}
+)
+
+// RegisterSubfield makes Readers call handler with the data of each
+// subfield with the given ID in the FEXTRA field of the headers they read
+// into Header, and makes ReadHeader do the same. It lets applications
+// interpret their own subfields while the header is read. An error
+// returned by handler is returned by the read of the header.
+//
+// The handler is called once per header read, so it may see the same
+// header more than once, for example when a Reader is created and then
+// Reset to the same stream. It is not called if the FEXTRA field is not
+// made of well-formed subfields. Registering an ID again replaces its
+// handler, and a nil handler removes it. RegisterSubfield panics if id is
+// one of those used by this package.
+func RegisterSubfield(id [2]byte, handler func([]byte) error) {
+	if reservedSubfields[id] {
+		panic(fmt.Sprintf("gzip: subfield ID %q is reserved", id[:]))
+	}
+	subfieldMu.Lock()
+	defer subfieldMu.Unlock()
+	if handler == nil {
+		delete(subfieldHandlers, id)
+		return
+	}
+	subfieldHandlers[id] = handler
+}
+
+// callSubfieldHandlers calls the registered handlers of the subfields
+// in extra.
+func callSubfieldHandlers(extra []byte) error {
+	subfieldMu.RLock()
+	n := len(subfieldHandlers)
+	subfieldMu.RUnlock()
+	if n == 0 {
+		return nil
+	}
+	fields, ok := splitSubfields(extra)
+	if !ok {
+		return nil
+	}
+	for _, f := range fields {
+		subfieldMu.RLock()
+		handler := subfieldHandlers[f.id]
+		subfieldMu.RUnlock()
+		if handler == nil {
+			continue
+		}
+		if err := handler(f.data); err != nil {
+			return fmt.Errorf("gzip: subfield %q: %w", f.id[:], err)
+		}
+	}
+	return nil
+}
+
+// A subfield is a subfield of an FEXTRA field.
+type subfield struct {
+	id   [2]byte
+	data []byte
+}
+
+// splitSubfields returns the subfields of the FEXTRA field extra, and
+// false if it is not made of subfields.
+func splitSubfields(extra []byte) ([]subfield, bool) {
+	var fields []subfield
+	for x := extra; len(x) > 0; {
+		if len(x) < 4 {
+			return nil, false
+		}
+		n := int(binary.LittleEndian.Uint16(x[2:4]))
+		if 4+n > len(x) {
+			return nil, false
+		}
+		fields = append(fields, subfield{id: [2]byte{x[0], x[1]}, data: x[4 : 4+n]})
+		x = x[4+n:]
+	}
+	return fields, true
+}
+
+// headerExtra returns the FEXTRA field to write: Extra, followed by an
+// empty index pointer for containers, whose offset is recorded so that
+// Close can fill it in.
+func (z *Writer) headerExtra() []byte {
+	if !z.container {
+		return z.Extra
+	}
+	z.pointerOff = 10 + 2 + int64(len(z.Extra)) + 4
+	extra := append([]byte(nil), z.Extra...)
+	extra = append(extra, 'S', 'P', indexPointerLen, 0)
+	return append(extra, make([]byte, indexPointerLen)...)
+}
+
+// writeIndexPointer fills in the index pointer of a container of length
+// bytes holding size bytes of data, if the output can seek.
+func (z *Writer) writeIndexPointer(size, length int64) error {
+	ws, ok := z.w.(io.WriteSeeker)
+	if !ok || z.containerAt < 0 {
+		return nil
+	}
+	ptr := make([]byte, indexPointerLen)
+	binary.LittleEndian.PutUint64(ptr[0:8], uint64(size))
+	binary.LittleEndian.PutUint64(ptr[8:16], uint64(length))
+	if _, err := ws.Seek(z.containerAt+z.pointerOff, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := ws.Write(ptr); err != nil {
+		return err
+	}
+	if z.header != nil {
+		// The header checksum follows the header.
+		copy(z.header[z.pointerOff:], ptr)
+		sum := crc32.ChecksumIEEE(z.header)
+		if _, err := ws.Seek(z.containerAt+int64(len(z.header)), io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := ws.Write([]byte{byte(sum), byte(sum >> 8)}); err != nil {
+			return err
+		}
+	}
+	_, err := ws.Seek(z.containerAt+length, io.SeekStart)
+	return err
+}
+
+// indexPointer returns the values of the index pointer in extra.
+func indexPointer(extra []byte) (size, length int64, ok bool) {
+	fields, ok := splitSubfields(extra)
+	if !ok {
+		return 0, 0, false
+	}
+	for _, f := range fields {
+		if f.id == [2]byte{'S', 'P'} && len(f.data) == indexPointerLen {
+			size = int64(binary.LittleEndian.Uint64(f.data[0:8]))
+			length = int64(binary.LittleEndian.Uint64(f.data[8:16]))
+			return size, length, size >= 0 && length >= 0
+		}
+	}
+	return 0, 0, false
+}
+
+// openIndexed returns a Reader for the container whose header z has read,
+// using its index, if the source is an io.ReaderAt and the index is valid.
+func (z *Reader) openIndexed() (*Reader, bool) {
+	size, length, ok := indexPointer(z.Extra)
+	if !ok || z.src == nil {
+		return nil, false
+	}
+	ra, ok := z.src.(io.ReaderAt)
+	if !ok {
+		return nil, false
+	}
+	if length == 0 {
+		end, err := readerAtSize(ra)
+		if err != nil || end < z.srcStart {
+			return nil, false
+		}
+		length = end - z.srcStart
+	}
+	c, err := openContainer(io.NewSectionReader(ra, z.srcStart, length), length)
+	if err != nil {
+		return nil, false
+	}
+	if size != 0 && c.isize != size {
+		c.Close()
+		return nil, false
+	}
+	return c, true
+}
@@ -0,0 +1,50 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestRegisterSubfield(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Extra = []byte{'A', 'B', 1, 0, 'x', 'X', 'Y', 3, 0, 'a', 'b', 'c'}
+	w.Write([]byte("subfields"))
+	w.Close()
+
+	var got []string
+	RegisterSubfield([2]byte{'X', 'Y'}, func(data []byte) error {
+		got = append(got, string(data))
+		return nil
+	})
+	defer RegisterSubfield([2]byte{'X', 'Y'}, nil)
+	r, err := NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	if len(got) != 1 || got[0] != "abc" {
+		t.Errorf("handler got %q, want [abc]", got)
+	}
+	if _, err := ReadHeader(bytes.NewReader(buf.Bytes())); err != nil || len(got) != 2 {
+		t.Errorf("ReadHeader: %v, handler called %d times", err, len(got))
+	}
+
+	errBad := errors.New("bad subfield")
+	RegisterSubfield([2]byte{'X', 'Y'}, func([]byte) error { return errBad })
+	if _, err := NewReader(bytes.NewReader(buf.Bytes())); !errors.Is(err, errBad) {
+		t.Errorf("handler error: got %v, want %v", err, errBad)
+	}
+	RegisterSubfield([2]byte{'X', 'Y'}, nil)
+	if _, err := NewReader(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Errorf("after removing the handler: %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a reserved ID did not panic")
+		}
+	}()
+	RegisterSubfield([2]byte{'S', 'P'}, func([]byte) error { return nil })
+}
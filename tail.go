@@ -0,0 +1,32 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+)
+
+// ReadTail returns the last n bytes of the uncompressed data, or all of it
+// if it is shorter, for formats with a footer such as a record count at
+// the end. It needs a Reader created with metadata, which gives the size,
+// and returns ErrUnsupported otherwise. Only the blocks holding the tail
+// are decompressed, as by WriteToRange, so the position of the Reader does
+// not change if its source is an io.ReaderAt; otherwise the Reader is left
+// at the end of the data.
+func (z *Reader) ReadTail(n int64) ([]byte, error) {
+	if !z.canSeek {
+		return nil, ErrUnsupported
+	}
+	if n < 0 {
+		return nil, errors.New("gzip: negative count")
+	}
+	size := z.dataEnd() - z.origin
+	if n > size {
+		n = size
+	}
+	var buf bytes.Buffer
+	buf.Grow(int(n))
+	if _, err := z.WriteToRange(&buf, size-n, size); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
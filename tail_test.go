@@ -0,0 +1,43 @@
+package sgzip
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestReadTail(t *testing.T) {
+	in, comp, meta := testSeekableData(t, 200000, 16<<10)
+	open := map[string]func() (*Reader, error){
+		"ReaderAt": func() (*Reader, error) { return NewSeekingReader(bytes.NewReader(comp), &meta) },
+		"ReadSeeker": func() (*Reader, error) {
+			return NewSeekingReader(struct{ io.ReadSeeker }{bytes.NewReader(comp)}, &meta)
+		},
+	}
+	for name, fn := range open {
+		r, err := fn()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, n := range []int64{0, 1, 100, 16 << 10, 50000, 200000, 300000} {
+			want := in
+			if n < int64(len(in)) {
+				want = in[int64(len(in))-n:]
+			}
+			got, err := r.ReadTail(n)
+			if err != nil || !bytes.Equal(got, want) {
+				t.Errorf("%s: ReadTail(%d) = %d bytes, %v, want %d", name, n, len(got), err, len(want))
+			}
+		}
+		r.Close()
+	}
+
+	r, err := NewReader(bytes.NewReader(comp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := r.ReadTail(10); err != ErrUnsupported {
+		t.Errorf("without metadata: got %v, want ErrUnsupported", err)
+	}
+}
@@ -0,0 +1,62 @@
+package sgzip
+
+import (
+	"io"
+	"io/ioutil"
+)
+
+// WriteToMulti is like WriteTo, but writes the data to each of ws, for
+// consuming and storing it at the same time. Each block is decompressed
+// once and written to the writers in order, without copying it. Writing
+// stops at the first error of a writer, which is returned; the writers
+// before it have then been passed more data than the others. The result
+// is the number of bytes written to all of the writers, which does not
+// include the part of a block the writers before the failing one took.
+//
+// Like WriteTo, it grows the writers that have a Grow method to the size
+// of the rest of the data if it is known. Without writers, the data is
+// decompressed and checked only, as by WriteTo(ioutil.Discard).
+func (z *Reader) WriteToMulti(ws ...io.Writer) (int64, error) {
+	var tee teeWriter
+	for _, w := range ws {
+		if w != ioutil.Discard {
+			tee = append(tee, w)
+		}
+	}
+	switch len(tee) {
+	case 0:
+		return z.WriteTo(ioutil.Discard)
+	case 1:
+		return z.WriteTo(tee[0])
+	}
+	return z.WriteTo(tee)
+}
+
+// A teeWriter writes to each of its writers, like io.MultiWriter, and
+// passes on Grow. If a writer fails, the count returned is what all of
+// the writers took: none of p unless the failing writer is the last.
+type teeWriter []io.Writer
+
+func (t teeWriter) Write(p []byte) (int, error) {
+	for i, w := range t {
+		n, err := w.Write(p)
+		if err == nil && n != len(p) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			if i < len(t)-1 {
+				n = 0
+			}
+			return n, err
+		}
+	}
+	return len(p), nil
+}
+
+func (t teeWriter) Grow(n int) {
+	for _, w := range t {
+		if g, ok := w.(grower); ok {
+			g.Grow(n)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// failWriter accepts n bytes and fails after that.
+type failWriter struct {
+	n int
+}
+
+var errFailWriter = errors.New("write failed")
+
+func (f *failWriter) Write(p []byte) (int, error) {
+	if len(p) > f.n {
+		n := f.n
+		f.n = 0
+		return n, errFailWriter
+	}
+	f.n -= len(p)
+	return len(p), nil
+}
+
+func TestWriteToMulti(t *testing.T) {
+	in, comp, meta := testSeekableData(t, 1<<20, 64<<10)
+	r, err := NewSeekingReader(bytes.NewReader(comp), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var a, b bytes.Buffer
+	n, err := r.WriteToMulti(&a, ioutil.Discard, &b)
+	if err != nil || n != int64(len(in)) {
+		t.Fatalf("got %d, %v", n, err)
+	}
+	if !bytes.Equal(a.Bytes(), in) || !bytes.Equal(b.Bytes(), in) {
+		t.Error("wrong data")
+	}
+	if a.Cap() != len(in) {
+		t.Errorf("buffer grown to %d, want %d", a.Cap(), len(in))
+	}
+
+	// Writing stops at the first error.
+	r.Seek(0, io.SeekStart)
+	a.Reset()
+	b.Reset()
+	n, err = r.WriteToMulti(&a, &failWriter{n: 100000}, &b)
+	if err != errFailWriter {
+		t.Errorf("got %v, want %v", err, errFailWriter)
+	}
+	// The block holding the failing byte is not counted, as b did not
+	// get any of it.
+	if n != 64<<10 || int64(b.Len()) != n || a.Len() <= b.Len() || !bytes.Equal(b.Bytes(), in[:b.Len()]) {
+		t.Errorf("got %d, wrote %d and %d bytes", n, a.Len(), b.Len())
+	}
+
+	// If the last writer fails, what it took was written to all of them.
+	r.Seek(0, io.SeekStart)
+	a.Reset()
+	n, err = r.WriteToMulti(&a, &failWriter{n: 100000})
+	if err != errFailWriter || n != 100000 || a.Len() < 100000 {
+		t.Errorf("failing last writer: got %d, %v, wrote %d bytes", n, err, a.Len())
+	}
+
+	r.Seek(0, io.SeekStart)
+	if n, err := r.WriteToMulti(); err != nil || n != int64(len(in)) {
+		t.Errorf("no writers: got %d, %v", n, err)
+	}
+}
@@ -0,0 +1,99 @@
+package sgzip
+
+import (
+	"io"
+	"time"
+)
+
+// SetBlockReadTimeout limits how long each read from the underlying reader
+// may take to d. If a read does not complete in time, decompression stops
+// and Read returns ErrReadTimeout, which protects against a stalled
+// network source. A d of 0 disables the limit, which is the default.
+//
+// The stalled read cannot be interrupted and keeps running in the
+// background until the source returns; its result is discarded. Until
+// then the source must not be used again: Seek returns ErrReadTimeout,
+// and Reset must be given a different source. Once the read has
+// returned, the Reader can be used again after Seek or Reset. Reads are
+// issued for the Reader's input buffer rather than for each block, so the
+// limit bounds the time spent waiting for any part of a block. Cancelling
+// the context of WriteToContext does not interrupt a read either, so
+// closing the source is the only way to stop a stalled read early.
+//
+// The setting applies from the next time the Reader starts reading its
+// input, so it should be set on a zero Reader before calling Reset, or
+// before Seek on a Reader created with metadata. It is kept across calls
+// to Reset.
+func (z *Reader) SetBlockReadTimeout(d time.Duration) {
+	z.readTimeout = d
+}
+
+// withTimeout returns r limited by the read timeout, if one is set.
+func (z *Reader) withTimeout(r io.Reader) io.Reader {
+	z.timeout = nil
+	if z.readTimeout <= 0 {
+		return r
+	}
+	z.timeout = &timeoutReader{r: r, d: z.readTimeout}
+	return z.timeout
+}
+
+// stalled returns ErrReadTimeout if a read of the source that timed out
+// has not returned yet.
+func (z *Reader) stalled() error {
+	if z.timeout == nil || z.timeout.stalled == nil {
+		return nil
+	}
+	select {
+	case <-z.timeout.stalled:
+		return nil
+	default:
+		return ErrReadTimeout
+	}
+}
+
+// timeoutReader is an io.Reader whose reads fail with ErrReadTimeout if
+// the underlying reader does not return within d.
+type timeoutReader struct {
+	r       io.Reader
+	d       time.Duration
+	buf     []byte
+	err     error         // set once a read has timed out
+	stalled chan struct{} // closed once the read that timed out returns
+}
+
+func (t *timeoutReader) Read(p []byte) (int, error) {
+	if t.err != nil {
+		return 0, t.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	// Read into a buffer of our own, p must not be written after a
+	// timeout.
+	if cap(t.buf) < len(p) {
+		t.buf = make([]byte, len(p))
+	}
+	buf := t.buf[:len(p)]
+	var res read
+	done := make(chan struct{})
+	stop := make(chan struct{})
+	go func() {
+		defer close(done)
+		n, err := readSource(t.r, buf, stop)
+		res = read{b: buf[:n], err: err}
+	}()
+	timer := time.NewTimer(t.d)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return copy(p, res.b), res.err
+	case <-timer.C:
+		// Stop retrying a source that returns no data.
+		close(stop)
+		t.err = ErrReadTimeout
+		t.stalled = done
+		t.buf = nil // still in use by the stalled read
+		return 0, t.err
+	}
+}
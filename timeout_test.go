@@ -0,0 +1,122 @@
+package sgzip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestBlockReadTimeout(t *testing.T) {
+	in := make([]byte, 1<<20)
+	for i := range in {
+		in[i] = byte(i * i >> 7)
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.Write(in)
+	w.Close()
+
+	var r Reader
+	r.SetBlockReadTimeout(time.Second)
+	if err := r.Reset(struct{ io.Reader }{bytes.NewReader(buf.Bytes())}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadAll(&r); err != nil || !bytes.Equal(got, in) {
+		t.Fatalf("got %d bytes, %v", len(got), err)
+	}
+
+	// A source that stops sending before the end of the stream.
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go pw.Write(buf.Bytes()[:buf.Len()/2])
+	r.SetBlockReadTimeout(50 * time.Millisecond)
+	if err := r.Reset(pr); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := ioutil.ReadAll(&r)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != ErrReadTimeout {
+			t.Errorf("got %v, want ErrReadTimeout", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Read did not time out")
+	}
+	r.Close()
+}
+
+// stallingSource returns the data up to limit once armed is set, and then
+// blocks until release is closed, or returns no data if idle is set.
+type stallingSource struct {
+	*bytes.Reader
+	armed   bool
+	limit   int64
+	idle    bool
+	release chan struct{}
+}
+
+func (s *stallingSource) Read(p []byte) (int, error) {
+	if !s.armed {
+		return s.Reader.Read(p)
+	}
+	pos := s.Size() - int64(s.Len())
+	if pos >= s.limit {
+		if s.idle {
+			return 0, nil
+		}
+		<-s.release
+	} else if rest := s.limit - pos; int64(len(p)) > rest {
+		p = p[:rest]
+	}
+	return s.Reader.Read(p)
+}
+
+func TestBlockReadTimeoutSeek(t *testing.T) {
+	in, comp, meta := testSeekableData(t, 1<<20, 64<<10)
+	for _, idle := range []bool{false, true} {
+		src := &stallingSource{Reader: bytes.NewReader(comp), limit: int64(len(comp) / 2), idle: idle, release: make(chan struct{})}
+		r, err := NewSeekingReader(src, &meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.SetBlockReadTimeout(50 * time.Millisecond)
+		src.armed = true
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ioutil.ReadAll(r); err != ErrReadTimeout {
+			t.Fatalf("idle %v: got %v, want ErrReadTimeout", idle, err)
+		}
+		if !idle {
+			// The source is still in use by the stalled read.
+			if _, err := r.Seek(0, io.SeekStart); err != ErrReadTimeout {
+				t.Fatalf("Seek during the stalled read: got %v, want ErrReadTimeout", err)
+			}
+			close(src.release)
+		}
+		// Once the stalled read has returned, or given up on an idle
+		// source, the Reader can seek again.
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			_, err := r.Seek(0, io.SeekStart)
+			if err == nil {
+				break
+			}
+			if err != ErrReadTimeout || time.Now().After(deadline) {
+				t.Fatalf("idle %v: Seek after the stalled read: %v", idle, err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		got := make([]byte, 100000)
+		if _, err := io.ReadFull(r, got); err != nil || !bytes.Equal(got, in[:len(got)]) {
+			t.Fatalf("idle %v: ReadFull after Seek: %v", idle, err)
+		}
+		r.Close()
+	}
+}
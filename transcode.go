@@ -0,0 +1,59 @@
+package sgzip
+
+import (
+	"io"
+	"runtime"
+)
+
+// Transcode decompresses the gzip stream read from src and compresses it
+// again to dst as a seekable gzip stream with blocks of blockSize bytes.
+// The header of the first member is preserved, except for reserved FLG
+// bits, which are cleared. It returns the metadata
+// needed to seek in the written stream.
+//
+// Data is processed as it arrives, so memory use is bounded by the block
+// size and the number of blocks compressed in parallel.
+func Transcode(dst io.Writer, src io.Reader, blockSize int) (GzipMetadata, error) {
+	r, err := NewReader(src)
+	if err != nil {
+		return GzipMetadata{}, err
+	}
+	defer r.Close()
+	return recompress(dst, r, DefaultCompression, blockSize)
+}
+
+// ExportRemaining compresses the data from the current position of z to
+// the end of the stream to dst, as a new seekable gzip stream that starts
+// at offset 0, and returns its metadata. Together with Seek it splits a
+// large stream into independent pieces. The header of z is copied without
+// its reserved FLG bits, level
+// is the compression level and blockSize the block size of the new stream.
+// On success, z is at the end of the stream.
+func (z *Reader) ExportRemaining(dst io.Writer, level, blockSize int) (GzipMetadata, error) {
+	return recompress(dst, z, level, blockSize)
+}
+
+// recompress compresses the rest of the data read from r to dst.
+func recompress(dst io.Writer, r *Reader, level, blockSize int) (GzipMetadata, error) {
+	if blockSize <= 0 {
+		blockSize = defaultBlockSize
+	}
+	w, err := NewWriterLevel(dst, level)
+	if err != nil {
+		return GzipMetadata{}, err
+	}
+	if err := w.SetConcurrency(blockSize, runtime.GOMAXPROCS(0)); err != nil {
+		return GzipMetadata{}, err
+	}
+	w.Header = r.Header
+	// Reserved flags may announce fields this package does not write.
+	w.Header.ReservedFlags = 0
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return GzipMetadata{}, err
+	}
+	if err := w.Close(); err != nil {
+		return GzipMetadata{}, err
+	}
+	return w.MetaData(), nil
+}
@@ -0,0 +1,93 @@
+package sgzip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestTranscode(t *testing.T) {
+	dat, err := ioutil.ReadFile("testdata/test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plain bytes.Buffer
+	gw := gzip.NewWriter(&plain)
+	gw.Name = "test.json"
+	gw.Write(dat)
+	gw.Close()
+
+	var out bytes.Buffer
+	meta, err := Transcode(&out, &plain, 16<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Size != int64(len(dat)) {
+		t.Errorf("Size = %d, want %d", meta.Size, len(dat))
+	}
+	if meta.BlockSize != 16<<10 {
+		t.Errorf("BlockSize = %d, want %d", meta.BlockSize, 16<<10)
+	}
+
+	r, err := NewSeekingReader(bytes.NewReader(out.Bytes()), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.Name != "test.json" {
+		t.Errorf("Name = %q, want %q", r.Name, "test.json")
+	}
+	const pos = 50000
+	if _, err := r.Seek(pos, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, dat[pos:]) {
+		t.Error("decoded content does not match")
+	}
+}
+
+func TestExportRemaining(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 100000, 16<<10)
+	r, err := NewSeekingReader(bytes.NewReader(compressed), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	const pos = 30000
+	if _, err := r.Seek(pos, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	part, err := r.ExportRemaining(&out, BestSpeed, 8<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if part.Size != int64(len(in)-pos) || part.BlockSize != 8<<10 {
+		t.Errorf("Size = %d, BlockSize = %d, want %d, %d", part.Size, part.BlockSize, len(in)-pos, 8<<10)
+	}
+	if err := Verify(bytes.NewReader(out.Bytes()), &part); err != nil {
+		t.Fatal(err)
+	}
+	pr, err := NewSeekingReader(bytes.NewReader(out.Bytes()), &part)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	if _, err := pr.Seek(10000, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(pr)
+	if err != nil || !bytes.Equal(got, in[pos+10000:]) {
+		t.Errorf("read from the exported stream: %d bytes, %v", len(got), err)
+	}
+
+	if _, err := r.ExportRemaining(ioutil.Discard, 42, 8<<10); err == nil {
+		t.Error("invalid level: expected error")
+	}
+}
@@ -0,0 +1,241 @@
+package sgzip
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/flate"
+)
+
+// A BlockError records a verification failure in one block.
+type BlockError struct {
+	Block int // index of the block, starting at 0
+	Err   error
+}
+
+func (e *BlockError) Error() string {
+	return fmt.Sprintf("gzip: block %d: %v", e.Block, e.Err)
+}
+
+func (e *BlockError) Unwrap() error { return e.Err }
+
+// Verify decompresses every block of the stream described by meta from ra
+// and checks the block sizes, the per-block checksums if meta has them,
+// and the checksum and size in the trailer.
+// It is equivalent to VerifyConcurrent with a single worker.
+func Verify(ra io.ReaderAt, meta *GzipMetadata) error {
+	return VerifyConcurrent(ra, meta, 1)
+}
+
+// VerifyConcurrent is like Verify but checks up to workers blocks in
+// parallel, since blocks can be decompressed independently.
+//
+// A failing block is reported as a *BlockError. When several blocks are
+// corrupt, the one with the lowest index is reported, so the result does
+// not depend on scheduling. A trailer mismatch is reported as ErrChecksum
+// once all blocks have passed. Only single-member streams, as written by
+// Writer, can be verified.
+func VerifyConcurrent(ra io.ReaderAt, meta *GzipMetadata, workers int) error {
+	return VerifyContext(context.Background(), ra, meta, workers)
+}
+
+// VerifyContext is like VerifyConcurrent, but stops when ctx is done and
+// then returns ctx.Err(). The blocks being decompressed are finished
+// first, so it returns within about the time a worker takes for a block,
+// and no worker is left running.
+func VerifyContext(ctx context.Context, ra io.ReaderAt, meta *GzipMetadata, workers int) error {
+	if err := checkVersion(meta); err != nil {
+		return err
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	if len(meta.BlockData) < 2 {
+		return ErrInvalidMetadata
+	}
+	blockStarts := parseBlockData(meta.BlockData, meta.BlockSize)
+	blocks := len(meta.BlockData) - 1
+	crcs := make([]uint32, blocks)
+	errs := make([]error, blocks)
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	var skipped int32
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if ctx.Err() != nil {
+					atomic.StoreInt32(&skipped, 1)
+					continue
+				}
+				crcs[i], errs[i] = verifyBlock(ra, meta, blockStarts, i)
+			}
+		}()
+	}
+	var cancelled error
+	for i := 0; i < blocks && cancelled == nil; i++ {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			cancelled = ctx.Err()
+		}
+	}
+	close(next)
+	wg.Wait()
+	if cancelled == nil && atomic.LoadInt32(&skipped) != 0 {
+		// The context was done after the last block was handed out.
+		cancelled = ctx.Err()
+	}
+	if cancelled != nil {
+		return cancelled
+	}
+
+	var crc uint32
+	for i, err := range errs {
+		if err != nil {
+			return &BlockError{Block: i, Err: err}
+		}
+		crc = crc32Combine(crc, crcs[i], blockLen(meta, i))
+	}
+
+	var trailer [8]byte
+	if n, err := ra.ReadAt(trailer[:], blockStarts[len(blockStarts)-1]); n < len(trailer) {
+		return noEOF(err)
+	}
+	if binary.LittleEndian.Uint32(trailer[:4]) != crc || binary.LittleEndian.Uint32(trailer[4:]) != uint32(meta.Size+int64(meta.Padding)) {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// blockLen returns the uncompressed length of block i.
+func blockLen(meta *GzipMetadata, i int) int64 {
+	if u := meta.UBlockData; u != nil {
+		if i < 0 || i >= len(u) {
+			return 0
+		}
+		end := meta.Size
+		if i+1 < len(u) {
+			end = u[i+1]
+		}
+		if end < u[i] {
+			return 0
+		}
+		return end - u[i]
+	}
+	if meta.BlockLens != nil {
+		if i < len(meta.BlockLens) {
+			return int64(meta.BlockLens[i])
+		}
+		return 0
+	}
+	n := meta.Size + int64(meta.Padding) - int64(i)*int64(meta.BlockSize)
+	if n > int64(meta.BlockSize) {
+		n = int64(meta.BlockSize)
+	}
+	if n < 0 {
+		n = 0
+	}
+	return n
+}
+
+// verifyBlock decompresses block i and returns its checksum.
+func verifyBlock(ra io.ReaderAt, meta *GzipMetadata, blockStarts []int64, i int) (uint32, error) {
+	comp := make([]byte, blockStarts[i+1]-blockStarts[i])
+	if n, err := ra.ReadAt(comp, blockStarts[i]); n < len(comp) {
+		return 0, noEOF(err)
+	}
+	last := len(meta.BlockData) - 2
+	if last > 0 && meta.BlockData[last+1] == 0 {
+		// An empty last block follows the one ending the stream, see
+		// RebuildIndex.
+		last--
+		if i > last {
+			return 0, nil
+		}
+	}
+	fr := flate.NewReader(bytes.NewReader(comp))
+	defer fr.Close()
+	data := make([]byte, blockLen(meta, i))
+	if _, err := io.ReadFull(fr, data); err != nil {
+		return 0, noEOF(err)
+	}
+	if i == last {
+		// The last block must end the deflate stream.
+		if n, err := fr.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+			return 0, ErrInvalidMetadata
+		}
+	}
+	crc := crc32.ChecksumIEEE(data)
+	if i < len(meta.BlockCRC) && meta.BlockCRC[i] != crc {
+		return 0, ErrChecksum
+	}
+	return crc, nil
+}
+
+// VerifyRandomAccess checks that seeking r to the start of each block
+// described by meta and reading from there returns the data of the block:
+// as many bytes as meta records for it and, if meta has per-block
+// checksums, data with the recorded checksum. r is normally a Reader
+// created with meta, by NewSeekingReader or NewRandomReader. Unlike
+// Verify, which decompresses the blocks itself, it checks what the
+// callers of r get, so a Reader seeking to the wrong block or discarding
+// the wrong amount of data from it fails the check.
+//
+// The blocks are visited from last to first, so that every block is
+// reached by a Seek rather than by reading on from the previous one. A
+// failing block is reported as a *BlockError; when several blocks fail,
+// the one with the lowest index is reported. r is left at an unspecified
+// position.
+func VerifyRandomAccess(r *Reader, meta *GzipMetadata) error {
+	x, err := NewIndex(*meta)
+	if err != nil {
+		return err
+	}
+	var first error
+	var data []byte
+	for i := x.NumBlocks() - 1; i >= 0; i-- {
+		b, _ := x.Block(i)
+		if b.UncompressedLength == 0 {
+			continue
+		}
+		if int64(cap(data)) < b.UncompressedLength {
+			data = make([]byte, b.UncompressedLength)
+		}
+		data = data[:b.UncompressedLength]
+		// Padding after the data, see SetPadLastBlock, is not returned
+		// by r but is covered by the checksum of the block.
+		n := b.UncompressedLength
+		if rest := meta.Size - b.UncompressedOffset; n > rest {
+			n = rest
+		}
+		for j := n; j < b.UncompressedLength; j++ {
+			data[j] = 0
+		}
+		if err := verifyBlockAt(r, b.UncompressedOffset, data[:n]); err != nil {
+			first = &BlockError{Block: i, Err: err}
+			continue
+		}
+		if i < len(meta.BlockCRC) && meta.BlockCRC[i] != crc32.ChecksumIEEE(data) {
+			first = &BlockError{Block: i, Err: ErrChecksum}
+		}
+	}
+	return first
+}
+
+// verifyBlockAt seeks r to off and fills data from there.
+func verifyBlockAt(r *Reader, off int64, data []byte) error {
+	if _, err := r.Seek(off, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.ReadFull(r, data)
+	return noEOF(err)
+}
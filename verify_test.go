@@ -0,0 +1,133 @@
+package sgzip
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// eofReaderAt returns io.EOF with every read that reaches the end of the
+// data, including reads that fill p, as io.ReaderAt allows.
+type eofReaderAt []byte
+
+func (b eofReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(b)) {
+		return 0, io.EOF
+	}
+	n := copy(p, b[off:])
+	if off+int64(n) == int64(len(b)) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (b eofReaderAt) Size() int64 { return int64(len(b)) }
+
+func TestVerifyConcurrent(t *testing.T) {
+	_, compressed, meta := testSeekableData(t, 1<<20, 32<<10)
+	for _, workers := range []int{1, 4} {
+		if err := VerifyConcurrent(bytes.NewReader(compressed), &meta, workers); err != nil {
+			t.Fatalf("workers %d: %v", workers, err)
+		}
+	}
+	if err := Verify(bytes.NewReader(compressed), &meta); err != nil {
+		t.Fatal(err)
+	}
+
+	// Corrupt the checksum of two blocks; the lower one must be reported.
+	bad := meta
+	bad.BlockCRC = append([]uint32(nil), meta.BlockCRC...)
+	bad.BlockCRC[20]++
+	bad.BlockCRC[7]++
+	for i := 0; i < 5; i++ {
+		err := VerifyConcurrent(bytes.NewReader(compressed), &bad, 8)
+		var be *BlockError
+		if !errors.As(err, &be) || be.Block != 7 || !errors.Is(err, ErrChecksum) {
+			t.Fatalf("got %v, want checksum error in block 7", err)
+		}
+	}
+
+	// Without block checksums, corruption is caught by the trailer.
+	noCRC := meta
+	noCRC.BlockCRC = nil
+	trailer := append([]byte(nil), compressed...)
+	trailer[len(trailer)-8]++
+	if err := Verify(bytes.NewReader(trailer), &noCRC); err != ErrChecksum {
+		t.Errorf("corrupt trailer: got %v", err)
+	}
+
+	// A full read ending at the end of the data may come with io.EOF.
+	if err := Verify(eofReaderAt(compressed), &meta); err != nil {
+		t.Errorf("io.EOF with full reads: %v", err)
+	}
+	// A short read is an error, not an empty block.
+	short := compressed[:len(compressed)-20]
+	if err := Verify(eofReaderAt(short), &noCRC); err == nil {
+		t.Error("truncated stream: got nil error")
+	}
+}
+
+func TestVerifyRandomAccess(t *testing.T) {
+	in, compressed, meta := testSeekableData(t, 1<<20, 32<<10)
+	r, err := NewSeekingReader(bytes.NewReader(compressed), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err := VerifyRandomAccess(r, &meta); err != nil {
+		t.Fatal(err)
+	}
+	ra, err := NewRandomReader(bytes.NewReader(compressed), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ra.Close()
+	if err := VerifyRandomAccess(ra, &meta); err != nil {
+		t.Fatal(err)
+	}
+
+	// A Reader returning other data than recorded in meta fails.
+	bad := meta
+	bad.BlockCRC = append([]uint32(nil), meta.BlockCRC...)
+	bad.BlockCRC[20]++
+	bad.BlockCRC[7]++
+	var be *BlockError
+	if err := VerifyRandomAccess(r, &bad); !errors.As(err, &be) || be.Block != 7 || !errors.Is(err, ErrChecksum) {
+		t.Errorf("got %v, want checksum error in block 7", err)
+	}
+	edited := append([]byte(nil), in...)
+	edited[5*32<<10+100]++
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	w.SetConcurrency(32<<10, 4)
+	w.Write(edited)
+	w.Close()
+	editedMeta := w.MetaData()
+	re, err := NewSeekingReader(bytes.NewReader(buf.Bytes()), &editedMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer re.Close()
+	if err := VerifyRandomAccess(re, &meta); !errors.As(err, &be) || be.Block != 5 {
+		t.Errorf("edited data: got %v, want error in block 5", err)
+	}
+
+	// Padding is covered by the checksum of the last block. re may still
+	// be reading buf, so the padded stream gets a buffer of its own.
+	var padded bytes.Buffer
+	w = NewWriter(&padded)
+	w.SetConcurrency(32<<10, 4)
+	w.SetPadLastBlock(true)
+	w.Write(in[:100000])
+	w.Close()
+	padMeta := w.MetaData()
+	rp, err := NewSeekingReader(bytes.NewReader(padded.Bytes()), &padMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rp.Close()
+	if err := VerifyRandomAccess(rp, &padMeta); err != nil {
+		t.Errorf("padded: %v", err)
+	}
+}
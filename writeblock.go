@@ -0,0 +1,61 @@
+package sgzip
+
+import (
+	"errors"
+	"fmt"
+)
+
+var errWriteBlockMixed = errors.New("gzip: Write and WriteBlock cannot be mixed")
+
+// WriteBlock compresses p as a block of its own and returns the offset of
+// the block in the compressed stream, counted from the start of the
+// header. It allows aligning blocks to record boundaries that the caller
+// knows, instead of splitting the data every BlockSize bytes. The size of
+// each block is recorded in the BlockLens field of the metadata, and
+// MetaData().BlockSize is the block size set by SetConcurrency, which p
+// must not exceed.
+//
+// A Writer is either written with Write or with WriteBlock: once one of
+// them has been given data, the other returns an error until Reset.
+// WriteBlock returns after the block has been written, so blocks are not
+// compressed concurrently. Flush and Close work as usual. WriteBlock
+// cannot be used with SetAdaptiveBlocks or SetPadLastBlock.
+func (z *Writer) WriteBlock(p []byte) (compressedOffset int64, err error) {
+	if err := z.checkError(); err != nil {
+		return 0, err
+	}
+	switch {
+	case z.closed:
+		return 0, errors.New("gzip: WriteBlock after Close")
+	case z.adaptMin > 0 || z.padLast:
+		return 0, errors.New("gzip: WriteBlock cannot be used with adaptive or padded blocks")
+	case !z.manual && (z.size > 0 || z.flushed > 0):
+		return 0, errWriteBlockMixed
+	case len(p) == 0:
+		return 0, errors.New("gzip: WriteBlock of an empty block")
+	case len(p) > z.blockSize:
+		return 0, fmt.Errorf("gzip: block of %d bytes larger than block size %d", len(p), z.blockSize)
+	}
+	z.manual = true
+	if !z.wroteHeader {
+		if _, err := z.Write(nil); err != nil {
+			return 0, err
+		}
+	}
+
+	// All earlier blocks have been written, and data written by Flush
+	// since then is part of this block.
+	for _, n := range z.blockData {
+		compressedOffset += int64(n)
+	}
+	z.digest.Write(p)
+	z.currentBuffer = append(z.currentBuffer, p...)
+	z.size += int64(len(p))
+	z.flushed = 0
+	r, ok := z.queueCurrent(false)
+	if ok {
+		<-r.notifyWritten
+	}
+	z.writes.Wait()
+	return compressedOffset, z.checkError()
+}
@@ -0,0 +1,102 @@
+package sgzip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestWriteBlock(t *testing.T) {
+	var records [][]byte
+	for i, n := range []int{100, 5000, 1, 16 << 10, 777} {
+		records = append(records, bytes.Repeat([]byte{byte('a' + i)}, n))
+	}
+	var buf, idx bytes.Buffer
+	w, err := CreateSeekable(&buf, &idx, DefaultCompression, 16<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var offsets []int64
+	for i, rec := range records {
+		off, err := w.WriteBlock(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, off)
+		if i == 2 {
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if _, err := w.Write([]byte("x")); err == nil {
+		t.Error("Write after WriteBlock: expected error")
+	}
+	if _, err := w.WriteBlock(make([]byte, 16<<10+1)); err == nil {
+		t.Error("WriteBlock larger than the block size: expected error")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	meta := w.MetaData()
+	var wantLens []uint32
+	for _, rec := range records {
+		wantLens = append(wantLens, uint32(len(rec)))
+	}
+	wantLens = append(wantLens, 0) // the final marker block
+	if !reflect.DeepEqual(meta.BlockLens, wantLens) {
+		t.Errorf("BlockLens = %v, want %v", meta.BlockLens, wantLens)
+	}
+	decoded, err := DecodeIndex(&idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.BlockLens, meta.BlockLens) || !reflect.DeepEqual(decoded.BlockData, meta.BlockData) {
+		t.Error("index does not match the metadata")
+	}
+	if err := Verify(bytes.NewReader(buf.Bytes()), &meta); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewSeekingReader(bytes.NewReader(buf.Bytes()), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var pos int64
+	for i, rec := range records {
+		bi, err := meta.BlockInfo(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bi.CompressedOffset != offsets[i] || bi.UncompressedOffset != pos {
+			t.Errorf("record %d: block at %d, %d, want %d, %d", i, bi.CompressedOffset, bi.UncompressedOffset, offsets[i], pos)
+		}
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		got := make([]byte, len(rec))
+		if _, err := io.ReadFull(r, got); err != nil || !bytes.Equal(got, rec) {
+			t.Errorf("record %d: read %v", i, err)
+		}
+		pos += int64(len(rec))
+	}
+}
+
+func TestWriteBlockAfterWrite(t *testing.T) {
+	w := NewWriter(ioutil.Discard)
+	w.Write([]byte("data"))
+	if _, err := w.WriteBlock([]byte("block")); err == nil {
+		t.Error("WriteBlock after Write: expected error")
+	}
+	w.Close()
+
+	w.Reset(ioutil.Discard)
+	if _, err := w.WriteBlock([]byte("block")); err != nil {
+		t.Errorf("WriteBlock after Reset: %v", err)
+	}
+	w.Close()
+}
@@ -0,0 +1,103 @@
+package sgzip
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/klauspost/compress/flate"
+)
+
+// WriteToRange writes the uncompressed bytes from offset start up to end
+// to w and returns the number of bytes written. end is clamped to the end
+// of the stream, so fewer bytes are written if the range extends beyond
+// it, without an error.
+//
+// If the Reader was created with metadata and its source is an
+// io.ReaderAt, only the compressed blocks holding the range are read,
+// with one ReadAt call per buffer, and they are decompressed in the
+// calling goroutine into a single buffer that is written to w, as by
+// WriteToBuffer. The position of the Reader does not change, so several
+// goroutines can serve ranges of the same Reader at once. The checksum of
+// the data is not verified, as after a Seek. Otherwise WriteToRange is
+// CopyRange(w, start, end-start).
+func (z *Reader) WriteToRange(w io.Writer, start, end int64) (int64, error) {
+	if start < 0 || end < start {
+		return 0, ErrInvalidSeek
+	}
+	ra, off, ok := z.sourceAt()
+	if !ok || !z.canSeek {
+		n, err := z.CopyRange(w, start, end-start)
+		if err == io.EOF {
+			// The stream ended before the range.
+			err = nil
+		}
+		return n, err
+	}
+	if size := z.dataEnd() - z.origin; end > size {
+		end = size
+	}
+	if start >= end {
+		return 0, nil
+	}
+	first, cstart, discard := locateBlock(z.blockStarts, z.metaBlockSize, z.ustarts, z.origin+start)
+	last, _, _ := locateBlock(z.blockStarts, z.metaBlockSize, z.ustarts, z.origin+end-1)
+	if last < first {
+		last = first
+	}
+	cend := z.blockStarts[last+1]
+	bufSize := z.readBufSize
+	if bufSize == 0 {
+		bufSize = defaultBlockSize
+	}
+	br := bufio.NewReaderSize(io.NewSectionReader(ra, off+cstart, cend-cstart), bufSize)
+	fr := flate.NewReader(br)
+	defer fr.Close()
+
+	n := end - start
+	if n > defaultBlockSize {
+		n = defaultBlockSize
+	}
+	buf := make([]byte, n)
+	var total int64
+	for total < end-start {
+		m, err := fr.Read(buf)
+		b := buf[:m]
+		if discard > 0 {
+			d := discard
+			if d > int64(m) {
+				d = int64(m)
+			}
+			b = b[d:]
+			discard -= d
+		}
+		if rest := end - start - total; int64(len(b)) > rest {
+			b = b[:rest]
+		}
+		if len(b) > 0 {
+			written, werr := w.Write(b)
+			total += int64(written)
+			if werr == nil && written != len(b) {
+				werr = io.ErrShortWrite
+			}
+			if werr != nil {
+				return total, werr
+			}
+		}
+		if err == io.EOF && total < end-start {
+			// A member ends inside the range, as in merged metadata:
+			// continue after its trailer and the next header.
+			if _, err := br.Discard(8); err != nil {
+				return total, noEOF(err)
+			}
+			if _, err := ReadHeader(br); err != nil {
+				return total, noEOF(err)
+			}
+			fr.(flate.Resetter).Reset(br, nil)
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return total, err
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,84 @@
+package sgzip
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestWriteToRange(t *testing.T) {
+	in, comp, meta := testSeekableData(t, 200000, 16<<10)
+	cra := &countingReaderAt{ra: bytes.NewReader(comp)}
+	r, err := NewRandomReader(cra, &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	stream, err := NewReader(struct{ io.ReadSeeker }{bytes.NewReader(comp)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	starts := parseBlockData(meta.BlockData, meta.BlockSize)
+	for _, tc := range []struct{ start, end, want int64 }{
+		{0, 100, 100},
+		{16 << 10, 32 << 10, 16 << 10},
+		{50000, 120000, 70000},
+		{199000, 205000, 1000},
+		{200000, 200010, 0},
+		{123, 123, 0},
+	} {
+		_, before := cra.stats()
+		var buf bytes.Buffer
+		n, err := r.WriteToRange(&buf, tc.start, tc.end)
+		if err != nil {
+			t.Fatalf("WriteToRange(%d, %d): %v", tc.start, tc.end, err)
+		}
+		if n != tc.want || !bytes.Equal(buf.Bytes(), in[tc.start:tc.start+tc.want]) {
+			t.Errorf("WriteToRange(%d, %d) = %d bytes, want %d", tc.start, tc.end, n, tc.want)
+		}
+		if tc.want > 0 {
+			first, last := tc.start/(16<<10), (tc.start+tc.want-1)/(16<<10)
+			_, after := cra.stats()
+			if max := starts[last+1] - starts[first]; after-before > max {
+				t.Errorf("WriteToRange(%d, %d) read %d compressed bytes, want at most %d", tc.start, tc.end, after-before, max)
+			}
+		}
+
+		buf.Reset()
+		n, err = stream.WriteToRange(&buf, tc.start, tc.end)
+		if err != nil || n != tc.want || !bytes.Equal(buf.Bytes(), in[tc.start:tc.start+tc.want]) {
+			t.Errorf("without ReaderAt: WriteToRange(%d, %d) = %d, %v, want %d", tc.start, tc.end, n, err, tc.want)
+		}
+	}
+	if pos, _ := r.Seek(0, io.SeekCurrent); pos != 0 {
+		t.Errorf("WriteToRange moved the Reader to %d", pos)
+	}
+	if _, err := r.WriteToRange(ioutil.Discard, 10, 5); err != ErrInvalidSeek {
+		t.Errorf("end before start: got %v, want ErrInvalidSeek", err)
+	}
+}
+
+func TestWriteToRangeMerged(t *testing.T) {
+	in, compA, metaA := testSeekableData(t, 64<<10, 16<<10)
+	inB, compB, metaB := testSeekableData(t, 40000, 16<<10)
+	in = append(in, inB...)
+	var comp bytes.Buffer
+	meta, err := Concat(&comp, []SeekablePart{{bytes.NewReader(compA), metaA}, {bytes.NewReader(compB), metaB}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewSeekingReader(bytes.NewReader(comp.Bytes()), &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var buf bytes.Buffer
+	if _, err := r.WriteToRange(&buf, 60000, 70000); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), in[60000:70000]) {
+		t.Error("range across the members does not match")
+	}
+}
@@ -0,0 +1,71 @@
+package sgzip
+
+import "io"
+
+// NewWriterAt returns a new Writer writing a seekable gzip stream to wa,
+// starting at offset 0, using the given compression level, block size and
+// number of blocks compressed in parallel.
+//
+// Compressed blocks are written with WriteAt at their final offsets as
+// soon as the sizes of the preceding blocks are known, so writes of
+// different blocks can be in flight at the same time instead of being
+// serialized through a single io.Writer. At most workers writes are in
+// flight at a time, so a slow wa holds back compression as it would with
+// a sequential Writer. The header is written first and
+// the trailer last, so no part of the output is rewritten. The output and
+// metadata are identical to those produced by a Writer with the same
+// settings.
+//
+// It is the caller's responsibility to call Close on the Writer when done.
+// Calling Reset switches the Writer to sequential writes.
+func NewWriterAt(wa io.WriterAt, level, blockSize, workers int) (*Writer, error) {
+	ow := &offsetWriter{wa: wa}
+	z, err := NewWriterLevel(ow, level)
+	if err != nil {
+		return nil, err
+	}
+	if err := z.SetConcurrency(blockSize, workers); err != nil {
+		return nil, err
+	}
+	z.wa = ow
+	return z, nil
+}
+
+// offsetWriter is an io.Writer writing sequentially to an io.WriterAt.
+type offsetWriter struct {
+	wa  io.WriterAt
+	off int64
+}
+
+func (o *offsetWriter) Write(p []byte) (int, error) {
+	n, err := o.wa.WriteAt(p, o.off)
+	o.off += int64(n)
+	return n, err
+}
+
+// writeBlockAt reserves space for a compressed block and writes it in the
+// background. At most z.blocks writes are pending at a time; further
+// blocks wait for a slot, which holds back the compression of new blocks
+// as a slow sequential write would. This should only be called from the
+// result writer.
+func (z *Writer) writeBlockAt(buf []byte, r result) {
+	if z.writeSlots == nil {
+		z.writeSlots = make(chan struct{}, z.blocks)
+	}
+	z.writeSlots <- struct{}{}
+	off := z.wa.off
+	z.wa.off += int64(len(buf))
+	z.recordBlock(len(buf), r)
+	z.writes.Add(1)
+	go func() {
+		defer func() {
+			<-z.writeSlots
+			z.writes.Done()
+		}()
+		if _, err := z.wa.wa.WriteAt(buf, off); err != nil {
+			z.pushError(err)
+		}
+		z.dstPool.Put(buf)
+		z.blockWritten(r)
+	}()
+}
@@ -0,0 +1,106 @@
+package sgzip
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// bufferAt is an in-memory io.WriterAt.
+type bufferAt struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (b *bufferAt) WriteAt(p []byte, off int64) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if end := int(off) + len(p); end > len(b.buf) {
+		b.buf = append(b.buf, make([]byte, end-len(b.buf))...)
+	}
+	return copy(b.buf[off:], p), nil
+}
+
+func TestWriterAt(t *testing.T) {
+	in := bytes.Repeat([]byte("writer at test data "), 50000)
+	var want bytes.Buffer
+	w, _ := NewWriterLevel(&want, 5)
+	w.SetConcurrency(64<<10, 4)
+	w.Write(in)
+	w.Close()
+
+	var got bufferAt
+	wa, err := NewWriterAt(&got, 5, 64<<10, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(in); i += 10000 {
+		end := i + 10000
+		if end > len(in) {
+			end = len(in)
+		}
+		if _, err := wa.Write(in[i:end]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := wa.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.buf, want.Bytes()) {
+		t.Error("output differs from sequential writer")
+	}
+	if !reflect.DeepEqual(wa.MetaData(), w.MetaData()) {
+		t.Errorf("metadata = %+v, want %+v", wa.MetaData(), w.MetaData())
+	}
+}
+
+// slowAt is a bufferAt whose writes take a while, recording the largest
+// number of writes in flight.
+type slowAt struct {
+	bufferAt
+	pending, max int32
+}
+
+func (s *slowAt) WriteAt(p []byte, off int64) (int, error) {
+	n := atomic.AddInt32(&s.pending, 1)
+	defer atomic.AddInt32(&s.pending, -1)
+	for {
+		m := atomic.LoadInt32(&s.max)
+		if n <= m || atomic.CompareAndSwapInt32(&s.max, m, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	return s.bufferAt.WriteAt(p, off)
+}
+
+func TestWriterAtPendingWrites(t *testing.T) {
+	in := make([]byte, 2<<20)
+	rand.New(rand.NewSource(1)).Read(in)
+	var got slowAt
+	wa, err := NewWriterAt(&got, BestSpeed, 16<<10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wa.Write(in); err != nil {
+		t.Fatal(err)
+	}
+	if err := wa.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got.max > 2 {
+		t.Errorf("%d writes in flight, want at most 2", got.max)
+	}
+	r, err := NewReader(bytes.NewReader(got.buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := ioutil.ReadAll(r); err != nil || !bytes.Equal(out, in) {
+		t.Errorf("ReadAll: %v", err)
+	}
+}